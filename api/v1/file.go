@@ -0,0 +1,205 @@
+package v1
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/farnese17/chat/pkg/storage"
+	"github.com/farnese17/chat/registry"
+	"github.com/farnese17/chat/service"
+	"github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/farnese17/chat/utils/ginx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var files *service.FileService
+
+var fs storage.Storage
+
+func SetupFileService(s registry.Service) {
+	files = service.NewFileService(s)
+	fs = s.Storage()
+}
+
+func Upload(c *gin.Context) {
+	file, header, err := c.Request.FormFile("file")
+	if err != nil || file == nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	filename := header.Filename
+	id := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return files.Upload(id, file, filename)
+	})
+}
+
+func FileUsage(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return files.Usage(uid)
+	})
+}
+
+func Download(c *gin.Context) {
+	handleGetFile(c, "attachment")
+}
+
+func GetFile(c *gin.Context) {
+	handleGetFile(c, "inline")
+}
+
+// 带签名时不需要登录,否则需要登录并且文件发送到了用户所在的会话中
+func handleGetFile(c *gin.Context, disposition string) {
+	id := c.Param("id")
+	f, ok := getFile(c)
+	if !ok {
+		return
+	}
+	content, err := fs.Open(f)
+	if err != nil {
+		logger.Error("Failed to open file", zap.String("id", id), zap.Error(err))
+		abortWithFileError(c, errorsx.ErrFailed)
+		return
+	}
+	defer content.Close()
+
+	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%s;filename*=UTF-8''%s",
+		disposition, f.Name, f.Name))
+	// 本地文件支持Range请求,对象储存直接转发内容
+	if rs, ok := content.(io.ReadSeeker); ok {
+		http.ServeContent(c.Writer, c.Request, f.Name, time.Time{}, rs)
+		return
+	}
+	contentType := mime.TypeByExtension(filepath.Ext(f.Name))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.DataFromReader(http.StatusOK, f.Size, contentType, content, nil)
+}
+
+// 图片的缩略图,权限与获取文件相同
+func Thumbnail(c *gin.Context) {
+	size, err := strconv.Atoi(c.DefaultQuery("size", "0"))
+	if err != nil {
+		logger.Warn("Failed to get thumbnail: invaild param", zap.String("size", c.Query("size")))
+		abortWithFileError(c, errorsx.ErrInvalidParams)
+		return
+	}
+	f, ok := getFile(c)
+	if !ok {
+		return
+	}
+	content, contentType, err := files.Thumbnail(f, size)
+	if err != nil {
+		abortWithFileError(c, err)
+		return
+	}
+	defer content.Close()
+	c.Header("Cache-Control", "private, max-age=86400")
+	c.DataFromReader(http.StatusOK, -1, contentType, content, nil)
+}
+
+func getFile(c *gin.Context) (*storage.File, bool) {
+	var uid uint
+	var expires int64
+	signature := c.Query("signature")
+	if signature != "" {
+		expires, _ = strconv.ParseInt(c.Query("expires"), 10, 64)
+	} else {
+		uid = ginx.GetUserID(c)
+	}
+	f, err := files.Download(uid, c.Param("id"), expires, signature)
+	if err != nil {
+		abortWithFileError(c, err)
+		return nil, false
+	}
+	return f, true
+}
+
+// 返回文件内容的接口出错时使用HTTP状态码
+func abortWithFileError(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch err {
+	case errorsx.ErrFileNotFound, errorsx.ErrNoThumbnail:
+		status = http.StatusNotFound
+	case errorsx.ErrInvalidLink, errorsx.ErrLinkExpired:
+		status = http.StatusForbidden
+	case errorsx.ErrInvalidParams:
+		status = http.StatusBadRequest
+	}
+	c.AbortWithStatusJSON(status, gin.H{
+		"status":  errorsx.GetStatusCode(err),
+		"message": err.Error()})
+}
+
+func DeleteFile(c *gin.Context) {
+	fileID := c.Param("id")
+	id := ginx.GetUserID(c)
+	ginx.NoDataResponse(c, func() error {
+		return fs.Delete(id, fileID)
+	})
+}
+
+func FileLink(c *gin.Context) {
+	id := c.Param("id")
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return files.Link(uid, id)
+	})
+}
+
+func CreateUpload(c *gin.Context) {
+	var create *model.UploadCreate
+	c.ShouldBindJSON(&create)
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return files.CreateUpload(uid, create)
+	})
+}
+
+func UploadStatus(c *gin.Context) {
+	id := c.Param("id")
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return files.UploadStatus(uid, id)
+	})
+}
+
+// 请求体为分片的原始内容
+func UploadChunk(c *gin.Context) {
+	id := c.Param("id")
+	index, err := strconv.ParseInt(c.Param("index"), 10, 64)
+	if err != nil {
+		logger.Warn("Failed to upload chunk: invaild param", zap.String("index", c.Param("index")))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return files.UploadChunk(uid, id, index, c.Request.Body)
+	})
+}
+
+func CompleteUpload(c *gin.Context) {
+	id := c.Param("id")
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return files.CompleteUpload(uid, id)
+	})
+}
+
+func CancelUpload(c *gin.Context) {
+	id := c.Param("id")
+	uid := ginx.GetUserID(c)
+	ginx.NoDataResponse(c, func() error {
+		return files.CancelUpload(uid, id)
+	})
+}
@@ -0,0 +1,247 @@
+package v1_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/farnese17/chat/repository"
+	m "github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func clearFileData() {
+	repo := s.User().(repository.TestableRepo)
+	repo.ExecSql("DELETE FROM `file_reference`")
+	repo.ExecSql("DELETE FROM `file`")
+	repo.ExecSql("DELETE FROM `user_quota`")
+}
+
+func uploadFile(t *testing.T, uid uint, filename string, content []byte) string {
+	resp := equalHttpResp(t, sendFile(t, uid, filename, content))
+	return resp["data"].(string)
+}
+
+func sendFile(t *testing.T, uid uint, filename string, content []byte) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", filename)
+	assert.NoError(t, err)
+	part.Write(content)
+	writer.Close()
+
+	req := httptest.NewRequest("POST", "/api/v1/files", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	addToken(uid, req)
+	w := httptest.NewRecorder()
+	route.ServeHTTP(w, req)
+	return w
+}
+
+func TestFiles(t *testing.T) {
+	clearFileData()
+	clearMessageData()
+	setupTestData()
+
+	a, b, c := testData[0].ID, testData[1].ID, testData[2].ID
+	content := []byte("file content")
+	id := uploadFile(t, a, "a.txt", content)
+	_, err := uuid.Parse(id)
+	assert.NoError(t, err)
+	url := "/api/v1/files/" + id
+
+	// 未登录且没有签名
+	w := sendRequest(route, url, "GET", 0, nil)
+	equalError(t, errorsx.ErrInvalidToken, w)
+
+	// 上传者可以下载
+	w = sendRequest(route, url, "GET", a, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, content, w.Body.Bytes())
+
+	// 文件没有发送到b所在的会话中
+	w = sendRequest(route, url, "GET", b, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	testHasError(t, route, url+"/link", "POST", b, nil, errorsx.ErrFileNotFound)
+
+	// 发送给b后b可以下载,c不行
+	err = s.Message().Create(&m.Message{MsgID: uuid.NewString(), Sender: a, Receiver: b,
+		Body: "[文件] a.txt", Content: fmt.Sprintf(`{"kind":"file","file_id":"%s","name":"a.txt"}`, id), FileID: id})
+	assert.NoError(t, err)
+	w = sendRequest(route, "/api/v1/files/download/"+id, "GET", b, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, content, w.Body.Bytes())
+	w = sendRequest(route, url, "GET", c, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// 签名链接不需要登录
+	resp := testNoError(t, route, url+"/link", "POST", b, nil)
+	link := resp["data"].(map[string]any)
+	w = sendRequest(route, link["url"].(string), "GET", 0, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, content, w.Body.Bytes())
+	w = sendRequest(route, link["download_url"].(string), "GET", 0, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// 签名和文件不匹配
+	other := uploadFile(t, c, "c.txt", []byte("other content"))
+	w = sendRequest(route, "/api/v1/files/"+other, "GET", 0, nil, map[string]string{
+		"expires": fmt.Sprintf("%.0f", link["expires"]), "signature": "invalid"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	w = sendRequest(route, "/api/v1/files/"+other, "GET", 0, nil, map[string]string{
+		"expires": "1", "signature": s.Storage().Sign(other, 1)})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// 删除后无法下载
+	testNoError(t, route, url, "DELETE", a, nil)
+	w = sendRequest(route, link["url"].(string), "GET", 0, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestChunkedUpload(t *testing.T) {
+	clearFileData()
+	setupTestData()
+
+	a, b := testData[0].ID, testData[1].ID
+	content := []byte("chunked content")
+	resp := testNoError(t, route, "/api/v1/files/uploads", "POST", a,
+		strings.NewReader(fmt.Sprintf(`{"name":"a.txt","size":%d}`, len(content))))
+	session := resp["data"].(map[string]any)
+	assert.Equal(t, float64(0), session["offset"])
+	assert.Equal(t, float64(s.Config().FileServer().ChunkSize()), session["chunk_size"])
+	url := "/api/v1/files/uploads/" + session["id"].(string)
+
+	testHasError(t, route, "/api/v1/files/uploads", "POST", a, strings.NewReader(`{"name":"a.txt"}`), errorsx.ErrInvalidParams)
+	testHasError(t, route, url, "GET", b, nil, errorsx.ErrUploadNotFound)
+	testHasError(t, route, url+"/complete", "POST", a, nil, errorsx.ErrUploadIncomplete)
+	testHasError(t, route, url+"/chunks/1", "PUT", a, bytes.NewReader(content), errorsx.ErrInvalidChunk)
+	testHasError(t, route, url+"/chunks/x", "PUT", a, bytes.NewReader(content), errorsx.ErrInvalidParams)
+
+	// 重发已上传的分片只返回进度
+	for range 2 {
+		resp = testNoError(t, route, url+"/chunks/0", "PUT", a, bytes.NewReader(content))
+		assert.Equal(t, float64(len(content)), resp["data"].(map[string]any)["offset"])
+	}
+	resp = testNoError(t, route, url, "GET", a, nil)
+	assert.Equal(t, float64(len(content)), resp["data"].(map[string]any)["offset"])
+
+	resp = testNoError(t, route, url+"/complete", "POST", a, nil)
+	id := resp["data"].(string)
+	w := sendRequest(route, "/api/v1/files/"+id, "GET", a, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, content, w.Body.Bytes())
+	testHasError(t, route, url, "GET", a, nil, errorsx.ErrUploadNotFound)
+
+	// 取消上传
+	resp = testNoError(t, route, "/api/v1/files/uploads", "POST", a, strings.NewReader(`{"name":"b.txt","size":1}`))
+	url = "/api/v1/files/uploads/" + resp["data"].(map[string]any)["id"].(string)
+	testHasError(t, route, url, "DELETE", b, nil, errorsx.ErrUploadNotFound)
+	testNoError(t, route, url, "DELETE", a, nil)
+	testHasError(t, route, url+"/chunks/0", "PUT", a, strings.NewReader("b"), errorsx.ErrUploadNotFound)
+}
+
+func TestThumbnail(t *testing.T) {
+	clearFileData()
+	setupTestData()
+
+	a, b := testData[0].ID, testData[1].ID
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	buf := &bytes.Buffer{}
+	assert.NoError(t, png.Encode(buf, img))
+	id := uploadFile(t, a, "a.png", buf.Bytes())
+	url := "/api/v1/files/" + id + "/thumbnail"
+
+	w := sendRequest(route, url, "GET", a, nil, map[string]string{"size": "128"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	cfg, err := png.DecodeConfig(w.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, 128, cfg.Width)
+	assert.Equal(t, 64, cfg.Height)
+
+	// 默认大小
+	w = sendRequest(route, url, "GET", a, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	cfg, err = png.DecodeConfig(w.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, 256, cfg.Width)
+
+	w = sendRequest(route, url, "GET", a, nil, map[string]string{"size": "100"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = sendRequest(route, url, "GET", a, nil, map[string]string{"size": "x"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	// 没有权限
+	w = sendRequest(route, url, "GET", b, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// 签名链接也可以获取缩略图
+	resp := testNoError(t, route, "/api/v1/files/"+id+"/link", "POST", a, nil)
+	link := resp["data"].(map[string]any)
+	w = sendRequest(route, url, "GET", 0, nil, map[string]string{
+		"expires": fmt.Sprintf("%.0f", link["expires"]), "signature": s.Storage().Sign(id, int64(link["expires"].(float64)))})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	other := uploadFile(t, a, "a.txt", []byte("text"))
+	w = sendRequest(route, "/api/v1/files/"+other+"/thumbnail", "GET", a, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	equalFileError(t, errorsx.ErrNoThumbnail, w)
+}
+
+func equalFileError(t *testing.T, expected error, w *httptest.ResponseRecorder) {
+	var resp map[string]any
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.NoError(t, err)
+	assert.Equal(t, errorsx.GetStatusCode(expected), int(resp["status"].(float64)))
+}
+
+func TestFileQuota(t *testing.T) {
+	TestAdminCreate(t)
+	clearFileData()
+	setupTestData()
+
+	a := testData[0].ID
+	fsCfg := s.Config().FileServer()
+	resp := testNoError(t, route, "/api/v1/files/usage", "GET", a, nil)
+	usage := resp["data"].(map[string]any)
+	assert.Equal(t, map[string]any{"bytes": float64(0), "files": float64(0)}, usage["usage"])
+	assert.Equal(t, float64(fsCfg.QuotaBytes()), usage["quota"].(map[string]any)["max_bytes"])
+	assert.Equal(t, false, usage["custom"])
+
+	// 相同内容只计算一次大小
+	uploadFile(t, a, "a.txt", []byte("0123456789"))
+	uploadFile(t, a, "b.txt", []byte("0123456789"))
+	resp = testNoError(t, route, "/api/v1/files/usage", "GET", a, nil)
+	assert.Equal(t, map[string]any{"bytes": float64(10), "files": float64(2)}, resp["data"].(map[string]any)["usage"])
+
+	// 管理员单独设置限额
+	url := fmt.Sprintf("/api/v1/managers/users/%d/files/quota", a)
+	body := `{"max_bytes":15,"max_files":0,"max_file_size":0}`
+	testHasError(t, managerRouter, url, "PUT", adminIDs["read"], strings.NewReader(body), errorsx.ErrPermissiondenied)
+	testHasError(t, managerRouter, url, "PUT", adminIDs["write"], strings.NewReader(`{"max_bytes":-1}`), errorsx.ErrInvalidParams)
+	testNoError(t, managerRouter, url, "PUT", adminIDs["write"], strings.NewReader(body))
+	resp = testNoError(t, managerRouter, url, "GET", adminIDs["read"], nil)
+	quota := resp["data"].(map[string]any)
+	assert.Equal(t, true, quota["custom"])
+	assert.Equal(t, float64(15), quota["quota"].(map[string]any)["max_bytes"])
+
+	equalError(t, errorsx.ErrQuotaExceeded, sendFile(t, a, "c.txt", []byte("abcdefghij")))
+	uploadFile(t, a, "c.txt", []byte("abcde"))
+
+	testNoError(t, managerRouter, url, "DELETE", adminIDs["write"], nil)
+	resp = testNoError(t, route, "/api/v1/files/usage", "GET", a, nil)
+	assert.Equal(t, false, resp["data"].(map[string]any)["custom"])
+	uploadFile(t, a, "d.txt", []byte("abcdefghij"))
+
+	// 分片上传创建时检查大小
+	body = fmt.Sprintf(`{"name":"e.txt","size":%d}`, fsCfg.MaxFileSize()+1)
+	testHasError(t, route, "/api/v1/files/uploads", "POST", a, strings.NewReader(body), errorsx.ErrFileTooLarge)
+}
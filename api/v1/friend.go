@@ -52,6 +52,13 @@ func FriendList(c *gin.Context) {
 		return f.List(from)
 	})
 }
+func FriendPresence(c *gin.Context) {
+	from := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return f.Presence(from)
+	})
+}
+
 func BlockedMeList(c *gin.Context) {
 	from := ginx.GetUserID(c)
 	ginx.HasDataResponse(c, func() (any, error) {
@@ -209,6 +209,33 @@ func TestGetFriend(t *testing.T) {
 	wg.Wait()
 }
 
+func TestFriendPresence(t *testing.T) {
+	clearFriendData()
+	tests := genRandomFriendTestData(m.FSAdded)
+
+	url := "/api/v1/friends/presence"
+	for a, b := range tests {
+		from, to := testData[a], testData[b]
+		t.Run(fmt.Sprintf("presence %d-%d", from.ID, to.ID), func(t *testing.T) {
+			for _, id := range []uint{from.ID, to.ID} {
+				resp := testNoError(t, route, url, "GET", id, nil)
+				var ids []uint
+				for _, v := range resp["data"].([]any) {
+					p := v.(map[string]any)
+					ids = append(ids, uint(p["id"].(float64)))
+					assert.Contains(t, p, "online")
+					assert.Contains(t, p, "last_seen")
+				}
+				if id == from.ID {
+					assert.Contains(t, ids, to.ID)
+				} else {
+					assert.Contains(t, ids, from.ID)
+				}
+			}
+		})
+	}
+}
+
 func TestSearch_Friend(t *testing.T) {
 	clear()
 	testData = []*m.User{}
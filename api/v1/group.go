@@ -217,6 +217,59 @@ func Kick(c *gin.Context) {
 	})
 }
 
+func MuteMember(c *gin.Context) {
+	from := ginx.GetUserID(c)
+	to, err1 := strconv.ParseUint(c.Param("id"), 10, 64)
+	gid, err2 := strconv.ParseUint(c.Param("gid"), 10, 64)
+	minutes, err3 := strconv.Atoi(c.Query("minutes"))
+	if err1 != nil || err2 != nil || err3 != nil {
+		logger.Warn("Failed to mute member: invaild param",
+			zap.Uint("from", from),
+			zap.String("to", c.Param("id")),
+			zap.String("gid", c.Param("gid")),
+			zap.String("minutes", c.Query("minutes")))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.NoDataResponse(c, func() error {
+		return g.MuteMember(from, uint(to), uint(gid), minutes)
+	})
+}
+
+func MuteAll(c *gin.Context) {
+	from := ginx.GetUserID(c)
+	gid, err1 := strconv.ParseUint(c.Param("gid"), 10, 64)
+	muted, err2 := strconv.ParseBool(c.Query("muted"))
+	if err1 != nil || err2 != nil {
+		logger.Warn("Failed to mute group: invaild param",
+			zap.Uint("from", from),
+			zap.String("gid", c.Param("gid")),
+			zap.String("muted", c.Query("muted")))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.NoDataResponse(c, func() error {
+		return g.MuteAll(from, uint(gid), muted)
+	})
+}
+
+func SetDoNotDisturb(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	gid, err1 := strconv.ParseUint(c.Param("gid"), 10, 64)
+	enabled, err2 := strconv.ParseBool(c.Query("enabled"))
+	if err1 != nil || err2 != nil {
+		logger.Warn("Failed to set do not disturb: invaild param",
+			zap.Uint("uid", uid),
+			zap.String("gid", c.Param("gid")),
+			zap.String("enabled", c.Query("enabled")))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.NoDataResponse(c, func() error {
+		return g.SetDoNotDisturb(uid, uint(gid), enabled)
+	})
+}
+
 func AcceptInvite(c *gin.Context) {
 	uid := ginx.GetUserID(c)
 	var msg websocket.ChatMsg
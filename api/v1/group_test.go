@@ -14,6 +14,7 @@ import (
 
 	"github.com/farnese17/chat/repository"
 	m "github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
 	"github.com/farnese17/chat/utils/validator"
 	ws "github.com/farnese17/chat/websocket"
 	"github.com/stretchr/testify/assert"
@@ -547,6 +548,93 @@ func TestKick(t *testing.T) {
 	wg.Wait()
 }
 
+func TestMuteMember(t *testing.T) {
+	clearGroupData()
+	setupTestData()
+	setupTestGroupData()
+
+	genTestMembers(t, m.GroupRoleMember)
+	member := testGroupData[0].Owner
+	for _, tt := range testGroupData[1:] {
+		t.Run(fmt.Sprintf("mute member %d", tt.GID), func(t *testing.T) {
+			url := fmt.Sprintf("/api/v1/groups/%d/members/%d/mute", tt.GID, member)
+			resp := testNoError(t, route, url, "PUT", tt.Owner, nil, map[string]string{"minutes": "10"})
+			assert.Nil(t, resp["data"])
+
+			info, err := s.Group().MuteInfo(tt.GID)
+			assert.NoError(t, err)
+			assert.Greater(t, info.Members[member], time.Now().Unix())
+
+			// 普通成员无权禁言
+			url = fmt.Sprintf("/api/v1/groups/%d/members/%d/mute", tt.GID, tt.Owner)
+			testHasError(t, route, url, "PUT", member, nil, errorsx.ErrPermissiondenied, map[string]string{"minutes": "10"})
+
+			// 解除禁言
+			url = fmt.Sprintf("/api/v1/groups/%d/members/%d/mute", tt.GID, member)
+			testNoError(t, route, url, "PUT", tt.Owner, nil, map[string]string{"minutes": "0"})
+			info, err = s.Group().MuteInfo(tt.GID)
+			assert.NoError(t, err)
+			assert.Empty(t, info.Members)
+		})
+	}
+}
+
+func TestMuteAll(t *testing.T) {
+	clearGroupData()
+	setupTestData()
+	setupTestGroupData()
+
+	for _, tt := range testGroupData {
+		t.Run(fmt.Sprintf("mute all %d", tt.GID), func(t *testing.T) {
+			url := fmt.Sprintf("/api/v1/groups/%d/mute", tt.GID)
+			resp := testNoError(t, route, url, "PUT", tt.Owner, nil, map[string]string{"muted": "true"})
+			assert.Nil(t, resp["data"])
+			info, err := s.Group().MuteInfo(tt.GID)
+			assert.NoError(t, err)
+			assert.True(t, info.MuteAll)
+
+			testNoError(t, route, url, "PUT", tt.Owner, nil, map[string]string{"muted": "false"})
+			info, err = s.Group().MuteInfo(tt.GID)
+			assert.NoError(t, err)
+			assert.False(t, info.MuteAll)
+
+			testHasError(t, route, url, "PUT", tt.Owner, nil, errorsx.ErrInvalidParams, map[string]string{"muted": "x"})
+		})
+	}
+}
+
+func TestSetDoNotDisturb(t *testing.T) {
+	clearGroupData()
+	setupTestData()
+	setupTestGroupData()
+
+	dnd := func(uid, gid uint) bool {
+		groups, err := s.Group().List(uid)
+		assert.NoError(t, err)
+		for _, group := range groups {
+			if group.GID == gid {
+				return group.DoNotDisturb
+			}
+		}
+		return false
+	}
+	for _, tt := range testGroupData {
+		t.Run(fmt.Sprintf("do not disturb %d", tt.GID), func(t *testing.T) {
+			url := fmt.Sprintf("/api/v1/groups/%d/dnd", tt.GID)
+			resp := testNoError(t, route, url, "PUT", tt.Owner, nil, map[string]string{"enabled": "true"})
+			assert.Nil(t, resp["data"])
+			assert.True(t, dnd(tt.Owner, tt.GID))
+			// 重复设置
+			testNoError(t, route, url, "PUT", tt.Owner, nil, map[string]string{"enabled": "true"})
+
+			testNoError(t, route, url, "PUT", tt.Owner, nil, map[string]string{"enabled": "false"})
+			assert.False(t, dnd(tt.Owner, tt.GID))
+
+			testHasError(t, route, url, "PUT", tt.Owner, nil, errorsx.ErrInvalidParams, map[string]string{"enabled": "x"})
+		})
+	}
+}
+
 func TestCreateAnnounce(t *testing.T) {
 	clearGroupData()
 	setupTestData()
@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"strconv"
+
+	"github.com/farnese17/chat/registry"
+	"github.com/farnese17/chat/service"
+	"github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/ginx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var ks *service.KeyService
+
+func SetupKeyService(s registry.Service) {
+	ks = service.NewKeyService(s)
+}
+
+func UploadKeys(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	var upload *model.KeyUpload
+	if err := c.ShouldBindJSON(&upload); err != nil {
+		logger.Warn("Failed to upload keys: invaild param", zap.Uint("uid", uid), zap.Error(err))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.NoDataResponse(c, func() error {
+		return ks.Upload(uid, upload)
+	})
+}
+
+func AddPreKeys(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	var preKeys []*model.PreKey
+	if err := c.ShouldBindJSON(&preKeys); err != nil {
+		logger.Warn("Failed to add prekeys: invaild param", zap.Uint("uid", uid), zap.Error(err))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.NoDataResponse(c, func() error {
+		return ks.AddPreKeys(uid, preKeys)
+	})
+}
+
+func PreKeyCount(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ks.PreKeyCount(uid)
+	})
+}
+
+func KeyBundle(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	target, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ks.Bundle(uid, uint(target))
+	})
+}
+
+func DeleteKeys(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	ginx.NoDataResponse(c, func() error {
+		return ks.Delete(uid)
+	})
+}
@@ -0,0 +1,64 @@
+package v1_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/farnese17/chat/repository"
+	m "github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/stretchr/testify/assert"
+)
+
+func clearKeyData() {
+	repo := s.User().(repository.TestableRepo)
+	repo.ExecSql("DELETE FROM `identity_key`")
+	repo.ExecSql("DELETE FROM `pre_key`")
+}
+
+func TestKeys(t *testing.T) {
+	clearKeyData()
+	setupTestData()
+
+	a, b := testData[0].ID, testData[1].ID
+	url := fmt.Sprintf("/api/v1/keys/%d", a)
+	testHasError(t, route, url, "GET", b, nil, errorsx.ErrKeyNotFound)
+	body, _ := json.Marshal([]*m.PreKey{{KeyID: 3, PublicKey: "cHJla2V5Mw=="}})
+	testHasError(t, route, "/api/v1/keys/prekeys", "POST", a, bytes.NewBuffer(body), errorsx.ErrKeyNotFound)
+
+	upload := m.KeyUpload{
+		IdentityKey: m.IdentityKey{IdentityKey: "aWRlbnRpdHk=", SignedPreKeyID: 1, SignedPreKey: "c2lnbmVk", Signature: "c2lnbmF0dXJl"},
+		PreKeys:     []*m.PreKey{{KeyID: 1, PublicKey: "cHJla2V5MQ=="}, {KeyID: 2, PublicKey: "cHJla2V5Mg=="}},
+	}
+	data, _ := json.Marshal(upload)
+	testNoError(t, route, "/api/v1/keys", "PUT", a, bytes.NewBuffer(data))
+	testNoError(t, route, "/api/v1/keys/prekeys", "POST", a, bytes.NewBuffer(body))
+	resp := testNoError(t, route, "/api/v1/keys/prekeys/count", "GET", a, nil)
+	assert.Equal(t, float64(3), resp["data"].(map[string]any)["count"])
+
+	// 按上传顺序取出一次性预共享公钥,用完后只返回签名预共享公钥
+	for _, keyID := range []float64{1, 2, 3} {
+		resp = testNoError(t, route, url, "GET", b, nil)
+		bundle := resp["data"].(map[string]any)
+		assert.Equal(t, upload.IdentityKey.IdentityKey, bundle["identity_key"])
+		assert.Equal(t, upload.SignedPreKey, bundle["signed_prekey"])
+		assert.Equal(t, keyID, bundle["prekey"].(map[string]any)["key_id"])
+	}
+	resp = testNoError(t, route, url, "GET", b, nil)
+	assert.Nil(t, resp["data"].(map[string]any)["prekey"])
+
+	// 身份公钥变化后旧的一次性预共享公钥失效
+	testNoError(t, route, "/api/v1/keys/prekeys", "POST", a, bytes.NewBuffer(body))
+	upload.IdentityKey.IdentityKey = "bmV3IGlkZW50aXR5"
+	upload.PreKeys = nil
+	data, _ = json.Marshal(upload)
+	testNoError(t, route, "/api/v1/keys", "PUT", a, bytes.NewBuffer(data))
+	resp = testNoError(t, route, "/api/v1/keys/prekeys/count", "GET", a, nil)
+	assert.Equal(t, float64(0), resp["data"].(map[string]any)["count"])
+
+	testNoError(t, route, "/api/v1/keys", "DELETE", a, nil)
+	testHasError(t, route, "/api/v1/keys", "DELETE", a, nil, errorsx.ErrKeyNotFound)
+	testHasError(t, route, url, "GET", b, nil, errorsx.ErrKeyNotFound)
+}
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/farnese17/chat/middleware"
+	"github.com/farnese17/chat/pkg/storage"
 	"github.com/farnese17/chat/registry"
 	"github.com/farnese17/chat/service"
 	"github.com/farnese17/chat/service/model"
@@ -15,6 +16,7 @@ import (
 	"github.com/farnese17/chat/utils/ginx"
 	"github.com/farnese17/chat/websocket"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
@@ -199,6 +201,43 @@ func UnbanUser(c *gin.Context) {
 	})
 }
 
+func GetFileQuota(c *gin.Context) {
+	id := c.Param("id")
+	ginx.HasDataResponse(c, func() (any, error) {
+		return mgr.FileQuota(id)
+	})
+}
+
+// 各项限额为0时不限制
+func SetFileQuota(c *gin.Context) {
+	id := c.Param("id")
+	var quota *storage.Quota
+	if err := c.ShouldBindJSON(&quota); err != nil || quota == nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	setFileQuota(c, id, quota)
+}
+
+func ResetFileQuota(c *gin.Context) {
+	setFileQuota(c, c.Param("id"), nil)
+}
+
+func setFileQuota(c *gin.Context, id string, quota *storage.Quota) {
+	handler := ginx.GetUserID(c)
+	ginx.NoDataResponse(c, func() error {
+		err := mgr.SetFileQuota(id, quota)
+		if err != nil {
+			registry.GetService().Logger().Error("Failed to set file quota",
+				zap.Error(err), zap.Uint("handler", handler), zap.String("user_id", id))
+			return err
+		}
+		registry.GetService().Logger().Info("Set file quota",
+			zap.Uint("handler", handler), zap.String("user_id", id), zap.Any("quota", quota))
+		return nil
+	})
+}
+
 func CreateAdmin(c *gin.Context) {
 	handler := ginx.GetUserID(c)
 	var data *model.Manager
@@ -355,11 +394,12 @@ func AdminLogin(c *gin.Context) {
 			return nil, err
 		}
 		s.Logger().Info("Administrator log in", zap.Float64("id", id))
-		token, err := middleware.GenerateToken(uint(id))
+		device := uuid.NewString()
+		token, err := middleware.GenerateToken(uint(id), device)
 		if err != nil {
 			return nil, err
 		}
-		s.Cache().SetToken(uint(id), token, s.Config().Common().TokenValidPeriod())
+		s.Cache().SetToken(uint(id), device, token, s.Config().Common().TokenValidPeriod())
 		return token, nil
 	})
 }
@@ -420,9 +460,11 @@ func detailHealthyStatus(s registry.Service) map[string]any {
 
 	var wsConnections int
 	var wsUptime time.Duration
+	var wsQueue map[string]any
 	if s.Hub() != nil {
 		wsConnections = s.Hub().Count()
 		wsUptime = s.Hub().Uptime()
+		wsQueue = s.Hub().Stats()
 	}
 
 	res := map[string]any{
@@ -432,6 +474,7 @@ func detailHealthyStatus(s registry.Service) map[string]any {
 				"status":      status["services"].(map[string]any)["websocket"],
 				"connections": wsConnections,
 				"uptime":      wsUptime.Round(time.Second).String(),
+				"queue":       wsQueue,
 			},
 			"database": map[string]any{
 				"status": status["services"].(map[string]any)["database"],
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand/v2"
+	"net/http/httptest"
 	"os"
 	"path"
 	"strconv"
@@ -238,6 +239,35 @@ func TestBanUserTemp(t *testing.T) {
 	})
 }
 
+// 封禁后用户所有设备的token失效
+func TestBanRevokesTokens(t *testing.T) {
+	setupAdmins(t)
+	user := generateTestUsers(t, 1)[0]
+	passwd, _ := utils.HashPassword("aaaaaa")
+	assert.NoError(t, s.User().UpdatePassword(user.ID, passwd))
+
+	body, _ := json.Marshal(map[string]any{
+		"account": strconv.FormatUint(uint64(user.ID), 10), "password": "aaaaaa", "device": "phone"})
+	resp := testNoError(t, route, "/api/v1/login", "POST", 0, bytes.NewBuffer(body))
+	token := resp["token"].(string)
+	s.Cache().Flush()
+
+	request := func() map[string]any {
+		req := httptest.NewRequest("GET", "/api/v1/sessions", nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, req)
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+	assert.Equal(t, float64(200), request()["status"])
+
+	url := fmt.Sprintf("/api/v1/managers/users/%d/ban/temp", user.ID)
+	testNoError(t, managerRouter, url, "PUT", adminIDs["super"], nil)
+	assert.Equal(t, float64(errorsx.GetStatusCode(errorsx.ErrCantParseToken)), request()["status"])
+}
+
 func TestBanUserPerma(t *testing.T) {
 	url := "/api/v1/managers/users/%d/ban/perma"
 	testBanUsers(t, url)
@@ -0,0 +1,250 @@
+package v1
+
+import (
+	"strconv"
+
+	"github.com/farnese17/chat/registry"
+	"github.com/farnese17/chat/service"
+	"github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/ginx"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+var ms *service.MessageService
+
+func SetupMessageService(s registry.Service) {
+	ms = service.NewMessageService(s)
+}
+
+func ConversationMessages(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	peer, err := strconv.ParseUint(c.Param("peer"), 10, 64)
+	if err != nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	var cursor *model.Cursor
+	c.ShouldBindJSON(&cursor)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.Conversation(uid, uint(peer), cursor)
+	})
+}
+
+func GroupMessages(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	gid, err := strconv.ParseUint(c.Param("gid"), 10, 64)
+	if err != nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	var cursor *model.Cursor
+	c.ShouldBindJSON(&cursor)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.GroupMessages(uid, uint(gid), cursor)
+	})
+}
+
+func AddReaction(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	var req struct {
+		Emoji string `json:"emoji"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Warn("Failed to add reaction: invaild param",
+			zap.Uint("uid", uid),
+			zap.String("id", c.Param("id")),
+			zap.Error(err))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.React(uid, c.Param("id"), req.Emoji, true)
+	})
+}
+
+func RemoveReaction(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.React(uid, c.Param("id"), c.Query("emoji"), false)
+	})
+}
+
+func Reactions(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.Reactions(uid, c.Param("id"))
+	})
+}
+
+func ThreadReplies(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	var cursor *model.Cursor
+	c.ShouldBindJSON(&cursor)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.ThreadReplies(uid, c.Param("id"), cursor)
+	})
+}
+
+func SubscribeThread(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	subscribed, err := strconv.ParseBool(c.Query("subscribed"))
+	if err != nil {
+		logger.Warn("Failed to subscribe thread: invaild param",
+			zap.Uint("uid", uid),
+			zap.String("id", c.Param("id")),
+			zap.String("subscribed", c.Query("subscribed")))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.NoDataResponse(c, func() error {
+		return ms.SubscribeThread(uid, c.Param("id"), subscribed)
+	})
+}
+
+func PinMessage(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	ginx.NoDataResponse(c, func() error {
+		return ms.Pin(uid, c.Param("id"), true)
+	})
+}
+
+func UnpinMessage(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	ginx.NoDataResponse(c, func() error {
+		return ms.Pin(uid, c.Param("id"), false)
+	})
+}
+
+func GroupPins(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	gid, err := strconv.ParseUint(c.Param("gid"), 10, 64)
+	if err != nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	var cursor *model.Cursor
+	c.ShouldBindJSON(&cursor)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.GroupPins(uid, uint(gid), cursor)
+	})
+}
+
+func ConversationPins(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	peer, err := strconv.ParseUint(c.Param("peer"), 10, 64)
+	if err != nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	var cursor *model.Cursor
+	c.ShouldBindJSON(&cursor)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.ConversationPins(uid, uint(peer), cursor)
+	})
+}
+
+func SetGroupRetention(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	gid, err := strconv.ParseUint(c.Param("gid"), 10, 64)
+	if err != nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ttl, err := strconv.ParseInt(c.Query("ttl"), 10, 64)
+	if err != nil {
+		logger.Warn("Failed to set retention: invaild param",
+			zap.Uint("uid", uid),
+			zap.Uint64("gid", gid),
+			zap.String("ttl", c.Query("ttl")))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.NoDataResponse(c, func() error {
+		return ms.SetGroupRetention(uid, uint(gid), ttl)
+	})
+}
+
+func GroupRetention(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	gid, err := strconv.ParseUint(c.Param("gid"), 10, 64)
+	if err != nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.GroupRetention(uid, uint(gid))
+	})
+}
+
+func SetConversationRetention(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	peer, err := strconv.ParseUint(c.Param("peer"), 10, 64)
+	if err != nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ttl, err := strconv.ParseInt(c.Query("ttl"), 10, 64)
+	if err != nil {
+		logger.Warn("Failed to set retention: invaild param",
+			zap.Uint("uid", uid),
+			zap.Uint64("peer", peer),
+			zap.String("ttl", c.Query("ttl")))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.NoDataResponse(c, func() error {
+		return ms.SetDirectRetention(uid, uint(peer), ttl)
+	})
+}
+
+func ConversationRetention(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	peer, err := strconv.ParseUint(c.Param("peer"), 10, 64)
+	if err != nil {
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.DirectRetention(uid, uint(peer))
+	})
+}
+
+func SearchMessages(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	var search model.MessageSearch
+	if err := c.ShouldBindQuery(&search); err != nil {
+		logger.Warn("Failed to search messages: invaild param",
+			zap.Uint("uid", uid),
+			zap.String("query", c.Request.URL.RawQuery),
+			zap.Error(err))
+		ginx.HandleInvalidParam(c)
+		return
+	}
+	var cursor *model.SearchCursor
+	c.ShouldBindJSON(&cursor)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.Search(uid, &search, cursor)
+	})
+}
+
+func ScheduledMessages(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.ScheduledMessages(uid)
+	})
+}
+
+func CancelScheduled(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	ginx.NoDataResponse(c, func() error {
+		return ms.CancelScheduled(uid, c.Param("id"))
+	})
+}
+
+func Conversations(c *gin.Context) {
+	uid := ginx.GetUserID(c)
+	ginx.HasDataResponse(c, func() (any, error) {
+		return ms.Conversations(uid)
+	})
+}
@@ -0,0 +1,300 @@
+package v1_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/farnese17/chat/repository"
+	m "github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	ws "github.com/farnese17/chat/websocket"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func clearMessageData() {
+	repo := s.User().(repository.TestableRepo)
+	repo.ExecSql("DELETE FROM `message`")
+	repo.ExecSql("DELETE FROM `reaction`")
+	repo.ExecSql("DELETE FROM `reaction_count`")
+	repo.ExecSql("DELETE FROM `thread_subscriber`")
+	repo.ExecSql("DELETE FROM `pinned_message`")
+	repo.ExecSql("DELETE FROM `scheduled_message`")
+	repo.ExecSql("DELETE FROM `retention`")
+}
+
+func genTestMessages(t *testing.T, count int, fn func(i int) *m.Message) []*m.Message {
+	messages := make([]*m.Message, count)
+	for i := range count {
+		msg := fn(i)
+		msg.MsgID = uuid.NewString()
+		msg.Body = fmt.Sprintf("message %d", i)
+		msg.Time = time.Now().UnixMilli()
+		assert.NoError(t, s.Message().Create(msg))
+		messages[i] = msg
+	}
+	return messages
+}
+
+func TestConversationMessages(t *testing.T) {
+	clearMessageData()
+	setupTestData()
+
+	a, b := testData[0].ID, testData[1].ID
+	messages := genTestMessages(t, 25, func(i int) *m.Message {
+		if i%2 == 0 {
+			return &m.Message{Type: ws.Chat, Sender: a, Receiver: b}
+		}
+		return &m.Message{Type: ws.Chat, Sender: b, Receiver: a}
+	})
+	// 其他会话的消息不应出现
+	genTestMessages(t, 5, func(i int) *m.Message {
+		return &m.Message{Type: ws.Chat, Sender: a, Receiver: testData[2].ID}
+	})
+
+	url := fmt.Sprintf("/api/v1/conversations/%d/messages", b)
+	cursor := &m.Cursor{PageSize: 10, LastID: 0, HasMore: true}
+	var got []map[string]any
+	for cursor.HasMore {
+		body, _ := json.Marshal(cursor)
+		resp := testNoError(t, route, url, "GET", a, bytes.NewBuffer(body))
+		data := resp["data"].(map[string]any)
+		for _, msg := range data["data"].([]any) {
+			got = append(got, msg.(map[string]any))
+		}
+		jsonData, _ := json.Marshal(data["cursor"])
+		json.Unmarshal(jsonData, &cursor)
+	}
+
+	assert.Equal(t, len(messages), len(got))
+	for i, msg := range got {
+		expected := messages[len(messages)-1-i]
+		equalStruct(t, expected, msg)
+	}
+
+	body, _ := json.Marshal(m.Cursor{PageSize: 0})
+	testHasError(t, route, url, "GET", a, bytes.NewBuffer(body), errorsx.ErrPageSizeTooSmall)
+}
+
+func TestGroupMessages(t *testing.T) {
+	clearMessageData()
+	clearGroupData()
+	setupTestData()
+	setupTestGroupData()
+
+	group := testGroupData[0]
+	messages := genTestMessages(t, 15, func(i int) *m.Message {
+		return &m.Message{Type: ws.Broadcast, Sender: group.Owner, GroupID: group.GID}
+	})
+
+	url := fmt.Sprintf("/api/v1/groups/%d/messages", group.GID)
+	body, _ := json.Marshal(m.Cursor{PageSize: 20, LastID: 0, HasMore: true})
+	resp := testNoError(t, route, url, "GET", group.Owner, bytes.NewBuffer(body))
+	got := resp["data"].(map[string]any)["data"].([]any)
+	assert.Equal(t, len(messages), len(got))
+	for i, msg := range got {
+		equalStruct(t, messages[len(messages)-1-i], msg.(map[string]any))
+	}
+
+	// 非群组成员
+	body, _ = json.Marshal(m.Cursor{PageSize: 20, LastID: 0, HasMore: true})
+	testHasError(t, route, url, "GET", testGroupData[1].Owner, bytes.NewBuffer(body), errorsx.ErrNotInGroup)
+}
+
+func TestConversationList(t *testing.T) {
+	clearMessageData()
+	clearGroupData()
+	setupTestData()
+	setupTestGroupData()
+
+	a, b := testData[0].ID, testData[1].ID
+	group := testGroupData[2]
+	direct := genTestMessages(t, 5, func(i int) *m.Message {
+		return &m.Message{Type: ws.Chat, Sender: b, Receiver: a}
+	})
+	genTestMessages(t, 3, func(i int) *m.Message {
+		return &m.Message{Type: ws.Broadcast, Sender: b, GroupID: group.GID}
+	})
+	s.Cache().Remove(m.CacheReadCursor + strconv.FormatUint(uint64(a), 10))
+	s.Cache().Flush()
+	_, err := s.Cache().SetReadCursor(a, b, 0, direct[1].ID)
+	assert.NoError(t, err)
+
+	// 群组成员才能看到群聊会话
+	resp := testNoError(t, route, "/api/v1/conversations", "GET", a, nil)
+	data := resp["data"].([]any)
+	assert.Len(t, data, 1)
+	conv := data[0].(map[string]any)
+	assert.Equal(t, float64(b), conv["peer_id"])
+	assert.Equal(t, float64(direct[4].ID), conv["last_seq"])
+	assert.Equal(t, float64(direct[1].ID), conv["read_seq"])
+	assert.Equal(t, float64(3), conv["unread"])
+
+	resp = testNoError(t, route, "/api/v1/conversations", "GET", group.Owner, nil)
+	data = resp["data"].([]any)
+	assert.Len(t, data, 1)
+	conv = data[0].(map[string]any)
+	assert.Equal(t, float64(group.GID), conv["group_id"])
+	assert.Equal(t, float64(3), conv["unread"])
+}
+
+func TestPinnedMessages(t *testing.T) {
+	startWebsocket()
+	defer shutdownWebsocket()
+	clearMessageData()
+	clearGroupData()
+	setupTestData()
+	setupTestGroupData()
+
+	a, b := testData[0].ID, testData[1].ID
+	direct := genTestMessages(t, 3, func(i int) *m.Message {
+		return &m.Message{Type: ws.Chat, Sender: a, Receiver: b}
+	})
+	url := fmt.Sprintf("/api/v1/messages/%s/pin", direct[0].MsgID)
+	testNoError(t, route, url, "PUT", b, nil)
+	testHasError(t, route, url, "PUT", a, nil, errorsx.ErrAlreadyPinned)
+	testNoError(t, route, fmt.Sprintf("/api/v1/messages/%s/pin", direct[2].MsgID), "PUT", a, nil)
+	// 不是会话的参与者
+	testHasError(t, route, url, "DELETE", testData[2].ID, nil, errorsx.ErrMessageNotFound)
+
+	// 双方看到相同的置顶消息,从新到旧
+	body, _ := json.Marshal(m.Cursor{PageSize: 1, HasMore: true})
+	resp := testNoError(t, route, fmt.Sprintf("/api/v1/conversations/%d/pins", b), "GET", a, bytes.NewBuffer(body))
+	data := resp["data"].(map[string]any)
+	pins := data["data"].([]any)
+	assert.Len(t, pins, 1)
+	assert.Equal(t, direct[2].MsgID, pins[0].(map[string]any)["message"].(map[string]any)["id"])
+	assert.True(t, data["cursor"].(map[string]any)["has_more"].(bool))
+	body, _ = json.Marshal(m.Cursor{PageSize: 10, HasMore: true})
+	resp = testNoError(t, route, fmt.Sprintf("/api/v1/conversations/%d/pins", a), "GET", b, bytes.NewBuffer(body))
+	assert.Len(t, resp["data"].(map[string]any)["data"], 2)
+
+	testNoError(t, route, url, "DELETE", a, nil)
+	testHasError(t, route, url, "DELETE", a, nil, errorsx.ErrNotPinned)
+	// 撤回的消息会取消置顶
+	assert.NoError(t, s.Message().Recall(direct[2].MsgID))
+	body, _ = json.Marshal(m.Cursor{PageSize: 10, HasMore: true})
+	resp = testNoError(t, route, fmt.Sprintf("/api/v1/conversations/%d/pins", b), "GET", a, bytes.NewBuffer(body))
+	assert.Len(t, resp["data"].(map[string]any)["data"], 0)
+
+	group := testGroupData[0]
+	messages := genTestMessages(t, 1, func(i int) *m.Message {
+		return &m.Message{Type: ws.Broadcast, Sender: group.Owner, GroupID: group.GID}
+	})
+	url = fmt.Sprintf("/api/v1/messages/%s/pin", messages[0].MsgID)
+	testHasError(t, route, url, "PUT", testGroupData[1].Owner, nil, errorsx.ErrNotInGroup)
+	testNoError(t, route, url, "PUT", group.Owner, nil)
+
+	body, _ = json.Marshal(m.Cursor{PageSize: 10, HasMore: true})
+	resp = testNoError(t, route, fmt.Sprintf("/api/v1/groups/%d/pins", group.GID), "GET", group.Owner, bytes.NewBuffer(body))
+	pins = resp["data"].(map[string]any)["data"].([]any)
+	assert.Len(t, pins, 1)
+	assert.Equal(t, float64(group.Owner), pins[0].(map[string]any)["pinned_by"])
+}
+
+func TestMessageRetention(t *testing.T) {
+	startWebsocket()
+	defer shutdownWebsocket()
+	clearMessageData()
+	clearGroupData()
+	setupTestData()
+	setupTestGroupData()
+
+	a, b := testData[0].ID, testData[1].ID
+	url := fmt.Sprintf("/api/v1/conversations/%d/retention", b)
+	testHasError(t, route, url+"?ttl=30", "PUT", a, nil, errorsx.ErrInvalidParams)
+	testHasError(t, route, url+"?ttl=abc", "PUT", a, nil, errorsx.ErrInvalidParams)
+	resp := testNoError(t, route, url, "GET", a, nil)
+	assert.Equal(t, float64(0), resp["data"].(map[string]any)["ttl"])
+
+	testNoError(t, route, url+"?ttl=3600", "PUT", a, nil)
+	// 双方看到相同的设置
+	resp = testNoError(t, route, fmt.Sprintf("/api/v1/conversations/%d/retention", a), "GET", b, nil)
+	data := resp["data"].(map[string]any)
+	assert.Equal(t, float64(3600), data["ttl"])
+	assert.Equal(t, float64(a), data["updated_by"])
+	testNoError(t, route, fmt.Sprintf("/api/v1/conversations/%d/retention?ttl=0", a), "PUT", b, nil)
+	resp = testNoError(t, route, url, "GET", a, nil)
+	assert.Equal(t, float64(0), resp["data"].(map[string]any)["ttl"])
+
+	group := testGroupData[0]
+	url = fmt.Sprintf("/api/v1/groups/%d/retention", group.GID)
+	testHasError(t, route, url+"?ttl=86400", "PUT", testGroupData[1].Owner, nil, errorsx.ErrNotInGroup)
+	testNoError(t, route, url+"?ttl=86400", "PUT", group.Owner, nil)
+	resp = testNoError(t, route, url, "GET", group.Owner, nil)
+	assert.Equal(t, float64(86400), resp["data"].(map[string]any)["ttl"])
+}
+
+func TestSearchMessages(t *testing.T) {
+	clearMessageData()
+	clearGroupData()
+	setupTestData()
+	setupTestGroupData()
+
+	a, b, c := testData[0].ID, testData[1].ID, testData[2].ID
+	// a 不在该群组中
+	group := testGroupData[2]
+	create := func(msg *m.Message) *m.Message {
+		msg.MsgID = uuid.NewString()
+		msg.Time = time.Now().UnixMilli()
+		assert.NoError(t, s.Message().Create(msg))
+		return msg
+	}
+	best := create(&m.Message{Type: ws.Chat, Sender: a, Receiver: b, Body: "周末一起去爬山,爬山之后吃火锅"})
+	other := create(&m.Message{Type: ws.Chat, Sender: b, Receiver: a, Body: "明天去爬山吗"})
+	image := create(&m.Message{Type: ws.Chat, Sender: b, Receiver: a, Body: "[图片] 爬山",
+		Content: `{"kind":"image","file_id":1}`})
+	grouped := create(&m.Message{Type: ws.Broadcast, Sender: group.Owner, GroupID: group.GID, Body: "群里也在讨论爬山"})
+	// 不属于自己的会话和撤回的消息不出现在结果中
+	create(&m.Message{Type: ws.Chat, Sender: b, Receiver: c, Body: "爬山"})
+	recalled := create(&m.Message{Type: ws.Chat, Sender: a, Receiver: b, Body: "爬山"})
+	assert.NoError(t, s.Message().Recall(recalled.MsgID))
+
+	search := func(handler uint, query map[string]string, cursor m.SearchCursor) map[string]any {
+		body, _ := json.Marshal(cursor)
+		resp := testNoError(t, route, "/api/v1/messages/search", "GET", handler, bytes.NewBuffer(body), query)
+		return resp["data"].(map[string]any)
+	}
+	ids := func(data map[string]any) []string {
+		var ids []string
+		for _, hit := range data["data"].([]any) {
+			ids = append(ids, hit.(map[string]any)["id"].(string))
+		}
+		return ids
+	}
+
+	// 相关度最高的在前,逐页获取
+	var got []string
+	cursor := m.SearchCursor{Cursor: m.Cursor{PageSize: 1, HasMore: true}}
+	for cursor.HasMore {
+		data := search(a, map[string]string{"q": "爬山"}, cursor)
+		got = append(got, ids(data)...)
+		jsonData, _ := json.Marshal(data["cursor"])
+		json.Unmarshal(jsonData, &cursor)
+	}
+	assert.Len(t, got, 3)
+	assert.Equal(t, best.MsgID, got[0])
+	assert.ElementsMatch(t, []string{best.MsgID, other.MsgID, image.MsgID}, got)
+
+	cursor = m.SearchCursor{Cursor: m.Cursor{PageSize: 10, HasMore: true}}
+	data := search(a, map[string]string{"q": "爬山", "kind": "image"}, cursor)
+	assert.Equal(t, []string{image.MsgID}, ids(data))
+	data = search(a, map[string]string{"q": "爬山", "from": strconv.FormatUint(uint64(a), 10)}, cursor)
+	assert.Equal(t, []string{best.MsgID}, ids(data))
+	hit := data["data"].([]any)[0].(map[string]any)
+	assert.Contains(t, hit["snippet"], "<em>爬山</em>")
+
+	data = search(group.Owner, map[string]string{"q": "爬山", "group_id": strconv.FormatUint(uint64(group.GID), 10)}, cursor)
+	assert.Equal(t, []string{grouped.MsgID}, ids(data))
+
+	body, _ := json.Marshal(cursor)
+	testHasError(t, route, "/api/v1/messages/search", "GET", a, bytes.NewBuffer(body), errorsx.ErrInvalidParams,
+		map[string]string{"q": ""})
+	body, _ = json.Marshal(cursor)
+	testHasError(t, route, "/api/v1/messages/search", "GET", testGroupData[1].Owner, bytes.NewBuffer(body), errorsx.ErrNotInGroup,
+		map[string]string{"q": "爬山", "group_id": strconv.FormatUint(uint64(group.GID), 10)})
+}
@@ -1,28 +1,26 @@
 package v1
 
 import (
-	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/farnese17/chat/config"
 	"github.com/farnese17/chat/middleware"
-	"github.com/farnese17/chat/pkg/storage"
 	"github.com/farnese17/chat/registry"
 	"github.com/farnese17/chat/service"
 	"github.com/farnese17/chat/service/model"
 	"github.com/farnese17/chat/utils/errorsx"
 	"github.com/farnese17/chat/utils/ginx"
+	"github.com/farnese17/chat/utils/validator"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
 var u *service.UserService
 
-var fs storage.Storage
-
 func SetupUserService(s registry.Service) {
 	u = service.NewUserService(s)
-	fs = s.Storage()
 }
 
 func Register(c *gin.Context) {
@@ -91,7 +89,18 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	token, err := middleware.GenerateToken(user.ID)
+	// 客户端没有提供设备ID时生成一个,之后登录应携带该ID
+	device := params["device"]
+	if device == "" {
+		device = uuid.NewString()
+	}
+	if err := validator.ValidateDevice(device); err != nil {
+		ginx.ResponseJson(c, err, nil)
+		c.Abort()
+		return
+	}
+
+	token, err := middleware.GenerateToken(user.ID, device)
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
 			"status":  errorsx.GetStatusCode(errorsx.ErrInvalidToken),
@@ -100,62 +109,45 @@ func Login(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	// 插入、替换token
+	// 插入、替换该设备的token
 	expire := config.GetConfig().Common().TokenValidPeriod()
-	registry.GetService().Cache().SetToken(user.ID, token, expire)
+	cache := registry.GetService().Cache()
+	cache.SetToken(user.ID, device, token, expire)
+	now := time.Now()
+	cache.AddSession(user.ID, &model.Session{
+		Device:    device,
+		UserAgent: c.Request.UserAgent(),
+		IP:        c.ClientIP(),
+		LoginAt:   now.Unix(),
+		ExpireAt:  now.Add(expire).Unix(),
+	})
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  errorsx.GetStatusCode(errorsx.ErrNil),
 		"message": errorsx.ErrNil.Error(),
 		"token":   token,
+		"device":  device,
 		"data":    user,
 	})
 }
 
 func LogOut(c *gin.Context) {
-	u.Logout(ginx.GetUserID(c))
+	u.Logout(ginx.GetUserID(c), ginx.GetDeviceID(c))
 	ginx.ResponseJson(c, errorsx.ErrNil, nil)
 }
 
-func Upload(c *gin.Context) {
-	file, header, err := c.Request.FormFile("file")
-	if err != nil || file == nil {
-		ginx.HandleInvalidParam(c)
-		return
-	}
-	filename := header.Filename
+func Sessions(c *gin.Context) {
 	id := ginx.GetUserID(c)
+	device := ginx.GetDeviceID(c)
 	ginx.HasDataResponse(c, func() (any, error) {
-		return fs.Upload(id, file, filename)
+		return u.Sessions(id, device)
 	})
 }
 
-func Download(c *gin.Context) {
-	handleGetFile(c, "attachment")
-}
-
-func GetFile(c *gin.Context) {
-	handleGetFile(c, "inline")
-}
-
-func handleGetFile(c *gin.Context, disposition string) {
-	id := c.Param("id")
-	f, err := fs.Download(id)
-	if err != nil {
-		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{
-			"status":  http.StatusNotFound,
-			"message": errorsx.ErrNotFound.Error()})
-		return
-	}
-	c.Header("Content-Disposition", fmt.Sprintf("%s; filename=%s;filename*=UTF-8''%s",
-		disposition, f.Name, f.Name))
-	c.File(f.Path)
-}
-
-func DeleteFile(c *gin.Context) {
-	fileID := c.Param("id")
+func RevokeSession(c *gin.Context) {
 	id := ginx.GetUserID(c)
+	device := c.Param("device")
 	ginx.NoDataResponse(c, func() error {
-		return fs.Delete(id, fileID)
+		return u.RevokeSession(id, device)
 	})
 }
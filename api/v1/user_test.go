@@ -44,6 +44,9 @@ func TestMain(m *testing.M) {
 	v1.SetupGroupService(s)
 	v1.SetupFriendService(s)
 	v1.SetupManagerService(s)
+	v1.SetupMessageService(s)
+	v1.SetupKeyService(s)
+	v1.SetupFileService(s)
 	go s.Cache().StartFlush()
 	route = router.SetupRouter("release")
 	managerRouter = router.SetupManagerRouter("release")
@@ -131,6 +134,7 @@ func TestLogin(t *testing.T) {
 			expected := testData[idx]
 			equalStruct(t, expected, resp["data"].(map[string]any))
 			assert.NotEmpty(t, resp["token"].(string))
+			assert.NotEmpty(t, resp["device"].(string))
 		})
 	}
 
@@ -143,6 +147,54 @@ func TestLogin(t *testing.T) {
 	wg.Wait()
 }
 
+func TestSessions(t *testing.T) {
+	setupTestData()
+	user := testData[0]
+
+	login := func(device string) string {
+		body, _ := json.Marshal(map[string]any{
+			"account": strconv.FormatUint(uint64(user.ID), 10), "password": "aaaaaa", "device": device})
+		resp := testNoError(t, route, "/api/v1/login", "POST", 0, bytes.NewBuffer(body))
+		assert.Equal(t, device, resp["device"])
+		return resp["token"].(string)
+	}
+	request := func(method, url, token string) map[string]any {
+		req := httptest.NewRequest(method, url, nil)
+		req.Header.Add("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		route.ServeHTTP(w, req)
+		var resp map[string]any
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	phone, desktop := login("phone"), login("desktop")
+	s.Cache().Flush()
+
+	resp := request("GET", "/api/v1/sessions", desktop)
+	assert.Equal(t, float64(200), resp["status"])
+	current := make(map[string]bool)
+	for _, v := range resp["data"].([]any) {
+		session := v.(map[string]any)
+		current[session["device"].(string)] = session["current"].(bool)
+	}
+	assert.Equal(t, false, current["phone"])
+	assert.Equal(t, true, current["desktop"])
+
+	resp = request("DELETE", "/api/v1/sessions/phone", desktop)
+	assert.Equal(t, float64(200), resp["status"])
+	resp = request("DELETE", "/api/v1/sessions/phone", desktop)
+	assert.Equal(t, float64(errorsx.GetStatusCode(errorsx.ErrSessionNotFound)), resp["status"])
+
+	// 被注销的设备token失效,其他设备不受影响
+	resp = request("GET", "/api/v1/sessions", phone)
+	assert.NotEqual(t, float64(200), resp["status"])
+	resp = request("POST", "/api/v1/logout", desktop)
+	assert.Equal(t, float64(200), resp["status"])
+	resp = request("GET", "/api/v1/sessions", desktop)
+	assert.NotEqual(t, float64(200), resp["status"])
+}
+
 func TestSearchUser(t *testing.T) {
 	setupTestData()
 
@@ -263,11 +315,13 @@ func equalHttpResp(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
 	return resp
 }
 
+const testDevice = "test"
+
 func addToken(uid uint, req *http.Request) string {
-	token, err := s.Cache().GetToken(uid)
+	token, err := s.Cache().GetToken(uid, testDevice)
 	if err != nil || token == "" {
-		token, _ = middleware.GenerateToken(uid)
-		s.Cache().SetToken(uid, token, s.Config().Common().TokenValidPeriod())
+		token, _ = middleware.GenerateToken(uid, testDevice)
+		s.Cache().SetToken(uid, testDevice, token, s.Config().Common().TokenValidPeriod())
 		s.Cache().Flush()
 	}
 	req.Header.Add("Authorization", "Bearer "+token)
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/farnese17/chat/registry"
+	"github.com/farnese17/chat/utils/ginx"
 	"github.com/farnese17/chat/websocket"
 	"github.com/gin-gonic/gin"
 )
@@ -15,6 +16,7 @@ func WsRoutes(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	id := c.MustGet("from").(uint)
-	websocket.UpgradeToWS(s, id, c.Writer, c.Request)
+	id := ginx.GetUserID(c)
+	device := ginx.GetDeviceID(c)
+	websocket.UpgradeToWS(s, id, device, c.Writer, c.Request)
 }
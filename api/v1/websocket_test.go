@@ -1,16 +1,19 @@
 package v1_test
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand/v2"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/farnese17/chat/config"
 	"github.com/farnese17/chat/middleware"
 	"github.com/farnese17/chat/repository"
 	"github.com/farnese17/chat/service/model"
@@ -53,15 +56,19 @@ func shutdownWebsocket() {
 }
 
 func registerClientToWs(t *testing.T, id uint) {
+	registerClientWithDialer(t, id, websocket.DefaultDialer)
+}
+
+func registerClientWithDialer(t *testing.T, id uint, dialer *websocket.Dialer) {
 	t.Run(fmt.Sprintf("register %d", id), func(t *testing.T) {
-		token, err := s.Cache().GetToken(id)
+		token, err := s.Cache().GetToken(id, testDevice)
 		if err != nil || token == "" {
-			token, _ = middleware.GenerateToken(id)
-			s.Cache().SetToken(id, token, s.Config().Common().TokenValidPeriod())
+			token, _ = middleware.GenerateToken(id, testDevice)
+			s.Cache().SetToken(id, testDevice, token, s.Config().Common().TokenValidPeriod())
 			s.Cache().Flush()
 		}
 		url := fmt.Sprintf("ws://localhost:%d/api/v1/ws", port)
-		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{
+		conn, _, err := dialer.Dial(url, http.Header{
 			"Authorization": []string{"Bearer " + token}})
 		assert.NoError(t, err)
 		mu.Lock()
@@ -275,6 +282,61 @@ func TestWebsocketChat(t *testing.T) {
 	checkPendingMessage(t)
 }
 
+func TestWebsocketMsgpack(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	defer shutdownWebsocket()
+
+	var sender, receiver uint = 100001, 100002
+	registerClientWithDialer(t, sender, &websocket.Dialer{
+		Subprotocols:      []string{ws.ProtocolMsgpack},
+		EnableCompression: true,
+	})
+	registerClientToWs(t, receiver)
+	waitingForClientsRegisterComplete(t, 2)
+
+	conn := getConn(sender)
+	assert.Equal(t, ws.ProtocolMsgpack, conn.Subprotocol())
+	codec := ws.CodecFor(ws.ProtocolMsgpack)
+
+	t.Run("send msgpack", func(t *testing.T) {
+		data, err := codec.Encode(ws.Chat, &ws.ChatMsg{To: receiver, Body: strings.Repeat("abcd", 256), Time: genMsgTime()})
+		assert.NoError(t, err)
+		assert.NoError(t, conn.WriteMessage(websocket.BinaryMessage, data))
+
+		// 接收者仍然使用json
+		expected := ws.ChatMsg{Type: ws.Chat, From: sender, To: receiver, Body: strings.Repeat("abcd", 256)}
+		getConn(receiver).SetReadDeadline(time.Now().Add(time.Second * 5))
+		receiveChatMessage(t, getConn(receiver), expected)
+
+		conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		frameType, p, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		assert.Equal(t, websocket.BinaryMessage, frameType)
+		msgType, body, err := codec.Decode(p)
+		assert.NoError(t, err)
+		assert.Equal(t, ws.Ack, msgType)
+		var ack ws.AckMsg
+		assert.NoError(t, codec.DecodeBody(body, &ack))
+		assert.Equal(t, sender, ack.To)
+	})
+
+	t.Run("receive msgpack", func(t *testing.T) {
+		send(t, ws.Chat, ws.ChatMsg{To: sender, Body: "abcd", Time: genMsgTime()}, getConn(receiver))
+
+		conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		_, p, err := conn.ReadMessage()
+		assert.NoError(t, err)
+		msgType, body, err := codec.Decode(p)
+		assert.NoError(t, err)
+		assert.Equal(t, ws.Chat, msgType)
+		var msg ws.ChatMsg
+		assert.NoError(t, codec.DecodeBody(body, &msg))
+		assert.Equal(t, receiver, msg.From)
+		assert.Equal(t, "abcd", msg.Body)
+	})
+}
+
 func TestWebsocketBroadcast(t *testing.T) {
 	startWebsocket()
 	clearWebsocket()
@@ -456,6 +518,70 @@ func TestSendUpdateNotify(t *testing.T) {
 	checkPendingMessage(t)
 }
 
+func TestReapDeadPeer(t *testing.T) {
+	cfg := s.Config()
+	assert.NoError(t, cfg.SetCommon("ping_interval", "100ms"))
+	assert.NoError(t, cfg.SetCommon("pong_wait", "300ms"))
+	defer func() {
+		cfg.SetCommon("pong_wait", "60s")
+		cfg.SetCommon("ping_interval", "30s")
+	}()
+
+	startWebsocket()
+	clearWebsocket()
+	defer shutdownWebsocket()
+
+	var id uint = 100001
+	registerClientToWs(t, id)
+	waitingForClientsRegisterComplete(t, 1)
+
+	// 不读取连接,不会回复pong
+	waitingForClientsRegisterComplete(t, 0)
+	assert.False(t, s.Hub().Online(id))
+
+	msg := &ws.ChatMsg{Type: ws.UpdateBlackList, From: 100002, To: id, Extra: true, Time: genMsgTime()}
+	s.Hub().SendUpdateBlockedListNotify(msg)
+	assert.True(t, waitingForCacheComplete(1, []uint{id}))
+}
+
+func TestSlowConsumer(t *testing.T) {
+	cfg := s.Config()
+	assert.NoError(t, cfg.SetCommon("send_queue_size", "4"))
+	assert.NoError(t, cfg.SetCommon("send_queue_policy", "disconnect"))
+	defer func() {
+		cfg.SetCommon("send_queue_size", "256")
+		cfg.SetCommon("send_queue_policy", "drop_oldest")
+	}()
+
+	startWebsocket()
+	clearWebsocket()
+	defer shutdownWebsocket()
+
+	var id uint = 100001
+	registerClientToWs(t, id)
+	waitingForClientsRegisterComplete(t, 1)
+
+	// 不读取连接,写入阻塞后发送队列很快就会满
+	body := strings.Repeat("x", 512*1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 100 {
+			msg := &ws.ChatMsg{Type: ws.UpdateBlackList, From: 100002, To: id, Body: body, Time: genMsgTime()}
+			s.Hub().SendUpdateBlockedListNotify(msg)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("hub blocked by slow consumer")
+	}
+
+	waitingForClientsRegisterComplete(t, 0)
+	stats := s.Hub().Stats()
+	assert.Equal(t, int64(1), stats["slow_disconnects"])
+}
+
 func TestACkMessage(t *testing.T) {
 	startWebsocket()
 	clearWebsocket()
@@ -708,3 +834,527 @@ func genMsgTime() int64 {
 	return time.Now().Add(-5 * time.Second).UnixMilli()
 
 }
+
+func TestSenderAuthentication(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	defer shutdownWebsocket()
+
+	var sender, receiver uint = 100001, 100002
+	registerClientToWs(t, sender)
+	registerClientToWs(t, receiver)
+	waitingForClientsRegisterComplete(t, 2)
+
+	// 伪造发送者
+	send(t, ws.Chat, ws.ChatMsg{ID: "forged", Type: ws.Chat, From: receiver, To: sender, Body: "abcd"}, clients[sender])
+	receiveErrorMessage(t, clients[sender], ws.ErrorMsg{Type: ws.Error, ID: "forged",
+		Code: errorsx.GetStatusCode(errorsx.ErrSenderMismatch), Message: errorsx.ErrSenderMismatch.Error()})
+
+	// 不在群组内
+	s.Cache().Remove(model.CacheGroup + strconv.FormatUint(uint64(1e9+2), 10))
+	s.Cache().AddMember(uint(1e9+2), receiver, model.GroupRoleMember)
+	s.Cache().Flush()
+	send(t, ws.Broadcast, ws.ChatMsg{ID: "not-member", Type: ws.Broadcast, To: uint(1e9 + 2), Body: "abcd"}, clients[sender])
+	receiveErrorMessage(t, clients[sender], ws.ErrorMsg{Type: ws.Error, ID: "not-member",
+		Code: errorsx.GetStatusCode(errorsx.ErrNotInGroup), Message: errorsx.ErrNotInGroup.Error()})
+
+	// 未填写发送者由服务端填充
+	send(t, ws.Chat, ws.ChatMsg{Type: ws.Chat, To: receiver, Body: "abcd"}, clients[sender])
+	clients[receiver].SetReadDeadline(time.Now().Add(time.Second * 5))
+	receiveChatMessage(t, clients[receiver], ws.ChatMsg{Type: ws.Chat, From: sender, To: receiver, Body: "abcd"})
+}
+
+func TestNullMessageBody(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	defer shutdownWebsocket()
+
+	var sender, receiver uint = 100001, 100002
+	registerClientToWs(t, sender)
+	registerClientToWs(t, receiver)
+	waitingForClientsRegisterComplete(t, 2)
+
+	// body为null时关闭连接,不影响服务端
+	for _, msgType := range []int{ws.Chat, ws.Broadcast, ws.Ack, ws.Read, ws.Typing, ws.SenderKey, ws.ReactionAdd} {
+		conn := clients[sender]
+		err := conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"type":%d,"body":null}`, msgType)))
+		assert.NoError(t, err)
+		conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+		for err == nil {
+			_, _, err = conn.ReadMessage()
+		}
+		assert.Error(t, err)
+		registerClientToWs(t, sender)
+	}
+
+	send(t, ws.Chat, ws.ChatMsg{Type: ws.Chat, From: receiver, To: sender, Body: "abcd"}, clients[receiver])
+	receiveChatMessage(t, clients[sender], ws.ChatMsg{Type: ws.Chat, From: receiver, To: sender, Body: "abcd"})
+}
+
+func receiveErrorMessage(t *testing.T, conn *websocket.Conn, expected ws.ErrorMsg) {
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	_, p, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	var message ws.Message
+	json.Unmarshal(p, &message)
+	assert.Equal(t, ws.Error, message.Type)
+	var msg ws.ErrorMsg
+	json.Unmarshal(message.Body, &msg)
+	assert.Equal(t, expected, msg)
+}
+
+func TestFriendshipEnforcement(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	defer shutdownWebsocket()
+
+	var sender, receiver uint = 100001, 100002
+	registerClientToWs(t, sender)
+	registerClientToWs(t, receiver)
+	waitingForClientsRegisterComplete(t, 2)
+
+	tests := []struct {
+		status   int
+		policy   string
+		expected error
+	}{
+		{model.FSBlock2To1, config.StrangerMessageAllow, errorsx.ErrBlocked},
+		{model.FSBlock1To2, config.StrangerMessageAllow, errorsx.ErrAlreadyBlock},
+		{model.FSBothBlocked, config.StrangerMessageAllow, errorsx.ErrAlreadyBlock},
+		{model.FSNull, config.StrangerMessageDeny, errorsx.ErrNotFriend},
+		{model.FSReq1To2, config.StrangerMessageDeny, errorsx.ErrNotFriend},
+	}
+	defer s.Config().SetCommon("stranger_message", config.StrangerMessageAllow)
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("friendship %d", i), func(t *testing.T) {
+			s.Cache().SetFriendStatus(sender, receiver, tt.status)
+			s.Cache().Flush()
+			assert.NoError(t, s.Config().SetCommon("stranger_message", tt.policy))
+			id := uuid.NewString()
+			send(t, ws.Chat, ws.ChatMsg{ID: id, Type: ws.Chat, To: receiver, Body: "abcd"}, clients[sender])
+			receiveErrorMessage(t, clients[sender], ws.ErrorMsg{Type: ws.Error, ID: id,
+				Code: errorsx.GetStatusCode(tt.expected), Message: tt.expected.Error()})
+		})
+	}
+
+	// 好友之间正常投递
+	s.Cache().SetFriendStatus(sender, receiver, model.FSAdded)
+	s.Cache().Flush()
+	send(t, ws.Chat, ws.ChatMsg{Type: ws.Chat, To: receiver, Body: "abcd"}, clients[sender])
+	clients[receiver].SetReadDeadline(time.Now().Add(time.Second * 5))
+	receiveChatMessage(t, clients[receiver], ws.ChatMsg{Type: ws.Chat, From: sender, To: receiver, Body: "abcd"})
+}
+
+func TestRecallAndEdit(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	clearMessageData()
+	defer shutdownWebsocket()
+
+	var sender, receiver uint = 100001, 100002
+	registerClientToWs(t, sender)
+	registerClientToWs(t, receiver)
+	waitingForClientsRegisterComplete(t, 2)
+	s.Cache().SetFriendStatus(sender, receiver, model.FSAdded)
+	s.Cache().Flush()
+
+	id := uuid.NewString()
+	send(t, ws.Chat, ws.ChatMsg{ID: id, To: receiver, Body: "abcd"}, clients[sender])
+	clients[receiver].SetReadDeadline(time.Now().Add(time.Second * 5))
+	receiveChatMessage(t, clients[receiver], ws.ChatMsg{ID: id, Type: ws.Chat, From: sender, To: receiver, Body: "abcd"})
+
+	// 只有发送者可以撤回
+	send(t, ws.Recall, ws.ChatMsg{ID: id}, clients[receiver])
+	receiveErrorMessage(t, clients[receiver], ws.ErrorMsg{Type: ws.Error, ID: id,
+		Code: errorsx.GetStatusCode(errorsx.ErrNotMessageSender), Message: errorsx.ErrNotMessageSender.Error()})
+
+	// 编辑
+	send(t, ws.Edit, ws.ChatMsg{ID: id, Body: "efgh"}, clients[sender])
+	receiveChatMessage(t, clients[receiver], ws.ChatMsg{ID: id, Type: ws.Edit, From: sender, To: receiver, Body: "efgh"})
+	msg, err := s.Message().Get(id)
+	assert.NoError(t, err)
+	assert.Equal(t, "efgh", msg.Body)
+	assert.NotZero(t, msg.EditedAt)
+
+	// 撤回
+	send(t, ws.Recall, ws.ChatMsg{ID: id}, clients[sender])
+	receiveChatMessage(t, clients[receiver], ws.ChatMsg{ID: id, Type: ws.Recall, From: sender, To: receiver})
+	msg, err = s.Message().Get(id)
+	assert.NoError(t, err)
+	assert.True(t, msg.Recalled)
+	assert.Empty(t, msg.Body)
+
+	// 依次为聊天、编辑、撤回的确认消息
+	for range 3 {
+		clients[sender].SetReadDeadline(time.Now().Add(time.Second * 5))
+		_, p, err := clients[sender].ReadMessage()
+		assert.NoError(t, err)
+		var message ws.Message
+		json.Unmarshal(p, &message)
+		assert.Equal(t, ws.Ack, message.Type)
+	}
+
+	// 已撤回的消息不能再编辑
+	send(t, ws.Edit, ws.ChatMsg{ID: id, Body: "ijkl"}, clients[sender])
+	receiveErrorMessage(t, clients[sender], ws.ErrorMsg{Type: ws.Error, ID: id,
+		Code: errorsx.GetStatusCode(errorsx.ErrMessageRecalled), Message: errorsx.ErrMessageRecalled.Error()})
+
+	// 超过时限
+	expired := &model.Message{MsgID: uuid.NewString(), Type: ws.Chat, Sender: sender, Receiver: receiver,
+		Body: "abcd", Time: time.Now().Add(-time.Hour).UnixMilli()}
+	assert.NoError(t, s.Message().Create(expired))
+	send(t, ws.Recall, ws.ChatMsg{ID: expired.MsgID}, clients[sender])
+	receiveErrorMessage(t, clients[sender], ws.ErrorMsg{Type: ws.Error, ID: expired.MsgID,
+		Code: errorsx.GetStatusCode(errorsx.ErrModifyExpired), Message: errorsx.ErrModifyExpired.Error()})
+}
+
+func TestReadReceipt(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	clearMessageData()
+	defer shutdownWebsocket()
+
+	var sender, receiver uint = 100001, 100002
+	registerClientToWs(t, sender)
+	registerClientToWs(t, receiver)
+	waitingForClientsRegisterComplete(t, 2)
+	s.Cache().Remove(model.CacheReadCursor + strconv.FormatUint(uint64(receiver), 10))
+	s.Cache().Flush()
+
+	msg := &model.Message{MsgID: uuid.NewString(), Type: ws.Chat, Sender: sender, Receiver: receiver,
+		Body: "abcd", Time: time.Now().UnixMilli()}
+	assert.NoError(t, s.Message().Create(msg))
+
+	send(t, ws.Read, ws.ReadMsg{ID: msg.MsgID}, clients[receiver])
+	clients[sender].SetReadDeadline(time.Now().Add(time.Second * 5))
+	_, p, err := clients[sender].ReadMessage()
+	assert.NoError(t, err)
+	var message ws.Message
+	json.Unmarshal(p, &message)
+	assert.Equal(t, ws.Read, message.Type)
+	var receipt ws.ReadMsg
+	json.Unmarshal(message.Body, &receipt)
+	assert.Equal(t, msg.MsgID, receipt.ID)
+	assert.Equal(t, receiver, receipt.From)
+	assert.Equal(t, sender, receipt.To)
+
+	seq, err := s.Cache().GetReadCursor(receiver, sender, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, msg.ID, seq)
+
+	// 不存在的消息
+	id := uuid.NewString()
+	send(t, ws.Read, ws.ReadMsg{ID: id}, clients[receiver])
+	receiveErrorMessage(t, clients[receiver], ws.ErrorMsg{Type: ws.Error, ID: id,
+		Code: errorsx.GetStatusCode(errorsx.ErrMessageNotFound), Message: errorsx.ErrMessageNotFound.Error()})
+}
+
+func receiveAck(t *testing.T, conn *websocket.Conn) {
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	_, p, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	var message ws.Message
+	json.Unmarshal(p, &message)
+	assert.Equal(t, ws.Ack, message.Type)
+}
+
+func TestRichContent(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	clearMessageData()
+	clearFileData()
+	defer shutdownWebsocket()
+
+	var sender, receiver uint = 100001, 100002
+	registerClientToWs(t, sender)
+	registerClientToWs(t, receiver)
+	waitingForClientsRegisterComplete(t, 2)
+	s.Cache().SetFriendStatus(sender, receiver, model.FSAdded)
+	s.Cache().Flush()
+	fileID := uploadFile(t, sender, "a.txt", []byte("file content"))
+	other := uploadFile(t, receiver+1, "b.txt", []byte("other content"))
+
+	// 服务端生成摘要
+	id := uuid.NewString()
+	image := &ws.Content{Kind: ws.ContentImage, FileID: fileID}
+	send(t, ws.Chat, ws.ChatMsg{ID: id, To: receiver, Content: image}, clients[sender])
+	clients[receiver].SetReadDeadline(time.Now().Add(time.Second * 5))
+	receiveChatMessage(t, clients[receiver], ws.ChatMsg{ID: id, Type: ws.Chat, From: sender, To: receiver,
+		Body: "[图片]", Content: image})
+	receiveAck(t, clients[sender])
+	msg, err := s.Message().Get(id)
+	assert.NoError(t, err)
+	assert.JSONEq(t, fmt.Sprintf(`{"kind":"image","file_id":"%s"}`, fileID), msg.Content)
+
+	// 纯文本内容转为普通消息
+	send(t, ws.Chat, ws.ChatMsg{To: receiver, Content: &ws.Content{Kind: ws.ContentText, Text: "abcd"}}, clients[sender])
+	receiveChatMessage(t, clients[receiver], ws.ChatMsg{Type: ws.Chat, From: sender, To: receiver, Body: "abcd"})
+	receiveAck(t, clients[sender])
+
+	// 引用
+	quote := &ws.Content{Kind: ws.ContentQuote, Text: "efgh", ParentID: id}
+	send(t, ws.Chat, ws.ChatMsg{To: receiver, Content: quote}, clients[sender])
+	receiveChatMessage(t, clients[receiver], ws.ChatMsg{Type: ws.Chat, From: sender, To: receiver,
+		Body: "efgh", Content: quote})
+	receiveAck(t, clients[sender])
+
+	tests := []struct {
+		msg      ws.ChatMsg
+		msgType  int
+		expected error
+	}{
+		// 图片缺少文件ID
+		{ws.ChatMsg{To: receiver, Content: &ws.Content{Kind: ws.ContentImage}}, ws.Chat, errorsx.ErrInvalidContent},
+		{ws.ChatMsg{To: receiver, Content: &ws.Content{Kind: "video", FileID: fileID}}, ws.Chat, errorsx.ErrInvalidContent},
+		// 其他人上传且没有发送到自己所在会话中的文件
+		{ws.ChatMsg{To: receiver, Content: &ws.Content{Kind: ws.ContentFile, FileID: other, Name: "b.txt"}}, ws.Chat, errorsx.ErrPermissiondenied},
+		{ws.ChatMsg{To: receiver, Content: &ws.Content{Kind: ws.ContentImage, FileID: "not-exist"}}, ws.Chat, errorsx.ErrPermissiondenied},
+		// 引用其他会话的消息
+		{ws.ChatMsg{To: receiver + 1, Content: &ws.Content{Kind: ws.ContentQuote, Text: "a", ParentID: id}}, ws.Chat, errorsx.ErrMessageNotFound},
+		// 只能编辑文本消息
+		{ws.ChatMsg{ID: id, Body: "ijkl"}, ws.Edit, errorsx.ErrCantEditContent},
+	}
+	for i, tt := range tests {
+		t.Run(fmt.Sprintf("invalid content %d", i), func(t *testing.T) {
+			if tt.msg.ID == "" {
+				tt.msg.ID = uuid.NewString()
+			}
+			send(t, tt.msgType, tt.msg, clients[sender])
+			receiveErrorMessage(t, clients[sender], ws.ErrorMsg{Type: ws.Error, ID: tt.msg.ID,
+				Code: errorsx.GetStatusCode(tt.expected), Message: tt.expected.Error()})
+		})
+	}
+}
+
+func TestMention(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	clearMessageData()
+	defer shutdownWebsocket()
+
+	var sender, receiver, gid uint = 100001, 100002, uint(1e9 + 1)
+	registerClientToWs(t, sender)
+	registerClientToWs(t, receiver)
+	waitingForClientsRegisterComplete(t, 2)
+	s.Cache().Remove(model.CacheGroup + strconv.FormatUint(uint64(gid), 10))
+	s.Cache().AddMember(gid, sender, model.GroupRoleMember)
+	s.Cache().AddMember(gid, receiver, model.GroupRoleMember)
+	s.Cache().Flush()
+
+	// 提及非群组成员
+	id := uuid.NewString()
+	send(t, ws.Broadcast, ws.ChatMsg{ID: id, To: gid, Body: "abcd", Mentions: []uint{100003}}, clients[sender])
+	receiveErrorMessage(t, clients[sender], ws.ErrorMsg{Type: ws.Error, ID: id,
+		Code: errorsx.GetStatusCode(errorsx.ErrMentionNotMember), Message: errorsx.ErrMentionNotMember.Error()})
+
+	// 提及自己会被忽略
+	id = uuid.NewString()
+	send(t, ws.Broadcast, ws.ChatMsg{ID: id, To: gid, Body: "abcd", Mentions: []uint{receiver, sender}}, clients[sender])
+	clients[receiver].SetReadDeadline(time.Now().Add(time.Second * 5))
+	receiveChatMessage(t, clients[receiver], ws.ChatMsg{ID: id, Type: ws.Broadcast, From: sender, To: receiver,
+		Body: "abcd", Extra: float64(gid), Mentions: []uint{receiver}})
+	receiveChatMessage(t, clients[receiver], ws.ChatMsg{ID: id, Type: ws.Mention, From: sender, To: gid, Body: "abcd"})
+
+	msg, err := s.Message().Get(id)
+	assert.NoError(t, err)
+	assert.Equal(t, "[100002]", msg.Mentions)
+}
+
+func receiveReaction(t *testing.T, conn *websocket.Conn, msgType int, expected ws.ReactionDelta) {
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	_, p, err := conn.ReadMessage()
+	assert.NoError(t, err)
+	var message ws.Message
+	json.Unmarshal(p, &message)
+	assert.Equal(t, msgType, message.Type)
+	var msg ws.ChatMsg
+	json.Unmarshal(message.Body, &msg)
+	assert.Equal(t, expected.Emoji, msg.Body)
+	assert.Equal(t, &expected, msg.Reaction)
+}
+
+func TestReaction(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	clearMessageData()
+	defer shutdownWebsocket()
+
+	var sender, receiver uint = 100001, 100002
+	registerClientToWs(t, sender)
+	registerClientToWs(t, receiver)
+	waitingForClientsRegisterComplete(t, 2)
+
+	msg := &model.Message{MsgID: uuid.NewString(), Type: ws.Chat, Sender: sender, Receiver: receiver,
+		Body: "abcd", Time: time.Now().UnixMilli()}
+	assert.NoError(t, s.Message().Create(msg))
+
+	// websocket添加,会话双方都会收到变化
+	send(t, ws.ReactionAdd, ws.ReactionMsg{ID: msg.MsgID, Emoji: "👍"}, clients[receiver])
+	expected := ws.ReactionDelta{MessageID: msg.MsgID, Emoji: "👍", Count: 1}
+	receiveReaction(t, clients[sender], ws.ReactionAdd, expected)
+	receiveReaction(t, clients[receiver], ws.ReactionAdd, expected)
+
+	// 不同的表情分别计数
+	url := fmt.Sprintf("/api/v1/messages/%s/reactions", msg.MsgID)
+	body, _ := json.Marshal(map[string]string{"emoji": "👎"})
+	resp := testNoError(t, route, url, "POST", sender, bytes.NewBuffer(body))
+	assert.Equal(t, float64(1), resp["data"].(map[string]any)["count"])
+	receiveReaction(t, clients[receiver], ws.ReactionAdd, ws.ReactionDelta{MessageID: msg.MsgID, Emoji: "👎", Count: 1})
+	body, _ = json.Marshal(map[string]string{"emoji": "👍"})
+	resp = testNoError(t, route, url, "POST", sender, bytes.NewBuffer(body))
+	assert.Equal(t, float64(2), resp["data"].(map[string]any)["count"])
+	receiveReaction(t, clients[receiver], ws.ReactionAdd, ws.ReactionDelta{MessageID: msg.MsgID, Emoji: "👍", Count: 2})
+
+	// 重复回应
+	body, _ = json.Marshal(map[string]string{"emoji": "👍"})
+	testHasError(t, route, url, "POST", sender, bytes.NewBuffer(body), errorsx.ErrAlreadyReacted)
+
+	reactions, err := s.Message().Reactions(msg.MsgID, receiver)
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.ReactionCount{
+		{MsgID: msg.MsgID, Emoji: "👍", Count: 2, Reacted: true},
+		{MsgID: msg.MsgID, Emoji: "👎", Count: 1, Reacted: false},
+	}, reactions)
+
+	// 取消
+	testNoError(t, route, url, "DELETE", receiver, nil, map[string]string{"emoji": "👍"})
+	testHasError(t, route, url, "DELETE", receiver, nil, errorsx.ErrReactionNotFound, map[string]string{"emoji": "👍"})
+	testNoError(t, route, url, "DELETE", sender, nil, map[string]string{"emoji": "👎"})
+	receiveReaction(t, clients[receiver], ws.ReactionRemove, ws.ReactionDelta{MessageID: msg.MsgID, Emoji: "👍", Count: 1})
+	receiveReaction(t, clients[receiver], ws.ReactionRemove, ws.ReactionDelta{MessageID: msg.MsgID, Emoji: "👎", Count: 0})
+	reactions, err = s.Message().Reactions(msg.MsgID, receiver)
+	assert.NoError(t, err)
+	assert.Equal(t, []*model.ReactionCount{{MsgID: msg.MsgID, Emoji: "👍", Count: 1}}, reactions)
+
+	// 不是会话的参与者
+	testHasError(t, route, url, "GET", 100003, nil, errorsx.ErrMessageNotFound)
+	send(t, ws.ReactionAdd, ws.ReactionMsg{ID: msg.MsgID, Emoji: "a b"}, clients[receiver])
+	receiveErrorMessage(t, clients[receiver], ws.ErrorMsg{Type: ws.Error, ID: msg.MsgID,
+		Code: errorsx.GetStatusCode(errorsx.ErrInvalidParams), Message: errorsx.ErrInvalidParams.Error()})
+}
+
+// 跳过确认消息,读取下一条群聊消息
+func receiveBroadcast(t *testing.T, conn *websocket.Conn) ws.ChatMsg {
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	for {
+		_, p, err := conn.ReadMessage()
+		if !assert.NoError(t, err) {
+			return ws.ChatMsg{}
+		}
+		var message ws.Message
+		json.Unmarshal(p, &message)
+		if message.Type == ws.Ack {
+			continue
+		}
+		assert.Equal(t, ws.Broadcast, message.Type)
+		var msg ws.ChatMsg
+		json.Unmarshal(message.Body, &msg)
+		return msg
+	}
+}
+
+func TestThread(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	clearMessageData()
+	defer shutdownWebsocket()
+
+	var author, replier, other, gid uint = 100001, 100002, 100003, uint(1e9 + 1)
+	for _, id := range []uint{author, replier, other} {
+		registerClientToWs(t, id)
+	}
+	waitingForClientsRegisterComplete(t, 3)
+	s.Cache().Remove(model.CacheGroup + strconv.FormatUint(uint64(gid), 10))
+	for _, id := range []uint{author, replier, other} {
+		s.Cache().AddMember(gid, id, model.GroupRoleMember)
+	}
+	s.Cache().Flush()
+
+	parent := &model.Message{MsgID: uuid.NewString(), Type: ws.Broadcast, Sender: author, GroupID: gid,
+		Body: "abcd", Time: time.Now().UnixMilli()}
+	assert.NoError(t, s.Message().Create(parent))
+
+	// 第一次回复只发给回复者和原消息作者
+	first := uuid.NewString()
+	send(t, ws.Broadcast, ws.ChatMsg{ID: first, To: gid, Body: "reply 1", ThreadID: parent.MsgID}, clients[replier])
+	for _, id := range []uint{author, replier} {
+		msg := receiveBroadcast(t, clients[id])
+		assert.Equal(t, first, msg.ID)
+		assert.Equal(t, parent.MsgID, msg.ThreadID)
+	}
+
+	// 订阅后收到之后的回复
+	url := fmt.Sprintf("/api/v1/messages/%s/thread/subscription", parent.MsgID)
+	testNoError(t, route, url, "PUT", other, nil, map[string]string{"subscribed": "true"})
+	second := uuid.NewString()
+	send(t, ws.Broadcast, ws.ChatMsg{ID: second, To: gid, Body: "reply 2", ThreadID: parent.MsgID}, clients[author])
+	for _, id := range []uint{author, replier, other} {
+		msg := receiveBroadcast(t, clients[id])
+		assert.Equal(t, second, msg.ID)
+	}
+
+	url = fmt.Sprintf("/api/v1/messages/%s/thread", parent.MsgID)
+	body, _ := json.Marshal(model.Cursor{PageSize: 10, HasMore: true})
+	resp := testNoError(t, route, url, "GET", other, bytes.NewBuffer(body))
+	data := resp["data"].(map[string]any)
+	assert.Equal(t, float64(2), data["parent"].(map[string]any)["reply_count"])
+	assert.NotZero(t, data["parent"].(map[string]any)["last_reply_at"])
+	assert.Len(t, data["data"], 2)
+
+	// 回复不出现在群聊记录中
+	messages, _, err := s.Message().GroupMessages(gid, &model.Cursor{PageSize: 10})
+	assert.NoError(t, err)
+	assert.Len(t, messages, 1)
+
+	// 不能回复话题回复
+	id := uuid.NewString()
+	send(t, ws.Broadcast, ws.ChatMsg{ID: id, To: gid, Body: "abcd", ThreadID: first}, clients[other])
+	receiveErrorMessage(t, clients[other], ws.ErrorMsg{Type: ws.Error, ID: id,
+		Code: errorsx.GetStatusCode(errorsx.ErrInvalidThread), Message: errorsx.ErrInvalidThread.Error()})
+}
+
+func TestScheduledMessage(t *testing.T) {
+	startWebsocket()
+	clearWebsocket()
+	clearMessageData()
+	defer shutdownWebsocket()
+
+	var a, b uint = 100001, 100002
+	registerClientToWs(t, a)
+	registerClientToWs(t, b)
+	waitingForClientsRegisterComplete(t, 2)
+
+	sendAt := time.Now().Add(2 * time.Second).UnixMilli()
+	first, second := uuid.NewString(), uuid.NewString()
+	for _, id := range []string{first, second} {
+		send(t, ws.Chat, ws.ChatMsg{ID: id, To: b, Body: "abcd", SendAt: sendAt}, clients[a])
+		clients[a].SetReadDeadline(time.Now().Add(time.Second * 5))
+		receiveChatMessage(t, clients[a], ws.ChatMsg{ID: id, Type: ws.Scheduled, From: a, To: b, Body: "abcd", SendAt: sendAt})
+	}
+
+	resp := testNoError(t, route, "/api/v1/messages/scheduled", "GET", a, nil)
+	assert.Len(t, resp["data"], 2)
+	url := "/api/v1/messages/scheduled/" + second
+	testHasError(t, route, url, "DELETE", b, nil, errorsx.ErrScheduledNotFound)
+	testNoError(t, route, url, "DELETE", a, nil)
+	testHasError(t, route, url, "DELETE", a, nil, errorsx.ErrScheduledNotFound)
+
+	// 到期后只发送未取消的消息
+	clients[b].SetReadDeadline(time.Now().Add(time.Second * 5))
+	receiveChatMessage(t, clients[b], ws.ChatMsg{ID: first, Type: ws.Chat, From: a, To: b, Body: "abcd"})
+	clients[a].SetReadDeadline(time.Now().Add(time.Second * 5))
+	_, p, err := clients[a].ReadMessage()
+	assert.NoError(t, err)
+	var ack ws.Message
+	json.Unmarshal(p, &ack)
+	assert.Equal(t, ws.Ack, ack.Type)
+	resp = testNoError(t, route, "/api/v1/messages/scheduled", "GET", a, nil)
+	assert.Len(t, resp["data"], 0)
+
+	// 超出最长延后时间
+	id := uuid.NewString()
+	far := time.Now().Add(s.Config().Common().MaxScheduleDelay() + time.Hour).UnixMilli()
+	send(t, ws.Chat, ws.ChatMsg{ID: id, To: b, Body: "abcd", SendAt: far}, clients[a])
+	receiveErrorMessage(t, clients[a], ws.ErrorMsg{Type: ws.Error, ID: id,
+		Code: errorsx.GetStatusCode(errorsx.ErrInvalidSendAt), Message: errorsx.ErrInvalidSendAt.Error()})
+}
@@ -34,18 +34,32 @@ type Config interface {
 func GenerateDefaultConfig(path string) *config_ {
 	cfg := &config_{
 		Common_: &Common_{
-			HttpPort_:          "8080",
-			ManagerPort_:       "9000",
-			Path_:              path,
-			LogDir_:            "./chat/log/",
-			RetryDelay_:        400 * time.Millisecond,
-			JitterCoeff_:       0.5,
-			MaxRetries_:        3,
-			InviteValidDays_:   7,
-			TokenValidPeriod_:  48 * time.Hour,
-			CheckAckTimeout_:   time.Second * 2,
-			MessageAckTiemout_: time.Second * 3,
-			ResendBatchSize_:   100,
+			HttpPort_:            "8080",
+			ManagerPort_:         "9000",
+			Path_:                path,
+			LogDir_:              "./chat/log/",
+			RetryDelay_:          400 * time.Millisecond,
+			JitterCoeff_:         0.5,
+			MaxRetries_:          3,
+			InviteValidDays_:     7,
+			TokenValidPeriod_:    48 * time.Hour,
+			CheckAckTimeout_:     time.Second * 2,
+			MessageAckTiemout_:   time.Second * 3,
+			ResendBatchSize_:     100,
+			StrangerMessage_:     StrangerMessageAllow,
+			MessageModifyWindow_: 2 * time.Minute,
+			NodeHeartbeat_:       3 * time.Second,
+			NodeTimeout_:         10 * time.Second,
+			PingInterval_:        30 * time.Second,
+			PongWait_:            60 * time.Second,
+			WriteWait_:           10 * time.Second,
+			SendQueueSize_:       256,
+			SendQueuePolicy_:     SendQueueDropOldest,
+			Compression_:         true,
+			CompressThreshold_:   512,
+			ScheduleInterval_:    time.Second,
+			MaxScheduleDelay_:    30 * 24 * time.Hour,
+			PurgeInterval_:       time.Minute,
 		},
 		Database_: &Database_{},
 		Cache_: &Cache_{
@@ -55,9 +69,16 @@ func GenerateDefaultConfig(path string) *config_ {
 			RetryDelay_:         time.Millisecond * 10,
 		},
 		FileServer_: &FileServer_{
-			Addr_:    "http://localhost:3000/",
-			Path_:    "./chat/storage/files/",
-			LogPath_: "./chat/storage/storage.log",
+			Backend_:      BackendLocal,
+			Region_:       "us-east-1",
+			Addr_:         "http://localhost:3000/",
+			Path_:         "./chat/storage/files/",
+			LogPath_:      "./chat/storage/storage.log",
+			LinkTTL_:      time.Hour,
+			ChunkSize_:    5 << 20,
+			UploadExpiry_: 24 * time.Hour,
+			MaxFileSize_:  1 << 30,
+			QuotaBytes_:   10 << 30,
 		},
 	}
 	cfg.getENV()
@@ -173,12 +194,24 @@ func (cfg *config_) getENV() {
 		db, _ := strconv.Atoi(dbNum)
 		cfg.Cache_.DbNum_ = db
 	}
+	if nodeID := os.Getenv("CHAT_NODE_ID"); nodeID != "" {
+		cfg.Common_.NodeID_ = nodeID
+	}
 	if fsPath := os.Getenv("CHAT_STORAGE_PATH"); fsPath != "" {
 		cfg.FileServer_.Path_ = fsPath
 	}
 	if fsLogPath := os.Getenv("CHAT_STORAGE_LOG"); fsLogPath != "" {
 		cfg.FileServer_.LogPath_ = fsLogPath
 	}
+	if secret := os.Getenv("CHAT_STORAGE_SECRET"); secret != "" {
+		cfg.FileServer_.LinkSecret_ = secret
+	}
+	if ak := os.Getenv("CHAT_S3_ACCESS_KEY"); ak != "" {
+		cfg.FileServer_.AccessKey_ = ak
+	}
+	if sk := os.Getenv("CHAT_S3_SECRET_KEY"); sk != "" {
+		cfg.FileServer_.SecretKey_ = sk
+	}
 }
 
 func GetConfig() Config {
@@ -204,7 +237,7 @@ func (cfg *config_) Get() map[string]any {
 		for k, v := range m {
 			if val, ok := v.(map[string]any); ok {
 				handler(val)
-			} else if k == "password" {
+			} else if k == "password" || k == "link_secret" || k == "secret_key" {
 				delete(m, k)
 			}
 		}
@@ -305,6 +338,121 @@ func (cfg *config_) SetCommon(k, v string) error {
 			return errors.New("resend_batch_size的值必须大于0")
 		}
 		cfg.Common_.ResendBatchSize_ = val
+	case "stranger_message":
+		if v != StrangerMessageAllow && v != StrangerMessageDeny {
+			return errors.New("stranger_message的值必须是allow或deny")
+		}
+		cfg.Common_.StrangerMessage_ = v
+	case "message_modify_window":
+		t, err := cfg.convertToTime(v)
+		if err != nil {
+			return err
+		}
+		if t <= 0 {
+			return errors.New("撤回和编辑时限太短")
+		}
+		cfg.Common_.MessageModifyWindow_ = t
+	case "node_heartbeat":
+		t, err := cfg.convertToTime(v)
+		if err != nil {
+			return err
+		}
+		if t <= 0 {
+			return errors.New("节点心跳间隔太短")
+		}
+		if t >= cfg.Common_.NodeTimeout_ {
+			return errors.New("node_heartbeat必须小于node_timeout")
+		}
+		cfg.Common_.NodeHeartbeat_ = t
+	case "node_timeout":
+		t, err := cfg.convertToTime(v)
+		if err != nil {
+			return err
+		}
+		if t <= cfg.Common_.NodeHeartbeat_ {
+			return errors.New("node_timeout必须大于node_heartbeat")
+		}
+		cfg.Common_.NodeTimeout_ = t
+	case "ping_interval":
+		t, err := cfg.convertToTime(v)
+		if err != nil {
+			return err
+		}
+		if t <= 0 {
+			return errors.New("心跳间隔太短")
+		}
+		if t >= cfg.Common_.PongWait_ {
+			return errors.New("ping_interval必须小于pong_wait")
+		}
+		cfg.Common_.PingInterval_ = t
+	case "pong_wait":
+		t, err := cfg.convertToTime(v)
+		if err != nil {
+			return err
+		}
+		if t <= cfg.Common_.PingInterval_ {
+			return errors.New("pong_wait必须大于ping_interval")
+		}
+		cfg.Common_.PongWait_ = t
+	case "write_wait":
+		t, err := cfg.convertToTime(v)
+		if err != nil {
+			return err
+		}
+		if t <= 0 {
+			return errors.New("写超时太短")
+		}
+		cfg.Common_.WriteWait_ = t
+	case "send_queue_size":
+		val, _ := strconv.Atoi(v)
+		if val < 1 {
+			return errors.New("send_queue_size的值必须大于0")
+		}
+		cfg.Common_.SendQueueSize_ = val
+	case "send_queue_policy":
+		if v != SendQueueDropOldest && v != SendQueueDisconnect {
+			return errors.New("send_queue_policy的值必须是drop_oldest或disconnect")
+		}
+		cfg.Common_.SendQueuePolicy_ = v
+	case "compression":
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New("compression的值必须是true或false")
+		}
+		cfg.Common_.Compression_ = b
+	case "compression_threshold":
+		val, err := strconv.Atoi(v)
+		if err != nil || val < 0 {
+			return errors.New("compression_threshold的值不能小于0")
+		}
+		cfg.Common_.CompressThreshold_ = val
+	case "schedule_interval":
+		t, err := cfg.convertToTime(v)
+		if err != nil {
+			return err
+		}
+		if t <= 0 {
+			return errors.New("定时消息检查间隔太短")
+		}
+		cfg.Common_.ScheduleInterval_ = t
+	case "max_schedule_delay":
+		t, err := cfg.convertToTime(v)
+		if err != nil {
+			return err
+		}
+		if t < time.Minute {
+			return errors.New("max_schedule_delay不能小于1分钟")
+		}
+		cfg.Common_.MaxScheduleDelay_ = t
+	case "purge_interval":
+		t, err := cfg.convertToTime(v)
+		if err != nil {
+			return err
+		}
+		if t < time.Second {
+			return errors.New("purge_interval不能小于1秒")
+		}
+		cfg.Common_.PurgeInterval_ = t
 	default:
 		return errorsx.ErrNoSettingOption
 	}
@@ -344,21 +492,47 @@ func (cfg *config_) SetCache(k, v string) error {
 }
 
 type Common_ struct {
-	HttpAddress_       string        `yaml:"http_address" json:"http_address" comment:"服务器地址"`
-	Manager_Address_   string        `yaml:"manager_address" json:"manager_address" comment:"管理服务器地址"`
-	HttpPort_          string        `yaml:"http_port" json:"http_port" comment:"端口"`
-	ManagerPort_       string        `yaml:"manager_port" json:"manager_port" comment:"管理端口"`
-	Path_              string        `yaml:"path" json:"path" comment:"配置文件路径"`
-	LogDir_            string        `yaml:"log_dir" json:"log_dir" comment:"日志目录"`
-	RetryDelay_        time.Duration `yaml:"retry_delay" json:"retry_delay" comment:"重试退避基数"`
-	JitterCoeff_       float64       `yaml:"jitter_coeff" json:"jitter_coeff" comment:"重试退避抖动系数"`
-	MaxRetries_        int           `yaml:"max_retries" json:"max_retries" comment:"最大重试次数"`
-	InviteValidDays_   int           `yaml:"invite_valid_days" json:"invite_valid_days" comment:"群组邀请有效期"`
-	TokenValidPeriod_  time.Duration `yaml:"token_valid_period" json:"token_valid_period" comment:"token有效期"`
-	CheckAckTimeout_   time.Duration `yaml:"check_ack_timeout" json:"check_ack_timeout" comment:"检查未确认消息的间隔"`
-	MessageAckTiemout_ time.Duration `yaml:"message_ack_timeout" json:"message_ack_timeout" comment:"等待确认的消息的超时时间"`
-	ResendBatchSize_   int64         `yaml:"resend_batch_size" json:"resend_batch_size" comment:"获取未确认消息用于重发的批大小"`
-}
+	HttpAddress_         string        `yaml:"http_address" json:"http_address" comment:"服务器地址"`
+	Manager_Address_     string        `yaml:"manager_address" json:"manager_address" comment:"管理服务器地址"`
+	HttpPort_            string        `yaml:"http_port" json:"http_port" comment:"端口"`
+	ManagerPort_         string        `yaml:"manager_port" json:"manager_port" comment:"管理端口"`
+	Path_                string        `yaml:"path" json:"path" comment:"配置文件路径"`
+	LogDir_              string        `yaml:"log_dir" json:"log_dir" comment:"日志目录"`
+	RetryDelay_          time.Duration `yaml:"retry_delay" json:"retry_delay" comment:"重试退避基数"`
+	JitterCoeff_         float64       `yaml:"jitter_coeff" json:"jitter_coeff" comment:"重试退避抖动系数"`
+	MaxRetries_          int           `yaml:"max_retries" json:"max_retries" comment:"最大重试次数"`
+	InviteValidDays_     int           `yaml:"invite_valid_days" json:"invite_valid_days" comment:"群组邀请有效期"`
+	TokenValidPeriod_    time.Duration `yaml:"token_valid_period" json:"token_valid_period" comment:"token有效期"`
+	CheckAckTimeout_     time.Duration `yaml:"check_ack_timeout" json:"check_ack_timeout" comment:"检查未确认消息的间隔"`
+	MessageAckTiemout_   time.Duration `yaml:"message_ack_timeout" json:"message_ack_timeout" comment:"等待确认的消息的超时时间"`
+	ResendBatchSize_     int64         `yaml:"resend_batch_size" json:"resend_batch_size" comment:"获取未确认消息用于重发的批大小"`
+	StrangerMessage_     string        `yaml:"stranger_message" json:"stranger_message" comment:"是否允许非好友发送单聊消息: allow/deny"`
+	MessageModifyWindow_ time.Duration `yaml:"message_modify_window" json:"message_modify_window" comment:"消息发出后允许撤回和编辑的时限"`
+	Cluster_             bool          `yaml:"cluster" json:"cluster" comment:"集群模式,多个节点通过redis转发消息,修改后需要重启"`
+	NodeID_              string        `yaml:"node_id" json:"node_id" comment:"集群节点ID,为空时启动时随机生成,不能包含|"`
+	NodeHeartbeat_       time.Duration `yaml:"node_heartbeat" json:"node_heartbeat" comment:"集群节点心跳间隔"`
+	NodeTimeout_         time.Duration `yaml:"node_timeout" json:"node_timeout" comment:"集群节点超过该时间没有心跳视为下线,清理其路由"`
+	PingInterval_        time.Duration `yaml:"ping_interval" json:"ping_interval" comment:"向websocket客户端发送ping的间隔"`
+	PongWait_            time.Duration `yaml:"pong_wait" json:"pong_wait" comment:"超过该时间没有收到客户端的pong或消息视为断线"`
+	WriteWait_           time.Duration `yaml:"write_wait" json:"write_wait" comment:"websocket写超时,超时视为断线"`
+	SendQueueSize_       int           `yaml:"send_queue_size" json:"send_queue_size" comment:"每个websocket连接的发送队列长度,修改后对新连接生效"`
+	SendQueuePolicy_     string        `yaml:"send_queue_policy" json:"send_queue_policy" comment:"发送队列已满时的处理: drop_oldest(最早的消息转为离线消息)/disconnect(断开连接)"`
+	Compression_         bool          `yaml:"compression" json:"compression" comment:"客户端支持permessage-deflate时是否压缩websocket消息"`
+	CompressThreshold_   int           `yaml:"compression_threshold" json:"compression_threshold" comment:"小于该字节数的websocket消息不压缩"`
+	ScheduleInterval_    time.Duration `yaml:"schedule_interval" json:"schedule_interval" comment:"检查到期定时消息的间隔"`
+	MaxScheduleDelay_    time.Duration `yaml:"max_schedule_delay" json:"max_schedule_delay" comment:"定时消息最多可以延后发送的时间"`
+	PurgeInterval_       time.Duration `yaml:"purge_interval" json:"purge_interval" comment:"删除超过保留时间的消息的间隔"`
+}
+
+const (
+	StrangerMessageAllow = "allow"
+	StrangerMessageDeny  = "deny"
+)
+
+const (
+	SendQueueDropOldest = "drop_oldest"
+	SendQueueDisconnect = "disconnect"
+)
 
 type Common interface {
 	HttpPort() string
@@ -373,6 +547,22 @@ type Common interface {
 	CheckAckTimeout() time.Duration
 	MessageAckTiemout() time.Duration
 	ResendBatchSize() int64
+	AllowStrangerMessage() bool
+	MessageModifyWindow() time.Duration
+	Cluster() bool
+	NodeID() string
+	NodeHeartbeat() time.Duration
+	NodeTimeout() time.Duration
+	PingInterval() time.Duration
+	PongWait() time.Duration
+	WriteWait() time.Duration
+	SendQueueSize() int
+	SendQueuePolicy() string
+	Compression() bool
+	CompressionThreshold() int
+	ScheduleInterval() time.Duration
+	MaxScheduleDelay() time.Duration
+	PurgeInterval() time.Duration
 }
 
 func (c *Common_) HttpPort() string {
@@ -423,6 +613,70 @@ func (c *Common_) ResendBatchSize() int64 {
 	return c.ResendBatchSize_
 }
 
+func (c *Common_) AllowStrangerMessage() bool {
+	return c.StrangerMessage_ != StrangerMessageDeny
+}
+
+func (c *Common_) MessageModifyWindow() time.Duration {
+	return c.MessageModifyWindow_
+}
+
+func (c *Common_) Cluster() bool {
+	return c.Cluster_
+}
+
+func (c *Common_) NodeID() string {
+	return c.NodeID_
+}
+
+func (c *Common_) NodeHeartbeat() time.Duration {
+	return c.NodeHeartbeat_
+}
+
+func (c *Common_) NodeTimeout() time.Duration {
+	return c.NodeTimeout_
+}
+
+func (c *Common_) PingInterval() time.Duration {
+	return c.PingInterval_
+}
+
+func (c *Common_) PongWait() time.Duration {
+	return c.PongWait_
+}
+
+func (c *Common_) WriteWait() time.Duration {
+	return c.WriteWait_
+}
+
+func (c *Common_) SendQueueSize() int {
+	return c.SendQueueSize_
+}
+
+func (c *Common_) SendQueuePolicy() string {
+	return c.SendQueuePolicy_
+}
+
+func (c *Common_) Compression() bool {
+	return c.Compression_
+}
+
+func (c *Common_) CompressionThreshold() int {
+	return c.CompressThreshold_
+}
+
+func (c *Common_) ScheduleInterval() time.Duration {
+	return c.ScheduleInterval_
+}
+
+func (c *Common_) MaxScheduleDelay() time.Duration {
+	return c.MaxScheduleDelay_
+}
+
+func (c *Common_) PurgeInterval() time.Duration {
+	return c.PurgeInterval_
+}
+
 type Database_ struct {
 	Host_     string `yaml:"host" json:"host"`
 	Port_     string `yaml:"port" json:"port"`
@@ -502,16 +756,57 @@ func (cfg *Cache_) RetryDelay(n int) time.Duration {
 	return cfg.RetryDelay_ * (1 << n)
 }
 
+// 文件储存后端
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
 type FileServer_ struct {
+	Backend_ string `yaml:"backend" json:"backend" comment:"文件储存后端: local,s3"`
 	Addr_    string `yaml:"addr" json:"addr" comment:"文件储存系统地址,本地储存无需配置"`
 	Path_    string `yaml:"path" json:"path" comment:"文件储存目录"`
 	LogPath_ string `yaml:"log_path" comment:"文件储存系统日志"`
+	// 多节点部署时需要使用相同的密钥
+	LinkSecret_   string        `yaml:"link_secret" json:"-" comment:"下载链接签名密钥,为空时每次启动随机生成"`
+	LinkTTL_      time.Duration `yaml:"link_ttl" json:"link_ttl" comment:"下载链接有效期"`
+	ChunkSize_    int64         `yaml:"chunk_size" json:"chunk_size" comment:"分片上传的分片大小(字节)"`
+	UploadExpiry_ time.Duration `yaml:"upload_expiry" json:"upload_expiry" comment:"分片上传超过该时间没有新的分片时清理"`
+	// 限额为-1时不限制,为0时使用默认值
+	MaxFileSize_  int64  `yaml:"max_file_size" json:"max_file_size" comment:"单个文件的最大字节数,-1不限制"`
+	QuotaBytes_   int64  `yaml:"quota_bytes" json:"quota_bytes" comment:"每个用户可以使用的字节数,-1不限制"`
+	QuotaFiles_   int64  `yaml:"quota_files" json:"quota_files" comment:"每个用户可以上传的文件数,0或-1不限制"`
+	AllowedTypes_ string `yaml:"allowed_types" json:"allowed_types" comment:"允许上传的文件类型,逗号分隔,如image/*,application/pdf,为空时允许所有类型"`
+	DeniedTypes_  string `yaml:"denied_types" json:"denied_types" comment:"禁止上传的文件类型,逗号分隔,优先于allowed_types"`
+	// 对象储存的地址为addr,path用作上传时的临时目录
+	Bucket_    string `yaml:"bucket" json:"bucket" comment:"对象储存的bucket"`
+	Region_    string `yaml:"region" json:"region" comment:"对象储存的区域"`
+	AccessKey_ string `yaml:"access_key" json:"access_key" comment:"对象储存的access key"`
+	SecretKey_ string `yaml:"secret_key" json:"-" comment:"对象储存的secret key"`
 }
 
 type FileServer interface {
+	Backend() string
 	Addr() string
 	Path() string
 	LogPath() string
+	LinkSecret() string
+	LinkTTL() time.Duration
+	ChunkSize() int64
+	UploadExpiry() time.Duration
+	MaxFileSize() int64
+	QuotaBytes() int64
+	QuotaFiles() int64
+	AllowedTypes() []string
+	DeniedTypes() []string
+	Bucket() string
+	Region() string
+	AccessKey() string
+	SecretKey() string
+}
+
+func (fs *FileServer_) Backend() string {
+	return fs.Backend_
 }
 
 func (fs *FileServer_) Addr() string {
@@ -526,6 +821,68 @@ func (fs *FileServer_) LogPath() string {
 	return fs.LogPath_
 }
 
+func (fs *FileServer_) LinkSecret() string {
+	return fs.LinkSecret_
+}
+
+func (fs *FileServer_) LinkTTL() time.Duration {
+	return fs.LinkTTL_
+}
+
+func (fs *FileServer_) ChunkSize() int64 {
+	return fs.ChunkSize_
+}
+
+func (fs *FileServer_) UploadExpiry() time.Duration {
+	return fs.UploadExpiry_
+}
+
+func (fs *FileServer_) MaxFileSize() int64 {
+	return fs.MaxFileSize_
+}
+
+func (fs *FileServer_) QuotaBytes() int64 {
+	return fs.QuotaBytes_
+}
+
+func (fs *FileServer_) QuotaFiles() int64 {
+	return fs.QuotaFiles_
+}
+
+func (fs *FileServer_) AllowedTypes() []string {
+	return splitTypes(fs.AllowedTypes_)
+}
+
+func (fs *FileServer_) DeniedTypes() []string {
+	return splitTypes(fs.DeniedTypes_)
+}
+
+func splitTypes(s string) []string {
+	var types []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+func (fs *FileServer_) Bucket() string {
+	return fs.Bucket_
+}
+
+func (fs *FileServer_) Region() string {
+	return fs.Region_
+}
+
+func (fs *FileServer_) AccessKey() string {
+	return fs.AccessKey_
+}
+
+func (fs *FileServer_) SecretKey() string {
+	return fs.SecretKey_
+}
+
 func (cfg *config_) convertToTime(s string) (time.Duration, error) {
 	t, err := time.ParseDuration(s)
 	if err != nil {
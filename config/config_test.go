@@ -29,7 +29,7 @@ func getConfigFromDisk(t *testing.T) map[string]any {
 	for _, v := range cfgMap {
 		assert.NotEmpty(t, v)
 		for kk := range v.(map[string]any) {
-			if kk == "password" {
+			if kk == "password" || kk == "link_secret" || kk == "secret_key" {
 				delete(v.(map[string]any), kk)
 			}
 		}
@@ -72,6 +72,36 @@ func TestSetCommon(t *testing.T) {
 		{"set max_retries", "max_retries", "1", nil},
 		{"set invite_valid_days", "invite_valid_days", "1", nil},
 		{"set token_valid_period", "token_valid_period", "24h", nil},
+		{"set stranger_message", "stranger_message", "none", errors.New("stranger_message的值必须是allow或deny")},
+		{"set stranger_message", "stranger_message", "deny", nil},
+		{"set message_modify_window", "message_modify_window", "0s", errors.New("撤回和编辑时限太短")},
+		{"set message_modify_window", "message_modify_window", "5m", nil},
+		{"set node_heartbeat", "node_heartbeat", "0s", errors.New("节点心跳间隔太短")},
+		{"set node_heartbeat", "node_heartbeat", "1m", errors.New("node_heartbeat必须小于node_timeout")},
+		{"set node_heartbeat", "node_heartbeat", "2s", nil},
+		{"set node_timeout", "node_timeout", "2s", errors.New("node_timeout必须大于node_heartbeat")},
+		{"set node_timeout", "node_timeout", "8s", nil},
+		{"set ping_interval", "ping_interval", "0s", errors.New("心跳间隔太短")},
+		{"set ping_interval", "ping_interval", "2m", errors.New("ping_interval必须小于pong_wait")},
+		{"set ping_interval", "ping_interval", "20s", nil},
+		{"set pong_wait", "pong_wait", "10s", errors.New("pong_wait必须大于ping_interval")},
+		{"set pong_wait", "pong_wait", "40s", nil},
+		{"set write_wait", "write_wait", "0s", errors.New("写超时太短")},
+		{"set write_wait", "write_wait", "5s", nil},
+		{"set send_queue_size", "send_queue_size", "0", errors.New("send_queue_size的值必须大于0")},
+		{"set send_queue_size", "send_queue_size", "128", nil},
+		{"set send_queue_policy", "send_queue_policy", "block", errors.New("send_queue_policy的值必须是drop_oldest或disconnect")},
+		{"set send_queue_policy", "send_queue_policy", "disconnect", nil},
+		{"set compression", "compression", "yes", errors.New("compression的值必须是true或false")},
+		{"set compression", "compression", "false", nil},
+		{"set compression_threshold", "compression_threshold", "-1", errors.New("compression_threshold的值不能小于0")},
+		{"set compression_threshold", "compression_threshold", "1024", nil},
+		{"set schedule_interval", "schedule_interval", "0s", errors.New("定时消息检查间隔太短")},
+		{"set schedule_interval", "schedule_interval", "500ms", nil},
+		{"set max_schedule_delay", "max_schedule_delay", "10s", errors.New("max_schedule_delay不能小于1分钟")},
+		{"set max_schedule_delay", "max_schedule_delay", "168h", nil},
+		{"set purge_interval", "purge_interval", "10ms", errors.New("purge_interval不能小于1秒")},
+		{"set purge_interval", "purge_interval", "30s", nil},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -93,6 +123,14 @@ func TestSetCommon(t *testing.T) {
 	tokenValidPeriod, err := time.ParseDuration("24h")
 	assert.NoError(t, err)
 	assert.Equal(t, tokenValidPeriod, verity)
+	verity = cfg.Common().AllowStrangerMessage()
+	assert.Equal(t, false, verity)
+	verity = cfg.Common().MessageModifyWindow()
+	assert.Equal(t, 5*time.Minute, verity)
+	verity = cfg.Common().NodeHeartbeat()
+	assert.Equal(t, 2*time.Second, verity)
+	verity = cfg.Common().NodeTimeout()
+	assert.Equal(t, 8*time.Second, verity)
 }
 
 func TestSetCache(t *testing.T) {
@@ -28,6 +28,9 @@ func main() {
 	v1.SetupGroupService(service)
 	v1.SetupFriendService(service)
 	v1.SetupManagerService(service)
+	v1.SetupMessageService(service)
+	v1.SetupKeyService(service)
+	v1.SetupFileService(service)
 
 	managerRouter := router.SetupManagerRouter("release")
 	go func() {
@@ -14,15 +14,18 @@ import (
 var mySigningKey = []byte("go-chat signing")
 var invalidToken = errorsx.ErrInvalidToken.Error()
 
+// Device 为登录设备的ID,同一用户每个设备有独立的token
 type MyClaim struct {
-	ID uint
+	ID     uint
+	Device string
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(id uint) (string, error) {
+func GenerateToken(id uint, device string) (string, error) {
 	expire := config.GetConfig().Common().TokenValidPeriod()
 	claims := MyClaim{
-		ID: id,
+		ID:     id,
+		Device: device,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expire)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -69,6 +72,7 @@ func JWT(status int) gin.HandlerFunc {
 			return
 		}
 		c.Set("from", chaim.ID)
+		c.Set("device", chaim.Device)
 		c.Next()
 	}
 }
@@ -80,7 +84,8 @@ func VerifyTokenInWhitelist(status int) gin.HandlerFunc {
 		pre := "Bearer "
 		token = token[len(pre):]
 		id := c.MustGet("from").(uint)
-		val, err := cache.GetToken(id)
+		device := c.GetString("device")
+		val, err := cache.GetToken(id, device)
 		if err != nil {
 			c.JSON(status, gin.H{
 				"status":  errorsx.GetStatusCode(errorsx.ErrCantParseToken),
@@ -100,3 +105,14 @@ func VerifyTokenInWhitelist(status int) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// 请求带有签名时跳过登录验证,签名由处理函数检查
+func SkipIfSigned(handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("signature") != "" {
+			c.Next()
+			return
+		}
+		handler(c)
+	}
+}
@@ -5,28 +5,39 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-redis/redis"
+	"github.com/google/uuid"
 	"gorm.io/driver/mysql"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/schema"
 )
 
+// Path在本地储存时为文件路径,对象储存时为对象key
+// Width和Height为图片的宽高,其他文件为0
 type File struct {
 	ID         uint   `json:"id" gorm:"primaryKey;autoIncrement"`
 	Name       string `json:"name" gorm:"type:varchar(255);not null"`
 	Path       string `json:"path" gorm:"type:varchar(255);not null"`
 	Hash       string `json:"hash" gorm:"type:varchar(100);not null;column:hash;index:idx_hash"`
+	Size       int64  `json:"size" gorm:"not null;default:0"`
+	MIME       string `json:"mime" gorm:"type:varchar(100);not null;default:'';column:mime"`
+	Width      int    `json:"width" gorm:"not null;default:0"`
+	Height     int    `json:"height" gorm:"not null;default:0"`
 	UploadedBy uint   `json:"uploaded_by" gorm:"not null;column:uploaded_by"`
 	CreatedAt  int64  `json:"created_at" gorm:"autoCreateTime;column:created_at"`
 	DeletedAt  int64  `json:"deleted_at" gorm:"default:null;column:deleted_at"`
 }
 
+// 对外只暴露PublicID,自增ID可以被猜到
 type FileReference struct {
 	ID         uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	PublicID   string `json:"public_id" gorm:"type:varchar(64);uniqueIndex;column:public_id"`
 	FileID     uint   `json:"file_id" gorm:"not null;column:file_id;index:idx_file_id"`
 	Name       string `json:"name" gorm:"type:varchar(255);not null"`
 	UploadedBy uint   `json:"uploaded_by" gorm:"not null;column:uploaded_by"`
@@ -52,10 +63,19 @@ const (
 
 type DB interface {
 	FindFileByHash(hash string) ([]*File, bool, error)
+	// id为引用的公开ID
 	Get(id string) (*File, error)
 	CreateReference(f *FileReference) (uint, error)
-	SaveFile(f *File) (*FileReference, error)
+	SaveFile(f *File, publicID string) (*FileReference, error)
 	Delete(uid uint, fileID string) error
+	// 用户已使用的空间
+	Usage(uid uint) (*Usage, error)
+	// 用户是否引用了该文件
+	Referenced(uid uint, fileID uint) (bool, error)
+	// 没有单独设置时返回ErrNotFound
+	GetQuota(uid uint) (*Quota, error)
+	// q为nil时删除
+	SetQuota(uid uint, q *Quota) error
 	Close()
 }
 
@@ -102,11 +122,15 @@ func setupSQLDB(dialector gorm.Dialector, logger *Logger) (*gorm.DB, *sql.DB, er
 		return nil, nil, err
 	}
 	logger.logger.Println("Connected to database")
-	err = db.AutoMigrate(&File{}, &FileReference{})
+	err = db.AutoMigrate(&File{}, &FileReference{}, &UserQuota{})
 	if err != nil && !strings.Contains(err.Error(), "Duplicate key name") {
 		return nil, nil, err
 	}
 	logger.logger.Println("Database tables migration completed successfully")
+	if err := backfillPublicID(db); err != nil {
+		logger.logger.Printf("Failed to backfill public id: %v\n", err)
+		return nil, nil, err
+	}
 
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -120,6 +144,21 @@ func setupSQLDB(dialector gorm.Dialector, logger *Logger) (*gorm.DB, *sql.DB, er
 	return db, sqlDB, nil
 }
 
+// 为旧的引用生成公开ID
+func backfillPublicID(db *gorm.DB) error {
+	var ids []uint
+	if err := db.Model(&FileReference{}).Where("public_id IS NULL").Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	for _, id := range ids {
+		err := db.Model(&FileReference{}).Where("id = ?", id).Update("public_id", uuid.NewString()).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *sqlDB) HandleError(err error) error {
 	if err == nil {
 		return nil
@@ -159,8 +198,8 @@ func (m *sqlDB) CreateReference(f *FileReference) (uint, error) {
 }
 
 // 保存文件路径
-func (m *sqlDB) SaveFile(f *File) (*FileReference, error) {
-	fileRef := &FileReference{FileID: f.ID, Name: f.Name, UploadedBy: f.UploadedBy}
+func (m *sqlDB) SaveFile(f *File, publicID string) (*FileReference, error) {
+	fileRef := &FileReference{PublicID: publicID, FileID: f.ID, Name: f.Name, UploadedBy: f.UploadedBy}
 	err := m.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(f).Error; err != nil {
 			return err
@@ -178,13 +217,13 @@ func (m *sqlDB) SaveFile(f *File) (*FileReference, error) {
 	return fileRef, m.HandleError(err)
 }
 
-// 获取文件
+// 获取文件,uploaded_by为引用的上传者
 func (m *sqlDB) Get(id string) (*File, error) {
 	var file *File
 	err := m.db.Model(&FileReference{}).
-		Select("file_reference.file_id AS id,file_reference.name,f.path,f.hash").
+		Select("file_reference.file_id AS id,file_reference.name,f.path,f.hash,f.size,f.mime,f.width,f.height,file_reference.uploaded_by").
 		Joins("LEFT JOIN file AS f ON f.id = file_reference.file_id").
-		Where("file_reference.id = ? AND file_reference.deleted_at is null", id).
+		Where("file_reference.public_id = ? AND file_reference.deleted_at is null", id).
 		First(&file).Error
 	if err := m.HandleError(err); err != nil {
 		return nil, err
@@ -196,7 +235,7 @@ func (m *sqlDB) Get(id string) (*File, error) {
 }
 
 func (m *sqlDB) Delete(uid uint, fileID string) error {
-	q := `UPDATE file_reference SET deleted_at = ? WHERE id = ? AND uploaded_by = ?`
+	q := `UPDATE file_reference SET deleted_at = ? WHERE public_id = ? AND uploaded_by = ?`
 	result := m.db.Exec(q, time.Now().Unix(), fileID, uid)
 	if err := m.HandleError(result.Error); err != nil {
 		return err
@@ -207,6 +246,46 @@ func (m *sqlDB) Delete(uid uint, fileID string) error {
 	return nil
 }
 
+// 同一用户引用的相同文件只计算一次大小
+func (m *sqlDB) Usage(uid uint) (*Usage, error) {
+	usage := &Usage{}
+	q := `SELECT
+		(SELECT COUNT(*) FROM file_reference WHERE uploaded_by = ? AND deleted_at IS NULL) AS files,
+		(SELECT COALESCE(SUM(size),0) FROM file WHERE id IN
+			(SELECT file_id FROM file_reference WHERE uploaded_by = ? AND deleted_at IS NULL)) AS bytes`
+	err := m.db.Raw(q, uid, uid).Scan(usage).Error
+	if err := m.HandleError(err); err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+func (m *sqlDB) Referenced(uid uint, fileID uint) (bool, error) {
+	var count int64
+	err := m.db.Model(&FileReference{}).
+		Where("uploaded_by = ? AND file_id = ? AND deleted_at IS NULL", uid, fileID).
+		Count(&count).Error
+	return count > 0, m.HandleError(err)
+}
+
+func (m *sqlDB) GetQuota(uid uint) (*Quota, error) {
+	var uq *UserQuota
+	err := m.db.Where("uid = ?", uid).First(&uq).Error
+	if err := m.HandleError(err); err != nil {
+		return nil, err
+	}
+	return &uq.Quota, nil
+}
+
+func (m *sqlDB) SetQuota(uid uint, q *Quota) error {
+	if q == nil {
+		return m.HandleError(m.db.Where("uid = ?", uid).Delete(&UserQuota{}).Error)
+	}
+	uq := &UserQuota{UID: uid, Quota: *q}
+	err := m.db.Clauses(clause.OnConflict{UpdateAll: true}).Create(uq).Error
+	return m.HandleError(err)
+}
+
 func (m *sqlDB) Close() {
 	m.sqlDB.Close()
 }
@@ -218,6 +297,9 @@ const (
 	FileReferenceKey   = RedisPrefix + "file_reference:"
 	FileReferenceIDKey = RedisPrefix + "file_reference_id"
 	FileHashKey        = RedisPrefix + "file_hash:"
+	// 用户的引用,统计已使用的空间
+	UserFilesKey = RedisPrefix + "user_files:"
+	QuotaKey     = RedisPrefix + "quota:"
 )
 
 type redisDB struct {
@@ -322,6 +404,7 @@ func (r *redisDB) Get(id string) (*File, error) {
 		local file = cjson.decode(fileData)
 		file.id = ref.id
 		file.name = ref.name
+		file.uploaded_by = ref.uploaded_by
 		
 		local res = cjson.encode(file)
 		return res
@@ -346,6 +429,7 @@ func (r *redisDB) CreateReference(f *FileReference) (uint, error) {
 	script := redis.NewScript(`
 		local refIDKey = KEYS[1]
 		local refKey = KEYS[2]
+		local userKey = KEYS[3]
 		local ref = ARGV[1]
 		
 		local refID = redis.call("INCR",refIDKey)
@@ -354,13 +438,14 @@ func (r *redisDB) CreateReference(f *FileReference) (uint, error) {
 		refData.id = refID
 		ref = cjson.encode(refData)
 
-		redis.call("SET",refKey .. refID,ref)
+		redis.call("SET",refKey .. refData.public_id,ref)
+		redis.call("SADD",userKey .. refData.uploaded_by,refData.public_id)
 		return refID
 	`)
 
 	f.CreatedAt = time.Now().Unix()
 	fjson, _ := json.Marshal(f)
-	result, err := script.Run(r.client, []string{FileReferenceIDKey, FileReferenceKey}, fjson).Result()
+	result, err := script.Run(r.client, []string{FileReferenceIDKey, FileReferenceKey, UserFilesKey}, fjson).Result()
 	if err != nil {
 		return 0, r.handleError(err)
 	}
@@ -371,13 +456,14 @@ func (r *redisDB) CreateReference(f *FileReference) (uint, error) {
 	return uint(id), nil
 }
 
-func (r *redisDB) SaveFile(f *File) (*FileReference, error) {
+func (r *redisDB) SaveFile(f *File, publicID string) (*FileReference, error) {
 	script := redis.NewScript(`
 		local fileIDKey = KEYS[1]
 		local refIDKey = KEYS[2]
 		local fileKey = KEYS[3]
 		local refKey = KEYS[4]
 		local hashKey = KEYS[5]
+		local userKey = KEYS[6]
 		local file = ARGV[1]
 		local ref = ARGV[2]
 
@@ -396,19 +482,20 @@ func (r *redisDB) SaveFile(f *File) (*FileReference, error) {
 		ref = cjson.encode(refData)
 
 		redis.call("SET",fileKey .. fileID,file)
-		redis.call("SET",refKey .. refID,ref)
+		redis.call("SET",refKey .. refData.public_id,ref)
 		redis.call("SADD",hashKey .. hash,fileID)
+		redis.call("SADD",userKey .. refData.uploaded_by,refData.public_id)
 
 		return ref
 	`)
 
 	f.CreatedAt = time.Now().Unix()
-	fileRef := &FileReference{Name: f.Name, UploadedBy: f.UploadedBy, CreatedAt: f.CreatedAt}
+	fileRef := &FileReference{PublicID: publicID, Name: f.Name, UploadedBy: f.UploadedBy, CreatedAt: f.CreatedAt}
 	fJson, _ := json.Marshal(f)
 	rJson, _ := json.Marshal(fileRef)
 
 	result, err := script.Run(r.client,
-		[]string{FileIDKey, FileReferenceIDKey, FileKey, FileReferenceKey, FileHashKey},
+		[]string{FileIDKey, FileReferenceIDKey, FileKey, FileReferenceKey, FileHashKey, UserFilesKey},
 		fJson, rJson).Result()
 	if err != nil {
 		return nil, r.handleError(err)
@@ -426,6 +513,7 @@ func (r *redisDB) SaveFile(f *File) (*FileReference, error) {
 func (r *redisDB) Delete(uid uint, fileID string) error {
 	script := redis.NewScript(`
 		local fileKey = KEYS[1]
+		local userKey = KEYS[2]
 		local uploader = tonumber(ARGV[1])
 
 		local file = redis.call("GET",fileKey)
@@ -439,11 +527,13 @@ func (r *redisDB) Delete(uid uint, fileID string) error {
 		end
 
 		local deleted = redis.call("DEL",fileKey)
+		redis.call("SREM",userKey,f.public_id)
 		return deleted
 	`)
 
 	key := FileReferenceKey + fileID
-	result, err := script.Run(r.client, []string{key}, uid).Result()
+	userKey := UserFilesKey + strconv.FormatUint(uint64(uid), 10)
+	result, err := script.Run(r.client, []string{key, userKey}, uid).Result()
 	if err != nil {
 		return r.handleError(err)
 	}
@@ -458,6 +548,91 @@ func (r *redisDB) Delete(uid uint, fileID string) error {
 	return nil
 }
 
+// 只统计记录在用户集合中的引用
+func (r *redisDB) Usage(uid uint) (*Usage, error) {
+	script := redis.NewScript(`
+		local userKey = KEYS[1]
+		local refKey = KEYS[2]
+		local fileKey = KEYS[3]
+
+		local ids = redis.call("SMEMBERS",userKey)
+		local files = 0
+		local bytes = 0
+		local seen = {}
+		for i = 1, #ids do
+			local refData = redis.call("GET",refKey .. ids[i])
+			if refData then
+				local ref = cjson.decode(refData)
+				files = files + 1
+				if not seen[ref.file_id] then
+					seen[ref.file_id] = true
+					local fileData = redis.call("GET",fileKey .. ref.file_id)
+					if fileData then
+						bytes = bytes + (cjson.decode(fileData).size or 0)
+					end
+				end
+			end
+		end
+		return {bytes, files}
+	`)
+	userKey := UserFilesKey + strconv.FormatUint(uint64(uid), 10)
+	result, err := script.Run(r.client, []string{userKey, FileReferenceKey, FileKey}).Result()
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	data, ok := result.([]interface{})
+	if !ok || len(data) != 2 {
+		return nil, errors.New("redis: unexpected result")
+	}
+	bytes, _ := data[0].(int64)
+	files, _ := data[1].(int64)
+	return &Usage{Bytes: bytes, Files: files}, nil
+}
+
+func (r *redisDB) Referenced(uid uint, fileID uint) (bool, error) {
+	script := redis.NewScript(`
+		local userKey = KEYS[1]
+		local refKey = KEYS[2]
+		local fileID = tonumber(ARGV[1])
+
+		local ids = redis.call("SMEMBERS",userKey)
+		for i = 1, #ids do
+			local refData = redis.call("GET",refKey .. ids[i])
+			if refData and cjson.decode(refData).file_id == fileID then
+				return 1
+			end
+		end
+		return 0
+	`)
+	userKey := UserFilesKey + strconv.FormatUint(uint64(uid), 10)
+	result, err := script.Run(r.client, []string{userKey, FileReferenceKey}, fileID).Result()
+	if err != nil {
+		return false, r.handleError(err)
+	}
+	return result == int64(1), nil
+}
+
+func (r *redisDB) GetQuota(uid uint) (*Quota, error) {
+	data, err := r.client.Get(QuotaKey + strconv.FormatUint(uint64(uid), 10)).Bytes()
+	if err != nil {
+		return nil, r.handleError(err)
+	}
+	var q *Quota
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (r *redisDB) SetQuota(uid uint, q *Quota) error {
+	key := QuotaKey + strconv.FormatUint(uint64(uid), 10)
+	if q == nil {
+		return r.handleError(r.client.Del(key).Err())
+	}
+	data, _ := json.Marshal(q)
+	return r.handleError(r.client.Set(key, data, 0).Err())
+}
+
 func (r *redisDB) Close() {
 	r.client.Close()
 }
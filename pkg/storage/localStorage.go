@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"errors"
 	"fmt"
@@ -19,9 +20,22 @@ var (
 )
 
 type Storage interface {
-	Upload(uploader uint, file multipart.File, filename string) (uint, error)
-	Download(id string) (*File, error)
+	// 返回文件的公开ID
+	Upload(uploader uint, file multipart.File, filename string) (string, error)
+	Download(id string, access *Access) (*File, error)
+	// 读取Download返回的文件内容
+	Open(f *File) (io.ReadCloser, error)
+	// 读取图片的缩略图,size为ThumbnailSizes之一
+	Thumbnail(f *File, size int) (io.ReadCloser, error)
+	// 生成下载链接的签名,expires为unix秒
+	Sign(id string, expires int64) string
 	Delete(uid uint, fileID string) error
+	// 用户的限额和已使用的空间
+	Usage(uid uint) (*QuotaUsage, error)
+	// 检查用户能否再上传size字节的文件,分片上传创建时使用
+	CheckQuota(uid uint, size int64) error
+	// 单独设置用户的限额,q为nil时恢复默认限额
+	SetQuota(uid uint, q *Quota) error
 	Close()
 }
 
@@ -40,10 +54,13 @@ type LocalStorage struct {
 	DB     DB
 	Logger *Logger
 	IDGen  IDGenerator
+	// 下载链接的签名密钥
+	Secret []byte
+	Policy *Policy
 }
 
-// option为nil,默认使用sqlite
-func NewLocalStorage(fileDir, logDir string, option Option) (Storage, error) {
+// option为nil,默认使用sqlite,secret为空时使用随机密钥,policy为nil时不限制上传
+func NewLocalStorage(fileDir, logDir, secret string, option Option, policy *Policy) (Storage, error) {
 	fileDir = filepath.Clean(fileDir)
 	logger, err := SetupLogger(logDir)
 	if err != nil {
@@ -60,12 +77,17 @@ func NewLocalStorage(fileDir, logDir string, option Option) (Storage, error) {
 		DB:     db,
 		Logger: logger,
 		IDGen:  &DefaultIDGenerator{},
+		Secret: []byte(secret),
+		Policy: policy,
+	}
+	if secret == "" {
+		ls.Secret = randomSecret()
 	}
 	log.Println("Success connection to DB")
 	return ls, nil
 }
 
-func (ls *LocalStorage) Upload(uploader uint, file multipart.File, filename string) (uint, error) {
+func (ls *LocalStorage) Upload(uploader uint, file multipart.File, filename string) (string, error) {
 	defer file.Close()
 	// 创建目录
 	t := time.Now().Format("20060102")
@@ -78,7 +100,7 @@ func (ls *LocalStorage) Upload(uploader uint, file multipart.File, filename stri
 	}
 	// ..../files/date/type/file
 	if err := os.MkdirAll(dir, 0740); err != nil {
-		return 0, err
+		return "", err
 	}
 
 	// 创建文件,计算hash值
@@ -86,49 +108,138 @@ func (ls *LocalStorage) Upload(uploader uint, file multipart.File, filename stri
 	filePath := filepath.Join(dir, diskName)
 	f, err := os.OpenFile(filePath, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
-		return 0, err
+		return "", err
 	}
 	defer f.Close()
+	src, err := limitSize(ls.DB, ls.Policy, uploader, file)
+	if err != nil {
+		os.Remove(filePath)
+		return "", err
+	}
 	h := sha256.New()
-	if _, err := io.Copy(io.MultiWriter(f, h), file); err != nil {
+	size, err := io.Copy(io.MultiWriter(f, h), src)
+	if err != nil {
 		os.Remove(filePath)
-		return 0, err
+		return "", err
 	}
 	hash := fmt.Sprintf("%x", h.Sum(nil))
 
-	// 检查文件是否存在,存在则创建引用直接返回
-	id, created, err := ls.checkAndCreateReference(uploader, hash, filename, f)
+	// 公开ID不可猜测,自增ID只在内部使用
+	publicID := ls.IDGen.NewID()
+	mtype, same, err := checkUpload(ls.DB, ls.Open, ls.Policy, uploader, hash, size, f)
 	if err != nil {
 		os.Remove(filePath)
-		return 0, err
+		return "", err
 	}
-	if created {
+	// 文件已存在则创建引用直接返回
+	if same != nil {
 		os.Remove(filePath)
-		return id, nil
+		if err := createReference(ls.DB, same, uploader, filename, publicID); err != nil {
+			return "", err
+		}
+		return publicID, nil
+	}
+
+	// 图片生成缩略图,失败时仍然保存原文件
+	info, thumbs, err := extractMedia(f, mtype.String())
+	if err != nil {
+		ls.Logger.logger.Printf("Failed to create thumbnail %s: %v\n", filePath, err)
+	}
+	for thumbSize, data := range thumbs {
+		if err := os.WriteFile(thumbnailPath(filePath, info.MIME, thumbSize), data, 0644); err != nil {
+			ls.Logger.logger.Printf("Failed to save thumbnail %s: %v\n", filePath, err)
+		}
 	}
 
 	// 保存文件路径
-	saveFile := &File{Name: filename, Path: filePath, Hash: hash, UploadedBy: uploader}
-	var fileID uint
-	if fileRef, err := ls.DB.SaveFile(saveFile); err != nil {
+	saveFile := &File{Name: filename, Path: filePath, Hash: hash, Size: size,
+		MIME: info.MIME, Width: info.Width, Height: info.Height, UploadedBy: uploader}
+	if _, err := ls.DB.SaveFile(saveFile, publicID); err != nil {
 		os.Remove(filePath)
-		return 0, ErrUploadFailed
-	} else {
-		fileID = fileRef.ID
+		for thumbSize := range thumbs {
+			os.Remove(thumbnailPath(filePath, info.MIME, thumbSize))
+		}
+		return "", ErrUploadFailed
 	}
 
-	return fileID, nil
+	return publicID, nil
 }
 
 // view or download
-func (ls *LocalStorage) Download(id string) (*File, error) {
-	return ls.DB.Get(id)
+func (ls *LocalStorage) Download(id string, access *Access) (*File, error) {
+	return download(ls.DB, ls.Secret, id, access)
+}
+
+func (ls *LocalStorage) Open(f *File) (io.ReadCloser, error) {
+	return os.Open(f.Path)
+}
+
+func (ls *LocalStorage) Thumbnail(f *File, size int) (io.ReadCloser, error) {
+	if err := checkThumbnail(f, size); err != nil {
+		return nil, err
+	}
+	file, err := os.Open(thumbnailPath(f.Path, f.MIME, size))
+	if os.IsNotExist(err) {
+		return nil, ErrNoThumbnail
+	}
+	return file, err
+}
+
+// 有签名时只验证签名,否则上传者和Permitted允许的用户可以下载
+func download(db DB, secret []byte, id string, access *Access) (*File, error) {
+	if access == nil {
+		return nil, ErrPermissiondenied
+	}
+	if access.Signature != "" {
+		if err := verify(secret, id, access.Expires, access.Signature); err != nil {
+			return nil, err
+		}
+		return db.Get(id)
+	}
+
+	if access.UserID == 0 {
+		return nil, ErrPermissiondenied
+	}
+	file, err := db.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if file.UploadedBy == access.UserID {
+		return file, nil
+	}
+	if access.Permitted == nil {
+		return nil, ErrPermissiondenied
+	}
+	ok, err := access.Permitted(access.UserID, id)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrPermissiondenied
+	}
+	return file, nil
+}
+
+func (ls *LocalStorage) Sign(id string, expires int64) string {
+	return sign(ls.Secret, id, expires)
 }
 
 func (ls *LocalStorage) Delete(uid uint, fileID string) error {
 	return ls.DB.Delete(uid, fileID)
 }
 
+func (ls *LocalStorage) Usage(uid uint) (*QuotaUsage, error) {
+	return usageOf(ls.DB, ls.Policy, uid)
+}
+
+func (ls *LocalStorage) CheckQuota(uid uint, size int64) error {
+	return checkQuota(ls.DB, ls.Policy, uid, size, nil)
+}
+
+func (ls *LocalStorage) SetQuota(uid uint, q *Quota) error {
+	return setQuota(ls.DB, uid, q)
+}
+
 func (ls *LocalStorage) Close() {
 	ls.DB.Close()
 }
@@ -140,74 +251,80 @@ func (ls *LocalStorage) addExt(name, ext string) string {
 	return name
 }
 
-// 检查文件是否存在
-// 如果不存在，返回false和nil,表示没有插入引用表
-// 如果存在，插入引用表
-// 返回true和引用ID，表示插入引用表成功
-func (ls *LocalStorage) checkAndCreateReference(uploader uint, hash string, filename string, newFile *os.File) (uint, bool, error) {
-	files, exist, err := ls.DB.FindFileByHash(hash)
+// 读取已保存的文件,本地储存和对象储存共用去重逻辑
+type opener func(f *File) (io.ReadCloser, error)
+
+// 查找内容相同的文件,不存在时返回nil
+func findSameFile(db DB, open opener, hash string, newFile *os.File) (*File, error) {
+	files, exist, err := db.FindFileByHash(hash)
 	if err != nil {
-		return 0, false, err
+		return nil, err
 	}
 	if !exist {
-		return 0, false, nil
+		return nil, nil
 	}
 
 	// hash值相同，对比文件
-	f, same := ls.compareFile(newFile, files...)
+	f, same := compareFile(open, newFile, files...)
 	if !same {
-		return 0, false, nil
+		return nil, nil
 	}
+	return f, nil
+}
 
+// 以publicID创建已存在文件的引用
+func createReference(db DB, f *File, uploader uint, filename, publicID string) error {
 	fileRef := &FileReference{
+		PublicID:   publicID,
 		FileID:     f.ID,
 		Name:       filename,
 		UploadedBy: uploader,
 	}
-	id, err := ls.DB.CreateReference(fileRef)
-	if err != nil {
-		return 0, false, err
-	}
-
-	return id, true, nil
+	_, err := db.CreateReference(fileRef)
+	return err
 }
 
-func (ls *LocalStorage) compareFile(newFile *os.File, oldFilesPath ...*File) (*File, bool) {
+func compareFile(open opener, newFile *os.File, oldFiles ...*File) (*File, bool) {
 	newFileInfo, _ := newFile.Stat()
 	newFileSize := newFileInfo.Size()
 
-	for _, f := range oldFilesPath {
-		oldFile, err := os.Open(f.Path)
-		if err != nil {
+	for _, f := range oldFiles {
+		// 旧的记录没有保存大小
+		if f.Size != 0 && f.Size != newFileSize {
 			continue
 		}
-		defer oldFile.Close()
-
-		oldFileInfo, _ := oldFile.Stat()
-		oldFileSize := oldFileInfo.Size()
-		if newFileSize != oldFileSize {
-			continue
+		if sameContent(open, f, newFile) {
+			return f, true
 		}
+	}
+	return nil, false
+}
 
-		newFile.Seek(0, 0)
-		oldFile.Seek(0, 0)
-		buffer1 := make([]byte, 8196)
-		buffer2 := make([]byte, 8196)
-		for {
-			n1, err1 := newFile.Read(buffer1)
-			n2, err2 := oldFile.Read(buffer2)
-			if n1 != n2 || string(buffer1[:n1]) != string(buffer2[:n2]) {
-				break
-			}
-			if err1 == io.EOF && err2 == io.EOF {
-				return f, true
-			}
-			if err1 != nil || err2 != nil {
-				break
-			}
+func sameContent(open opener, f *File, newFile *os.File) bool {
+	oldFile, err := open(f)
+	if err != nil {
+		return false
+	}
+	defer oldFile.Close()
+
+	newFile.Seek(0, 0)
+	buffer1 := make([]byte, 8196)
+	buffer2 := make([]byte, 8196)
+	for {
+		// 对象储存的响应可能分多次读取
+		n1, err1 := io.ReadFull(newFile, buffer1)
+		n2, err2 := io.ReadFull(oldFile, buffer2)
+		if n1 != n2 || !bytes.Equal(buffer1[:n1], buffer2[:n2]) {
+			return false
+		}
+		if err1 != nil || err2 != nil {
+			return isEOF(err1) && isEOF(err2)
 		}
 	}
-	return nil, false
+}
+
+func isEOF(err error) bool {
+	return err == io.EOF || err == io.ErrUnexpectedEOF
 }
 
 // hash.sha256作为文件名
@@ -36,6 +36,7 @@ func setup(t *testing.T) (storage.Storage, *mock.MockDB, *mock.MockIDGenerator)
 		DB:     m,
 		Logger: logger,
 		IDGen:  idGen,
+		Secret: []byte("secret"),
 	}
 	return ls, m, idGen
 }
@@ -57,8 +58,9 @@ func TestUpload(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			idGen.EXPECT().NewID().Return("test")
+			idGen.EXPECT().NewID().Return("public")
 			m.EXPECT().FindFileByHash(gomock.Any()).Return(nil, false, nil)
-			m.EXPECT().SaveFile(gomock.Any()).Return(&storage.FileReference{ID: 1, FileID: 1}, nil)
+			m.EXPECT().SaveFile(gomock.Any(), "public").Return(&storage.FileReference{ID: 1, FileID: 1, PublicID: "public"}, nil)
 			// 创建测试文件
 			file := createTestFile(t, fileDir, tt.filename)
 			defer file.Close()
@@ -73,7 +75,7 @@ func TestUpload(t *testing.T) {
 			// 执行
 			gotFileID, err := ls.Upload(1, file, tt.filename)
 			assert.NoError(t, err)
-			assert.Equal(t, uint(1), gotFileID)
+			assert.Equal(t, "public", gotFileID)
 
 			// 预期保存的目录
 			ext := filepath.Ext(tt.filename)
@@ -97,8 +99,12 @@ func TestUpload(t *testing.T) {
 		ext := filepath.Ext(filename)
 		files := []*storage.File{{ID: 1, Path: filepath.Join(fileDir, time.Now().Format("20060102"), ext[1:], mockID+ext)}}
 		idGen.EXPECT().NewID().Return(mockID)
+		idGen.EXPECT().NewID().Return("public")
 		m.EXPECT().FindFileByHash(gomock.Any()).Return(files, true, nil)
-		m.EXPECT().CreateReference(gomock.Any()).Return(uint(1), nil)
+		m.EXPECT().CreateReference(gomock.Any()).DoAndReturn(func(ref *storage.FileReference) (uint, error) {
+			assert.Equal(t, "public", ref.PublicID)
+			return 1, nil
+		})
 
 		file := createTestFile(t, fileDir, filename)
 		defer file.Close()
@@ -106,7 +112,53 @@ func TestUpload(t *testing.T) {
 
 		got, err := ls.Upload(1, file, filename)
 		assert.NoError(t, err)
-		assert.Equal(t, uint(1), got)
+		assert.Equal(t, "public", got)
+	})
+}
+
+func TestDownload(t *testing.T) {
+	ls, m, _ := setup(t)
+	defer clear()
+
+	file := &storage.File{ID: 1, Name: "test.txt", Path: "test.txt", UploadedBy: 1}
+	expires := time.Now().Add(time.Minute).Unix()
+	permitted := func(uid uint, id string) (bool, error) {
+		return uid == 2, nil
+	}
+	tests := []struct {
+		name   string
+		access *storage.Access
+		get    bool
+		err    error
+	}{
+		{"uploader", &storage.Access{UserID: 1}, true, nil},
+		{"permitted", &storage.Access{UserID: 2, Permitted: permitted}, true, nil},
+		{"not permitted", &storage.Access{UserID: 3, Permitted: permitted}, true, storage.ErrPermissiondenied},
+		{"without permission check", &storage.Access{UserID: 2}, true, storage.ErrPermissiondenied},
+		{"anonymous", &storage.Access{}, false, storage.ErrPermissiondenied},
+		{"nil access", nil, false, storage.ErrPermissiondenied},
+		{"signed", &storage.Access{Expires: expires, Signature: ls.Sign("public", expires)}, true, nil},
+		{"invalid signature", &storage.Access{Expires: expires, Signature: ls.Sign("other", expires)}, false, storage.ErrInvalidSignature},
+		{"modified expires", &storage.Access{Expires: expires + 1, Signature: ls.Sign("public", expires)}, false, storage.ErrInvalidSignature},
+		{"expired", &storage.Access{Expires: expires - 120, Signature: ls.Sign("public", expires-120)}, false, storage.ErrLinkExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.get {
+				m.EXPECT().Get("public").Return(file, nil)
+			}
+			got, err := ls.Download("public", tt.access)
+			assert.Equal(t, tt.err, err)
+			if tt.err == nil {
+				assert.Equal(t, file, got)
+			}
+		})
+	}
+
+	t.Run("not found", func(t *testing.T) {
+		m.EXPECT().Get("none").Return(nil, storage.ErrNotFound)
+		_, err := ls.Download("none", &storage.Access{UserID: 1})
+		assert.Equal(t, storage.ErrNotFound, err)
 	})
 }
 
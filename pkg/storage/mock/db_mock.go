@@ -106,17 +106,76 @@ func (mr *MockDBMockRecorder) Get(id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockDB)(nil).Get), id)
 }
 
+// GetQuota mocks base method.
+func (m *MockDB) GetQuota(uid uint) (*storage.Quota, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetQuota", uid)
+	ret0, _ := ret[0].(*storage.Quota)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetQuota indicates an expected call of GetQuota.
+func (mr *MockDBMockRecorder) GetQuota(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetQuota", reflect.TypeOf((*MockDB)(nil).GetQuota), uid)
+}
+
+// Referenced mocks base method.
+func (m *MockDB) Referenced(uid, fileID uint) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Referenced", uid, fileID)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Referenced indicates an expected call of Referenced.
+func (mr *MockDBMockRecorder) Referenced(uid, fileID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Referenced", reflect.TypeOf((*MockDB)(nil).Referenced), uid, fileID)
+}
+
 // SaveFile mocks base method.
-func (m *MockDB) SaveFile(f *storage.File) (*storage.FileReference, error) {
+func (m *MockDB) SaveFile(f *storage.File, publicID string) (*storage.FileReference, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "SaveFile", f)
+	ret := m.ctrl.Call(m, "SaveFile", f, publicID)
 	ret0, _ := ret[0].(*storage.FileReference)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // SaveFile indicates an expected call of SaveFile.
-func (mr *MockDBMockRecorder) SaveFile(f interface{}) *gomock.Call {
+func (mr *MockDBMockRecorder) SaveFile(f, publicID interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveFile", reflect.TypeOf((*MockDB)(nil).SaveFile), f, publicID)
+}
+
+// SetQuota mocks base method.
+func (m *MockDB) SetQuota(uid uint, q *storage.Quota) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetQuota", uid, q)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetQuota indicates an expected call of SetQuota.
+func (mr *MockDBMockRecorder) SetQuota(uid, q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetQuota", reflect.TypeOf((*MockDB)(nil).SetQuota), uid, q)
+}
+
+// Usage mocks base method.
+func (m *MockDB) Usage(uid uint) (*storage.Usage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Usage", uid)
+	ret0, _ := ret[0].(*storage.Usage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Usage indicates an expected call of Usage.
+func (mr *MockDBMockRecorder) Usage(uid interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveFile", reflect.TypeOf((*MockDB)(nil).SaveFile), f)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Usage", reflect.TypeOf((*MockDB)(nil).Usage), uid)
 }
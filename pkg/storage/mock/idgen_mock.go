@@ -5,6 +5,7 @@
 package mock
 
 import (
+	io "io"
 	multipart "mime/multipart"
 	reflect "reflect"
 
@@ -35,6 +36,32 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
+// CheckQuota mocks base method.
+func (m *MockStorage) CheckQuota(uid uint, size int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CheckQuota", uid, size)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CheckQuota indicates an expected call of CheckQuota.
+func (mr *MockStorageMockRecorder) CheckQuota(uid, size interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CheckQuota", reflect.TypeOf((*MockStorage)(nil).CheckQuota), uid, size)
+}
+
+// Close mocks base method.
+func (m *MockStorage) Close() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Close")
+}
+
+// Close indicates an expected call of Close.
+func (mr *MockStorageMockRecorder) Close() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorage)(nil).Close))
+}
+
 // Delete mocks base method.
 func (m *MockStorage) Delete(uid uint, fileID string) error {
 	m.ctrl.T.Helper()
@@ -50,25 +77,83 @@ func (mr *MockStorageMockRecorder) Delete(uid, fileID interface{}) *gomock.Call
 }
 
 // Download mocks base method.
-func (m *MockStorage) Download(id string) (*storage.File, error) {
+func (m *MockStorage) Download(id string, access *storage.Access) (*storage.File, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Download", id)
+	ret := m.ctrl.Call(m, "Download", id, access)
 	ret0, _ := ret[0].(*storage.File)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // Download indicates an expected call of Download.
-func (mr *MockStorageMockRecorder) Download(id interface{}) *gomock.Call {
+func (mr *MockStorageMockRecorder) Download(id, access interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockStorage)(nil).Download), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockStorage)(nil).Download), id, access)
+}
+
+// Open mocks base method.
+func (m *MockStorage) Open(f *storage.File) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Open", f)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Open indicates an expected call of Open.
+func (mr *MockStorageMockRecorder) Open(f interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Open", reflect.TypeOf((*MockStorage)(nil).Open), f)
+}
+
+// SetQuota mocks base method.
+func (m *MockStorage) SetQuota(uid uint, q *storage.Quota) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetQuota", uid, q)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetQuota indicates an expected call of SetQuota.
+func (mr *MockStorageMockRecorder) SetQuota(uid, q interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetQuota", reflect.TypeOf((*MockStorage)(nil).SetQuota), uid, q)
+}
+
+// Sign mocks base method.
+func (m *MockStorage) Sign(id string, expires int64) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Sign", id, expires)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// Sign indicates an expected call of Sign.
+func (mr *MockStorageMockRecorder) Sign(id, expires interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sign", reflect.TypeOf((*MockStorage)(nil).Sign), id, expires)
+}
+
+// Thumbnail mocks base method.
+func (m *MockStorage) Thumbnail(f *storage.File, size int) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Thumbnail", f, size)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Thumbnail indicates an expected call of Thumbnail.
+func (mr *MockStorageMockRecorder) Thumbnail(f, size interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Thumbnail", reflect.TypeOf((*MockStorage)(nil).Thumbnail), f, size)
 }
 
 // Upload mocks base method.
-func (m *MockStorage) Upload(uploader uint, file multipart.File, filename string) (uint, error) {
+func (m *MockStorage) Upload(uploader uint, file multipart.File, filename string) (string, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Upload", uploader, file, filename)
-	ret0, _ := ret[0].(uint)
+	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -79,6 +164,21 @@ func (mr *MockStorageMockRecorder) Upload(uploader, file, filename interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Upload", reflect.TypeOf((*MockStorage)(nil).Upload), uploader, file, filename)
 }
 
+// Usage mocks base method.
+func (m *MockStorage) Usage(uid uint) (*storage.QuotaUsage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Usage", uid)
+	ret0, _ := ret[0].(*storage.QuotaUsage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Usage indicates an expected call of Usage.
+func (mr *MockStorageMockRecorder) Usage(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Usage", reflect.TypeOf((*MockStorage)(nil).Usage), uid)
+}
+
 // MockIDGenerator is a mock of IDGenerator interface.
 type MockIDGenerator struct {
 	ctrl     *gomock.Controller
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+)
+
+// 文件内容保存在兼容S3的对象储存中,多个节点可以共享
+// 元数据和引用仍然保存在DB中,去重逻辑与本地储存相同
+type ObjectStorage struct {
+	// 上传时计算hash和对比文件的临时目录
+	TempDir string
+	Client  *S3Client
+	DB      DB
+	Logger  *Logger
+	IDGen   IDGenerator
+	Secret  []byte
+	Policy  *Policy
+}
+
+// option为nil,默认使用sqlite,secret为空时使用随机密钥,policy为nil时不限制上传
+func NewObjectStorage(client *S3Client, tempDir, logDir, secret string, option Option, policy *Policy) (Storage, error) {
+	if err := os.MkdirAll(tempDir, 0740); err != nil {
+		return nil, err
+	}
+	logger, err := SetupLogger(logDir)
+	if err != nil {
+		fmt.Println(err)
+		return nil, err
+	}
+	db, err := SetupDB(option, logger)
+	if err != nil {
+		log.Printf("Failed to connection to DB: %v\n", err)
+		return nil, err
+	}
+	s := &ObjectStorage{
+		TempDir: filepath.Clean(tempDir),
+		Client:  client,
+		DB:      db,
+		Logger:  logger,
+		IDGen:   &DefaultIDGenerator{},
+		Secret:  []byte(secret),
+		Policy:  policy,
+	}
+	if secret == "" {
+		s.Secret = randomSecret()
+	}
+	log.Println("Success connection to DB")
+	return s, nil
+}
+
+func (s *ObjectStorage) Upload(uploader uint, file multipart.File, filename string) (string, error) {
+	defer file.Close()
+	// 先写入临时文件,计算hash值
+	tmp, err := os.CreateTemp(s.TempDir, "upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	src, err := limitSize(s.DB, s.Policy, uploader, file)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, h), src)
+	if err != nil {
+		return "", err
+	}
+	hash := fmt.Sprintf("%x", h.Sum(nil))
+
+	// date/type/file
+	ext := filepath.Ext(filename)
+	dir := "unknown"
+	if len(ext) > 1 {
+		dir = ext[1:]
+	}
+	key := path.Join(time.Now().Format("20060102"), dir, s.IDGen.NewID()+ext)
+
+	publicID := s.IDGen.NewID()
+	mtype, same, err := checkUpload(s.DB, s.Open, s.Policy, uploader, hash, size, tmp)
+	if err != nil {
+		return "", err
+	}
+	// 文件已存在则创建引用直接返回
+	if same != nil {
+		if err := createReference(s.DB, same, uploader, filename, publicID); err != nil {
+			return "", err
+		}
+		return publicID, nil
+	}
+
+	info, thumbs, err := extractMedia(tmp, mtype.String())
+	if err != nil {
+		s.Logger.logger.Printf("Failed to create thumbnail %s: %v\n", key, err)
+	}
+	if _, err := tmp.Seek(0, 0); err != nil {
+		return "", err
+	}
+	if err := s.Client.PutObject(key, tmp, size, hash); err != nil {
+		s.Logger.logger.Printf("Failed to put object %s: %v\n", key, err)
+		return "", ErrUploadFailed
+	}
+	for thumbSize, data := range thumbs {
+		thumbKey := thumbnailPath(key, info.MIME, thumbSize)
+		if err := s.Client.PutObject(thumbKey, bytes.NewReader(data), int64(len(data)), fmt.Sprintf("%x", sha256.Sum256(data))); err != nil {
+			s.Logger.logger.Printf("Failed to put object %s: %v\n", thumbKey, err)
+		}
+	}
+	saveFile := &File{Name: filename, Path: key, Hash: hash, Size: size,
+		MIME: info.MIME, Width: info.Width, Height: info.Height, UploadedBy: uploader}
+	if _, err := s.DB.SaveFile(saveFile, publicID); err != nil {
+		s.Client.DeleteObject(key)
+		for thumbSize := range thumbs {
+			s.Client.DeleteObject(thumbnailPath(key, info.MIME, thumbSize))
+		}
+		return "", ErrUploadFailed
+	}
+	return publicID, nil
+}
+
+func (s *ObjectStorage) Download(id string, access *Access) (*File, error) {
+	return download(s.DB, s.Secret, id, access)
+}
+
+func (s *ObjectStorage) Open(f *File) (io.ReadCloser, error) {
+	return s.Client.GetObject(f.Path)
+}
+
+func (s *ObjectStorage) Thumbnail(f *File, size int) (io.ReadCloser, error) {
+	if err := checkThumbnail(f, size); err != nil {
+		return nil, err
+	}
+	body, err := s.Client.GetObject(thumbnailPath(f.Path, f.MIME, size))
+	if errors.Is(err, ErrNotFound) {
+		return nil, ErrNoThumbnail
+	}
+	return body, err
+}
+
+func (s *ObjectStorage) Sign(id string, expires int64) string {
+	return sign(s.Secret, id, expires)
+}
+
+func (s *ObjectStorage) Delete(uid uint, fileID string) error {
+	return s.DB.Delete(uid, fileID)
+}
+
+func (s *ObjectStorage) Usage(uid uint) (*QuotaUsage, error) {
+	return usageOf(s.DB, s.Policy, uid)
+}
+
+func (s *ObjectStorage) CheckQuota(uid uint, size int64) error {
+	return checkQuota(s.DB, s.Policy, uid, size, nil)
+}
+
+func (s *ObjectStorage) SetQuota(uid uint, q *Quota) error {
+	return setQuota(s.DB, uid, q)
+}
+
+func (s *ObjectStorage) Close() {
+	s.DB.Close()
+}
@@ -0,0 +1,140 @@
+package storage_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/farnese17/chat/pkg/storage"
+	"github.com/farnese17/chat/pkg/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupObjectStorage(t *testing.T) (storage.Storage, *fakeS3, *mock.MockDB, *mock.MockIDGenerator) {
+	ctrl := gomock.NewController(t)
+	m := mock.NewMockDB(ctrl)
+	idGen := mock.NewMockIDGenerator(ctrl)
+	fake, client := newFakeS3(t)
+
+	logger, _ = storage.SetupLogger("./")
+	s := &storage.ObjectStorage{
+		TempDir: t.TempDir(),
+		Client:  client,
+		DB:      m,
+		Logger:  logger,
+		IDGen:   idGen,
+		Secret:  []byte("secret"),
+	}
+	return s, fake, m, idGen
+}
+
+func TestObjectStorageUpload(t *testing.T) {
+	s, fake, m, idGen := setupObjectStorage(t)
+	defer clear()
+
+	content := []byte("fake object content")
+	hash := fmt.Sprintf("%x", sha256.Sum256(content))
+	key := path.Join(time.Now().Format("20060102"), "txt", "object.txt")
+	upload := func(uploader uint, filename string, content []byte) (string, error) {
+		file := createTestFile(t, fileDir, filename)
+		writeTestFile(t, file, content)
+		return s.Upload(uploader, file, filename)
+	}
+
+	idGen.EXPECT().NewID().Return("object")
+	idGen.EXPECT().NewID().Return("public1")
+	m.EXPECT().FindFileByHash(hash).Return(nil, false, nil)
+	m.EXPECT().SaveFile(gomock.Any(), "public1").DoAndReturn(func(f *storage.File, publicID string) (*storage.FileReference, error) {
+		assert.Equal(t, key, f.Path)
+		assert.Equal(t, hash, f.Hash)
+		assert.Equal(t, int64(len(content)), f.Size)
+		return &storage.FileReference{ID: 1, FileID: 1, PublicID: publicID}, nil
+	})
+	id, err := upload(1, "a.txt", content)
+	assert.NoError(t, err)
+	assert.Equal(t, "public1", id)
+	data, ok := fake.object(key)
+	assert.True(t, ok)
+	assert.Equal(t, content, data)
+
+	// 内容相同只创建引用,不上传对象
+	existed := []*storage.File{{ID: 1, Path: key, Hash: hash, Size: int64(len(content))}}
+	idGen.EXPECT().NewID().Return("object2")
+	idGen.EXPECT().NewID().Return("public2")
+	m.EXPECT().FindFileByHash(hash).Return(existed, true, nil)
+	m.EXPECT().CreateReference(gomock.Any()).DoAndReturn(func(ref *storage.FileReference) (uint, error) {
+		assert.Equal(t, uint(1), ref.FileID)
+		assert.Equal(t, "public2", ref.PublicID)
+		return 2, nil
+	})
+	id, err = upload(2, "b.txt", content)
+	assert.NoError(t, err)
+	assert.Equal(t, "public2", id)
+	_, ok = fake.object(path.Join(time.Now().Format("20060102"), "txt", "object2.txt"))
+	assert.False(t, ok)
+
+	// hash相同但内容不同时保存新的对象
+	other := []byte("other object content")
+	collided := []*storage.File{{ID: 1, Path: key, Hash: hash, Size: int64(len(other))}}
+	idGen.EXPECT().NewID().Return("object3")
+	idGen.EXPECT().NewID().Return("public3")
+	m.EXPECT().FindFileByHash(gomock.Any()).Return(collided, true, nil)
+	m.EXPECT().SaveFile(gomock.Any(), "public3").Return(&storage.FileReference{ID: 3, FileID: 2, PublicID: "public3"}, nil)
+	id, err = upload(1, "c.txt", other)
+	assert.NoError(t, err)
+	assert.Equal(t, "public3", id)
+	data, ok = fake.object(path.Join(time.Now().Format("20060102"), "txt", "object3.txt"))
+	assert.True(t, ok)
+	assert.Equal(t, other, data)
+
+	// 保存元数据失败时删除对象
+	idGen.EXPECT().NewID().Return("object4")
+	idGen.EXPECT().NewID().Return("public4")
+	m.EXPECT().FindFileByHash(gomock.Any()).Return(nil, false, nil)
+	m.EXPECT().SaveFile(gomock.Any(), "public4").Return(nil, storage.ErrTimeout)
+	_, err = upload(1, "d.txt", []byte("d"))
+	assert.Equal(t, storage.ErrUploadFailed, err)
+	_, ok = fake.object(path.Join(time.Now().Format("20060102"), "txt", "object4.txt"))
+	assert.False(t, ok)
+
+	// 临时文件已删除
+	entries, err := os.ReadDir(s.(*storage.ObjectStorage).TempDir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestObjectStorageOpen(t *testing.T) {
+	s, _, m, idGen := setupObjectStorage(t)
+	defer clear()
+
+	content := []byte("fake object content")
+	idGen.EXPECT().NewID().Return("object")
+	idGen.EXPECT().NewID().Return("public")
+	m.EXPECT().FindFileByHash(gomock.Any()).Return(nil, false, nil)
+	var saved *storage.File
+	m.EXPECT().SaveFile(gomock.Any(), "public").DoAndReturn(func(f *storage.File, publicID string) (*storage.FileReference, error) {
+		saved = f
+		return &storage.FileReference{ID: 1, FileID: 1, PublicID: publicID}, nil
+	})
+	file := createTestFile(t, fileDir, "a.txt")
+	writeTestFile(t, file, content)
+	_, err := s.Upload(1, file, "a.txt")
+	assert.NoError(t, err)
+
+	m.EXPECT().Get("public").Return(saved, nil)
+	f, err := s.Download("public", &storage.Access{UserID: 1})
+	assert.NoError(t, err)
+	body, err := s.Open(f)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, content, data)
+
+	_, err = s.Open(&storage.File{Path: "none"})
+	assert.Equal(t, storage.ErrNotFound, err)
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+var (
+	ErrFileTooLarge   = errors.New("file too large")
+	ErrQuotaExceeded  = errors.New("quota exceeded")
+	ErrTypeNotAllowed = errors.New("file type not allowed")
+	ErrInvalidQuota   = errors.New("invalid quota")
+)
+
+// 用户的限额,小于等于0表示不限制
+type Quota struct {
+	MaxBytes    int64 `json:"max_bytes" gorm:"not null;default:0"`
+	MaxFiles    int64 `json:"max_files" gorm:"not null;default:0"`
+	MaxFileSize int64 `json:"max_file_size" gorm:"not null;default:0"`
+}
+
+// 管理员为用户单独设置的限额,覆盖默认限额
+type UserQuota struct {
+	UID       uint  `json:"uid" gorm:"primaryKey;autoIncrement:false"`
+	Quota     Quota `json:"quota" gorm:"embedded"`
+	UpdatedAt int64 `json:"updated_at" gorm:"autoUpdateTime"`
+}
+
+// 已使用的空间,同一用户引用的相同文件只计算一次大小,文件数按引用计算
+type Usage struct {
+	Bytes int64 `json:"bytes"`
+	Files int64 `json:"files"`
+}
+
+// 用户的使用情况,custom表示限额由管理员单独设置
+type QuotaUsage struct {
+	Usage  Usage `json:"usage"`
+	Quota  Quota `json:"quota"`
+	Custom bool  `json:"custom"`
+}
+
+// 上传策略,为nil时不检查限额和类型
+// 类型按文件内容识别,支持 image/* 的形式
+// 类型本身或其父类型(如docx的父类型为application/zip)匹配即可,Denied优先,Allowed为空时允许所有类型
+type Policy struct {
+	Quota   Quota
+	Allowed []string
+	Denied  []string
+}
+
+// 识别文件内容的类型
+func sniff(r io.ReadSeeker) (*mimetype.MIME, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return mimetype.DetectReader(r)
+}
+
+func (p *Policy) checkType(mtype *mimetype.MIME) error {
+	if p == nil {
+		return nil
+	}
+	for _, pattern := range p.Denied {
+		if matchType(mtype, pattern) {
+			return ErrTypeNotAllowed
+		}
+	}
+	if len(p.Allowed) == 0 {
+		return nil
+	}
+	for _, pattern := range p.Allowed {
+		if matchType(mtype, pattern) {
+			return nil
+		}
+	}
+	return ErrTypeNotAllowed
+}
+
+func matchType(mtype *mimetype.MIME, pattern string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == "" {
+		return false
+	}
+	for m := mtype; m != nil; m = m.Parent() {
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(m.String(), prefix+"/") {
+				return true
+			}
+		} else if m.Is(pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// 返回用户的限额,没有单独设置时使用默认限额
+func quotaOf(db DB, p *Policy, uid uint) (Quota, bool, error) {
+	q, err := db.GetQuota(uid)
+	if err == nil {
+		return *q, true, nil
+	}
+	if !errors.Is(err, ErrNotFound) {
+		return Quota{}, false, err
+	}
+	if p == nil {
+		return Quota{}, false, nil
+	}
+	return p.Quota, false, nil
+}
+
+func usageOf(db DB, p *Policy, uid uint) (*QuotaUsage, error) {
+	q, custom, err := quotaOf(db, p, uid)
+	if err != nil {
+		return nil, err
+	}
+	usage, err := db.Usage(uid)
+	if err != nil {
+		return nil, err
+	}
+	return &QuotaUsage{Usage: *usage, Quota: q, Custom: custom}, nil
+}
+
+// 检查文件类型和用户限额,返回识别出的类型和内容相同的已保存文件
+func checkUpload(db DB, open opener, p *Policy, uploader uint, hash string, size int64, newFile *os.File) (*mimetype.MIME, *File, error) {
+	mtype, err := sniff(newFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := p.checkType(mtype); err != nil {
+		return nil, nil, err
+	}
+	same, err := findSameFile(db, open, hash, newFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := checkQuota(db, p, uploader, size, same); err != nil {
+		return nil, nil, err
+	}
+	return mtype, same, nil
+}
+
+// 超过单个文件的大小限制时停止读取
+func limitSize(db DB, p *Policy, uid uint, r io.Reader) (io.Reader, error) {
+	if p == nil {
+		return r, nil
+	}
+	q, _, err := quotaOf(db, p, uid)
+	if err != nil {
+		return nil, err
+	}
+	if q.MaxFileSize <= 0 {
+		return r, nil
+	}
+	return io.LimitReader(r, q.MaxFileSize+1), nil
+}
+
+// 检查上传size字节的文件后是否超出限额
+// existing为内容相同的已保存文件,用户已经引用过时不增加已使用的空间
+// 并发上传时可能略微超出限额
+func checkQuota(db DB, p *Policy, uid uint, size int64, existing *File) error {
+	if p == nil {
+		return nil
+	}
+	info, err := usageOf(db, p, uid)
+	if err != nil {
+		return err
+	}
+	q := info.Quota
+	if q.MaxFileSize > 0 && size > q.MaxFileSize {
+		return ErrFileTooLarge
+	}
+	if q.MaxFiles > 0 && info.Usage.Files+1 > q.MaxFiles {
+		return ErrQuotaExceeded
+	}
+	if q.MaxBytes <= 0 {
+		return nil
+	}
+	if existing != nil {
+		referenced, err := db.Referenced(uid, existing.ID)
+		if err != nil {
+			return err
+		}
+		if referenced {
+			size = 0
+		}
+	}
+	if info.Usage.Bytes+size > q.MaxBytes {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// q为nil时删除单独设置的限额
+func setQuota(db DB, uid uint, q *Quota) error {
+	if q == nil {
+		return db.SetQuota(uid, nil)
+	}
+	if q.MaxBytes < 0 || q.MaxFiles < 0 || q.MaxFileSize < 0 {
+		return ErrInvalidQuota
+	}
+	return db.SetQuota(uid, q)
+}
@@ -0,0 +1,95 @@
+package storage_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/farnese17/chat/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupQuota(t *testing.T) storage.Storage {
+	dir := t.TempDir()
+	policy := &storage.Policy{
+		Quota:   storage.Quota{MaxBytes: 20, MaxFiles: 3, MaxFileSize: 10},
+		Allowed: []string{"text/*", "image/*"},
+		Denied:  []string{"text/html"},
+	}
+	s, err := storage.NewLocalStorage(filepath.Join(dir, "files"), dir,
+		"secret", &storage.SqliteOption{Path: filepath.Join(dir, "storage.sqlite")}, policy)
+	assert.NoError(t, err)
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestQuota(t *testing.T) {
+	s := setupQuota(t)
+	defer os.RemoveAll(fileDir)
+	upload := func(uid uint, filename string, content []byte) (string, error) {
+		file := createTestFile(t, t.TempDir()+"/", filename)
+		writeTestFile(t, file, content)
+		return s.Upload(uid, file, filename)
+	}
+	usage := func(uid uint) storage.Usage {
+		got, err := s.Usage(uid)
+		assert.NoError(t, err)
+		return got.Usage
+	}
+
+	// 按内容识别类型,与扩展名无关
+	_, err := upload(2, "a.txt", []byte("<html><body>a</body></html>"))
+	assert.Equal(t, storage.ErrTypeNotAllowed, err)
+	_, err = upload(2, "a.txt", []byte("%PDF-1.4\n"))
+	assert.Equal(t, storage.ErrTypeNotAllowed, err)
+	_, err = upload(2, "a.pdf", []byte("plain"))
+	assert.NoError(t, err)
+
+	_, err = upload(1, "a.txt", []byte("01234567890"))
+	assert.Equal(t, storage.ErrFileTooLarge, err)
+	first, err := upload(1, "a.txt", []byte("0123456789"))
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Usage{Bytes: 10, Files: 1}, usage(1))
+
+	// 相同内容只计算一次大小
+	second, err := upload(1, "b.txt", []byte("0123456789"))
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Usage{Bytes: 10, Files: 2}, usage(1))
+	_, err = upload(3, "a.txt", []byte("0123456789"))
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Usage{Bytes: 10, Files: 1}, usage(3))
+
+	_, err = upload(1, "c.txt", []byte("abcdefghij"))
+	assert.NoError(t, err)
+	assert.Equal(t, storage.Usage{Bytes: 20, Files: 3}, usage(1))
+	_, err = upload(1, "d.txt", []byte("d"))
+	assert.Equal(t, storage.ErrQuotaExceeded, err)
+
+	// 删除一个引用后文件仍被另一个引用使用
+	assert.NoError(t, s.Delete(1, first))
+	assert.Equal(t, storage.Usage{Bytes: 20, Files: 2}, usage(1))
+	_, err = upload(1, "d.txt", []byte("d"))
+	assert.Equal(t, storage.ErrQuotaExceeded, err)
+	// 已经引用的文件不增加空间
+	_, err = upload(1, "e.txt", []byte("0123456789"))
+	assert.NoError(t, err)
+	assert.NoError(t, s.Delete(1, second))
+
+	// 单独设置限额
+	assert.Equal(t, storage.ErrFileTooLarge, s.CheckQuota(1, 100))
+	assert.Equal(t, storage.ErrInvalidQuota, s.SetQuota(1, &storage.Quota{MaxBytes: -1}))
+	assert.NoError(t, s.SetQuota(1, &storage.Quota{MaxBytes: 1000}))
+	got, err := s.Usage(1)
+	assert.NoError(t, err)
+	assert.True(t, got.Custom)
+	assert.Equal(t, storage.Quota{MaxBytes: 1000}, got.Quota)
+	assert.NoError(t, s.CheckQuota(1, 100))
+	assert.NoError(t, s.SetQuota(1, &storage.Quota{MaxBytes: 1000, MaxFiles: 10}))
+	got, _ = s.Usage(1)
+	assert.Equal(t, int64(10), got.Quota.MaxFiles)
+
+	assert.NoError(t, s.SetQuota(1, nil))
+	got, _ = s.Usage(1)
+	assert.False(t, got.Custom)
+	assert.Equal(t, storage.Quota{MaxBytes: 20, MaxFiles: 3, MaxFileSize: 10}, got.Quota)
+}
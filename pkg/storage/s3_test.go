@@ -0,0 +1,107 @@
+package storage_test
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/farnese17/chat/pkg/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+// 内存中的S3,只支持路径风格的PUT/GET/DELETE,检查access key和payload hash
+type fakeS3 struct {
+	mu        sync.Mutex
+	accessKey string
+	objects   map[string][]byte
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *storage.S3Client) {
+	fake := &fakeS3{accessKey: "access", objects: make(map[string][]byte)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	client := &storage.S3Client{
+		Endpoint:  server.URL,
+		Region:    "us-east-1",
+		Bucket:    "chat",
+		AccessKey: "access",
+		SecretKey: "secret",
+	}
+	return fake, client
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential="+f.accessKey+"/") ||
+		!strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date") ||
+		r.Header.Get("x-amz-date") == "" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, _ := io.ReadAll(r.Body)
+		if r.Header.Get("x-amz-content-sha256") != fmt.Sprintf("%x", sha256.Sum256(data)) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = data
+	case http.MethodGet:
+		data, ok := f.objects[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) object(key string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.objects["/chat/"+key]
+	return data, ok
+}
+
+func TestS3Client(t *testing.T) {
+	fake, client := newFakeS3(t)
+	content := "s3 content"
+	hash := fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+
+	key := "20240101/txt/中文 name.txt"
+	err := client.PutObject(key, strings.NewReader(content), int64(len(content)), hash)
+	assert.NoError(t, err)
+	data, ok := fake.object(key)
+	assert.True(t, ok)
+	assert.Equal(t, content, string(data))
+
+	body, err := client.GetObject(key)
+	assert.NoError(t, err)
+	data, _ = io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, content, string(data))
+
+	assert.NoError(t, client.DeleteObject(key))
+	_, err = client.GetObject(key)
+	assert.Equal(t, storage.ErrNotFound, err)
+
+	// payload hash与内容不一致
+	err = client.PutObject(key, strings.NewReader("other"), 5, hash)
+	assert.Error(t, err)
+	client.AccessKey = "wrong"
+	err = client.PutObject(key, strings.NewReader(content), int64(len(content)), hash)
+	assert.Error(t, err)
+}
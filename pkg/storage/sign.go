@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrLinkExpired      = errors.New("link expired")
+	ErrInvalidSignature = errors.New("invalid signature")
+)
+
+// 下载凭证,签名有效时不检查用户
+// 没有签名时上传者可以直接下载,其他用户由Permitted判断
+type Access struct {
+	// unix秒
+	Expires   int64
+	Signature string
+	UserID    uint
+	Permitted func(uid uint, id string) (bool, error)
+}
+
+// 签名为hmac-sha256(id:expires),使用url安全的base64编码
+func sign(secret []byte, id string, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id + ":" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func verify(secret []byte, id string, expires int64, signature string) error {
+	if !hmac.Equal([]byte(sign(secret, id, expires)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	if expires < time.Now().Unix() {
+		return ErrLinkExpired
+	}
+	return nil
+}
+
+// 未配置密钥时使用随机密钥,重启后已签发的链接失效
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	rand.Read(secret)
+	return secret
+}
@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"slices"
+	"strings"
+)
+
+var (
+	ErrNoThumbnail = errors.New("no thumbnail")
+	ErrInvalidSize = errors.New("invalid thumbnail size")
+)
+
+// 缩略图最长边的像素,从大到小生成
+var ThumbnailSizes = []int{512, 256, 128}
+
+const DefaultThumbnailSize = 256
+
+// 超过该像素数的图片只记录尺寸,不生成缩略图
+const maxImagePixels = 40 << 20
+
+// 文件类型和图片尺寸,不是图片时宽高为0
+type mediaInfo struct {
+	Width  int
+	Height int
+	MIME   string
+}
+
+// mime为识别出的文件类型,JPEG/PNG/GIF读取尺寸并生成缩略图
+// 生成缩略图失败时仍然返回文件类型和尺寸
+func extractMedia(r io.ReadSeeker, mime string) (mediaInfo, map[int][]byte, error) {
+	info := mediaInfo{MIME: mime}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return info, nil, err
+	}
+	cfg, format, err := image.DecodeConfig(r)
+	if err != nil || !slices.Contains([]string{"jpeg", "png", "gif"}, format) {
+		return info, nil, nil
+	}
+	info.Width, info.Height, info.MIME = cfg.Width, cfg.Height, "image/"+format
+	if info.Width*info.Height > maxImagePixels {
+		return info, nil, fmt.Errorf("image too large: %dx%d", info.Width, info.Height)
+	}
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return info, nil, err
+	}
+	// GIF只使用第一帧
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return info, nil, err
+	}
+	thumbs := make(map[int][]byte, len(ThumbnailSizes))
+	for _, size := range ThumbnailSizes {
+		// 从上一个较大的缩略图缩小,只需要遍历一次原图
+		img = resize(img, size)
+		buf := &bytes.Buffer{}
+		if ThumbnailType(info.MIME) == "image/jpeg" {
+			err = jpeg.Encode(buf, img, &jpeg.Options{Quality: 80})
+		} else {
+			err = png.Encode(buf, img)
+		}
+		if err != nil {
+			return info, nil, err
+		}
+		thumbs[size] = buf.Bytes()
+	}
+	return info, thumbs, nil
+}
+
+// JPEG的缩略图为JPEG,PNG和GIF的缩略图为PNG,保留透明度
+func ThumbnailType(mime string) string {
+	if mime == "image/jpeg" {
+		return "image/jpeg"
+	}
+	return "image/png"
+}
+
+// 缩略图和原文件保存在同一目录,文件名为 原文件名_thumb大小.扩展名
+func thumbnailPath(p, mime string, size int) string {
+	ext := ".png"
+	if ThumbnailType(mime) == "image/jpeg" {
+		ext = ".jpg"
+	}
+	return fmt.Sprintf("%s_thumb%d%s", p, size, ext)
+}
+
+func isImage(f *File) bool {
+	return f.Width > 0 && strings.HasPrefix(f.MIME, "image/")
+}
+
+func checkThumbnail(f *File, size int) error {
+	if !slices.Contains(ThumbnailSizes, size) {
+		return ErrInvalidSize
+	}
+	if !isImage(f) {
+		return ErrNoThumbnail
+	}
+	return nil
+}
+
+// 按比例缩小到最长边为size,使用区域平均,不放大
+func resize(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w <= size && h <= size {
+		return src
+	}
+	dw, dh := size, h*size/w
+	if h > w {
+		dw, dh = w*size/h, size
+	}
+	dw, dh = max(dw, 1), max(dh, 1)
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := b.Min.Y+y*h/dh, b.Min.Y+(y+1)*h/dh
+		for x := 0; x < dw; x++ {
+			x0, x1 := b.Min.X+x*w/dw, b.Min.X+(x+1)*w/dw
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: uint8(a / n >> 8),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,136 @@
+package storage_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"testing"
+
+	"github.com/farnese17/chat/pkg/storage"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func testImage(t *testing.T, format string, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	buf := &bytes.Buffer{}
+	var err error
+	switch format {
+	case "jpeg":
+		err = jpeg.Encode(buf, img, nil)
+	case "png":
+		err = png.Encode(buf, img)
+	case "gif":
+		err = gif.Encode(buf, img, nil)
+	}
+	assert.NoError(t, err)
+	return buf.Bytes()
+}
+
+func TestThumbnail(t *testing.T) {
+	ls, m, idGen := setup(t)
+	defer clear()
+
+	tests := []struct {
+		name     string
+		filename string
+		content  []byte
+		mime     string
+		width    int
+		height   int
+		// 各个大小的缩略图尺寸,nil表示没有缩略图
+		thumbs map[int][2]int
+	}{
+		{"jpeg", "a.jpg", testImage(t, "jpeg", 1024, 512), "image/jpeg", 1024, 512,
+			map[int][2]int{512: {512, 256}, 256: {256, 128}, 128: {128, 64}}},
+		{"png", "b.png", testImage(t, "png", 300, 600), "image/png", 300, 600,
+			map[int][2]int{512: {256, 512}, 256: {128, 256}, 128: {64, 128}}},
+		// 不放大
+		{"small gif", "c.gif", testImage(t, "gif", 200, 100), "image/gif", 200, 100,
+			map[int][2]int{512: {200, 100}, 256: {200, 100}, 128: {128, 64}}},
+		{"text", "d.txt", []byte("plain text"), "text/plain; charset=utf-8", 0, 0, nil},
+		{"fake image", "e.png", []byte("not an image"), "text/plain; charset=utf-8", 0, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idGen.EXPECT().NewID().Return(tt.name)
+			idGen.EXPECT().NewID().Return("public")
+			m.EXPECT().FindFileByHash(gomock.Any()).Return(nil, false, nil)
+			var saved *storage.File
+			m.EXPECT().SaveFile(gomock.Any(), "public").DoAndReturn(func(f *storage.File, publicID string) (*storage.FileReference, error) {
+				saved = f
+				return &storage.FileReference{ID: 1, FileID: 1, PublicID: publicID}, nil
+			})
+			file := createTestFile(t, fileDir, tt.filename)
+			writeTestFile(t, file, tt.content)
+			_, err := ls.Upload(1, file, tt.filename)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.mime, saved.MIME)
+			assert.Equal(t, tt.width, saved.Width)
+			assert.Equal(t, tt.height, saved.Height)
+
+			if tt.thumbs == nil {
+				_, err := ls.Thumbnail(saved, storage.DefaultThumbnailSize)
+				assert.Equal(t, storage.ErrNoThumbnail, err)
+				return
+			}
+			for size, bounds := range tt.thumbs {
+				body, err := ls.Thumbnail(saved, size)
+				assert.NoError(t, err)
+				data, _ := io.ReadAll(body)
+				body.Close()
+				cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+				assert.NoError(t, err)
+				assert.Equal(t, storage.ThumbnailType(tt.mime), "image/"+format)
+				assert.Equal(t, bounds, [2]int{cfg.Width, cfg.Height})
+			}
+			_, err = ls.Thumbnail(saved, 100)
+			assert.Equal(t, storage.ErrInvalidSize, err)
+		})
+	}
+}
+
+func TestObjectStorageThumbnail(t *testing.T) {
+	s, fake, m, idGen := setupObjectStorage(t)
+	defer clear()
+
+	idGen.EXPECT().NewID().Return("object")
+	idGen.EXPECT().NewID().Return("public")
+	m.EXPECT().FindFileByHash(gomock.Any()).Return(nil, false, nil)
+	var saved *storage.File
+	m.EXPECT().SaveFile(gomock.Any(), "public").DoAndReturn(func(f *storage.File, publicID string) (*storage.FileReference, error) {
+		saved = f
+		return &storage.FileReference{ID: 1, FileID: 1, PublicID: publicID}, nil
+	})
+	file := createTestFile(t, fileDir, "a.png")
+	writeTestFile(t, file, testImage(t, "png", 600, 300))
+	_, err := s.Upload(1, file, "a.png")
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", saved.MIME)
+
+	body, err := s.Thumbnail(saved, 256)
+	assert.NoError(t, err)
+	cfg, err := png.DecodeConfig(body)
+	body.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, 256, cfg.Width)
+	assert.Equal(t, 128, cfg.Height)
+	_, ok := fake.object(saved.Path + "_thumb512.png")
+	assert.True(t, ok)
+
+	// 旧的文件没有缩略图
+	fake.mu.Lock()
+	delete(fake.objects, "/chat/"+saved.Path+"_thumb128.png")
+	fake.mu.Unlock()
+	_, err = s.Thumbnail(saved, 128)
+	assert.Equal(t, storage.ErrNoThumbnail, err)
+}
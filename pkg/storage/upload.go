@@ -0,0 +1,289 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found")
+	ErrInvalidChunk     = errors.New("invalid chunk")
+	ErrUploadIncomplete = errors.New("upload incomplete")
+)
+
+// 清理过期上传的间隔
+const cleanupInterval = 10 * time.Minute
+
+// 分片上传的进度,offset为已接收的字节数,下一个分片的序号为offset/chunk_size
+type UploadSession struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Size       int64  `json:"size"`
+	ChunkSize  int64  `json:"chunk_size"`
+	Offset     int64  `json:"offset"`
+	UploadedBy uint   `json:"uploaded_by"`
+	// unix秒,之前没有新的分片时上传会被清理
+	ExpiresAt int64 `json:"expires_at"`
+}
+
+// 可续传的分片上传,分片按序号追加到dir中的临时文件,完成后交给Storage计算hash、去重和保存
+// 会话保存在本地目录,多节点部署时同一个上传需要发到同一个节点或使用共享目录
+type Uploads struct {
+	Dir       string
+	ChunkSize int64
+	// 最后一次写入后超过该时间没有完成的上传会被清理
+	Expiry  time.Duration
+	Storage Storage
+	IDGen   IDGenerator
+
+	locks sync.Map
+	done  chan struct{}
+}
+
+func NewUploads(dir string, chunkSize int64, expiry time.Duration, store Storage) (*Uploads, error) {
+	if chunkSize <= 0 {
+		return nil, fmt.Errorf("invalid chunk size: %d", chunkSize)
+	}
+	if err := os.MkdirAll(dir, 0740); err != nil {
+		return nil, err
+	}
+	u := &Uploads{
+		Dir:       filepath.Clean(dir),
+		ChunkSize: chunkSize,
+		Expiry:    expiry,
+		Storage:   store,
+		IDGen:     &DefaultIDGenerator{},
+		done:      make(chan struct{}),
+	}
+	go u.cleanup()
+	return u, nil
+}
+
+func (u *Uploads) Create(uploader uint, name string, size int64) (*UploadSession, error) {
+	session := &UploadSession{
+		ID:         u.IDGen.NewID(),
+		Name:       name,
+		Size:       size,
+		ChunkSize:  u.ChunkSize,
+		UploadedBy: uploader,
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(u.partPath(session.ID), nil, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(u.metaPath(session.ID), data, 0644); err != nil {
+		os.Remove(u.partPath(session.ID))
+		return nil, err
+	}
+	session.ExpiresAt = time.Now().Add(u.Expiry).Unix()
+	return session, nil
+}
+
+func (u *Uploads) Status(uploader uint, id string) (*UploadSession, error) {
+	session, unlock, err := u.acquire(uploader, id)
+	if err != nil {
+		return nil, err
+	}
+	unlock()
+	return session, nil
+}
+
+// 分片必须按序号写入,除最后一个分片外大小都是chunk_size
+// 已经写入的分片直接返回进度,客户端没有收到响应时可以重发;写入失败时丢弃该分片
+func (u *Uploads) WriteChunk(uploader uint, id string, index int64, chunk io.Reader) (*UploadSession, error) {
+	session, unlock, err := u.acquire(uploader, id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	next := (session.Offset + session.ChunkSize - 1) / session.ChunkSize
+	if index < 0 || index > next || index == next && session.Offset == session.Size {
+		return nil, ErrInvalidChunk
+	}
+	if index < next {
+		return session, nil
+	}
+
+	f, err := os.OpenFile(u.partPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(session.Offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	want := min(session.ChunkSize, session.Size-session.Offset)
+	n, err := io.CopyN(f, chunk, want)
+	if err == nil {
+		// 分片比预期的大
+		if extra, _ := chunk.Read(make([]byte, 1)); extra > 0 {
+			err = ErrInvalidChunk
+		}
+	}
+	if err != nil {
+		f.Truncate(session.Offset)
+		// 分片比预期的小或者连接中断
+		if isEOF(err) || errors.Is(err, ErrInvalidChunk) {
+			return nil, ErrInvalidChunk
+		}
+		return nil, err
+	}
+	session.Offset += n
+	session.ExpiresAt = time.Now().Add(u.Expiry).Unix()
+	return session, nil
+}
+
+// 所有分片写入后交给Storage保存,返回文件的公开ID
+func (u *Uploads) Complete(uploader uint, id string) (string, error) {
+	session, unlock, err := u.acquire(uploader, id)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if session.Offset != session.Size {
+		return "", ErrUploadIncomplete
+	}
+	f, err := os.Open(u.partPath(id))
+	if err != nil {
+		return "", err
+	}
+	// Upload会关闭文件
+	fileID, err := u.Storage.Upload(uploader, f, session.Name)
+	if err != nil {
+		return "", err
+	}
+	u.remove(id)
+	return fileID, nil
+}
+
+func (u *Uploads) Cancel(uploader uint, id string) error {
+	_, unlock, err := u.acquire(uploader, id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	u.remove(id)
+	return nil
+}
+
+// 删除最后一次写入早于now-Expiry的上传,返回删除的数量
+func (u *Uploads) RemoveExpired(now time.Time) int {
+	entries, err := os.ReadDir(u.Dir)
+	if err != nil {
+		return 0
+	}
+	var removed int
+	for _, entry := range entries {
+		id, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		unlock := u.lock(id)
+		if updatedAt, err := u.updatedAt(id); err == nil && updatedAt.Add(u.Expiry).Before(now) {
+			u.remove(id)
+			removed++
+		}
+		unlock()
+	}
+	return removed
+}
+
+func (u *Uploads) Close() {
+	close(u.done)
+}
+
+func (u *Uploads) cleanup() {
+	ticker := time.NewTicker(cleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			u.RemoveExpired(time.Now())
+		case <-u.done:
+			return
+		}
+	}
+}
+
+// 锁定并读取上传的进度,只有上传者可以访问,其他用户和不存在一样
+func (u *Uploads) acquire(uploader uint, id string) (*UploadSession, func(), error) {
+	if id == "" || filepath.Base(id) != id || strings.HasPrefix(id, ".") {
+		return nil, nil, ErrUploadNotFound
+	}
+	unlock := u.lock(id)
+	session, err := u.load(uploader, id)
+	if err != nil {
+		unlock()
+		return nil, nil, err
+	}
+	return session, unlock, nil
+}
+
+func (u *Uploads) load(uploader uint, id string) (*UploadSession, error) {
+	data, err := os.ReadFile(u.metaPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	var session *UploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	if session.UploadedBy != uploader {
+		return nil, ErrUploadNotFound
+	}
+	info, err := os.Stat(u.partPath(id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrUploadNotFound
+		}
+		return nil, err
+	}
+	session.Offset = info.Size()
+	session.ExpiresAt = info.ModTime().Add(u.Expiry).Unix()
+	return session, nil
+}
+
+// 写入分片会更新临时文件的修改时间
+func (u *Uploads) updatedAt(id string) (time.Time, error) {
+	info, err := os.Stat(u.partPath(id))
+	if err != nil {
+		info, err = os.Stat(u.metaPath(id))
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return info.ModTime(), nil
+}
+
+func (u *Uploads) remove(id string) {
+	os.Remove(u.partPath(id))
+	os.Remove(u.metaPath(id))
+	u.locks.Delete(id)
+}
+
+func (u *Uploads) lock(id string) func() {
+	mu, _ := u.locks.LoadOrStore(id, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	return mu.(*sync.Mutex).Unlock
+}
+
+func (u *Uploads) metaPath(id string) string {
+	return filepath.Join(u.Dir, id+".json")
+}
+
+func (u *Uploads) partPath(id string) string {
+	return filepath.Join(u.Dir, id+".part")
+}
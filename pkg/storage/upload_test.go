@@ -0,0 +1,124 @@
+package storage_test
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/farnese17/chat/pkg/storage"
+	"github.com/farnese17/chat/pkg/storage/mock"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupUploads(t *testing.T) (*storage.Uploads, *mock.MockStorage) {
+	ctrl := gomock.NewController(t)
+	s := mock.NewMockStorage(ctrl)
+	u, err := storage.NewUploads(t.TempDir(), 4, time.Hour, s)
+	assert.NoError(t, err)
+	t.Cleanup(u.Close)
+	return u, s
+}
+
+func TestChunkedUpload(t *testing.T) {
+	u, s := setupUploads(t)
+
+	content := []byte("0123456789")
+	session, err := u.Create(1, "a.txt", int64(len(content)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), session.ChunkSize)
+	assert.Equal(t, int64(0), session.Offset)
+
+	// 只有上传者可以访问
+	_, err = u.Status(2, session.ID)
+	assert.Equal(t, storage.ErrUploadNotFound, err)
+	_, err = u.Status(1, "../"+session.ID)
+	assert.Equal(t, storage.ErrUploadNotFound, err)
+
+	_, err = u.Complete(1, session.ID)
+	assert.Equal(t, storage.ErrUploadIncomplete, err)
+
+	tests := []struct {
+		name   string
+		index  int64
+		chunk  []byte
+		offset int64
+		err    error
+	}{
+		{"first chunk", 0, content[:4], 4, nil},
+		{"resend", 0, content[:4], 4, nil},
+		{"skip chunk", 2, content[8:], 0, storage.ErrInvalidChunk},
+		{"too small", 1, content[4:7], 0, storage.ErrInvalidChunk},
+		{"too large", 1, content[4:9], 0, storage.ErrInvalidChunk},
+		{"second chunk", 1, content[4:8], 8, nil},
+		{"last chunk", 2, content[8:], 10, nil},
+		{"after last chunk", 3, []byte("a"), 0, storage.ErrInvalidChunk},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := u.WriteChunk(1, session.ID, tt.index, bytes.NewReader(tt.chunk))
+			assert.Equal(t, tt.err, err)
+			if tt.err == nil {
+				assert.Equal(t, tt.offset, got.Offset)
+			}
+		})
+	}
+	got, err := u.Status(1, session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), got.Offset)
+
+	s.EXPECT().Upload(uint(1), gomock.Any(), "a.txt").DoAndReturn(func(uploader uint, file multipart.File, filename string) (string, error) {
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, content, data)
+		return "public", nil
+	})
+	id, err := u.Complete(1, session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "public", id)
+
+	// 完成后删除临时文件
+	_, err = u.Status(1, session.ID)
+	assert.Equal(t, storage.ErrUploadNotFound, err)
+	entries, _ := os.ReadDir(u.Dir)
+	assert.Empty(t, entries)
+}
+
+func TestCancelUpload(t *testing.T) {
+	u, _ := setupUploads(t)
+
+	session, err := u.Create(1, "a.txt", 10)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.ErrUploadNotFound, u.Cancel(2, session.ID))
+	assert.NoError(t, u.Cancel(1, session.ID))
+	assert.Equal(t, storage.ErrUploadNotFound, u.Cancel(1, session.ID))
+}
+
+func TestRemoveExpiredUploads(t *testing.T) {
+	u, _ := setupUploads(t)
+
+	expired, err := u.Create(1, "a.txt", 10)
+	assert.NoError(t, err)
+	active, err := u.Create(1, "b.txt", 10)
+	assert.NoError(t, err)
+	old := time.Now().Add(-2 * time.Hour)
+	for _, ext := range []string{".json", ".part"} {
+		os.Chtimes(filepath.Join(u.Dir, expired.ID+ext), old, old)
+	}
+
+	assert.Equal(t, 1, u.RemoveExpired(time.Now()))
+	_, err = u.Status(1, expired.ID)
+	assert.Equal(t, storage.ErrUploadNotFound, err)
+	_, err = u.Status(1, active.ID)
+	assert.NoError(t, err)
+
+	// 写入分片后重新计算过期时间
+	_, err = u.WriteChunk(1, active.ID, 0, bytes.NewReader([]byte("0123")))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, u.RemoveExpired(time.Now().Add(30*time.Minute)))
+	assert.Equal(t, 1, u.RemoveExpired(time.Now().Add(2*time.Hour)))
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 	"time"
 
@@ -27,9 +28,12 @@ type Service interface {
 	Friend() repo.FriendRepository
 	Group() repo.GroupRepository
 	Manager() repo.Manager
+	Message() repo.MessageRepository
+	Key() repo.KeyRepository
 	Cache() repo.Cache
 	Hub() websocket.HubInterface
 	Storage() storage.Storage
+	Uploads() *storage.Uploads
 
 	SetHub(hub websocket.HubInterface)
 	Shutdown()
@@ -62,9 +66,12 @@ type registry struct {
 	friendRepo repo.FriendRepository
 	groupRepo  repo.GroupRepository
 	mgrRepo    repo.Manager
+	msgRepo    repo.MessageRepository
+	keyRepo    repo.KeyRepository
 	cache      repo.Cache
 	hub        websocket.HubInterface
 	storage    storage.Storage
+	uploads    *storage.Uploads
 
 	config    config.Config
 	runningAt time.Time
@@ -78,6 +85,38 @@ func getDSN(cfg config.Config) string {
 	return dsn
 }
 
+// 文件元数据保存在数据库中,内容根据配置保存在本地或对象储存中
+func setupStorage(cfg config.Config) (storage.Storage, error) {
+	fsCfg := cfg.FileServer()
+	option := &storage.MysqlOption{
+		User:     cfg.Database().User(),
+		Password: cfg.Database().Password(),
+		Addr:     cfg.Database().Host(),
+		Port:     cfg.Database().Port(),
+		DBName:   cfg.Database().DBname(),
+	}
+	policy := &storage.Policy{
+		Quota: storage.Quota{
+			MaxBytes:    fsCfg.QuotaBytes(),
+			MaxFiles:    fsCfg.QuotaFiles(),
+			MaxFileSize: fsCfg.MaxFileSize(),
+		},
+		Allowed: fsCfg.AllowedTypes(),
+		Denied:  fsCfg.DeniedTypes(),
+	}
+	if fsCfg.Backend() == config.BackendS3 {
+		client := &storage.S3Client{
+			Endpoint:  fsCfg.Addr(),
+			Region:    fsCfg.Region(),
+			Bucket:    fsCfg.Bucket(),
+			AccessKey: fsCfg.AccessKey(),
+			SecretKey: fsCfg.SecretKey(),
+		}
+		return storage.NewObjectStorage(client, fsCfg.Path(), fsCfg.LogPath(), fsCfg.LinkSecret(), option, policy)
+	}
+	return storage.NewLocalStorage(fsCfg.Path(), fsCfg.LogPath(), fsCfg.LinkSecret(), option, policy)
+}
+
 func handleDBConnectError(err error) {
 	if err != nil {
 		fmt.Println("Initial db failed: " + err.Error())
@@ -117,19 +156,18 @@ func initRegistry(configPath string) (*registry, error) {
 
 	var fs storage.Storage
 	for {
-		fs, err = storage.NewLocalStorage(cfg.FileServer().Path(), cfg.FileServer().LogPath(), &storage.MysqlOption{
-			User:     cfg.Database().User(),
-			Password: cfg.Database().Password(),
-			Addr:     cfg.Database().Host(),
-			Port:     cfg.Database().Port(),
-			DBName:   cfg.Database().DBname(),
-		})
+		fs, err = setupStorage(cfg)
 		if err != nil {
 			handleDBConnectError(err)
 			continue
 		}
 		break
 	}
+	uploads, err := storage.NewUploads(filepath.Join(cfg.FileServer().Path(), "uploads"),
+		cfg.FileServer().ChunkSize(), cfg.FileServer().UploadExpiry(), fs)
+	if err != nil {
+		return nil, err
+	}
 
 	reg := &registry{
 		mu:        sync.RWMutex{},
@@ -139,6 +177,7 @@ func initRegistry(configPath string) (*registry, error) {
 		logger:    logger,
 		config:    cfg,
 		storage:   fs,
+		uploads:   uploads,
 		runningAt: time.Now(),
 	}
 	reg.initRepository()
@@ -156,6 +195,8 @@ func (r *registry) initRepository() {
 	r.friendRepo = repo.NewSQLFriendRepository(r.db)
 	r.groupRepo = repo.NewSQLGroupRepository(r.db)
 	r.mgrRepo = repo.NewSQLManagerRepository(r.db)
+	r.msgRepo = repo.NewSQLMessageRepository(r.db)
+	r.keyRepo = repo.NewSQLKeyRepository(r.db)
 }
 
 func (r *registry) Uptime() time.Duration {
@@ -186,6 +227,14 @@ func (r *registry) Manager() repo.Manager {
 	return r.mgrRepo
 }
 
+func (r *registry) Message() repo.MessageRepository {
+	return r.msgRepo
+}
+
+func (r *registry) Key() repo.KeyRepository {
+	return r.keyRepo
+}
+
 func (r *registry) Cache() repo.Cache {
 	return r.cache
 }
@@ -202,11 +251,16 @@ func (r *registry) SetHub(hub websocket.HubInterface) {
 	r.hub = hub
 }
 
+func (r *registry) Uploads() *storage.Uploads {
+	return r.uploads
+}
+
 func (r *registry) Storage() storage.Storage {
 	return r.storage
 }
 
 func (r *registry) Shutdown() {
+	r.uploads.Close()
 	r.storage.Close()
 	r.sqlDB.Close()
 	r.cache.Stop()
@@ -1,9 +1,11 @@
 package repository
 
 import (
+	"cmp"
 	"container/heap"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"hash/fnv"
 	"math"
 	"math/rand/v2"
@@ -32,7 +34,10 @@ type Cache interface {
 	GetOfflineMessages(id uint) ([]string, error)
 	GetPendingMessages() ([]string, error)
 	RemoveOfflineMessage(id uint, message string)
+	UpdateOfflineMessage(id uint, msgID string, update func(message string) string) error
 	RemovePendingMessage(msgID string, receiver uint, sign int64) error
+	RemoveOfflineMessages(id uint, msgIDs []string) error
+	RemovePendingMessages(from, to int64, msgIDs []string) error
 	GetMembersAndCache(gid uint) ([]uint, error)
 	GetMembers(gid uint) ([]uint, error)
 	GetAdmin(gid uint) ([]uint, error)
@@ -45,8 +50,32 @@ type Cache interface {
 	Remove(key string)
 	Flush() error
 
-	SetToken(id uint, token string, expire time.Duration)
-	GetToken(id uint) (string, error)
+	GetFriendStatus(id1, id2 uint) (int, error)
+	SetFriendStatus(id1, id2 uint, status int)
+	GetGroupMute(gid uint) (*m.GroupMuteInfo, error)
+	RemoveGroupMute(gid uint) error
+	SetReadCursor(uid, peer, gid, seq uint) (bool, error)
+	GetReadCursor(uid, peer, gid uint) (uint, error)
+	GetReadCursors(uid uint) (direct map[uint]uint, group map[uint]uint, err error)
+	AddReadBy(msgID string, uid uint) (int64, error)
+	SetLastSeen(id uint, lastSeen int64)
+	GetLastSeen(ids ...uint) (map[uint]int64, error)
+
+	AddRoute(node string, uid uint, device string) error
+	RemoveRoute(node string, uid uint, device string, last bool) error
+	GetRoutes(uids ...uint) (map[uint][]m.Route, error)
+	NodeHeartbeat(node string) (bool, error)
+	RemoveStaleNodes(timeout time.Duration) ([]string, error)
+	RemoveNode(node string) error
+	Publish(channel string, payload []byte) (int64, error)
+	Subscribe(channel string, handler func(payload string)) (func() error, error)
+
+	SetToken(id uint, device, token string, expire time.Duration)
+	GetToken(id uint, device string) (string, error)
+	AddSession(id uint, session *m.Session)
+	GetSessions(id uint) ([]*m.Session, error)
+	RemoveSession(id uint, device string) (bool, error)
+	RemoveTokens(id uint) error
 	SetBanned(id string, level int, expire time.Duration)
 	IsBanned(id uint) bool
 	IsBanPermanent(id uint) bool
@@ -219,6 +248,103 @@ func (rc *RedisCache) RemoveOfflineMessage(id uint, message string) {
 	rc.removeFromSet(key, message)
 }
 
+// 修改离线消息中ID为msgID的消息,update返回空字符串时删除该消息
+func (rc *RedisCache) UpdateOfflineMessage(id uint, msgID string, update func(message string) string) error {
+	// 先提交管道中尚未写入的离线消息
+	if err := rc.Flush(); err != nil {
+		return err
+	}
+	key := m.CacheMessage + strconv.Itoa(int(id))
+	messages, err := rc.getFromSet(key)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	for _, message := range messages {
+		var header struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(message), &header); err != nil || header.ID != msgID {
+			continue
+		}
+		newMessage := update(message)
+		if newMessage == message {
+			continue
+		}
+		_, err := rc.client.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.SRem(key, message)
+			if newMessage != "" {
+				pipe.SAdd(key, newMessage)
+			}
+			return nil
+		})
+		if err != nil {
+			rc.service.Logger().Error("Failed to update offline message", zap.Error(err))
+			return err
+		}
+	}
+	return nil
+}
+
+// 删除离线消息中ID在msgIDs中的消息
+func (rc *RedisCache) RemoveOfflineMessages(id uint, msgIDs []string) error {
+	if err := rc.Flush(); err != nil {
+		return err
+	}
+	key := m.CacheMessage + strconv.Itoa(int(id))
+	messages, err := rc.getFromSet(key)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	removed := matchMessageID(messages, msgIDs)
+	if len(removed) == 0 {
+		return nil
+	}
+	return rc.handleError(rc.client.SRem(key, removed...).Err())
+}
+
+// 删除时间在from和to之间且ID在msgIDs中的待确认消息,待确认消息的score为消息时间
+func (rc *RedisCache) RemovePendingMessages(from, to int64, msgIDs []string) error {
+	key := m.CacheMessagePending
+	min, max := strconv.FormatInt(from, 10), strconv.FormatInt(to, 10)
+	var offset int64
+	for {
+		messages, err := rc.client.ZRangeByScore(key, redis.ZRangeBy{Min: min, Max: max, Offset: offset, Count: 500}).Result()
+		if err != nil {
+			return rc.handleError(err)
+		}
+		removed := matchMessageID(messages, msgIDs)
+		if len(removed) > 0 {
+			if err := rc.client.ZRem(key, removed...).Err(); err != nil {
+				return rc.handleError(err)
+			}
+		}
+		if len(messages) < 500 {
+			return nil
+		}
+		offset += int64(len(messages) - len(removed))
+	}
+}
+
+func matchMessageID(messages []string, msgIDs []string) []any {
+	var matched []any
+	for _, message := range messages {
+		var header struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(message), &header); err == nil && slices.Contains(msgIDs, header.ID) {
+			matched = append(matched, message)
+		}
+	}
+	return matched
+}
+
 func (rc *RedisCache) GetPendingMessages() ([]string, error) {
 	key := m.CacheMessagePending
 	count := rc.service.Config().Common().ResendBatchSize()
@@ -494,15 +620,441 @@ func (r *RedisCache) getFromSortedSet(key string, start, end string) ([]string,
 	return data, r.handleError(err)
 }
 
+// friend status
+// 获取好友状态并缓存,没有记录视为陌生人
+func (rc *RedisCache) GetFriendStatus(id1, id2 uint) (int, error) {
+	key := friendStatusKey(id1, id2)
+	val, err := rc.get(key)
+	if err == nil {
+		status, err := strconv.Atoi(val)
+		if err == nil {
+			return status, nil
+		}
+	} else if !errors.Is(err, errorsx.ErrNotFound) {
+		return 0, err
+	}
+
+	if id1 > id2 {
+		id1, id2 = id2, id1
+	}
+	status := m.FSNull
+	friend, err := rc.service.Friend().QueryStatus(id1, id2)
+	if err != nil {
+		if !errors.Is(err, errorsx.ErrRecordNotFound) {
+			rc.service.Logger().Error("Failed to query friend status", zap.Error(err))
+			return 0, err
+		}
+	} else {
+		status = friend.Status
+	}
+	rc.SetFriendStatus(id1, id2, status)
+	return status, nil
+}
+
+func (rc *RedisCache) SetFriendStatus(id1, id2 uint, status int) {
+	rc.set(friendStatusKey(id1, id2), status, friendStatusExpire)
+}
+
+// 获取群组禁言状态并缓存,变更时删除缓存
+func (rc *RedisCache) GetGroupMute(gid uint) (*m.GroupMuteInfo, error) {
+	key := m.CacheGroupMute + strconv.FormatUint(uint64(gid), 10)
+	val, err := rc.get(key)
+	if err == nil {
+		var info m.GroupMuteInfo
+		if err := json.Unmarshal([]byte(val), &info); err == nil {
+			return &info, nil
+		}
+	} else if !errors.Is(err, errorsx.ErrNotFound) {
+		return nil, err
+	}
+
+	info, err := rc.service.Group().MuteInfo(gid)
+	if err != nil {
+		rc.service.Logger().Error("Failed to query group mute", zap.Error(err))
+		return nil, err
+	}
+	data, _ := json.Marshal(info)
+	rc.set(key, data, groupCacheExpire())
+	return info, nil
+}
+
+func (rc *RedisCache) RemoveGroupMute(gid uint) error {
+	rc.remove(m.CacheGroupMute + strconv.FormatUint(uint64(gid), 10))
+	return rc.Flush()
+}
+
+// 更新读游标,只会前进,返回值表示是否更新
+func (rc *RedisCache) SetReadCursor(uid, peer, gid, seq uint) (bool, error) {
+	/*
+	   KEYS[1]: key
+	   ARGV[1]: field
+	   ARGV[2]: seq
+	*/
+	advance := redis.NewScript(`
+    local current = tonumber(redis.call("HGET",KEYS[1],ARGV[1]) or "0")
+    local seq = tonumber(ARGV[2])
+    if seq <= current then
+        return 0
+    end
+    redis.call("HSET",KEYS[1],ARGV[1],seq)
+    return 1
+    `)
+
+	key := m.CacheReadCursor + strconv.FormatUint(uint64(uid), 10)
+	result, err := advance.Run(rc.client, []string{key}, readCursorField(peer, gid), seq).Int()
+	if err != nil {
+		rc.service.Logger().Error("Failed to set read cursor", zap.Error(err))
+		return false, err
+	}
+	return result == 1, nil
+}
+
+func (rc *RedisCache) GetReadCursor(uid, peer, gid uint) (uint, error) {
+	key := m.CacheReadCursor + strconv.FormatUint(uint64(uid), 10)
+	seq, err := rc.client.HGet(key, readCursorField(peer, gid)).Uint64()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return uint(seq), nil
+}
+
+// 获取用户全部读游标,分别以对方id和群组id为键
+func (rc *RedisCache) GetReadCursors(uid uint) (map[uint]uint, map[uint]uint, error) {
+	key := m.CacheReadCursor + strconv.FormatUint(uint64(uid), 10)
+	data, err := rc.client.HGetAll(key).Result()
+	if err != nil {
+		return nil, nil, err
+	}
+	direct, group := make(map[uint]uint), make(map[uint]uint)
+	for field, val := range data {
+		id, err1 := strconv.ParseUint(field[2:], 10, 64)
+		seq, err2 := strconv.ParseUint(val, 10, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		if strings.HasPrefix(field, "g:") {
+			group[uint(id)] = uint(seq)
+		} else {
+			direct[uint(id)] = uint(seq)
+		}
+	}
+	return direct, group, nil
+}
+
+// 记录群聊消息的已读用户,返回已读人数
+func (rc *RedisCache) AddReadBy(msgID string, uid uint) (int64, error) {
+	key := m.CacheReadBy + msgID
+	var count *redis.IntCmd
+	_, err := rc.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd(key, uid)
+		pipe.Expire(key, readByExpire)
+		count = pipe.SCard(key)
+		return nil
+	})
+	if err != nil {
+		rc.service.Logger().Error("Failed to add read by", zap.Error(err))
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+func (rc *RedisCache) SetLastSeen(id uint, lastSeen int64) {
+	rc.pipe.HSet(m.CacheLastSeen, strconv.FormatUint(uint64(id), 10), lastSeen)
+	rc.incrCount(1)
+}
+
+// 获取用户最后在线时间,没有记录的用户不会出现在结果中
+func (rc *RedisCache) GetLastSeen(ids ...uint) (map[uint]int64, error) {
+	result := make(map[uint]int64)
+	if len(ids) == 0 {
+		return result, nil
+	}
+	fields := make([]string, len(ids))
+	for i, id := range ids {
+		fields[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	data, err := rc.client.HMGet(m.CacheLastSeen, fields...).Result()
+	if err != nil {
+		rc.service.Logger().Error("Failed to get last seen", zap.Error(err))
+		return nil, err
+	}
+	for i, val := range data {
+		str, ok := val.(string)
+		if !ok {
+			continue
+		}
+		if t, err := strconv.ParseInt(str, 10, 64); err == nil {
+			result[ids[i]] = t
+		}
+	}
+	return result, nil
+}
+
+// 登记用户设备所在的节点,同时记录节点上的用户用于节点下线后清理
+func (rc *RedisCache) AddRoute(node string, uid uint, device string) error {
+	id := strconv.FormatUint(uint64(uid), 10)
+	_, err := rc.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd(m.CacheRoute+id, routeMember(node, device))
+		pipe.SAdd(m.CacheNodeUsers+node, id)
+		return nil
+	})
+	if err != nil {
+		rc.service.Logger().Error("Failed to add route",
+			zap.String("node", node), zap.Uint("uid", uid), zap.Error(err))
+	}
+	return err
+}
+
+// last表示用户在该节点上已经没有其他设备
+func (rc *RedisCache) RemoveRoute(node string, uid uint, device string, last bool) error {
+	id := strconv.FormatUint(uint64(uid), 10)
+	_, err := rc.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SRem(m.CacheRoute+id, routeMember(node, device))
+		if last {
+			pipe.SRem(m.CacheNodeUsers+node, id)
+		}
+		return nil
+	})
+	if err != nil {
+		rc.service.Logger().Error("Failed to remove route",
+			zap.String("node", node), zap.Uint("uid", uid), zap.Error(err))
+	}
+	return err
+}
+
+func (rc *RedisCache) GetRoutes(uids ...uint) (map[uint][]m.Route, error) {
+	result := make(map[uint][]m.Route)
+	if len(uids) == 0 {
+		return result, nil
+	}
+	cmds := make([]*redis.StringSliceCmd, len(uids))
+	_, err := rc.client.Pipelined(func(pipe redis.Pipeliner) error {
+		for i, uid := range uids {
+			cmds[i] = pipe.SMembers(m.CacheRoute + strconv.FormatUint(uint64(uid), 10))
+		}
+		return nil
+	})
+	if err != nil {
+		rc.service.Logger().Error("Failed to get routes", zap.Error(err))
+		return nil, err
+	}
+	for i, cmd := range cmds {
+		for _, member := range cmd.Val() {
+			node, device, ok := strings.Cut(member, "|")
+			if !ok {
+				continue
+			}
+			result[uids[i]] = append(result[uids[i]], m.Route{Node: node, Device: device})
+		}
+	}
+	return result, nil
+}
+
+func routeMember(node, device string) string {
+	return node + "|" + device
+}
+
+// 更新节点心跳,返回值表示节点是否是新加入的(首次启动或已被当作下线清理)
+func (rc *RedisCache) NodeHeartbeat(node string) (bool, error) {
+	added, err := rc.client.ZAdd(m.CacheNodes, redis.Z{
+		Score:  float64(time.Now().UnixMilli()),
+		Member: node,
+	}).Result()
+	if err != nil {
+		rc.service.Logger().Error("Failed to update node heartbeat", zap.String("node", node), zap.Error(err))
+		return false, err
+	}
+	return added > 0, nil
+}
+
+// 清理超时没有心跳的节点,返回被清理的节点
+func (rc *RedisCache) RemoveStaleNodes(timeout time.Duration) ([]string, error) {
+	max := strconv.FormatInt(time.Now().Add(-timeout).UnixMilli(), 10)
+	nodes, err := rc.client.ZRangeByScore(m.CacheNodes, redis.ZRangeBy{Min: "-inf", Max: max}).Result()
+	if err != nil {
+		rc.service.Logger().Error("Failed to get stale nodes", zap.Error(err))
+		return nil, err
+	}
+	removed := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if err := rc.RemoveNode(node); err != nil {
+			continue
+		}
+		removed = append(removed, node)
+	}
+	return removed, nil
+}
+
+// 删除节点和该节点上所有用户的路由
+func (rc *RedisCache) RemoveNode(node string) error {
+	/*
+	   KEYS[1]: 节点上的用户
+	   KEYS[2]: 节点列表
+	   ARGV[1]: 节点ID
+	   ARGV[2]: 路由前缀
+	*/
+	removeNode := redis.NewScript(`
+    local prefix = ARGV[1] .. "|"
+    local users = redis.call("SMEMBERS",KEYS[1])
+    for _,uid in ipairs(users) do
+        local key = ARGV[2] .. uid
+        for _,route in ipairs(redis.call("SMEMBERS",key)) do
+            if string.sub(route,1,#prefix) == prefix then
+                redis.call("SREM",key,route)
+            end
+        end
+    end
+    redis.call("DEL",KEYS[1])
+    redis.call("ZREM",KEYS[2],ARGV[1])
+    return #users
+    `)
+	err := removeNode.Run(rc.client, []string{m.CacheNodeUsers + node, m.CacheNodes}, node, m.CacheRoute).Err()
+	if err != nil && !errors.Is(err, redis.Nil) {
+		rc.service.Logger().Error("Failed to remove node", zap.String("node", node), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// 返回值为收到消息的订阅者数量
+func (rc *RedisCache) Publish(channel string, payload []byte) (int64, error) {
+	n, err := rc.client.Publish(channel, payload).Result()
+	if err != nil {
+		rc.service.Logger().Error("Failed to publish message", zap.String("channel", channel), zap.Error(err))
+		return 0, err
+	}
+	return n, nil
+}
+
+// 订阅成功后在后台调用handler,返回值用于取消订阅
+func (rc *RedisCache) Subscribe(channel string, handler func(payload string)) (func() error, error) {
+	pubsub := rc.client.Subscribe(channel)
+	if _, err := pubsub.Receive(); err != nil {
+		pubsub.Close()
+		rc.service.Logger().Error("Failed to subscribe channel", zap.String("channel", channel), zap.Error(err))
+		return nil, err
+	}
+	go func() {
+		for msg := range pubsub.Channel() {
+			handler(msg.Payload)
+		}
+	}()
+	return pubsub.Close, nil
+}
+
+func readCursorField(peer, gid uint) string {
+	if gid != 0 {
+		return "g:" + strconv.FormatUint(uint64(gid), 10)
+	}
+	return "u:" + strconv.FormatUint(uint64(peer), 10)
+}
+
+func friendStatusKey(id1, id2 uint) string {
+	if id1 > id2 {
+		id1, id2 = id2, id1
+	}
+	return fmt.Sprintf("%s%d:%d", m.CacheFriendStatus, id1, id2)
+}
+
 // token
-func (rc *RedisCache) SetToken(id uint, token string, expire time.Duration) {
-	key := m.CacheToken + strconv.FormatUint(uint64(id), 10)
-	rc.set(key, token, expire)
+func (rc *RedisCache) SetToken(id uint, device, token string, expire time.Duration) {
+	rc.set(tokenKey(id, device), token, expire)
 }
-func (rc *RedisCache) GetToken(id uint) (string, error) {
-	key := m.CacheToken + strconv.FormatUint(uint64(id), 10)
-	return rc.get(key)
+func (rc *RedisCache) GetToken(id uint, device string) (string, error) {
+	return rc.get(tokenKey(id, device))
+}
+
+func tokenKey(id uint, device string) string {
+	return m.CacheToken + strconv.FormatUint(uint64(id), 10) + ":" + device
+}
+
+// 会话随最后一次登录续期,单个会话的过期由expire_at判断
+func (rc *RedisCache) AddSession(id uint, session *m.Session) {
+	key := m.CacheSession + strconv.FormatUint(uint64(id), 10)
+	data, _ := json.Marshal(session)
+	rc.pipe.HSet(key, session.Device, data)
+	rc.pipe.ExpireAt(key, time.Unix(session.ExpireAt, 0))
+	rc.incrCount(2)
+}
+
+// 获取未过期的会话,同时清理已过期的会话
+func (rc *RedisCache) GetSessions(id uint) ([]*m.Session, error) {
+	if err := rc.Flush(); err != nil {
+		return nil, err
+	}
+	key := m.CacheSession + strconv.FormatUint(uint64(id), 10)
+	data, err := rc.client.HGetAll(key).Result()
+	if err != nil {
+		rc.service.Logger().Error("Failed to get sessions", zap.Uint("id", id), zap.Error(err))
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	sessions := make([]*m.Session, 0, len(data))
+	var expired []string
+	for device, val := range data {
+		var session m.Session
+		if err := json.Unmarshal([]byte(val), &session); err != nil || session.ExpireAt <= now {
+			expired = append(expired, device)
+			continue
+		}
+		sessions = append(sessions, &session)
+	}
+	if len(expired) > 0 {
+		rc.client.HDel(key, expired...)
+	}
+	slices.SortFunc(sessions, func(a, b *m.Session) int {
+		return cmp.Compare(b.LoginAt, a.LoginAt)
+	})
+	return sessions, nil
 }
+
+// 删除会话和对应的token,返回值表示会话是否存在
+func (rc *RedisCache) RemoveSession(id uint, device string) (bool, error) {
+	key := m.CacheSession + strconv.FormatUint(uint64(id), 10)
+	var removed *redis.IntCmd
+	_, err := rc.client.TxPipelined(func(pipe redis.Pipeliner) error {
+		removed = pipe.HDel(key, device)
+		pipe.Del(tokenKey(id, device))
+		return nil
+	})
+	if err != nil {
+		rc.service.Logger().Error("Failed to remove session",
+			zap.Uint("id", id), zap.String("device", device), zap.Error(err))
+		return false, err
+	}
+	return removed.Val() > 0, nil
+}
+// 删除用户所有设备的token和会话,用于封禁和删除管理员
+func (rc *RedisCache) RemoveTokens(id uint) error {
+	// 先提交管道中尚未写入的token
+	if err := rc.Flush(); err != nil {
+		return err
+	}
+	keys := []string{m.CacheSession + strconv.FormatUint(uint64(id), 10)}
+	var cursor uint64
+	for {
+		data, next, err := rc.client.Scan(cursor, tokenKey(id, "*"), 1000).Result()
+		if err != nil {
+			rc.service.Logger().Error("Failed to scan tokens", zap.Uint("id", id), zap.Error(err))
+			return err
+		}
+		keys = append(keys, data...)
+		if next == 0 {
+			break
+		}
+		cursor = next
+	}
+	if err := rc.client.Del(keys...).Err(); err != nil {
+		rc.service.Logger().Error("Failed to remove tokens", zap.Uint("id", id), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
 func (rc *RedisCache) SetBanned(id string, level int, expire time.Duration) {
 	key := m.CacheBanned + id
 	rc.set(key, level, expire)
@@ -784,6 +1336,12 @@ func (w *warmer) warmGroups(s Service) error {
 	return nil
 }
 
+// 好友状态缓存有效期,状态变更时会直接覆盖
+const friendStatusExpire = 10 * time.Minute
+
+// 群聊消息已读用户记录的有效期
+const readByExpire = 7 * 24 * time.Hour
+
 func groupCacheExpire() time.Duration {
 	scope := []int{1, -1}
 	jitter := time.Duration(rand.IntN(30)*scope[rand.IntN(2)]) * time.Second
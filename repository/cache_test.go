@@ -3,7 +3,11 @@ package repository_test
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -12,16 +16,19 @@ import (
 	repo "github.com/farnese17/chat/repository"
 	"github.com/farnese17/chat/service/mock"
 	m "github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
 	"github.com/farnese17/chat/utils/logger"
 	ws "github.com/farnese17/chat/websocket"
 	"github.com/go-redis/redis"
 	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
 	"github.com/stretchr/testify/assert"
 )
 
 var (
 	cache   repo.Cache
 	u       *mock.MockUserRepository
+	f       *mock.MockFriendRepository
 	g       *mock.MockGroupRepository
 	client  *redis.Client
 	service *mock.MockService
@@ -38,10 +45,12 @@ func setupCache(t *testing.T) {
 	service = mock.NewMockService(ctrl)
 	u = mock.NewMockUserRepository(ctrl)
 	g = mock.NewMockGroupRepository(ctrl)
+	f = mock.NewMockFriendRepository(ctrl)
 	service.EXPECT().Logger().Return(logger).AnyTimes()
 	service.EXPECT().Config().Return(cfg).AnyTimes()
 	service.EXPECT().User().Return(u).AnyTimes()
 	service.EXPECT().Group().Return(g).AnyTimes()
+	service.EXPECT().Friend().Return(f).AnyTimes()
 
 	cache = repo.NewRedisCache(client, service)
 	service.EXPECT().Cache().Return(cache).AnyTimes()
@@ -84,6 +93,64 @@ func TestOfflineMessages(t *testing.T) {
 	})
 }
 
+func TestFriendStatus(t *testing.T) {
+	setupCache(t)
+	defer closeConnection()
+
+	id1, id2 := uint(1e5+1), uint(1e5+2)
+	// 未命中缓存,从数据库获取
+	f.EXPECT().QueryStatus(id1, id2).Return(&m.Friend{User1: id1, User2: id2, Status: m.FSAdded}, nil)
+	status, err := cache.GetFriendStatus(id2, id1)
+	assert.NoError(t, err)
+	assert.Equal(t, m.FSAdded, status)
+	cache.Flush()
+
+	// 命中缓存
+	status, err = cache.GetFriendStatus(id1, id2)
+	assert.NoError(t, err)
+	assert.Equal(t, m.FSAdded, status)
+
+	// 状态变更直接覆盖
+	cache.SetFriendStatus(id2, id1, m.FSBlock1To2)
+	cache.Flush()
+	status, err = cache.GetFriendStatus(id1, id2)
+	assert.NoError(t, err)
+	assert.Equal(t, m.FSBlock1To2, status)
+
+	// 没有记录视为陌生人
+	f.EXPECT().QueryStatus(id1, id2+1).Return(nil, errorsx.ErrRecordNotFound)
+	status, err = cache.GetFriendStatus(id1, id2+1)
+	assert.NoError(t, err)
+	assert.Equal(t, m.FSNull, status)
+}
+
+func TestGroupMute(t *testing.T) {
+	setupCache(t)
+	defer closeConnection()
+
+	gid := uint(1e9 + 1)
+	expected := &m.GroupMuteInfo{MuteAll: true, Members: map[uint]int64{uint(1e5 + 1): time.Now().Unix() + 60}}
+	// 未命中缓存,从数据库获取
+	g.EXPECT().MuteInfo(gid).Return(expected, nil)
+	info, err := cache.GetGroupMute(gid)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, info)
+	cache.Flush()
+
+	// 命中缓存
+	info, err = cache.GetGroupMute(gid)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, info)
+
+	// 删除缓存后重新获取
+	assert.NoError(t, cache.RemoveGroupMute(gid))
+	g.EXPECT().MuteInfo(gid).Return(&m.GroupMuteInfo{Members: map[uint]int64{}}, nil)
+	info, err = cache.GetGroupMute(gid)
+	assert.NoError(t, err)
+	assert.False(t, info.MuteAll)
+	assert.Empty(t, info.Members)
+}
+
 func TestGetMembersAndCache(t *testing.T) {
 	setupCache(t)
 	defer closeConnection()
@@ -246,6 +313,341 @@ func removeMessage(count int, expected *[]*ws.ChatMsg) {
 	*expected = (*expected)[count:]
 }
 
+func TestUpdateOfflineMessage(t *testing.T) {
+	setupCache(t)
+	defer closeConnection()
+
+	id := uint(1e5 + 1)
+	msgs := []ws.ChatMsg{
+		{ID: "a", Type: ws.Chat, From: id + 1, To: id, Body: "abcd"},
+		{ID: "b", Type: ws.Chat, From: id + 1, To: id, Body: "abcd"},
+	}
+	for _, msg := range msgs {
+		cache.StoreOfflineMessage(id, msg)
+	}
+
+	// 替换内容
+	msgs[0].Body = "efgh"
+	edited, _ := json.Marshal(msgs[0])
+	err := cache.UpdateOfflineMessage(id, "a", func(message string) string {
+		return string(edited)
+	})
+	assert.NoError(t, err)
+	// 删除
+	err = cache.UpdateOfflineMessage(id, "b", func(message string) string {
+		return ""
+	})
+	assert.NoError(t, err)
+	// 不存在的消息不会调用update
+	err = cache.UpdateOfflineMessage(id, "c", func(message string) string {
+		t.Error("unexpected update")
+		return ""
+	})
+	assert.NoError(t, err)
+
+	data, err := cache.GetOfflineMessages(id)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{string(edited)}, data)
+}
+
+func TestRemoveExpiredMessages(t *testing.T) {
+	setupCache(t)
+	defer closeConnection()
+
+	id := uint(1e5 + 1)
+	now := time.Now().UnixMilli()
+	msgs := []ws.ChatMsg{
+		{ID: "a", Type: ws.Chat, From: id + 1, To: id, Body: "abcd", Time: now - 2000},
+		{ID: "b", Type: ws.Chat, From: id + 1, To: id, Body: "abcd", Time: now - 1000},
+		{ID: "c", Type: ws.Chat, From: id + 1, To: id, Body: "abcd", Time: now},
+	}
+	for _, msg := range msgs {
+		cache.StoreOfflineMessage(id, msg)
+		cache.StorePendingMessage(msg, msg.Time)
+	}
+	cache.Flush()
+
+	// c 不在时间范围内
+	err := cache.RemoveOfflineMessages(id, []string{"a", "b"})
+	assert.NoError(t, err)
+	err = cache.RemovePendingMessages(now-2000, now-1000, []string{"a", "b", "c"})
+	assert.NoError(t, err)
+
+	data, err := cache.GetOfflineMessages(id)
+	assert.NoError(t, err)
+	assert.Len(t, data, 1)
+	assert.Contains(t, data[0], `"id":"c"`)
+
+	result, err := cache.GetPendingMessages()
+	assert.NoError(t, err)
+	for _, message := range result {
+		assert.NotContains(t, message, `"id":"a"`)
+		assert.NotContains(t, message, `"id":"b"`)
+	}
+	cache.RemovePendingMessage("c", id, now)
+}
+
+func TestReadCursor(t *testing.T) {
+	setupCache(t)
+	defer closeConnection()
+
+	uid, peer, gid := uint(1e5+1), uint(1e5+2), uint(1e9+1)
+	// 游标只会前进
+	tests := []struct {
+		peer, gid, seq uint
+		expected       bool
+	}{
+		{peer, 0, 10, true},
+		{peer, 0, 5, false},
+		{peer, 0, 10, false},
+		{peer, 0, 11, true},
+		{0, gid, 3, true},
+	}
+	for _, tt := range tests {
+		advanced, err := cache.SetReadCursor(uid, tt.peer, tt.gid, tt.seq)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.expected, advanced)
+	}
+
+	seq, err := cache.GetReadCursor(uid, peer, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(11), seq)
+	seq, err = cache.GetReadCursor(peer, uid, 0)
+	assert.NoError(t, err)
+	assert.Zero(t, seq)
+
+	direct, group, err := cache.GetReadCursors(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint]uint{peer: 11}, direct)
+	assert.Equal(t, map[uint]uint{gid: 3}, group)
+
+	// 重复已读不重复计数
+	for i, id := range []uint{uid, peer, uid} {
+		count, err := cache.AddReadBy("msg", id)
+		assert.NoError(t, err)
+		assert.Equal(t, int64(min(i+1, 2)), count)
+	}
+}
+
+func TestLastSeen(t *testing.T) {
+	setupCache(t)
+	defer closeConnection()
+
+	a, b, c := uint(1e5+1), uint(1e5+2), uint(1e5+3)
+	cache.SetLastSeen(a, 100)
+	cache.SetLastSeen(b, 200)
+	cache.SetLastSeen(a, 300)
+	cache.Flush()
+
+	got, err := cache.GetLastSeen(a, b, c)
+	assert.NoError(t, err)
+	assert.Equal(t, map[uint]int64{a: 300, b: 200}, got)
+
+	got, err = cache.GetLastSeen()
+	assert.NoError(t, err)
+	assert.Empty(t, got)
+}
+
+func TestSessions(t *testing.T) {
+	setupCache(t)
+	defer closeConnection()
+
+	uid := uint(1e5 + 1)
+	now := time.Now()
+	sessions := []*m.Session{
+		{Device: "phone", LoginAt: now.Unix() - 10, ExpireAt: now.Add(time.Hour).Unix()},
+		{Device: "desktop", LoginAt: now.Unix(), ExpireAt: now.Add(time.Hour).Unix()},
+		{Device: "expired", LoginAt: now.Unix() - 20, ExpireAt: now.Unix() - 1},
+	}
+	for _, session := range sessions {
+		cache.AddSession(uid, session)
+		cache.SetToken(uid, session.Device, "token-"+session.Device, time.Hour)
+	}
+
+	got, err := cache.GetSessions(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, []*m.Session{sessions[1], sessions[0]}, got)
+
+	token, err := cache.GetToken(uid, "phone")
+	assert.NoError(t, err)
+	assert.Equal(t, "token-phone", token)
+
+	removed, err := cache.RemoveSession(uid, "phone")
+	assert.NoError(t, err)
+	assert.True(t, removed)
+	removed, err = cache.RemoveSession(uid, "phone")
+	assert.NoError(t, err)
+	assert.False(t, removed)
+	_, err = cache.GetToken(uid, "phone")
+	assert.ErrorIs(t, err, errorsx.ErrNotFound)
+
+	got, err = cache.GetSessions(uid)
+	assert.NoError(t, err)
+	assert.Equal(t, []*m.Session{sessions[1]}, got)
+}
+
+func TestCluster(t *testing.T) {
+	setupCache(t)
+	defer closeConnection()
+
+	uid := uint(1e5 + 1)
+	assert.NoError(t, cache.AddRoute("n1", uid, "phone"))
+	assert.NoError(t, cache.AddRoute("n1", uid, "desktop"))
+	assert.NoError(t, cache.AddRoute("n2", uid, "pad"))
+	assert.NoError(t, cache.AddRoute("n2", uid+1, "phone"))
+
+	t.Run("routes", func(t *testing.T) {
+		got, err := cache.GetRoutes(uid, uid+1, uid+2)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []m.Route{
+			{Node: "n1", Device: "phone"}, {Node: "n1", Device: "desktop"}, {Node: "n2", Device: "pad"},
+		}, got[uid])
+		assert.Equal(t, []m.Route{{Node: "n2", Device: "phone"}}, got[uid+1])
+		assert.Empty(t, got[uid+2])
+
+		assert.NoError(t, cache.RemoveRoute("n1", uid, "phone", false))
+		got, err = cache.GetRoutes(uid)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, len(got[uid]))
+	})
+
+	t.Run("heartbeat", func(t *testing.T) {
+		added, err := cache.NodeHeartbeat("n1")
+		assert.NoError(t, err)
+		assert.True(t, added)
+		added, err = cache.NodeHeartbeat("n1")
+		assert.NoError(t, err)
+		assert.False(t, added)
+	})
+
+	t.Run("remove stale nodes", func(t *testing.T) {
+		cache.NodeHeartbeat("n2")
+		time.Sleep(time.Millisecond * 100)
+		cache.NodeHeartbeat("n1")
+
+		removed, err := cache.RemoveStaleNodes(time.Millisecond * 50)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"n2"}, removed)
+
+		got, err := cache.GetRoutes(uid, uid+1)
+		assert.NoError(t, err)
+		assert.Equal(t, []m.Route{{Node: "n1", Device: "desktop"}}, got[uid])
+		assert.Empty(t, got[uid+1])
+
+		// 节点被清理后再次心跳视为重新加入
+		added, err := cache.NodeHeartbeat("n2")
+		assert.NoError(t, err)
+		assert.True(t, added)
+	})
+
+	t.Run("remove node", func(t *testing.T) {
+		assert.NoError(t, cache.RemoveNode("n1"))
+		got, err := cache.GetRoutes(uid)
+		assert.NoError(t, err)
+		assert.Empty(t, got[uid])
+	})
+
+	t.Run("publish and subscribe", func(t *testing.T) {
+		received := make(chan string, 1)
+		unsubscribe, err := cache.Subscribe(m.ClusterChannel+"n1", func(payload string) {
+			received <- payload
+		})
+		assert.NoError(t, err)
+
+		n, err := cache.Publish(m.ClusterChannel+"n1", []byte("hello"))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(1), n)
+		select {
+		case got := <-received:
+			assert.Equal(t, "hello", got)
+		case <-time.After(time.Second):
+			t.Fatal("message not received")
+		}
+
+		assert.NoError(t, unsubscribe())
+		n, err = cache.Publish(m.ClusterChannel+"n1", []byte("hello"))
+		assert.NoError(t, err)
+		assert.Equal(t, int64(0), n)
+	})
+}
+
+type clusterConfig struct {
+	config.Config
+	node string
+}
+
+func (c *clusterConfig) Common() config.Common {
+	return &clusterCommon{c.Config.Common(), c.node}
+}
+
+type clusterCommon struct {
+	config.Common
+	node string
+}
+
+func (c *clusterCommon) Cluster() bool  { return true }
+func (c *clusterCommon) NodeID() string { return c.node }
+
+// 同一进程中启动两个节点,通过redis转发消息
+func TestClusterHubs(t *testing.T) {
+	setupCache(t)
+	defer closeConnection()
+	f.EXPECT().List(gomock.Any()).Return(nil, nil).AnyTimes()
+
+	ctrl := gomock.NewController(t)
+	newNode := func(node string) (ws.HubInterface, *httptest.Server) {
+		s := mock.NewMockService(ctrl)
+		s.EXPECT().Logger().Return(service.Logger()).AnyTimes()
+		s.EXPECT().Config().Return(&clusterConfig{service.Config(), node}).AnyTimes()
+		s.EXPECT().Cache().Return(cache).AnyTimes()
+		s.EXPECT().Friend().Return(f).AnyTimes()
+		hub := ws.NewHubInterface(s)
+		s.EXPECT().Hub().Return(hub).AnyTimes()
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, _ := strconv.ParseUint(r.URL.Query().Get("id"), 10, 64)
+			ws.UpgradeToWS(s, uint(id), r.URL.Query().Get("device"), w, r)
+		}))
+		return hub, srv
+	}
+	hub1, srv1 := newNode("n1")
+	defer srv1.Close()
+	defer hub1.Stop()
+	hub2, srv2 := newNode("n2")
+	defer srv2.Close()
+	defer hub2.Stop()
+
+	uid := uint(1e5 + 1)
+	url := "ws" + strings.TrimPrefix(srv2.URL, "http") + "?id=" + strconv.Itoa(int(uid)) + "&device=phone"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	assert.Eventually(t, func() bool { return hub1.Online(uid) }, time.Second, time.Millisecond*10)
+	assert.Equal(t, []string{"phone"}, hub1.Devices(uid))
+
+	t.Run("forward", func(t *testing.T) {
+		msg := &ws.ChatMsg{ID: "1", Type: ws.UpdateBlackList, To: uid}
+		hub1.SendUpdateBlockedListNotify(msg)
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		var got struct {
+			Type int         `json:"type"`
+			Body *ws.ChatMsg `json:"body"`
+		}
+		assert.NoError(t, conn.ReadJSON(&got))
+		assert.Equal(t, msg.ID, got.Body.ID)
+		assert.Equal(t, msg.To, got.Body.To)
+	})
+
+	t.Run("kick", func(t *testing.T) {
+		hub1.Kick(uid)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		_, _, err := conn.ReadMessage()
+		assert.Error(t, err)
+		assert.Eventually(t, func() bool { return !hub1.Online(uid) }, time.Second, time.Millisecond*10)
+	})
+}
+
 func TestPendingMessages(t *testing.T) {
 	setupCache(t)
 	defer closeConnection()
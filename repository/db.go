@@ -21,6 +21,7 @@ type Service interface {
 	Config() config.Config
 	Logger() *zap.Logger
 	User() UserRepository
+	Friend() FriendRepository
 	Group() GroupRepository
 	Manager() Manager
 	Cache() Cache
@@ -39,6 +40,11 @@ func SetupSQL(dsn string) (*gorm.DB, *sql.DB, error) {
 	db.AutoMigrate(&model.User{}, &model.Manager{},
 		&model.Friend{},
 		&model.Group{}, &model.GroupPerson{}, &model.GroupAnnouncement{},
+		&model.Message{}, &model.Reaction{}, &model.ReactionCount{}, &model.ThreadSubscriber{},
+		&model.PinnedMessage{},
+		&model.ScheduledMessage{},
+		&model.Retention{},
+		&model.IdentityKey{}, &model.PreKey{},
 	)
 	logger.GetLogger().Info("Database tables migration completed successfully")
 	if err := fixAutoIncrement(db); err != nil {
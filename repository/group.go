@@ -31,6 +31,10 @@ type GroupRepository interface {
 	ViewAnnounce(gid, uid any, cursor *m.Cursor) ([]*m.GroupAnnounceInfo, *m.Cursor, error)
 	DeleteAnnounce(gid, uid, announceID uint) error
 	List(uid uint) ([]*m.SummaryGroupInfo, error)
+	MuteMember(gid, uid uint, expireAt int64) error
+	MuteAll(gid uint, muted bool) error
+	MuteInfo(gid uint) (*m.GroupMuteInfo, error)
+	SetDoNotDisturb(gid, uid uint, enabled bool) error
 }
 
 type SQLGroupRepository struct {
@@ -112,7 +116,7 @@ func (s *SQLGroupRepository) Apply(gid, inviteID, targetID uint) error {
 func (s *SQLGroupRepository) Members(gid, uid any, limit int) ([]*m.MemberInfo, error) {
 	var members []*m.MemberInfo
 	query := s.db.Model(&m.GroupPerson{}).
-		Select("u.id,u.username,u.phone,u.email,u.avatar,group_person.role,group_person.created_at,u.ban_level,u.ban_expire_at").
+		Select("u.id,u.username,u.phone,u.email,u.avatar,group_person.role,group_person.created_at,u.ban_level,u.ban_expire_at,group_person.mute_expire_at").
 		Joins("LEFT JOIN `user` AS u ON u.id = `group_person`.member_id").
 		Where("group_id = ?", gid)
 
@@ -291,7 +295,7 @@ func (s *SQLGroupRepository) DeleteAnnounce(gid, uid, announceID uint) error {
 func (s *SQLGroupRepository) List(uid uint) ([]*m.SummaryGroupInfo, error) {
 	var groups []*m.SummaryGroupInfo
 	err := s.db.Table("`group_person` AS gp").
-		Select("g.gid,g.`name` AS `groupname`").
+		Select("g.gid,g.`name` AS `groupname`,gp.do_not_disturb").
 		Where("member_id = ?", uid).
 		Joins("LEFT JOIN `group` AS g ON g.gid = gp.group_id").
 		Find(&groups).Error
@@ -340,3 +344,57 @@ func (s *SQLGroupRepository) UpdateStatus(ctx *m.MemberStatusContext) error {
 	}
 	return nil
 }
+
+// 设置成员禁言到期时间,0表示解除禁言
+func (s *SQLGroupRepository) MuteMember(gid, uid uint, expireAt int64) error {
+	result := s.db.Model(&m.GroupPerson{}).
+		Where("group_id = ? AND member_id = ? AND role IN ?",
+			gid, uid, []int{m.GroupRoleMember, m.GroupRoleAdmin}).
+		Update("mute_expire_at", expireAt)
+	if err := errorsx.HandleError(result.Error); err != nil {
+		return err
+	}
+	if result.RowsAffected == 0 {
+		return errorsx.ErrNoAffectedRows
+	}
+	return nil
+}
+
+// 成员设置群组免打扰
+func (s *SQLGroupRepository) SetDoNotDisturb(gid, uid uint, enabled bool) error {
+	err := s.db.Model(&m.GroupPerson{}).
+		Where("group_id = ? AND member_id = ?", gid, uid).
+		Update("do_not_disturb", enabled).Error
+	return errorsx.HandleError(err)
+}
+
+func (s *SQLGroupRepository) MuteAll(gid uint, muted bool) error {
+	err := s.db.Model(&m.Group{}).
+		Where("gid = ?", gid).
+		Update("mute_all", muted).Error
+	return errorsx.HandleError(err)
+}
+
+// 获取群组禁言状态,只包含未到期的成员
+func (s *SQLGroupRepository) MuteInfo(gid uint) (*m.GroupMuteInfo, error) {
+	var group m.Group
+	if err := s.db.Select("gid,mute_all").
+		Where("gid = ?", gid).First(&group).Error; err != nil {
+		return nil, errorsx.HandleError(err)
+	}
+
+	var members []*m.GroupMemberMute
+	err := s.db.Model(&m.GroupPerson{}).
+		Select("member_id,mute_expire_at").
+		Where("group_id = ? AND mute_expire_at > ?", gid, time.Now().Unix()).
+		Find(&members).Error
+	if err := errorsx.HandleError(err); err != nil {
+		return nil, err
+	}
+
+	info := &m.GroupMuteInfo{MuteAll: group.MuteAll, Members: make(map[uint]int64)}
+	for _, member := range members {
+		info.Members[member.MemberID] = member.MuteExpireAt
+	}
+	return info, nil
+}
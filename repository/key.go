@@ -0,0 +1,112 @@
+package repository
+
+import (
+	m "github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type KeyRepository interface {
+	SaveKeys(key *m.IdentityKey, preKeys []*m.PreKey) error
+	AddPreKeys(uid uint, preKeys []*m.PreKey) error
+	CountPreKeys(uid uint) (int64, error)
+	IdentityKey(uid uint) (*m.IdentityKey, error)
+	TakePreKey(uid uint) (*m.PreKey, error)
+	DeleteKeys(uid uint) error
+}
+
+type SQLKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewSQLKeyRepository(db *gorm.DB) KeyRepository {
+	return &SQLKeyRepository{db}
+}
+
+// 保存身份公钥和签名预共享公钥,身份公钥变化时删除旧的一次性预共享公钥
+func (s *SQLKeyRepository) SaveKeys(key *m.IdentityKey, preKeys []*m.PreKey) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var old m.IdentityKey
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", key.UserID).Limit(1).Find(&old).Error
+		if err != nil {
+			return err
+		}
+		if old.UserID != 0 && old.IdentityKey != key.IdentityKey {
+			if err := tx.Where("user_id = ?", key.UserID).Delete(&m.PreKey{}).Error; err != nil {
+				return err
+			}
+		}
+		err = tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{
+				"identity_key", "signed_pre_key_id", "signed_pre_key", "signature", "updated_at"}),
+		}).Create(key).Error
+		if err != nil {
+			return err
+		}
+		return createPreKeys(tx, key.UserID, preKeys)
+	})
+	return errorsx.HandleError(err)
+}
+
+func (s *SQLKeyRepository) AddPreKeys(uid uint, preKeys []*m.PreKey) error {
+	return errorsx.HandleError(createPreKeys(s.db, uid, preKeys))
+}
+
+// key_id相同时覆盖公钥
+func createPreKeys(tx *gorm.DB, uid uint, preKeys []*m.PreKey) error {
+	if len(preKeys) == 0 {
+		return nil
+	}
+	for _, preKey := range preKeys {
+		preKey.ID = 0
+		preKey.UserID = uid
+	}
+	return tx.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"public_key"}),
+	}).Create(&preKeys).Error
+}
+
+func (s *SQLKeyRepository) CountPreKeys(uid uint) (int64, error) {
+	var count int64
+	err := s.db.Model(&m.PreKey{}).Where("user_id = ?", uid).Count(&count).Error
+	return count, errorsx.HandleError(err)
+}
+
+func (s *SQLKeyRepository) IdentityKey(uid uint) (*m.IdentityKey, error) {
+	var key m.IdentityKey
+	err := s.db.Where("user_id = ?", uid).First(&key).Error
+	return &key, errorsx.HandleError(err)
+}
+
+// 取出最早上传的一次性预共享公钥并删除,每个公钥只会被取出一次
+func (s *SQLKeyRepository) TakePreKey(uid uint) (*m.PreKey, error) {
+	var preKey m.PreKey
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", uid).Order("id").First(&preKey).Error
+		if err != nil {
+			return err
+		}
+		return tx.Delete(&preKey).Error
+	})
+	return &preKey, errorsx.HandleError(err)
+}
+
+func (s *SQLKeyRepository) DeleteKeys(uid uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", uid).Delete(&m.PreKey{}).Error; err != nil {
+			return err
+		}
+		result := tx.Where("user_id = ?", uid).Delete(&m.IdentityKey{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errorsx.ErrNoAffectedRows
+		}
+		return nil
+	})
+	return errorsx.HandleError(err)
+}
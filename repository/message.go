@@ -0,0 +1,527 @@
+package repository
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	m "github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MessageRepository interface {
+	Create(msg *m.Message) error
+	Conversation(uid, peer uint, cursor *m.Cursor) ([]*m.Message, *m.Cursor, error)
+	GroupMessages(gid uint, cursor *m.Cursor) ([]*m.Message, *m.Cursor, error)
+	Get(msgID string) (*m.Message, error)
+	Recall(msgID string) error
+	Edit(msgID, body string, editedAt int64) error
+	Conversations(uid uint) ([]*m.Conversation, error)
+	CountUnread(uid, peer, gid, readSeq uint) (int64, error)
+	AddReaction(reaction *m.Reaction) (int64, error)
+	RemoveReaction(msgID string, uid uint, emoji string) (int64, error)
+	Reactions(msgID string, uid uint) ([]*m.ReactionCount, error)
+	ThreadReplies(msgID string, cursor *m.Cursor) ([]*m.Message, *m.Cursor, error)
+	AddThreadReply(msgID string, replyAt int64) error
+	SubscribeThread(msgID string, uid uint) error
+	UnsubscribeThread(msgID string, uid uint) error
+	ThreadSubscribers(msgID string) ([]uint, error)
+	Pin(pin *m.PinnedMessage) error
+	Unpin(msgID string) error
+	GroupPins(gid uint, cursor *m.Cursor) ([]*m.PinnedMessage, *m.Cursor, error)
+	DirectPins(uid, peer uint, cursor *m.Cursor) ([]*m.PinnedMessage, *m.Cursor, error)
+	Search(uid uint, terms []string, search *m.MessageSearch, cursor *m.SearchCursor) ([]*m.MessageHit, *m.SearchCursor, error)
+	CreateScheduled(msg *m.ScheduledMessage) error
+	ScheduledMessages(uid uint) ([]*m.ScheduledMessage, error)
+	CancelScheduled(uid uint, msgID string) error
+	DueScheduled(now int64, limit int) ([]*m.ScheduledMessage, error)
+	ClaimScheduled(id uint, now int64, lease time.Duration) error
+	ReleaseScheduled(id uint) error
+	DeleteScheduled(id uint) error
+	SetRetention(retention *m.Retention) error
+	Retention(gid, uid, peer uint) (*m.Retention, error)
+	Retentions() ([]*m.Retention, error)
+	ExpiredMessages(retention *m.Retention, before int64, limit int) ([]*m.Message, error)
+	GroupMessageIDs(gid uint, msgIDs []string) ([]string, error)
+	DeleteMessages(msgIDs []string) error
+	FileShared(uid uint, fileID string) (bool, error)
+}
+
+type SQLMessageRepository struct {
+	db *gorm.DB
+}
+
+func NewSQLMessageRepository(db *gorm.DB) MessageRepository {
+	return &SQLMessageRepository{db}
+}
+
+func (s *SQLMessageRepository) Create(msg *m.Message) error {
+	err := s.db.Create(msg).Error
+	return errorsx.HandleError(err)
+}
+
+// 单聊记录,从新到旧
+func (s *SQLMessageRepository) Conversation(uid, peer uint, cursor *m.Cursor) ([]*m.Message, *m.Cursor, error) {
+	query := s.db.Model(&m.Message{}).
+		Where("group_id = 0 AND ((sender = ? AND receiver = ?) OR (sender = ? AND receiver = ?))",
+			uid, peer, peer, uid)
+	return s.page(query, cursor)
+}
+
+// 群聊记录,从新到旧,不包括话题回复
+func (s *SQLMessageRepository) GroupMessages(gid uint, cursor *m.Cursor) ([]*m.Message, *m.Cursor, error) {
+	query := s.db.Model(&m.Message{}).Where("group_id = ? AND thread_id = ''", gid)
+	return s.page(query, cursor)
+}
+
+// 话题回复,从新到旧
+func (s *SQLMessageRepository) ThreadReplies(msgID string, cursor *m.Cursor) ([]*m.Message, *m.Cursor, error) {
+	query := s.db.Model(&m.Message{}).Where("thread_id = ?", msgID)
+	return s.page(query, cursor)
+}
+
+// 增加原消息的回复数量并更新最后回复时间
+func (s *SQLMessageRepository) AddThreadReply(msgID string, replyAt int64) error {
+	result := s.db.Model(&m.Message{}).
+		Where("msg_id = ?", msgID).
+		Updates(map[string]any{
+			"reply_count":   gorm.Expr("reply_count + 1"),
+			"last_reply_at": gorm.Expr("GREATEST(last_reply_at, ?)", replyAt),
+		})
+	return s.checkAffected(result)
+}
+
+// 订阅话题,重复订阅不会报错
+func (s *SQLMessageRepository) SubscribeThread(msgID string, uid uint) error {
+	err := s.db.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&m.ThreadSubscriber{MsgID: msgID, UserID: uid}).Error
+	return errorsx.HandleError(err)
+}
+
+func (s *SQLMessageRepository) UnsubscribeThread(msgID string, uid uint) error {
+	err := s.db.Where("msg_id = ? AND user_id = ?", msgID, uid).Delete(&m.ThreadSubscriber{}).Error
+	return errorsx.HandleError(err)
+}
+
+func (s *SQLMessageRepository) ThreadSubscribers(msgID string) ([]uint, error) {
+	var subscribers []uint
+	err := s.db.Model(&m.ThreadSubscriber{}).Where("msg_id = ?", msgID).Pluck("user_id", &subscribers).Error
+	return subscribers, errorsx.HandleError(err)
+}
+
+func (s *SQLMessageRepository) Get(msgID string) (*m.Message, error) {
+	var msg *m.Message
+	err := s.db.Where("msg_id = ?", msgID).First(&msg).Error
+	return msg, errorsx.HandleError(err)
+}
+
+// 撤回消息,清空内容并取消置顶,已撤回的消息不会再次修改
+func (s *SQLMessageRepository) Recall(msgID string) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&m.Message{}).
+			Where("msg_id = ? AND recalled = ?", msgID, false).
+			Updates(map[string]any{"recalled": true, "body": "", "extra": "", "content": "", "mentions": ""})
+		if err := s.checkAffected(result); err != nil {
+			return err
+		}
+		err := tx.Where("msg_id = ?", msgID).Delete(&m.PinnedMessage{}).Error
+		return errorsx.HandleError(err)
+	})
+}
+
+func (s *SQLMessageRepository) Edit(msgID, body string, editedAt int64) error {
+	result := s.db.Model(&m.Message{}).
+		Where("msg_id = ? AND recalled = ?", msgID, false).
+		Updates(map[string]any{"body": body, "edited_at": editedAt})
+	return s.checkAffected(result)
+}
+
+// 用户参与的单聊和所在群组中有消息记录的群聊,按最后一条消息从新到旧
+func (s *SQLMessageRepository) Conversations(uid uint) ([]*m.Conversation, error) {
+	var direct []*m.Conversation
+	err := s.db.Model(&m.Message{}).
+		Select("IF(sender = ?, receiver, sender) AS peer_id,MAX(id) AS last_seq,MAX(time) AS last_time", uid).
+		Where("group_id = 0 AND (sender = ? OR receiver = ?)", uid, uid).
+		Group("peer_id").
+		Find(&direct).Error
+	if err := errorsx.HandleError(err); err != nil {
+		return nil, err
+	}
+
+	var group []*m.Conversation
+	err = s.db.Table("`message` AS msg").
+		Select("msg.group_id,MAX(msg.id) AS last_seq,MAX(msg.time) AS last_time").
+		Joins("JOIN group_person AS gp ON gp.group_id = msg.group_id AND gp.member_id = ? AND gp.role IN ?",
+			uid, []int{m.GroupRoleOwner, m.GroupRoleAdmin, m.GroupRoleMember}).
+		Where("msg.group_id <> 0 AND msg.thread_id = ''").
+		Group("msg.group_id").
+		Find(&group).Error
+	if err := errorsx.HandleError(err); err != nil {
+		return nil, err
+	}
+
+	conversations := append(direct, group...)
+	slices.SortFunc(conversations, func(a, b *m.Conversation) int {
+		return cmp.Compare(b.LastSeq, a.LastSeq)
+	})
+	return conversations, nil
+}
+
+// 读游标之后其他人发送的未撤回消息数量
+func (s *SQLMessageRepository) CountUnread(uid, peer, gid, readSeq uint) (int64, error) {
+	query := s.db.Model(&m.Message{}).Where("id > ? AND recalled = ?", readSeq, false)
+	if gid != 0 {
+		query.Where("group_id = ? AND thread_id = '' AND sender <> ?", gid, uid)
+	} else {
+		query.Where("group_id = 0 AND sender = ? AND receiver = ?", peer, uid)
+	}
+	var count int64
+	err := query.Count(&count).Error
+	return count, errorsx.HandleError(err)
+}
+
+// 添加表情回应并增加数量,返回增加后的数量,重复回应返回ErrDuplicateEntry
+func (s *SQLMessageRepository) AddReaction(reaction *m.Reaction) (int64, error) {
+	var count m.ReactionCount
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(reaction).Error; err != nil {
+			return err
+		}
+		count = m.ReactionCount{MsgID: reaction.MsgID, Emoji: reaction.Emoji, Count: 1}
+		err := tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.Assignments(map[string]any{"count": gorm.Expr("`count` + 1")}),
+		}).Create(&count).Error
+		if err != nil {
+			return err
+		}
+		return tx.Where("msg_id = ? AND emoji = ?", reaction.MsgID, reaction.Emoji).First(&count).Error
+	})
+	return count.Count, errorsx.HandleError(err)
+}
+
+// 取消表情回应并减少数量,返回减少后的数量,数量为0时删除记录
+func (s *SQLMessageRepository) RemoveReaction(msgID string, uid uint, emoji string) (int64, error) {
+	var count m.ReactionCount
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("msg_id = ? AND user_id = ? AND emoji = ?", msgID, uid, emoji).Delete(&m.Reaction{})
+		if err := s.checkAffected(result); err != nil {
+			return err
+		}
+		query := tx.Model(&m.ReactionCount{}).Where("msg_id = ? AND emoji = ?", msgID, emoji)
+		if err := query.Update("count", gorm.Expr("`count` - 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("msg_id = ? AND emoji = ?", msgID, emoji).First(&count).Error; err != nil {
+			return err
+		}
+		if count.Count > 0 {
+			return nil
+		}
+		return tx.Where("msg_id = ? AND emoji = ?", msgID, emoji).Delete(&m.ReactionCount{}).Error
+	})
+	return count.Count, errorsx.HandleError(err)
+}
+
+// 消息的表情回应数量,按数量从多到少
+func (s *SQLMessageRepository) Reactions(msgID string, uid uint) ([]*m.ReactionCount, error) {
+	var counts []*m.ReactionCount
+	err := s.db.Where("msg_id = ?", msgID).Order("`count` DESC").Find(&counts).Error
+	if err := errorsx.HandleError(err); err != nil {
+		return nil, err
+	}
+	if len(counts) == 0 {
+		return counts, nil
+	}
+	var reacted []string
+	err = s.db.Model(&m.Reaction{}).Where("msg_id = ? AND user_id = ?", msgID, uid).Pluck("emoji", &reacted).Error
+	if err := errorsx.HandleError(err); err != nil {
+		return nil, err
+	}
+	for _, count := range counts {
+		count.Reacted = slices.Contains(reacted, count.Emoji)
+	}
+	return counts, nil
+}
+
+// 置顶消息,重复置顶返回ErrDuplicateEntry
+func (s *SQLMessageRepository) Pin(pin *m.PinnedMessage) error {
+	err := s.db.Create(pin).Error
+	return errorsx.HandleError(err)
+}
+
+func (s *SQLMessageRepository) Unpin(msgID string) error {
+	result := s.db.Where("msg_id = ?", msgID).Delete(&m.PinnedMessage{})
+	return s.checkAffected(result)
+}
+
+// 群聊的置顶消息,从新到旧
+func (s *SQLMessageRepository) GroupPins(gid uint, cursor *m.Cursor) ([]*m.PinnedMessage, *m.Cursor, error) {
+	query := s.db.Model(&m.PinnedMessage{}).Where("group_id = ?", gid)
+	return s.pagePins(query, cursor)
+}
+
+// 单聊的置顶消息,从新到旧
+func (s *SQLMessageRepository) DirectPins(uid, peer uint, cursor *m.Cursor) ([]*m.PinnedMessage, *m.Cursor, error) {
+	query := s.db.Model(&m.PinnedMessage{}).
+		Where("group_id = 0 AND user_a = ? AND user_b = ?", min(uid, peer), max(uid, peer))
+	return s.pagePins(query, cursor)
+}
+
+// 按置顶顺序分页,并填充置顶的消息
+func (s *SQLMessageRepository) pagePins(query *gorm.DB, cursor *m.Cursor) ([]*m.PinnedMessage, *m.Cursor, error) {
+	if cursor.LastID == 0 {
+		cursor.LastID = math.MaxUint64
+	}
+	var pins []*m.PinnedMessage
+	err := query.Where("id < ?", cursor.LastID).
+		Order("id DESC").Limit(cursor.PageSize + 1).
+		Find(&pins).Error
+	if err := errorsx.HandleError(err); err != nil {
+		return nil, cursor, err
+	}
+	if len(pins) > cursor.PageSize {
+		pins = pins[:len(pins)-1]
+		cursor.LastID = pins[len(pins)-1].ID
+	} else {
+		cursor.HasMore = false
+	}
+	if len(pins) == 0 {
+		return pins, cursor, nil
+	}
+
+	ids := make([]string, len(pins))
+	for i, pin := range pins {
+		ids[i] = pin.MsgID
+	}
+	var messages []*m.Message
+	if err := s.db.Where("msg_id IN ?", ids).Find(&messages).Error; err != nil {
+		return nil, cursor, errorsx.HandleError(err)
+	}
+	for _, pin := range pins {
+		i := slices.IndexFunc(messages, func(msg *m.Message) bool {
+			return msg.MsgID == pin.MsgID
+		})
+		if i >= 0 {
+			pin.Message = messages[i]
+		}
+	}
+	return pins, cursor, nil
+}
+
+// 全文搜索用户所在会话中未撤回的消息,所有词都需要匹配,按相关度和seq从高到低排序
+// 加密消息的body是密文,不参与搜索
+func (s *SQLMessageRepository) Search(uid uint, terms []string, search *m.MessageSearch, cursor *m.SearchCursor) ([]*m.MessageHit, *m.SearchCursor, error) {
+	phrases := make([]string, len(terms))
+	for i, term := range terms {
+		phrases[i] = `+"` + term + `"`
+	}
+	against := strings.Join(phrases, " ")
+
+	members := s.db.Model(&m.GroupPerson{}).Select("group_id").
+		Where("member_id = ? AND role IN ?", uid, []int{m.GroupRoleOwner, m.GroupRoleAdmin, m.GroupRoleMember})
+	query := s.db.Model(&m.Message{}).
+		Select("`message`.*,MATCH(body) AGAINST(? IN BOOLEAN MODE) AS score", against).
+		Where("MATCH(body) AGAINST(? IN BOOLEAN MODE)", against).
+		Where("recalled = ?", false).
+		Where("((group_id = 0 AND (sender = ? OR receiver = ?)) OR group_id IN (?))", uid, uid, members)
+	if search.From != 0 {
+		query.Where("sender = ?", search.From)
+	}
+	if search.Peer != 0 {
+		query.Where("group_id = 0 AND ((sender = ? AND receiver = ?) OR (sender = ? AND receiver = ?))",
+			uid, search.Peer, search.Peer, uid)
+	}
+	if search.GroupID != 0 {
+		query.Where("group_id = ?", search.GroupID)
+	}
+	if search.After != 0 {
+		query.Where("time >= ?", search.After)
+	}
+	if search.Before != 0 {
+		query.Where("time < ?", search.Before)
+	}
+	switch search.Kind {
+	case "":
+		query.Where("content NOT LIKE ?", `{"kind":"encrypted"%`)
+	case "text":
+		query.Where("content = ''")
+	default:
+		// content由json序列化,kind为第一个字段
+		query.Where("content LIKE ?", `{"kind":"`+search.Kind+`"%`)
+	}
+	if cursor.LastID != 0 {
+		query.Having("score < ? OR (score = ? AND id < ?)", cursor.LastScore, cursor.LastScore, cursor.LastID)
+	}
+
+	var hits []*m.MessageHit
+	err := query.Order("score DESC,id DESC").Limit(cursor.PageSize + 1).Find(&hits).Error
+	if err := errorsx.HandleError(err); err != nil {
+		return nil, cursor, err
+	}
+	if len(hits) > cursor.PageSize {
+		hits = hits[:len(hits)-1]
+		last := hits[len(hits)-1]
+		cursor.LastID, cursor.LastScore = last.ID, last.Score
+	} else {
+		cursor.HasMore = false
+	}
+	return hits, cursor, nil
+}
+
+func (s *SQLMessageRepository) CreateScheduled(msg *m.ScheduledMessage) error {
+	err := s.db.Create(msg).Error
+	return errorsx.HandleError(err)
+}
+
+// 用户未发送的定时消息,按发送时间排序
+func (s *SQLMessageRepository) ScheduledMessages(uid uint) ([]*m.ScheduledMessage, error) {
+	var messages []*m.ScheduledMessage
+	err := s.db.Where("sender = ?", uid).Order("send_at,id").Find(&messages).Error
+	return messages, errorsx.HandleError(err)
+}
+
+func (s *SQLMessageRepository) CancelScheduled(uid uint, msgID string) error {
+	result := s.db.Where("sender = ? AND msg_id = ?", uid, msgID).Delete(&m.ScheduledMessage{})
+	return s.checkAffected(result)
+}
+
+// 已到发送时间且没有被其他节点持有租约的定时消息
+func (s *SQLMessageRepository) DueScheduled(now int64, limit int) ([]*m.ScheduledMessage, error) {
+	var messages []*m.ScheduledMessage
+	err := s.db.Where("send_at <= ? AND claimed_until <= ?", now, now).
+		Order("send_at,id").Limit(limit).Find(&messages).Error
+	return messages, errorsx.HandleError(err)
+}
+
+// 取得租约才能发送,发送成功后删除,发送失败或节点崩溃时租约到期后重试
+// 已被取消或被其他节点持有时返回ErrNoAffectedRows
+func (s *SQLMessageRepository) ClaimScheduled(id uint, now int64, lease time.Duration) error {
+	result := s.db.Model(&m.ScheduledMessage{}).
+		Where("id = ? AND claimed_until <= ?", id, now).
+		Update("claimed_until", now+lease.Milliseconds())
+	return s.checkAffected(result)
+}
+
+// 释放租约,下次检查时重试
+func (s *SQLMessageRepository) ReleaseScheduled(id uint) error {
+	err := s.db.Model(&m.ScheduledMessage{}).Where("id = ?", id).Update("claimed_until", 0).Error
+	return errorsx.HandleError(err)
+}
+
+// 已发送或无法发送的定时消息
+func (s *SQLMessageRepository) DeleteScheduled(id uint) error {
+	err := s.db.Delete(&m.ScheduledMessage{}, id).Error
+	return errorsx.HandleError(err)
+}
+
+// 设置会话的消息保留时间,ttl为0时取消
+func (s *SQLMessageRepository) SetRetention(retention *m.Retention) error {
+	if retention.TTL == 0 {
+		err := s.db.Where("group_id = ? AND user_a = ? AND user_b = ?",
+			retention.GroupID, retention.UserA, retention.UserB).
+			Delete(&m.Retention{}).Error
+		return errorsx.HandleError(err)
+	}
+	err := s.db.Clauses(clause.OnConflict{
+		DoUpdates: clause.AssignmentColumns([]string{"ttl", "updated_by", "updated_at"}),
+	}).Create(retention).Error
+	return errorsx.HandleError(err)
+}
+
+// 群聊时uid和peer为0,单聊时gid为0
+func (s *SQLMessageRepository) Retention(gid, uid, peer uint) (*m.Retention, error) {
+	var retention m.Retention
+	err := s.db.Where("group_id = ? AND user_a = ? AND user_b = ?", gid, min(uid, peer), max(uid, peer)).
+		First(&retention).Error
+	return &retention, errorsx.HandleError(err)
+}
+
+func (s *SQLMessageRepository) Retentions() ([]*m.Retention, error) {
+	var retentions []*m.Retention
+	err := s.db.Find(&retentions).Error
+	return retentions, errorsx.HandleError(err)
+}
+
+// 会话中发送时间早于before的消息,包括已撤回的消息和话题回复
+func (s *SQLMessageRepository) ExpiredMessages(retention *m.Retention, before int64, limit int) ([]*m.Message, error) {
+	query := s.db.Select("id,msg_id,type,sender,receiver,group_id,time").Where("time < ?", before)
+	if retention.GroupID != 0 {
+		query.Where("group_id = ?", retention.GroupID)
+	} else {
+		query.Where("group_id = 0 AND ((sender = ? AND receiver = ?) OR (sender = ? AND receiver = ?))",
+			retention.UserA, retention.UserB, retention.UserB, retention.UserA)
+	}
+	var messages []*m.Message
+	err := query.Order("id").Limit(limit).Find(&messages).Error
+	return messages, errorsx.HandleError(err)
+}
+
+// msgIDs中属于群组gid的消息
+func (s *SQLMessageRepository) GroupMessageIDs(gid uint, msgIDs []string) ([]string, error) {
+	var ids []string
+	err := s.db.Model(&m.Message{}).Where("group_id = ? AND msg_id IN ?", gid, msgIDs).Pluck("msg_id", &ids).Error
+	return ids, errorsx.HandleError(err)
+}
+
+// 删除消息及其表情回应、置顶和话题订阅
+func (s *SQLMessageRepository) DeleteMessages(msgIDs []string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []any{&m.Reaction{}, &m.ReactionCount{}, &m.PinnedMessage{}, &m.ThreadSubscriber{}, &m.Message{}} {
+			if err := tx.Where("msg_id IN ?", msgIDs).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return errorsx.HandleError(err)
+}
+
+// 文件是否发送到了用户参与的单聊或所在的群组中,撤回的消息不算
+func (s *SQLMessageRepository) FileShared(uid uint, fileID string) (bool, error) {
+	members := s.db.Model(&m.GroupPerson{}).Select("group_id").
+		Where("member_id = ? AND role IN ?", uid, []int{m.GroupRoleOwner, m.GroupRoleAdmin, m.GroupRoleMember})
+	var ids []uint
+	err := s.db.Model(&m.Message{}).
+		Where("file_id = ? AND recalled = ?", fileID, false).
+		Where("((group_id = 0 AND (sender = ? OR receiver = ?)) OR group_id IN (?))", uid, uid, members).
+		Limit(1).Pluck("id", &ids).Error
+	if err := errorsx.HandleError(err); err != nil {
+		return false, err
+	}
+	return len(ids) > 0, nil
+}
+
+func (s *SQLMessageRepository) checkAffected(result *gorm.DB) error {
+	if err := errorsx.HandleError(result.Error); err != nil {
+		return err
+	}
+	if result.RowsAffected == 0 {
+		return errorsx.ErrNoAffectedRows
+	}
+	return nil
+}
+
+func (s *SQLMessageRepository) page(query *gorm.DB, cursor *m.Cursor) ([]*m.Message, *m.Cursor, error) {
+	if cursor.LastID == 0 {
+		cursor.LastID = math.MaxUint64
+	}
+	var messages []*m.Message
+	err := query.Where("id < ?", cursor.LastID).
+		Order("id DESC").Limit(cursor.PageSize + 1).
+		Find(&messages).Error
+	if err := errorsx.HandleError(err); err != nil {
+		return nil, cursor, err
+	}
+
+	if len(messages) > cursor.PageSize {
+		messages = messages[:len(messages)-1]
+		cursor.LastID = messages[len(messages)-1].ID
+	} else {
+		cursor.HasMore = false
+	}
+	return messages, cursor, nil
+}
@@ -16,19 +16,34 @@ func SetupRouter(mode string) *gin.Engine {
 	r.Use(middleware.Logger())
 	r.Use(middleware.Cors())
 
-	r.GET("/api/v1/files/download/:id", v1.Download)
-	r.GET("/api/v1/files/:id", v1.GetFile)
+	// 带签名的文件链接不需要登录
+	fileAuth := []gin.HandlerFunc{
+		middleware.SkipIfSigned(middleware.JWT(http.StatusOK)),
+		middleware.SkipIfSigned(middleware.VerifyTokenInWhitelist(http.StatusOK)),
+	}
+	r.GET("/api/v1/files/download/:id", append(fileAuth, v1.Download)...)
+	r.GET("/api/v1/files/:id", append(fileAuth, v1.GetFile)...)
+	r.GET("/api/v1/files/:id/thumbnail", append(fileAuth, v1.Thumbnail)...)
 
 	auth := r.Group("api/v1")
 	auth.Use(middleware.JWT(http.StatusOK))
 	auth.Use(middleware.VerifyTokenInWhitelist(http.StatusOK))
 	{
 		auth.POST("/logout", v1.LogOut)
+		auth.GET("/sessions", v1.Sessions)
+		auth.DELETE("/sessions/:device", v1.RevokeSession)
 
 		// files
 		files := auth.Group("/files")
 		files.POST("", v1.Upload)
+		files.GET("/usage", v1.FileUsage)
 		files.DELETE("/:id", v1.DeleteFile)
+		files.POST("/:id/link", v1.FileLink)
+		files.POST("/uploads", v1.CreateUpload)
+		files.GET("/uploads/:id", v1.UploadStatus)
+		files.PUT("/uploads/:id/chunks/:index", v1.UploadChunk)
+		files.POST("/uploads/:id/complete", v1.CompleteUpload)
+		files.DELETE("/uploads/:id", v1.CancelUpload)
 
 		users := auth.Group("/users")
 		// user
@@ -61,12 +76,45 @@ func SetupRouter(mode string) *gin.Engine {
 		group.PUT("/:gid/admins/me/resign", v1.AdminResign)
 		group.DELETE("/:gid/members/me", v1.Leave)
 		group.DELETE("/:gid/members/:id", v1.Kick)
+		group.PUT("/:gid/members/:id/mute", v1.MuteMember)
+		group.PUT("/:gid/mute", v1.MuteAll)
+		group.PUT("/:gid/dnd", v1.SetDoNotDisturb)
 
 		group.POST("/:gid/announces", v1.ReleaseAnnounce)
 		group.GET("/:gid/announces", v1.ViewAnnounce)
 		group.GET("/:gid/announces/latest", v1.ViewLatestAnnounce)
 		group.DELETE("/:gid/announces/:id", v1.DeleteAnnounce)
 
+		group.GET("/:gid/messages", v1.GroupMessages)
+		group.GET("/:gid/pins", v1.GroupPins)
+		group.GET("/:gid/retention", v1.GroupRetention)
+		group.PUT("/:gid/retention", v1.SetGroupRetention)
+
+		// message
+		auth.GET("/conversations", v1.Conversations)
+		auth.GET("/conversations/:peer/messages", v1.ConversationMessages)
+		auth.GET("/conversations/:peer/pins", v1.ConversationPins)
+		auth.GET("/conversations/:peer/retention", v1.ConversationRetention)
+		auth.PUT("/conversations/:peer/retention", v1.SetConversationRetention)
+		auth.GET("/messages/search", v1.SearchMessages)
+		auth.GET("/messages/scheduled", v1.ScheduledMessages)
+		auth.DELETE("/messages/scheduled/:id", v1.CancelScheduled)
+		auth.GET("/messages/:id/reactions", v1.Reactions)
+		auth.POST("/messages/:id/reactions", v1.AddReaction)
+		auth.DELETE("/messages/:id/reactions", v1.RemoveReaction)
+		auth.GET("/messages/:id/thread", v1.ThreadReplies)
+		auth.PUT("/messages/:id/thread/subscription", v1.SubscribeThread)
+		auth.PUT("/messages/:id/pin", v1.PinMessage)
+		auth.DELETE("/messages/:id/pin", v1.UnpinMessage)
+
+		// keys
+		keys := auth.Group("/keys")
+		keys.PUT("", v1.UploadKeys)
+		keys.DELETE("", v1.DeleteKeys)
+		keys.POST("/prekeys", v1.AddPreKeys)
+		keys.GET("/prekeys/count", v1.PreKeyCount)
+		keys.GET("/:id", v1.KeyBundle)
+
 		// friend
 		friendCheckBan := auth.Group("/friends")
 		friendCheckBan.Use(middleware.BanFilter())
@@ -84,6 +132,7 @@ func SetupRouter(mode string) *gin.Engine {
 		friendValidateIDOnly.PUT("/setgroup/:id", v1.SetGroup)
 
 		auth.GET("/friends/search", v1.SearchFriend)
+		auth.GET("/friends/presence", v1.FriendPresence)
 		auth.GET("/friends", v1.FriendList)
 	}
 	public := r.Group("api/v1")
@@ -121,6 +170,7 @@ func SetupManagerRouter(mode string) *gin.Engine {
 		hasReadPermissions.GET("/config", v1.GetConfig)
 		hasReadPermissions.GET("/users/banned", v1.BannedUserList)
 		hasReadPermissions.GET("/users/banned/count", v1.CountBannedUser)
+		hasReadPermissions.GET("/users/:id/files/quota", v1.GetFileQuota)
 		hasReadPermissions.GET("/admins", v1.AdminList)
 		hasReadPermissions.GET("/admins/:id", v1.GetAdmin)
 		hasReadPermissions.PUT("/admins/:id/update/password", v1.AdminUpdatePassword)
@@ -139,6 +189,8 @@ func SetupManagerRouter(mode string) *gin.Engine {
 		hasWritePermissions.PUT("/users/:id/ban/nopost", v1.BanUserNoPost)
 		hasWritePermissions.PUT("/users/:id/ban/mute", v1.BanUserMuted)
 		hasWritePermissions.PUT("/users/:id/ban/unban", v1.UnbanUser)
+		hasWritePermissions.PUT("/users/:id/files/quota", v1.SetFileQuota)
+		hasWritePermissions.DELETE("/users/:id/files/quota", v1.ResetFileQuota)
 	}
 
 	hasSuperPermission := auth.Group("")
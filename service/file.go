@@ -0,0 +1,170 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/farnese17/chat/pkg/storage"
+	"github.com/farnese17/chat/registry"
+	m "github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/farnese17/chat/utils/validator"
+	"go.uber.org/zap"
+)
+
+// 文件的上传者和文件所在会话中的用户可以下载,其他人需要带签名的链接
+type FileService struct {
+	service registry.Service
+}
+
+func NewFileService(s registry.Service) *FileService {
+	return &FileService{s}
+}
+
+// 上传文件,返回文件ID,超出限额或类型不允许时返回对应的错误
+func (fs *FileService) Upload(uid uint, file multipart.File, filename string) (string, error) {
+	id, err := fs.service.Storage().Upload(uid, file, filename)
+	return id, fs.handleUploadError(uid, "", err)
+}
+
+// 已使用的空间和限额
+func (fs *FileService) Usage(uid uint) (*storage.QuotaUsage, error) {
+	usage, err := fs.service.Storage().Usage(uid)
+	if err != nil {
+		fs.service.Logger().Error("Failed to get usage", zap.Uint("uid", uid), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return usage, nil
+}
+
+// uid为0时只接受签名,没有权限和文件不存在一样返回ErrFileNotFound
+func (fs *FileService) Download(uid uint, id string, expires int64, signature string) (*storage.File, error) {
+	file, err := fs.service.Storage().Download(id, &storage.Access{
+		Expires:   expires,
+		Signature: signature,
+		UserID:    uid,
+		Permitted: fs.permitted,
+	})
+	switch {
+	case err == nil:
+		return file, nil
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrPermissiondenied):
+		return nil, errorsx.ErrFileNotFound
+	case errors.Is(err, storage.ErrInvalidSignature):
+		return nil, errorsx.ErrInvalidLink
+	case errors.Is(err, storage.ErrLinkExpired):
+		return nil, errorsx.ErrLinkExpired
+	default:
+		fs.service.Logger().Error("Failed to get file", zap.Uint("uid", uid), zap.String("id", id), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+}
+
+// 生成带签名的链接,持有链接的人不需要登录即可下载,只有能下载文件的用户可以生成
+func (fs *FileService) Link(uid uint, id string) (map[string]any, error) {
+	if _, err := fs.Download(uid, id, 0, ""); err != nil {
+		return nil, err
+	}
+	expires := time.Now().Add(fs.service.Config().FileServer().LinkTTL()).Unix()
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {fs.service.Storage().Sign(id, expires)},
+	}.Encode()
+	path := url.PathEscape(id) + "?" + query
+	return map[string]any{
+		"url":          "/api/v1/files/" + path,
+		"download_url": "/api/v1/files/download/" + path,
+		"expires":      expires,
+	}, nil
+}
+
+// 返回缩略图的内容和类型,size为0时使用默认大小
+func (fs *FileService) Thumbnail(f *storage.File, size int) (io.ReadCloser, string, error) {
+	if size == 0 {
+		size = storage.DefaultThumbnailSize
+	}
+	content, err := fs.service.Storage().Thumbnail(f, size)
+	switch {
+	case err == nil:
+		return content, storage.ThumbnailType(f.MIME), nil
+	case errors.Is(err, storage.ErrInvalidSize):
+		return nil, "", errorsx.ErrInvalidParams
+	case errors.Is(err, storage.ErrNoThumbnail):
+		return nil, "", errorsx.ErrNoThumbnail
+	default:
+		fs.service.Logger().Error("Failed to get thumbnail", zap.Uint("file", f.ID), zap.Int("size", size), zap.Error(err))
+		return nil, "", errorsx.ErrFailed
+	}
+}
+
+// 创建可续传的分片上传,分片按序号上传,全部上传后调用CompleteUpload
+func (fs *FileService) CreateUpload(uid uint, create *m.UploadCreate) (*storage.UploadSession, error) {
+	if create == nil {
+		return nil, errorsx.ErrInvalidParams
+	}
+	if err := validator.Validate(create); err != nil {
+		fs.service.Logger().Warn("Invalid upload", zap.Uint("uid", uid), zap.Error(err))
+		return nil, errorsx.ErrInvalidParams
+	}
+	// 创建时先检查大小和限额,类型在完成时检查
+	if err := fs.service.Storage().CheckQuota(uid, create.Size); err != nil {
+		return nil, fs.handleUploadError(uid, "", err)
+	}
+	session, err := fs.service.Uploads().Create(uid, create.Name, create.Size)
+	if err != nil {
+		fs.service.Logger().Error("Failed to create upload", zap.Uint("uid", uid), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return session, nil
+}
+
+func (fs *FileService) UploadStatus(uid uint, id string) (*storage.UploadSession, error) {
+	session, err := fs.service.Uploads().Status(uid, id)
+	return session, fs.handleUploadError(uid, id, err)
+}
+
+// 已经上传过的分片直接返回进度,客户端根据offset继续上传
+func (fs *FileService) UploadChunk(uid uint, id string, index int64, chunk io.Reader) (*storage.UploadSession, error) {
+	session, err := fs.service.Uploads().WriteChunk(uid, id, index, chunk)
+	return session, fs.handleUploadError(uid, id, err)
+}
+
+// 计算hash并保存文件,返回文件ID,内容相同的文件只保存一次
+func (fs *FileService) CompleteUpload(uid uint, id string) (string, error) {
+	fileID, err := fs.service.Uploads().Complete(uid, id)
+	return fileID, fs.handleUploadError(uid, id, err)
+}
+
+func (fs *FileService) CancelUpload(uid uint, id string) error {
+	return fs.handleUploadError(uid, id, fs.service.Uploads().Cancel(uid, id))
+}
+
+func (fs *FileService) handleUploadError(uid uint, id string, err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, storage.ErrUploadNotFound):
+		return errorsx.ErrUploadNotFound
+	case errors.Is(err, storage.ErrInvalidChunk):
+		return errorsx.ErrInvalidChunk
+	case errors.Is(err, storage.ErrUploadIncomplete):
+		return errorsx.ErrUploadIncomplete
+	case errors.Is(err, storage.ErrFileTooLarge):
+		return errorsx.ErrFileTooLarge
+	case errors.Is(err, storage.ErrQuotaExceeded):
+		return errorsx.ErrQuotaExceeded
+	case errors.Is(err, storage.ErrTypeNotAllowed):
+		return errorsx.ErrFileTypeNotAllowed
+	default:
+		fs.service.Logger().Error("Failed to upload", zap.Uint("uid", uid), zap.String("id", id), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+}
+
+func (fs *FileService) permitted(uid uint, id string) (bool, error) {
+	return fs.service.Message().FileShared(uid, id)
+}
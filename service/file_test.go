@@ -0,0 +1,231 @@
+package service_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/farnese17/chat/pkg/storage"
+	"github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDownloadFile(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	file := &storage.File{ID: 1, Name: "a.txt", Path: "a.txt", UploadedBy: uid}
+	mockd.EXPECT().Get("public").Return(file, nil).AnyTimes()
+	mockd.EXPECT().Get("none").Return(nil, storage.ErrNotFound).AnyTimes()
+	mockm.EXPECT().FileShared(uid+1, "public").Return(true, nil)
+	mockm.EXPECT().FileShared(uid+2, "public").Return(false, nil)
+	mockm.EXPECT().FileShared(uid+3, "public").Return(false, errors.New("db error"))
+
+	expires := time.Now().Add(time.Minute).Unix()
+	sign := s.Storage().Sign("public", expires)
+	tests := []struct {
+		name      string
+		uid       uint
+		id        string
+		expires   int64
+		signature string
+		expected  error
+	}{
+		{"uploader", uid, "public", 0, "", nil},
+		{"shared", uid + 1, "public", 0, "", nil},
+		{"not shared", uid + 2, "public", 0, "", errorsx.ErrFileNotFound},
+		{"failed", uid + 3, "public", 0, "", errorsx.ErrFailed},
+		{"not found", uid, "none", 0, "", errorsx.ErrFileNotFound},
+		{"signed", 0, "public", expires, sign, nil},
+		{"invalid signature", 0, "public", expires + 1, sign, errorsx.ErrInvalidLink},
+		{"expired", 0, "public", 1, s.Storage().Sign("public", 1), errorsx.ErrLinkExpired},
+		{"anonymous", 0, "public", 0, "", errorsx.ErrFileNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := files.Download(tt.uid, tt.id, tt.expires, tt.signature)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				assert.Equal(t, file, got)
+			}
+		})
+	}
+}
+
+func TestFileLink(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	file := &storage.File{ID: 1, Name: "a.txt", Path: "a.txt", UploadedBy: uid}
+	mockd.EXPECT().Get("public").Return(file, nil).AnyTimes()
+	mockm.EXPECT().FileShared(uid+1, "public").Return(false, nil)
+	t.Run("not shared", func(t *testing.T) {
+		_, err := files.Link(uid+1, "public")
+		assert.Equal(t, errorsx.ErrFileNotFound, err)
+	})
+
+	t.Run("success", func(t *testing.T) {
+		link, err := files.Link(uid, "public")
+		assert.NoError(t, err)
+		expires := link["expires"].(int64)
+		assert.InDelta(t, time.Now().Add(cfg.FileServer().LinkTTL()).Unix(), expires, 1)
+		assert.True(t, strings.HasPrefix(link["download_url"].(string), "/api/v1/files/download/public?"))
+
+		// 链接不需要登录即可下载
+		parsed, err := url.Parse(link["url"].(string))
+		assert.NoError(t, err)
+		assert.Equal(t, "/api/v1/files/public", parsed.Path)
+		assert.Equal(t, strconv.FormatInt(expires, 10), parsed.Query().Get("expires"))
+		got, err := files.Download(0, "public", expires, parsed.Query().Get("signature"))
+		assert.NoError(t, err)
+		assert.Equal(t, file, got)
+	})
+}
+
+func TestChunkedUpload(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	_, err := files.CreateUpload(uid, &model.UploadCreate{Name: "a.txt"})
+	assert.Equal(t, errorsx.ErrInvalidParams, err)
+	_, err = files.CreateUpload(uid, nil)
+	assert.Equal(t, errorsx.ErrInvalidParams, err)
+
+	content := []byte("0123456789")
+	session, err := files.CreateUpload(uid, &model.UploadCreate{Name: "a.txt", Size: int64(len(content))})
+	assert.NoError(t, err)
+
+	_, err = files.UploadStatus(uid+1, session.ID)
+	assert.Equal(t, errorsx.ErrUploadNotFound, err)
+	_, err = files.CompleteUpload(uid, session.ID)
+	assert.Equal(t, errorsx.ErrUploadIncomplete, err)
+	_, err = files.UploadChunk(uid, session.ID, 1, bytes.NewReader(content[4:8]))
+	assert.Equal(t, errorsx.ErrInvalidChunk, err)
+
+	for i := int64(0); i*4 < int64(len(content)); i++ {
+		got, err := files.UploadChunk(uid, session.ID, i, bytes.NewReader(content[i*4:min(i*4+4, int64(len(content)))]))
+		assert.NoError(t, err)
+		assert.Equal(t, min(i*4+4, int64(len(content))), got.Offset)
+	}
+	got, err := files.UploadStatus(uid, session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(content)), got.Offset)
+
+	mockfs.EXPECT().Upload(uid, gomock.Any(), "a.txt").DoAndReturn(func(uploader uint, file multipart.File, filename string) (string, error) {
+		defer file.Close()
+		data, _ := io.ReadAll(file)
+		assert.Equal(t, content, data)
+		return "", storage.ErrUploadFailed
+	})
+	_, err = files.CompleteUpload(uid, session.ID)
+	assert.Equal(t, errorsx.ErrFailed, err)
+
+	// 保存失败时可以重试
+	mockfs.EXPECT().Upload(uid, gomock.Any(), "a.txt").Return("public", nil)
+	id, err := files.CompleteUpload(uid, session.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, "public", id)
+	_, err = files.UploadStatus(uid, session.ID)
+	assert.Equal(t, errorsx.ErrUploadNotFound, err)
+
+	session, err = files.CreateUpload(uid, &model.UploadCreate{Name: "b.txt", Size: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, errorsx.ErrUploadNotFound, files.CancelUpload(uid+1, session.ID))
+	assert.NoError(t, files.CancelUpload(uid, session.ID))
+	assert.Equal(t, errorsx.ErrUploadNotFound, files.CancelUpload(uid, session.ID))
+}
+
+func TestThumbnail(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	dir := t.TempDir()
+	image := &storage.File{ID: 1, Name: "a.png", Path: filepath.Join(dir, "a.png"), MIME: "image/png", Width: 600, Height: 300}
+	err := os.WriteFile(image.Path+"_thumb256.png", []byte("thumbnail"), 0644)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		file     *storage.File
+		size     int
+		expected error
+	}{
+		{"default size", image, 0, nil},
+		{"size", image, 256, nil},
+		{"invalid size", image, 100, errorsx.ErrInvalidParams},
+		{"not generated", image, 128, errorsx.ErrNoThumbnail},
+		{"not image", &storage.File{ID: 2, Name: "a.txt", Path: filepath.Join(dir, "a.txt"), MIME: "text/plain"}, 0, errorsx.ErrNoThumbnail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, contentType, err := files.Thumbnail(tt.file, tt.size)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				data, _ := io.ReadAll(content)
+				content.Close()
+				assert.Equal(t, "thumbnail", string(data))
+				assert.Equal(t, "image/png", contentType)
+			}
+		})
+	}
+}
+
+func TestFileQuota(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	s.Storage().(*storage.LocalStorage).Policy = &storage.Policy{
+		Quota: storage.Quota{MaxBytes: 100, MaxFiles: 2, MaxFileSize: 50},
+	}
+	mockd.EXPECT().GetQuota(uid).Return(nil, storage.ErrNotFound).AnyTimes()
+	mockd.EXPECT().GetQuota(uid+1).Return(&storage.Quota{MaxBytes: 1000}, nil).AnyTimes()
+	mockd.EXPECT().GetQuota(uid+2).Return(nil, errors.New("db error")).AnyTimes()
+	mockd.EXPECT().Usage(uid).Return(&storage.Usage{Bytes: 60, Files: 1}, nil).AnyTimes()
+	mockd.EXPECT().Usage(uid+1).Return(&storage.Usage{Bytes: 60, Files: 5}, nil).AnyTimes()
+
+	t.Run("usage", func(t *testing.T) {
+		got, err := files.Usage(uid)
+		assert.NoError(t, err)
+		assert.Equal(t, &storage.QuotaUsage{
+			Usage: storage.Usage{Bytes: 60, Files: 1},
+			Quota: storage.Quota{MaxBytes: 100, MaxFiles: 2, MaxFileSize: 50},
+		}, got)
+
+		got, err = files.Usage(uid + 1)
+		assert.NoError(t, err)
+		assert.True(t, got.Custom)
+		assert.Equal(t, storage.Quota{MaxBytes: 1000}, got.Quota)
+
+		_, err = files.Usage(uid + 2)
+		assert.Equal(t, errorsx.ErrFailed, err)
+	})
+
+	tests := []struct {
+		name     string
+		uid      uint
+		size     int64
+		expected error
+	}{
+		{"ok", uid, 40, nil},
+		{"too large", uid, 51, errorsx.ErrFileTooLarge},
+		{"bytes exceeded", uid, 41, errorsx.ErrQuotaExceeded},
+		{"custom quota", uid + 1, 500, nil},
+		{"failed", uid + 2, 1, errorsx.ErrFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := files.CreateUpload(tt.uid, &model.UploadCreate{Name: "a.txt", Size: tt.size})
+			assert.Equal(t, tt.expected, err)
+		})
+	}
+}
@@ -168,6 +168,8 @@ func (f *FriendService) updateStatus(ctx *updateFriendContext,
 			}
 			return err
 		}
+		// 更新websocket使用的好友状态缓存
+		f.service.Cache().SetFriendStatus(id1, id2, ctx.status)
 		return nil
 	}
 	return nil
@@ -590,6 +592,34 @@ func (f *FriendService) List(id uint) (map[string][]*m.SummaryFriendInfo, error)
 	return data, nil
 }
 
+// 好友在线状态,推送服务不可用时全部视为离线
+func (f *FriendService) Presence(id uint) ([]*m.Presence, error) {
+	friends, err := f.service.Friend().List(id)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uint, 0, len(friends))
+	for _, friend := range friends {
+		if friend.Status == m.FSAdded {
+			ids = append(ids, friend.UID)
+		}
+	}
+	lastSeen, err := f.service.Cache().GetLastSeen(ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	hub := f.service.Hub()
+	data := make([]*m.Presence, len(ids))
+	for i, uid := range ids {
+		data[i] = &m.Presence{ID: uid, LastSeen: lastSeen[uid]}
+		if hub != nil && !hub.IsClosed() {
+			data[i].Online = hub.Online(uid)
+		}
+	}
+	return data, nil
+}
+
 func (f *FriendService) Get(from, to uint) (*m.Friendinfo, error) {
 	friend, err := f.service.Friend().Get(from, to)
 	if err != nil {
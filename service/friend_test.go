@@ -78,6 +78,7 @@ func TestRequest(t *testing.T) {
 		mockf.EXPECT().QueryStatus(uid, uid+1).Return(friend, nil)
 		if tt.expected == nil {
 			mockf.EXPECT().UpdateStatus(friend).Return(tt.mock)
+			mockc.EXPECT().SetFriendStatus(uid, uid+1, gomock.Any())
 			mockf.EXPECT().GetUser(gomock.Any()).Return(user, nil)
 		}
 		t.Run(fmt.Sprintf("request %d", i), func(t *testing.T) {
@@ -117,6 +118,7 @@ func TestRequest(t *testing.T) {
 			friend.Status = tt.status
 			mockf.EXPECT().QueryStatus(uid, uid+1).Return(friend, nil)
 			mockf.EXPECT().UpdateStatus(friend).Return(nil)
+			mockc.EXPECT().SetFriendStatus(uid, uid+1, gomock.Any())
 			mockf.EXPECT().GetUser(gomock.Any()).Return(user, nil)
 			err := f.Request(tt.from, tt.to)
 			assert.NoError(t, err)
@@ -180,6 +182,7 @@ func TestAccept(t *testing.T) {
 		mockf.EXPECT().QueryStatus(uid, uid+1).Return(friend, nil)
 		if tt.expected == nil {
 			mockf.EXPECT().UpdateStatus(gomock.Any()).Return(tt.mock)
+			mockc.EXPECT().SetFriendStatus(uid, uid+1, gomock.Any())
 			mockf.EXPECT().GetUser(tt.from, tt.to).Return(user, nil)
 		}
 		t.Run(fmt.Sprintf("accept friend request %d", i), func(t *testing.T) {
@@ -239,6 +242,7 @@ func TestReject(t *testing.T) {
 		mockf.EXPECT().QueryStatus(uid, uid+1).Return(friend, nil)
 		if tt.expected == nil {
 			mockf.EXPECT().UpdateStatus(gomock.Any()).Return(tt.mock)
+			mockc.EXPECT().SetFriendStatus(uid, uid+1, gomock.Any())
 			mockf.EXPECT().GetUser(gomock.Any()).Return(user, nil)
 		}
 		t.Run(fmt.Sprintf("reject friend %d", i), func(t *testing.T) {
@@ -298,6 +302,7 @@ func TestDeleteFriend(t *testing.T) {
 		mockf.EXPECT().QueryStatus(uid, uid+1).Return(friend, nil)
 		if tt.expected == nil {
 			mockf.EXPECT().UpdateStatus(gomock.Any()).Return(tt.mock)
+			mockc.EXPECT().SetFriendStatus(uid, uid+1, gomock.Any())
 			mockf.EXPECT().GetUser(gomock.Any()).Return(user, nil)
 		}
 		t.Run(fmt.Sprintf("delete friend %d", i), func(t *testing.T) {
@@ -352,6 +357,7 @@ func TestBlock(t *testing.T) {
 		mockf.EXPECT().QueryStatus(uid, uid+1).Return(friend, nil)
 		if tt.expected == nil {
 			mockf.EXPECT().UpdateStatus(gomock.Any()).Return(tt.mock)
+			mockc.EXPECT().SetFriendStatus(uid, uid+1, gomock.Any())
 			mockf.EXPECT().GetUser(gomock.Any()).Return(user, nil)
 		}
 		t.Run(fmt.Sprintf("block friend %d", i), func(t *testing.T) {
@@ -414,6 +420,7 @@ func TestUnblock(t *testing.T) {
 		mockf.EXPECT().QueryStatus(uid, uid+1).Return(friend, nil)
 		if tt.expected == nil {
 			mockf.EXPECT().UpdateStatus(gomock.Any()).Return(tt.mock)
+			mockc.EXPECT().SetFriendStatus(uid, uid+1, gomock.Any())
 			mockf.EXPECT().GetUser(gomock.Any()).Return(user, nil)
 		}
 		t.Run(fmt.Sprintf("unblock friend %d", i), func(t *testing.T) {
@@ -601,6 +608,51 @@ func TestFriendList(t *testing.T) {
 	})
 }
 
+func TestFriendPresence(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	data := []*model.SummaryFriendInfo{
+		{UID: uid + 1, Status: model.FSAdded},
+		{UID: uid + 2, Status: model.FSBlock1To2},
+		{UID: uid + 3, Status: model.FSReq2To1},
+		{UID: uid + 4, Status: model.FSAdded},
+	}
+	lastSeen := map[uint]int64{uid + 1: 1700000000000}
+
+	t.Run("presence: success", func(t *testing.T) {
+		mockf.EXPECT().List(uid).Return(data, nil)
+		mockc.EXPECT().GetLastSeen(uid+1, uid+4).Return(lastSeen, nil)
+		got, err := f.Presence(uid)
+		assert.NoError(t, err)
+		expected := []*model.Presence{
+			{ID: uid + 1, LastSeen: 1700000000000},
+			{ID: uid + 4},
+		}
+		assert.Equal(t, expected, got)
+	})
+	t.Run("presence: no friends", func(t *testing.T) {
+		mockf.EXPECT().List(uid).Return(data[1:3], nil)
+		mockc.EXPECT().GetLastSeen().Return(map[uint]int64{}, nil)
+		got, err := f.Presence(uid)
+		assert.NoError(t, err)
+		assert.Empty(t, got)
+	})
+	t.Run("presence: list error", func(t *testing.T) {
+		mockf.EXPECT().List(uid).Return(nil, errorsx.ErrOperactionTimeout)
+		got, err := f.Presence(uid)
+		assert.Equal(t, errorsx.ErrOperactionTimeout, err)
+		assert.Nil(t, got)
+	})
+	t.Run("presence: cache error", func(t *testing.T) {
+		mockf.EXPECT().List(uid).Return(data, nil)
+		mockc.EXPECT().GetLastSeen(uid+1, uid+4).Return(nil, errors.New("error"))
+		got, err := f.Presence(uid)
+		assert.Error(t, err)
+		assert.Nil(t, got)
+	})
+}
+
 func TestSearch(t *testing.T) {
 	setup(t)
 	defer clear(t)
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"strconv"
@@ -29,8 +30,15 @@ const (
 	kickMsg          = "%s 将 %s 踢出了群聊"
 	handOverOwnerMsg = "%s 成为了新的群主"
 	removeAdminMsg   = "%s 不再担任管理员(%s)"
+	muteMsg          = "%s 将 %s 禁言 %d 分钟"
+	unmuteMsg        = "%s 解除了 %s 的禁言"
+	muteAllMsg       = "%s 开启了全员禁言"
+	unmuteAllMsg     = "%s 关闭了全员禁言"
 )
 
+// 禁言时长上限(分钟)
+const maxMuteMinutes = 30 * 24 * 60
+
 type memberOperation int
 
 const (
@@ -44,6 +52,8 @@ const (
 	removeAdmin
 	adminResign
 	handOverOwner
+	muteMember
+	muteAll
 )
 
 type GroupService struct {
@@ -155,6 +165,7 @@ func (g *GroupService) Delete(gid uint, uid uint) error {
 	key := m.CacheGroup + strconv.FormatUint(uint64(gid), 10)
 	g.service.Cache().Remove(key)
 	g.service.Cache().RemoveGroupLastActiveTime(gid)
+	g.removeRetainedOfflineMessages(gid, members...)
 	g.service.Logger().Info("finished delete group", zap.Uint("gid", gid), zap.Uint("uid", uid))
 
 	// 广播解散消息
@@ -403,6 +414,28 @@ func (g *GroupService) validateStatus(ctx *m.MemberStatusContext, op memberOpera
 		default:
 			return errorsx.ErrNotInGroup
 		}
+	case muteMember:
+		if fStatus != m.GroupRoleOwner && fStatus != m.GroupRoleAdmin {
+			return errorsx.ErrPermissiondenied
+		}
+		switch tStatus {
+		case m.GroupRoleMember:
+			return nil
+		case m.GroupRoleAdmin:
+			// 只有群主可以禁言管理员
+			if fStatus == m.GroupRoleOwner {
+				return nil
+			}
+			return errorsx.ErrCantMuteAdmin
+		case m.GroupRoleOwner:
+			return errorsx.ErrCantMuteAdmin
+		default:
+			return errorsx.ErrNotInGroup
+		}
+	case muteAll:
+		if fStatus != m.GroupRoleOwner && fStatus != m.GroupRoleAdmin {
+			return errorsx.ErrPermissiondenied
+		}
 	}
 	return nil
 }
@@ -575,6 +608,7 @@ func (g *GroupService) Leave(uid, gid uint) error {
 		return err
 	}
 	err := g.removeCacheMember(gid, uid)
+	g.removeRetainedOfflineMessages(gid, uid)
 	body := fmt.Sprintf(leaveMsg, ctx.Data[uid].Username)
 	if err := g.broadcase(gid, body); err != nil {
 		return err
@@ -604,6 +638,7 @@ func (g *GroupService) Kick(from, to, gid uint) error {
 	}
 
 	err := g.removeCacheMember(gid, to)
+	g.removeRetainedOfflineMessages(gid, to)
 
 	msg := fmt.Sprintf(kickMsg, ctx.Data[from].Username, ctx.Data[to].Username)
 	if err := g.broadcase(gid, msg); err != nil {
@@ -747,6 +782,96 @@ func (g *GroupService) AdminResign(uid, gid uint) error {
 	return nil
 }
 
+// 禁言成员,minutes为0时解除禁言
+// 群主可以禁言管理员和普通成员,管理员只能禁言普通成员
+func (g *GroupService) MuteMember(from, to, gid uint, minutes int) error {
+	if minutes < 0 || minutes > maxMuteMinutes {
+		return errorsx.ErrInvalidParams
+	}
+	ctx := &m.MemberStatusContext{
+		GID:  gid,
+		From: from,
+		To:   to,
+	}
+	if err := g.validateStatus(ctx, muteMember); err != nil {
+		if errors.Is(err, errorsx.ErrUserNotExist) {
+			return errorsx.ErrNotInGroup
+		}
+		return err
+	}
+
+	var expireAt int64
+	if minutes > 0 {
+		expireAt = time.Now().Add(time.Duration(minutes) * time.Minute).Unix()
+	}
+	if err := g.service.Group().MuteMember(gid, to, expireAt); err != nil {
+		if errors.Is(err, errorsx.ErrNoAffectedRows) {
+			return errorsx.ErrNotInGroup
+		}
+		g.service.Logger().Error("Failed to mute member", zap.Error(err))
+		return err
+	}
+	err := g.removeCacheMute(gid)
+
+	var body string
+	if minutes > 0 {
+		body = fmt.Sprintf(muteMsg, ctx.Data[from].Username, ctx.Data[to].Username, minutes)
+	} else {
+		body = fmt.Sprintf(unmuteMsg, ctx.Data[from].Username, ctx.Data[to].Username)
+	}
+	if err := g.broadcase(gid, body); err != nil {
+		return err
+	}
+	return err
+}
+
+// 开启或关闭全员禁言,群主和管理员不受影响
+func (g *GroupService) MuteAll(from, gid uint, muted bool) error {
+	ctx := &m.MemberStatusContext{
+		GID:  gid,
+		From: from,
+	}
+	if err := g.validateStatus(ctx, muteAll); err != nil {
+		if errors.Is(err, errorsx.ErrUserNotExist) {
+			return errorsx.ErrPermissiondenied
+		}
+		return err
+	}
+
+	if err := g.service.Group().MuteAll(gid, muted); err != nil {
+		g.service.Logger().Error("Failed to mute group", zap.Error(err))
+		return err
+	}
+	err := g.removeCacheMute(gid)
+
+	body := fmt.Sprintf(unmuteAllMsg, ctx.Data[from].Username)
+	if muted {
+		body = fmt.Sprintf(muteAllMsg, ctx.Data[from].Username)
+	}
+	if err := g.broadcase(gid, body); err != nil {
+		return err
+	}
+	return err
+}
+
+// 成员开启或关闭群组免打扰,只影响普通消息的提醒,提及仍会通知
+func (g *GroupService) SetDoNotDisturb(uid, gid uint, enabled bool) error {
+	members, err := g.service.Cache().GetMembersAndCache(gid)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(members, uid) {
+		return errorsx.ErrNotInGroup
+	}
+	// 设置值与原值相同时没有影响的行
+	err = g.service.Group().SetDoNotDisturb(gid, uid, enabled)
+	if err != nil && !errors.Is(err, errorsx.ErrNoAffectedRows) {
+		g.service.Logger().Error("Failed to set do not disturb", zap.Uint("gid", gid), zap.Uint("uid", uid), zap.Error(err))
+		return err
+	}
+	return nil
+}
+
 func (g *GroupService) broadcase(gid uint, body string) error {
 	message := &ws.ChatMsg{
 		Type: ws.System,
@@ -785,6 +910,64 @@ func (g *GroupService) removeCacheMember(gid, uid uint) error {
 	return errorsx.ErrHandleSuccessed
 }
 
+// 设置了消息保留时间的群组,成员离开后不再按成员清理离线消息
+// 离开时删除其离线消息中属于该群组的消息,避免过期的消息在下次连接时仍被收到
+func (g *GroupService) removeRetainedOfflineMessages(gid uint, uids ...uint) {
+	if _, err := g.service.Message().Retention(gid, 0, 0); err != nil {
+		if !errors.Is(err, errorsx.ErrRecordNotFound) {
+			g.service.Logger().Error("Failed to get retention", zap.Uint("gid", gid), zap.Error(err))
+		}
+		return
+	}
+	for _, uid := range uids {
+		if err := g.removeGroupOfflineMessages(gid, uid); err != nil {
+			g.service.Logger().Error("Failed to remove offline messages",
+				zap.Uint("gid", gid), zap.Uint("uid", uid), zap.Error(err))
+		}
+	}
+}
+
+func (g *GroupService) removeGroupOfflineMessages(gid, uid uint) error {
+	messages, err := g.service.Cache().GetOfflineMessages(uid)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, message := range messages {
+		var header struct {
+			ID string `json:"id"`
+		}
+		if err := json.Unmarshal([]byte(message), &header); err == nil && header.ID != "" {
+			ids = append(ids, header.ID)
+		}
+	}
+	for batch := range slices.Chunk(ids, 500) {
+		groupIDs, err := g.service.Message().GroupMessageIDs(gid, batch)
+		if err != nil {
+			return err
+		}
+		if len(groupIDs) == 0 {
+			continue
+		}
+		if err := g.service.Cache().RemoveOfflineMessages(uid, groupIDs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GroupService) removeCacheMute(gid uint) error {
+	maxRetries := g.service.Config().Common().MaxRetries()
+	for try := 0; try < maxRetries; try++ {
+		if err := g.service.Cache().RemoveGroupMute(gid); err == nil {
+			return nil
+		}
+		delay := g.service.Config().Cache().RetryDelay(try)
+		time.Sleep(delay)
+	}
+	return errorsx.ErrHandleSuccessed
+}
+
 func (g *GroupService) msgIsValid(msgTime int64) bool {
 	now := time.Now().UnixMilli()
 	validDays := g.service.Config().Common().InviteValidDays()
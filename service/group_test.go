@@ -184,6 +184,7 @@ func TestDelete(t *testing.T) {
 			if tt.expected == nil {
 				mockc.EXPECT().Remove(gomock.Any()).Return()
 				mockc.EXPECT().RemoveGroupLastActiveTime(gid).Return()
+				mockm.EXPECT().Retention(gid, uint(0), uint(0)).Return(nil, errorsx.ErrRecordNotFound)
 			}
 			err := g.Delete(gid, uid)
 			assert.Equal(t, tt.expected, err)
@@ -200,6 +201,7 @@ func TestDelete(t *testing.T) {
 		mockg.EXPECT().Delete(gid, uid).Return(nil)
 		mockc.EXPECT().Remove(gomock.Any()).Return()
 		mockc.EXPECT().RemoveGroupLastActiveTime(gid).Return()
+		mockm.EXPECT().Retention(gid, uint(0), uint(0)).Return(nil, errorsx.ErrRecordNotFound)
 		err := g.Delete(gid, uid)
 		assert.NoError(t, err)
 		msg := <-mock.Message
@@ -699,6 +701,7 @@ func TestLeave(t *testing.T) {
 		}
 		if tt.expected == nil {
 			mockc.EXPECT().RemoveMember(gid, uid+1)
+			mockm.EXPECT().Retention(gid, uint(0), uint(0)).Return(nil, errorsx.ErrRecordNotFound)
 		}
 		t.Run(fmt.Sprintf("leave %d", i), func(t *testing.T) {
 			err := g.Leave(uid+1, gid)
@@ -715,6 +718,25 @@ func TestLeave(t *testing.T) {
 			}
 		})
 	}
+
+	// 设置了保留时间的群组,删除离开的成员离线消息中该群组的消息
+	t.Run("leave group with retention", func(t *testing.T) {
+		members[0].Role = model.GroupRoleMember
+		mockg.EXPECT().QueryRole(gid, gomock.Any()).Return(members, nil)
+		mockg.EXPECT().DeleteMember(gomock.Any()).Return(nil)
+		mockc.EXPECT().RemoveMember(gid, uid+1)
+		mockm.EXPECT().Retention(gid, uint(0), uint(0)).Return(&model.Retention{GroupID: gid, TTL: 60}, nil)
+		mockc.EXPECT().GetOfflineMessages(uid+1).Return([]string{
+			`{"id":"a","type":102,"to":1000000001}`,
+			`{"id":"b","type":101,"to":100002}`,
+			`{"id":"c","type":106,"to":1000000001}`,
+		}, nil)
+		mockm.EXPECT().GroupMessageIDs(gid, []string{"a", "b", "c"}).Return([]string{"a", "c"}, nil)
+		mockc.EXPECT().RemoveOfflineMessages(uid+1, []string{"a", "c"}).Return(nil)
+		err := g.Leave(uid+1, gid)
+		assert.NoError(t, err)
+		<-mock.Message
+	})
 }
 
 func TestKick(t *testing.T) {
@@ -753,6 +775,7 @@ func TestKick(t *testing.T) {
 			mockg.EXPECT().DeleteMember(gomock.Any()).Return(tt.mock)
 			if tt.expected == nil {
 				mockc.EXPECT().RemoveMember(gid, uid+1)
+				mockm.EXPECT().Retention(gid, uint(0), uint(0)).Return(nil, errorsx.ErrRecordNotFound)
 			}
 		}
 
@@ -773,6 +796,149 @@ func TestKick(t *testing.T) {
 	}
 }
 
+func TestMuteMember(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	members := []*model.GroupMemberRole{
+		{MemberID: uid, Username: "test1"},
+		{MemberID: uid + 1, Username: "test2"},
+	}
+
+	tests := []struct {
+		fStatus, tStatus int
+		minutes          int
+		mock             error
+		expected         error
+		mockQuery        bool
+		mockAll          bool
+		body             string
+	}{
+		{model.GroupRoleOwner, model.GroupRoleMember, -1, nil, errorsx.ErrInvalidParams, false, false, ""},
+		{model.GroupRoleOwner, model.GroupRoleMember, 30*24*60 + 1, nil, errorsx.ErrInvalidParams, false, false, ""},
+		{0, model.GroupRoleMember, 10, nil, errorsx.ErrPermissiondenied, true, false, ""},
+		{model.GroupRoleMember, model.GroupRoleMember, 10, nil, errorsx.ErrPermissiondenied, true, false, ""},
+		{model.GroupRoleAdmin, model.GroupRoleAdmin, 10, nil, errorsx.ErrCantMuteAdmin, true, false, ""},
+		{model.GroupRoleAdmin, model.GroupRoleOwner, 10, nil, errorsx.ErrCantMuteAdmin, true, false, ""},
+		{model.GroupRoleOwner, 0, 10, nil, errorsx.ErrNotInGroup, true, false, ""},
+		{model.GroupRoleOwner, model.GroupRoleMember, 10, errorsx.ErrNoAffectedRows, errorsx.ErrNotInGroup, true, true, ""},
+		{model.GroupRoleOwner, model.GroupRoleMember, 10, nil, nil, true, true, "test1 将 test2 禁言 10 分钟"},
+		{model.GroupRoleOwner, model.GroupRoleAdmin, 10, nil, nil, true, true, "test1 将 test2 禁言 10 分钟"},
+		{model.GroupRoleAdmin, model.GroupRoleMember, 0, nil, nil, true, true, "test1 解除了 test2 的禁言"},
+	}
+
+	for i, tt := range tests {
+		members[0].Role = tt.fStatus
+		members[1].Role = tt.tStatus
+		if tt.mockQuery {
+			mockg.EXPECT().QueryRole(gid, gomock.Any()).Return(members, nil)
+		}
+		if tt.mockAll {
+			mockg.EXPECT().MuteMember(gid, uid+1, gomock.Any()).DoAndReturn(
+				func(gid, uid uint, expireAt int64) error {
+					if tt.minutes == 0 {
+						assert.Zero(t, expireAt)
+					} else {
+						assert.Greater(t, expireAt, time.Now().Unix())
+					}
+					return tt.mock
+				})
+			if tt.expected == nil {
+				mockc.EXPECT().RemoveGroupMute(gid)
+			}
+		}
+
+		t.Run(fmt.Sprintf("mute member %d", i), func(t *testing.T) {
+			err := g.MuteMember(uid, uid+1, gid, tt.minutes)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				msg := <-mock.Message
+				message := &ws.ChatMsg{
+					Type: ws.System,
+					To:   gid,
+					Time: msg.Time,
+					Body: tt.body,
+				}
+				assert.Equal(t, message, msg)
+			}
+		})
+	}
+}
+
+func TestMuteAll(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	members := []*model.GroupMemberRole{{MemberID: uid, Username: "test1"}}
+
+	tests := []struct {
+		fStatus  int
+		muted    bool
+		mock     error
+		expected error
+		mockAll  bool
+		body     string
+	}{
+		{0, true, nil, errorsx.ErrPermissiondenied, false, ""},
+		{model.GroupRoleMember, true, nil, errorsx.ErrPermissiondenied, false, ""},
+		{model.GroupRoleOwner, true, errorsx.ErrFailed, errorsx.ErrFailed, true, ""},
+		{model.GroupRoleOwner, true, nil, nil, true, "test1 开启了全员禁言"},
+		{model.GroupRoleAdmin, false, nil, nil, true, "test1 关闭了全员禁言"},
+	}
+
+	for i, tt := range tests {
+		members[0].Role = tt.fStatus
+		mockg.EXPECT().QueryRole(gid, uid).Return(members, nil)
+		if tt.mockAll {
+			mockg.EXPECT().MuteAll(gid, tt.muted).Return(tt.mock)
+			if tt.expected == nil {
+				mockc.EXPECT().RemoveGroupMute(gid)
+			}
+		}
+
+		t.Run(fmt.Sprintf("mute all %d", i), func(t *testing.T) {
+			err := g.MuteAll(uid, gid, tt.muted)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				msg := <-mock.Message
+				assert.Equal(t, tt.body, msg.Body)
+				assert.Equal(t, ws.System, msg.Type)
+			}
+		})
+	}
+}
+
+func TestSetDoNotDisturb(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	tests := []struct {
+		members  []uint
+		cacheErr error
+		mock     error
+		mockDND  bool
+		expected error
+	}{
+		{nil, errorsx.ErrFailed, nil, false, errorsx.ErrFailed},
+		{[]uint{uid + 1}, nil, nil, false, errorsx.ErrNotInGroup},
+		{[]uint{uid}, nil, errorsx.ErrFailed, true, errorsx.ErrFailed},
+		// 重复设置
+		{[]uint{uid}, nil, errorsx.ErrNoAffectedRows, true, nil},
+		{[]uint{uid}, nil, nil, true, nil},
+	}
+
+	for i, tt := range tests {
+		mockc.EXPECT().GetMembersAndCache(gid).Return(tt.members, tt.cacheErr)
+		if tt.mockDND {
+			mockg.EXPECT().SetDoNotDisturb(gid, uid, true).Return(tt.mock)
+		}
+		t.Run(fmt.Sprintf("set do not disturb %d", i), func(t *testing.T) {
+			err := g.SetDoNotDisturb(uid, gid, true)
+			assert.Equal(t, tt.expected, err)
+		})
+	}
+}
+
 func TestHandOverOwner(t *testing.T) {
 	setup(t)
 	defer clear(t)
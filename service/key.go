@@ -0,0 +1,151 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/farnese17/chat/registry"
+	m "github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/farnese17/chat/utils/validator"
+	"go.uber.org/zap"
+)
+
+const (
+	// 每次最多上传的一次性预共享公钥数量
+	maxPreKeysPerUpload = 100
+	// 每个用户最多保存的一次性预共享公钥数量
+	maxPreKeys = 500
+)
+
+// 端到端加密的密钥目录,服务端只保存和分发公钥
+type KeyService struct {
+	service registry.Service
+}
+
+func NewKeyService(s registry.Service) *KeyService {
+	return &KeyService{s}
+}
+
+// 上传身份公钥、签名预共享公钥和一次性预共享公钥,开启端到端加密
+// 身份公钥变化时旧的一次性预共享公钥失效
+func (ks *KeyService) Upload(uid uint, upload *m.KeyUpload) error {
+	if upload == nil {
+		return errorsx.ErrInvalidParams
+	}
+	if err := validator.Validate(upload); err != nil {
+		ks.service.Logger().Warn("Invalid keys", zap.Uint("uid", uid), zap.Error(err))
+		return errorsx.ErrInvalidParams
+	}
+
+	var count int64
+	old, err := ks.service.Key().IdentityKey(uid)
+	if err == nil && old.IdentityKey == upload.IdentityKey.IdentityKey {
+		if count, err = ks.service.Key().CountPreKeys(uid); err != nil {
+			ks.service.Logger().Error("Failed to count prekeys", zap.Uint("uid", uid), zap.Error(err))
+			return errorsx.ErrFailed
+		}
+	} else if err != nil && !errors.Is(err, errorsx.ErrRecordNotFound) {
+		ks.service.Logger().Error("Failed to get identity key", zap.Uint("uid", uid), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	if count+int64(len(upload.PreKeys)) > maxPreKeys {
+		return errorsx.ErrTooManyPreKeys
+	}
+
+	key := upload.IdentityKey
+	key.UserID = uid
+	if err := ks.service.Key().SaveKeys(&key, upload.PreKeys); err != nil {
+		ks.service.Logger().Error("Failed to save keys", zap.Uint("uid", uid), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	return nil
+}
+
+// 补充一次性预共享公钥,需要先上传身份公钥
+func (ks *KeyService) AddPreKeys(uid uint, preKeys []*m.PreKey) error {
+	if len(preKeys) == 0 || len(preKeys) > maxPreKeysPerUpload {
+		return errorsx.ErrInvalidParams
+	}
+	for _, preKey := range preKeys {
+		if preKey == nil {
+			return errorsx.ErrInvalidParams
+		}
+		if err := validator.Validate(preKey); err != nil {
+			ks.service.Logger().Warn("Invalid prekey", zap.Uint("uid", uid), zap.Error(err))
+			return errorsx.ErrInvalidParams
+		}
+	}
+	if _, err := ks.identityKey(uid); err != nil {
+		return err
+	}
+
+	count, err := ks.service.Key().CountPreKeys(uid)
+	if err != nil {
+		ks.service.Logger().Error("Failed to count prekeys", zap.Uint("uid", uid), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	if count+int64(len(preKeys)) > maxPreKeys {
+		return errorsx.ErrTooManyPreKeys
+	}
+	if err := ks.service.Key().AddPreKeys(uid, preKeys); err != nil {
+		ks.service.Logger().Error("Failed to add prekeys", zap.Uint("uid", uid), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	return nil
+}
+
+// 剩余的一次性预共享公钥数量,客户端据此补充
+func (ks *KeyService) PreKeyCount(uid uint) (map[string]any, error) {
+	count, err := ks.service.Key().CountPreKeys(uid)
+	if err != nil {
+		ks.service.Logger().Error("Failed to count prekeys", zap.Uint("uid", uid), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return map[string]any{"count": count}, nil
+}
+
+// 获取用户的密钥包,每次取出一个一次性预共享公钥,用完后只返回签名预共享公钥
+func (ks *KeyService) Bundle(uid, target uint) (*m.KeyBundle, error) {
+	if err := validator.ValidateUID(target); err != nil {
+		return nil, errorsx.ErrInvalidParams
+	}
+	key, err := ks.identityKey(target)
+	if err != nil {
+		return nil, err
+	}
+	bundle := &m.KeyBundle{IdentityKey: key}
+	preKey, err := ks.service.Key().TakePreKey(target)
+	if err == nil {
+		bundle.PreKey = preKey
+	} else if !errors.Is(err, errorsx.ErrRecordNotFound) {
+		ks.service.Logger().Error("Failed to take prekey",
+			zap.Uint("uid", uid), zap.Uint("target", target), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return bundle, nil
+}
+
+// 删除所有公钥,关闭端到端加密
+func (ks *KeyService) Delete(uid uint) error {
+	err := ks.service.Key().DeleteKeys(uid)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNoAffectedRows) {
+			return errorsx.ErrKeyNotFound
+		}
+		ks.service.Logger().Error("Failed to delete keys", zap.Uint("uid", uid), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	return nil
+}
+
+func (ks *KeyService) identityKey(uid uint) (*m.IdentityKey, error) {
+	key, err := ks.service.Key().IdentityKey(uid)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return nil, errorsx.ErrKeyNotFound
+		}
+		ks.service.Logger().Error("Failed to get identity key", zap.Uint("uid", uid), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return key, nil
+}
@@ -0,0 +1,133 @@
+package service_test
+
+import (
+	"testing"
+
+	"github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func genPreKeys(count int) []*model.PreKey {
+	preKeys := make([]*model.PreKey, count)
+	for i := range count {
+		preKeys[i] = &model.PreKey{KeyID: uint32(i + 1), PublicKey: "cHJla2V5"}
+	}
+	return preKeys
+}
+
+func TestUploadKeys(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	key := model.IdentityKey{IdentityKey: "aWRlbnRpdHk=", SignedPreKeyID: 1, SignedPreKey: "c2lnbmVk", Signature: "c2lnbmF0dXJl"}
+	invalid := key
+	invalid.Signature = "not base64!"
+	t.Run("invalid", func(t *testing.T) {
+		err := ks.Upload(uid, &model.KeyUpload{IdentityKey: invalid})
+		assert.Equal(t, errorsx.ErrInvalidParams, err)
+		err = ks.Upload(uid, &model.KeyUpload{IdentityKey: key, PreKeys: genPreKeys(101)})
+		assert.Equal(t, errorsx.ErrInvalidParams, err)
+	})
+
+	// 身份公钥不变时计算已有的一次性预共享公钥
+	mockk.EXPECT().IdentityKey(uid).Return(&key, nil)
+	mockk.EXPECT().CountPreKeys(uid).Return(int64(450), nil)
+	t.Run("too many prekeys", func(t *testing.T) {
+		err := ks.Upload(uid, &model.KeyUpload{IdentityKey: key, PreKeys: genPreKeys(51)})
+		assert.Equal(t, errorsx.ErrTooManyPreKeys, err)
+	})
+
+	// 身份公钥变化时旧的一次性预共享公钥失效,不计数
+	changed := key
+	changed.IdentityKey = "bmV3IGlkZW50aXR5"
+	mockk.EXPECT().IdentityKey(uid).Return(&key, nil)
+	mockk.EXPECT().SaveKeys(gomock.Any(), gomock.Len(100)).DoAndReturn(func(k *model.IdentityKey, _ []*model.PreKey) error {
+		assert.Equal(t, uid, k.UserID)
+		assert.Equal(t, changed.IdentityKey, k.IdentityKey)
+		return nil
+	})
+	t.Run("change identity", func(t *testing.T) {
+		err := ks.Upload(uid, &model.KeyUpload{IdentityKey: changed, PreKeys: genPreKeys(100)})
+		assert.Nil(t, err)
+	})
+
+	mockk.EXPECT().IdentityKey(uid).Return(nil, errorsx.ErrRecordNotFound)
+	mockk.EXPECT().SaveKeys(gomock.Any(), gomock.Len(0)).Return(nil)
+	t.Run("first upload", func(t *testing.T) {
+		err := ks.Upload(uid, &model.KeyUpload{IdentityKey: key})
+		assert.Nil(t, err)
+	})
+}
+
+func TestAddPreKeys(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.Equal(t, errorsx.ErrInvalidParams, ks.AddPreKeys(uid, nil))
+		assert.Equal(t, errorsx.ErrInvalidParams, ks.AddPreKeys(uid, []*model.PreKey{{KeyID: 1}}))
+	})
+
+	mockk.EXPECT().IdentityKey(uid).Return(nil, errorsx.ErrRecordNotFound)
+	t.Run("no identity key", func(t *testing.T) {
+		assert.Equal(t, errorsx.ErrKeyNotFound, ks.AddPreKeys(uid, genPreKeys(1)))
+	})
+
+	mockk.EXPECT().IdentityKey(uid).Return(&model.IdentityKey{UserID: uid}, nil).Times(2)
+	mockk.EXPECT().CountPreKeys(uid).Return(int64(499), nil).Times(2)
+	mockk.EXPECT().AddPreKeys(uid, gomock.Len(1)).Return(nil)
+	t.Run("add", func(t *testing.T) {
+		assert.Equal(t, errorsx.ErrTooManyPreKeys, ks.AddPreKeys(uid, genPreKeys(2)))
+		assert.Nil(t, ks.AddPreKeys(uid, genPreKeys(1)))
+	})
+}
+
+func TestKeyBundle(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := ks.Bundle(uid, 0)
+		assert.Equal(t, errorsx.ErrInvalidParams, err)
+	})
+
+	mockk.EXPECT().IdentityKey(uid+1).Return(nil, errorsx.ErrRecordNotFound)
+	t.Run("not found", func(t *testing.T) {
+		_, err := ks.Bundle(uid, uid+1)
+		assert.Equal(t, errorsx.ErrKeyNotFound, err)
+	})
+
+	key := &model.IdentityKey{UserID: uid + 1, IdentityKey: "aWRlbnRpdHk="}
+	preKey := &model.PreKey{KeyID: 1, PublicKey: "cHJla2V5"}
+	mockk.EXPECT().IdentityKey(uid+1).Return(key, nil).Times(2)
+	gomock.InOrder(
+		mockk.EXPECT().TakePreKey(uid+1).Return(preKey, nil),
+		mockk.EXPECT().TakePreKey(uid+1).Return(nil, errorsx.ErrRecordNotFound),
+	)
+	t.Run("bundle", func(t *testing.T) {
+		bundle, err := ks.Bundle(uid, uid+1)
+		assert.Nil(t, err)
+		assert.Equal(t, key, bundle.IdentityKey)
+		assert.Equal(t, preKey, bundle.PreKey)
+
+		// 一次性预共享公钥用完
+		bundle, err = ks.Bundle(uid, uid+1)
+		assert.Nil(t, err)
+		assert.Equal(t, key, bundle.IdentityKey)
+		assert.Nil(t, bundle.PreKey)
+	})
+}
+
+func TestDeleteKeys(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	gomock.InOrder(
+		mockk.EXPECT().DeleteKeys(uid).Return(errorsx.ErrNoAffectedRows),
+		mockk.EXPECT().DeleteKeys(uid).Return(nil),
+	)
+	assert.Equal(t, errorsx.ErrKeyNotFound, ks.Delete(uid))
+	assert.Nil(t, ks.Delete(uid))
+}
@@ -1,11 +1,13 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"time"
 
+	"github.com/farnese17/chat/pkg/storage"
 	"github.com/farnese17/chat/registry"
 	m "github.com/farnese17/chat/service/model"
 	"github.com/farnese17/chat/utils"
@@ -37,12 +39,13 @@ func (mgr *Manager) CreateAdmin(data *m.Manager) (uint, error) {
 }
 
 func (mgr *Manager) DeleteAdmin(id uint) error {
-	err := mgr.service.Manager().Delete(id)
-	if err == nil {
-		key := m.CacheToken + strconv.Itoa(int(id))
-		mgr.service.Cache().Remove(key)
+	if err := mgr.service.Manager().Delete(id); err != nil {
+		return err
 	}
-	return err
+	if err := mgr.service.Cache().RemoveTokens(id); err != nil {
+		return errorsx.ErrHandleSuccessed
+	}
+	return nil
 }
 
 func (mgr *Manager) RestoreAdministrator(id uint) error {
@@ -96,12 +99,15 @@ func (mgr *Manager) Ban(id string, level int, days int) error {
 	}
 	mgr.service.Cache().SetBanned(id, level, expire)
 	if level == m.BanLevelTemporary || level == m.BanLevelPermanent {
-		key := m.CacheToken + id
-		mgr.service.Cache().Remove(key)
+		// 删除token失败时仍然断开连接,返回延迟生效
+		err = mgr.service.Cache().RemoveTokens(uint(uid))
 		mgr.service.Hub().Kick(uint(uid))
 		if level == m.BanLevelPermanent {
 			mgr.service.Cache().BFM().BanUser(uint(uid))
 		}
+		if err != nil {
+			return errorsx.ErrHandleSuccessed
+		}
 	}
 	if level == m.BanLevelMuted {
 		mgr.service.Cache().BFM().AddMute(uint(uid), expireAt)
@@ -125,6 +131,28 @@ func (mgr *Manager) Unban(id string) error {
 	return err
 }
 
+// 用户的文件限额和已使用的空间
+func (mgr *Manager) FileQuota(id string) (*storage.QuotaUsage, error) {
+	uid, _ := strconv.Atoi(id)
+	if err := validator.ValidateUID(uint(uid)); err != nil {
+		return nil, err
+	}
+	return mgr.service.Storage().Usage(uint(uid))
+}
+
+// 单独设置用户的文件限额,q为nil时恢复默认限额
+func (mgr *Manager) SetFileQuota(id string, q *storage.Quota) error {
+	uid, _ := strconv.Atoi(id)
+	if err := validator.ValidateUID(uint(uid)); err != nil {
+		return err
+	}
+	err := mgr.service.Storage().SetQuota(uint(uid), q)
+	if errors.Is(err, storage.ErrInvalidQuota) {
+		return errorsx.ErrInvalidParams
+	}
+	return err
+}
+
 func (mgr *Manager) BannedUserList(cursor *m.Cursor) (map[string]any, error) {
 	data, c, err := mgr.service.User().GetBanned(cursor, 0)
 	res := map[string]any{"cursor": c}
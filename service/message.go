@@ -0,0 +1,618 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/farnese17/chat/registry"
+	m "github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/farnese17/chat/utils/validator"
+	ws "github.com/farnese17/chat/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	pinMsg          = "%s 置顶了一条消息"
+	unpinMsg        = "%s 取消了置顶消息"
+	retentionMsg    = "%s 将消息保留时间设置为%s"
+	retentionOffMsg = "%s 关闭了消息自动删除"
+)
+
+const (
+	// 消息保留时间的范围,单位秒
+	minRetention = 60
+	maxRetention = 365 * 24 * 60 * 60
+)
+
+const (
+	// 搜索词数量上限
+	maxSearchTerms = 8
+	// 片段中匹配词前保留的字符数
+	snippetBefore = 20
+	// 片段的最大字符数
+	snippetLength = 80
+)
+
+type MessageService struct {
+	service registry.Service
+}
+
+func NewMessageService(s registry.Service) *MessageService {
+	return &MessageService{s}
+}
+
+// 获取单聊记录
+func (ms *MessageService) Conversation(uid, peer uint, cursor *m.Cursor) (map[string]any, error) {
+	if err := validator.ValidateUID(peer); err != nil {
+		return nil, err
+	}
+	if err := ms.verifyCursor(cursor); err != nil {
+		return nil, err
+	}
+
+	messages, cursor, err := ms.service.Message().Conversation(uid, peer, cursor)
+	if err != nil {
+		ms.service.Logger().Error("Failed to get conversation messages", zap.Uint("uid", uid), zap.Uint("peer", peer), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return map[string]any{"data": messages, "cursor": cursor}, nil
+}
+
+// 获取群聊记录,需要在群组内
+func (ms *MessageService) GroupMessages(uid, gid uint, cursor *m.Cursor) (map[string]any, error) {
+	if err := validator.ValidateGID(gid); err != nil {
+		return nil, err
+	}
+	if err := ms.verifyCursor(cursor); err != nil {
+		return nil, err
+	}
+	if err := ms.isMember(gid, uid); err != nil {
+		return nil, err
+	}
+
+	messages, cursor, err := ms.service.Message().GroupMessages(gid, cursor)
+	if err != nil {
+		ms.service.Logger().Error("Failed to get group messages", zap.Uint("uid", uid), zap.Uint("gid", gid), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return map[string]any{"data": messages, "cursor": cursor}, nil
+}
+
+// 获取会话列表和未读数量
+func (ms *MessageService) Conversations(uid uint) ([]*m.Conversation, error) {
+	conversations, err := ms.service.Message().Conversations(uid)
+	if err != nil {
+		ms.service.Logger().Error("Failed to get conversations", zap.Uint("uid", uid), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	direct, group, err := ms.service.Cache().GetReadCursors(uid)
+	if err != nil {
+		ms.service.Logger().Error("Failed to get read cursors", zap.Uint("uid", uid), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+
+	for _, conv := range conversations {
+		if conv.GroupID != 0 {
+			conv.ReadSeq = group[conv.GroupID]
+		} else {
+			conv.ReadSeq = direct[conv.PeerID]
+			// 对方的读游标用于展示已读状态,获取失败不影响列表
+			conv.PeerReadSeq, _ = ms.service.Cache().GetReadCursor(conv.PeerID, uid, 0)
+		}
+		if conv.ReadSeq >= conv.LastSeq {
+			continue
+		}
+		conv.Unread, err = ms.service.Message().CountUnread(uid, conv.PeerID, conv.GroupID, conv.ReadSeq)
+		if err != nil {
+			ms.service.Logger().Error("Failed to count unread messages", zap.Uint("uid", uid), zap.Error(err))
+			return nil, errorsx.ErrFailed
+		}
+	}
+	return conversations, nil
+}
+
+// 添加或取消表情回应,由推送服务通知会话中的用户
+func (ms *MessageService) React(uid uint, msgID, emoji string, add bool) (*m.ReactionCount, error) {
+	hub := ms.service.Hub()
+	if hub == nil {
+		return nil, errorsx.ErrMessagePushServiceUnavailabel
+	}
+	count, err := hub.React(uid, msgID, emoji, add)
+	if err != nil {
+		return nil, err
+	}
+	return &m.ReactionCount{MsgID: msgID, Emoji: emoji, Count: count, Reacted: add}, nil
+}
+
+// 获取消息的表情回应数量,需要参与该会话
+func (ms *MessageService) Reactions(uid uint, msgID string) ([]*m.ReactionCount, error) {
+	msg, err := ms.service.Message().Get(msgID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return nil, errorsx.ErrMessageNotFound
+		}
+		ms.service.Logger().Error("Failed to get message", zap.String("id", msgID), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	if msg.GroupID != 0 {
+		if err := ms.isMember(msg.GroupID, uid); err != nil {
+			return nil, err
+		}
+	} else if uid != msg.Sender && uid != msg.Receiver {
+		return nil, errorsx.ErrMessageNotFound
+	}
+
+	reactions, err := ms.service.Message().Reactions(msgID, uid)
+	if err != nil {
+		ms.service.Logger().Error("Failed to get reactions", zap.String("id", msgID), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return reactions, nil
+}
+
+// 获取话题的原消息和回复,需要在群组内
+func (ms *MessageService) ThreadReplies(uid uint, msgID string, cursor *m.Cursor) (map[string]any, error) {
+	if err := ms.verifyCursor(cursor); err != nil {
+		return nil, err
+	}
+	parent, err := ms.threadParent(uid, msgID)
+	if err != nil {
+		return nil, err
+	}
+
+	replies, cursor, err := ms.service.Message().ThreadReplies(msgID, cursor)
+	if err != nil {
+		ms.service.Logger().Error("Failed to get thread replies", zap.Uint("uid", uid), zap.String("id", msgID), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return map[string]any{"parent": parent, "data": replies, "cursor": cursor}, nil
+}
+
+// 订阅或取消订阅话题,订阅后会收到话题的回复
+func (ms *MessageService) SubscribeThread(uid uint, msgID string, subscribed bool) error {
+	if _, err := ms.threadParent(uid, msgID); err != nil {
+		return err
+	}
+
+	var err error
+	if subscribed {
+		err = ms.service.Message().SubscribeThread(msgID, uid)
+	} else {
+		err = ms.service.Message().UnsubscribeThread(msgID, uid)
+	}
+	if err != nil {
+		ms.service.Logger().Error("Failed to update thread subscription",
+			zap.Uint("uid", uid), zap.String("id", msgID), zap.Bool("subscribed", subscribed), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	return nil
+}
+
+// 话题的原消息,只能是群聊中不属于其他话题的消息
+func (ms *MessageService) threadParent(uid uint, msgID string) (*m.Message, error) {
+	parent, err := ms.service.Message().Get(msgID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return nil, errorsx.ErrMessageNotFound
+		}
+		ms.service.Logger().Error("Failed to get message", zap.String("id", msgID), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	if parent.GroupID == 0 || parent.ThreadID != "" {
+		return nil, errorsx.ErrInvalidThread
+	}
+	if err := ms.isMember(parent.GroupID, uid); err != nil {
+		return nil, err
+	}
+	return parent, nil
+}
+
+// 置顶或取消置顶消息,群聊需要群主或管理员,单聊双方都可以操作
+// 变化通过系统消息通知会话中的用户
+func (ms *MessageService) Pin(uid uint, msgID string, pinned bool) error {
+	msg, err := ms.service.Message().Get(msgID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return errorsx.ErrMessageNotFound
+		}
+		ms.service.Logger().Error("Failed to get message", zap.String("id", msgID), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	username, err := ms.pinPermission(uid, msg)
+	if err != nil {
+		return err
+	}
+
+	format := pinMsg
+	if pinned {
+		if msg.Recalled {
+			return errorsx.ErrMessageRecalled
+		}
+		pin := &m.PinnedMessage{
+			MsgID:    msgID,
+			GroupID:  msg.GroupID,
+			PinnedBy: uid,
+			PinnedAt: time.Now().UnixMilli(),
+		}
+		if msg.GroupID == 0 {
+			pin.UserA, pin.UserB = min(msg.Sender, msg.Receiver), max(msg.Sender, msg.Receiver)
+		}
+		err = ms.service.Message().Pin(pin)
+		if errors.Is(err, errorsx.ErrDuplicateEntry) {
+			return errorsx.ErrAlreadyPinned
+		}
+	} else {
+		format = unpinMsg
+		err = ms.service.Message().Unpin(msgID)
+		if errors.Is(err, errorsx.ErrNoAffectedRows) {
+			return errorsx.ErrNotPinned
+		}
+	}
+	if err != nil {
+		ms.service.Logger().Error("Failed to update pinned message",
+			zap.Uint("uid", uid), zap.String("id", msgID), zap.Bool("pinned", pinned), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+
+	body := fmt.Sprintf(format, username)
+	if msg.GroupID != 0 {
+		return NewGroupService(ms.service).broadcase(msg.GroupID, body)
+	}
+	peer := msg.Receiver
+	if uid == msg.Receiver {
+		peer = msg.Sender
+	}
+	return ms.notifyDirect(uid, peer, body)
+}
+
+// 获取群聊的置顶消息,从新到旧
+func (ms *MessageService) GroupPins(uid, gid uint, cursor *m.Cursor) (map[string]any, error) {
+	if err := validator.ValidateGID(gid); err != nil {
+		return nil, errorsx.ErrInvalidParams
+	}
+	if err := ms.verifyCursor(cursor); err != nil {
+		return nil, err
+	}
+	if err := ms.isMember(gid, uid); err != nil {
+		return nil, err
+	}
+
+	pins, cursor, err := ms.service.Message().GroupPins(gid, cursor)
+	if err != nil {
+		ms.service.Logger().Error("Failed to get pinned messages", zap.Uint("uid", uid), zap.Uint("gid", gid), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return map[string]any{"data": pins, "cursor": cursor}, nil
+}
+
+// 获取单聊的置顶消息,从新到旧
+func (ms *MessageService) ConversationPins(uid, peer uint, cursor *m.Cursor) (map[string]any, error) {
+	if err := validator.ValidateUID(peer); err != nil {
+		return nil, errorsx.ErrInvalidParams
+	}
+	if err := ms.verifyCursor(cursor); err != nil {
+		return nil, err
+	}
+
+	pins, cursor, err := ms.service.Message().DirectPins(uid, peer, cursor)
+	if err != nil {
+		ms.service.Logger().Error("Failed to get pinned messages", zap.Uint("uid", uid), zap.Uint("peer", peer), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return map[string]any{"data": pins, "cursor": cursor}, nil
+}
+
+// 检查置顶权限,返回操作者的用户名用于通知
+func (ms *MessageService) pinPermission(uid uint, msg *m.Message) (string, error) {
+	if msg.GroupID != 0 {
+		return ms.groupManager(uid, msg.GroupID)
+	}
+	if uid != msg.Sender && uid != msg.Receiver {
+		return "", errorsx.ErrMessageNotFound
+	}
+	return ms.username(uid)
+}
+
+// 检查用户是否为群主或管理员,返回用户名用于通知
+func (ms *MessageService) groupManager(uid, gid uint) (string, error) {
+	ctx, err := NewGroupService(ms.service).QueryRole(&m.MemberStatusContext{GID: gid, From: uid})
+	if err != nil {
+		if errors.Is(err, errorsx.ErrUserNotExist) {
+			return "", errorsx.ErrNotInGroup
+		}
+		return "", errorsx.ErrFailed
+	}
+	role := ctx.Data[uid]
+	if role.Role != m.GroupRoleOwner && role.Role != m.GroupRoleAdmin {
+		return "", errorsx.ErrPermissiondenied
+	}
+	return role.Username, nil
+}
+
+func (ms *MessageService) username(uid uint) (string, error) {
+	user, err := ms.service.User().Get(uid, "id")
+	if err != nil {
+		ms.service.Logger().Error("Failed to get user", zap.Uint("uid", uid), zap.Error(err))
+		return "", errorsx.ErrFailed
+	}
+	return user.Username, nil
+}
+
+// 单聊的系统消息发给双方,推送服务不可用时保存为离线消息
+func (ms *MessageService) notifyDirect(uid, peer uint, body string) error {
+	to := []uint{uid}
+	if peer != uid {
+		to = append(to, peer)
+	}
+
+	hub := ms.service.Hub()
+	now := time.Now().UnixMilli()
+	for _, id := range to {
+		message := &ws.ChatMsg{Type: ws.System, From: uid, To: id, Body: body, Time: now}
+		if hub == nil {
+			ms.service.Cache().StoreOfflineMessage(id, message)
+			continue
+		}
+		hub.SendToChat(message)
+	}
+	if hub == nil {
+		return errorsx.ErrMessagePushServiceUnavailabel
+	}
+	return nil
+}
+
+// 设置群聊的消息保留时间,需要群主或管理员,ttl单位为秒,0表示关闭
+func (ms *MessageService) SetGroupRetention(uid, gid uint, ttl int64) error {
+	if err := validator.ValidateGID(gid); err != nil {
+		return errorsx.ErrInvalidParams
+	}
+	if err := verifyRetention(ttl); err != nil {
+		return err
+	}
+	username, err := ms.groupManager(uid, gid)
+	if err != nil {
+		return err
+	}
+	if err := ms.setRetention(&m.Retention{GroupID: gid, TTL: ttl, UpdatedBy: uid}); err != nil {
+		return err
+	}
+	return NewGroupService(ms.service).broadcase(gid, retentionNotice(username, ttl))
+}
+
+// 设置单聊的消息保留时间,双方都可以设置,ttl单位为秒,0表示关闭
+func (ms *MessageService) SetDirectRetention(uid, peer uint, ttl int64) error {
+	if err := validator.ValidateUID(peer); err != nil || peer == uid {
+		return errorsx.ErrInvalidParams
+	}
+	if err := verifyRetention(ttl); err != nil {
+		return err
+	}
+	if _, err := ms.service.User().Get(peer, "id"); err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return errorsx.ErrUserNotExist
+		}
+		ms.service.Logger().Error("Failed to get user", zap.Uint("uid", peer), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	username, err := ms.username(uid)
+	if err != nil {
+		return err
+	}
+	retention := &m.Retention{UserA: min(uid, peer), UserB: max(uid, peer), TTL: ttl, UpdatedBy: uid}
+	if err := ms.setRetention(retention); err != nil {
+		return err
+	}
+	return ms.notifyDirect(uid, peer, retentionNotice(username, ttl))
+}
+
+// 获取群聊的消息保留时间,未设置时ttl为0
+func (ms *MessageService) GroupRetention(uid, gid uint) (*m.Retention, error) {
+	if err := validator.ValidateGID(gid); err != nil {
+		return nil, errorsx.ErrInvalidParams
+	}
+	if err := ms.isMember(gid, uid); err != nil {
+		return nil, err
+	}
+	return ms.retention(gid, 0, 0)
+}
+
+// 获取单聊的消息保留时间,未设置时ttl为0
+func (ms *MessageService) DirectRetention(uid, peer uint) (*m.Retention, error) {
+	if err := validator.ValidateUID(peer); err != nil || peer == uid {
+		return nil, errorsx.ErrInvalidParams
+	}
+	return ms.retention(0, uid, peer)
+}
+
+func (ms *MessageService) setRetention(retention *m.Retention) error {
+	if err := ms.service.Message().SetRetention(retention); err != nil {
+		ms.service.Logger().Error("Failed to set retention", zap.Uint("gid", retention.GroupID),
+			zap.Uint("user_a", retention.UserA), zap.Uint("user_b", retention.UserB), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	return nil
+}
+
+func (ms *MessageService) retention(gid, uid, peer uint) (*m.Retention, error) {
+	retention, err := ms.service.Message().Retention(gid, uid, peer)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return &m.Retention{GroupID: gid}, nil
+		}
+		ms.service.Logger().Error("Failed to get retention",
+			zap.Uint("gid", gid), zap.Uint("uid", uid), zap.Uint("peer", peer), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return retention, nil
+}
+
+func verifyRetention(ttl int64) error {
+	if ttl != 0 && (ttl < minRetention || ttl > maxRetention) {
+		return errorsx.ErrInvalidParams
+	}
+	return nil
+}
+
+func retentionNotice(username string, ttl int64) string {
+	if ttl == 0 {
+		return fmt.Sprintf(retentionOffMsg, username)
+	}
+	return fmt.Sprintf(retentionMsg, username, formatTTL(ttl))
+}
+
+// 按最大的整数单位显示保留时间,如 7天、12小时、90分钟
+func formatTTL(ttl int64) string {
+	units := []struct {
+		seconds int64
+		name    string
+	}{{86400, "天"}, {3600, "小时"}, {60, "分钟"}}
+	for _, unit := range units {
+		if ttl%unit.seconds == 0 {
+			return fmt.Sprintf("%d%s", ttl/unit.seconds, unit.name)
+		}
+	}
+	return fmt.Sprintf("%d秒", ttl)
+}
+
+// 获取未发送的定时消息,按发送时间排序
+func (ms *MessageService) ScheduledMessages(uid uint) ([]*m.ScheduledMessage, error) {
+	messages, err := ms.service.Message().ScheduledMessages(uid)
+	if err != nil {
+		ms.service.Logger().Error("Failed to get scheduled messages", zap.Uint("uid", uid), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	return messages, nil
+}
+
+// 取消未发送的定时消息,已发送的消息需要撤回
+func (ms *MessageService) CancelScheduled(uid uint, msgID string) error {
+	err := ms.service.Message().CancelScheduled(uid, msgID)
+	if errors.Is(err, errorsx.ErrNoAffectedRows) {
+		return errorsx.ErrScheduledNotFound
+	}
+	if err != nil {
+		ms.service.Logger().Error("Failed to cancel scheduled message", zap.Uint("uid", uid), zap.String("id", msgID), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	return nil
+}
+
+// 搜索用户所在会话中的消息,按相关度排序,snippet中匹配的词用<em>标记
+func (ms *MessageService) Search(uid uint, search *m.MessageSearch, cursor *m.SearchCursor) (map[string]any, error) {
+	if search == nil || cursor == nil {
+		return nil, errorsx.ErrInvalidParams
+	}
+	if err := validator.Validate(search); err != nil {
+		ms.service.Logger().Warn("Invalid search params", zap.Uint("uid", uid), zap.Error(err))
+		return nil, errorsx.ErrInvalidParams
+	}
+	if search.After != 0 && search.Before != 0 && search.After >= search.Before {
+		return nil, errorsx.ErrInvalidParams
+	}
+	if err := ms.verifyCursor(&cursor.Cursor); err != nil {
+		return nil, err
+	}
+	terms := searchTerms(search.Query)
+	if len(terms) == 0 {
+		return nil, errorsx.ErrInvalidParams
+	}
+	if search.GroupID != 0 {
+		if err := ms.isMember(search.GroupID, uid); err != nil {
+			return nil, err
+		}
+	}
+
+	hits, cursor, err := ms.service.Message().Search(uid, terms, search, cursor)
+	if err != nil {
+		ms.service.Logger().Error("Failed to search messages", zap.Uint("uid", uid), zap.String("q", search.Query), zap.Error(err))
+		return nil, errorsx.ErrFailed
+	}
+	for _, hit := range hits {
+		hit.Snippet = snippet(hit.Body, terms)
+	}
+	return map[string]any{"data": hits, "cursor": cursor}, nil
+}
+
+// 按空白分词并去重,去掉全文索引的引号
+func searchTerms(query string) []string {
+	var terms []string
+	for _, term := range strings.Fields(strings.ReplaceAll(query, `"`, " ")) {
+		term = strings.ToLower(term)
+		if !slices.Contains(terms, term) {
+			terms = append(terms, term)
+		}
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// 截取第一个匹配词附近的内容,匹配的词用<em>标记,其他内容转义
+func snippet(body string, terms []string) string {
+	runes := []rune(body)
+	lower := make([]rune, len(runes))
+	for i, r := range runes {
+		lower[i] = unicode.ToLower(r)
+	}
+	marked := make([]bool, len(runes))
+	first := -1
+	for _, term := range terms {
+		t := []rune(term)
+		for i := 0; i+len(t) <= len(lower); i++ {
+			if !slices.Equal(lower[i:i+len(t)], t) {
+				continue
+			}
+			for j := i; j < i+len(t); j++ {
+				marked[j] = true
+			}
+			if first == -1 || i < first {
+				first = i
+			}
+		}
+	}
+
+	start := max(first-snippetBefore, 0)
+	end := min(start+snippetLength, len(runes))
+	var sb strings.Builder
+	if start > 0 {
+		sb.WriteString("…")
+	}
+	for i := start; i < end; i++ {
+		if marked[i] && (i == start || !marked[i-1]) {
+			sb.WriteString("<em>")
+		}
+		sb.WriteString(html.EscapeString(string(runes[i])))
+		if marked[i] && (i == end-1 || !marked[i+1]) {
+			sb.WriteString("</em>")
+		}
+	}
+	if end < len(runes) {
+		sb.WriteString("…")
+	}
+	return sb.String()
+}
+
+func (ms *MessageService) verifyCursor(cursor *m.Cursor) error {
+	if cursor == nil {
+		return errorsx.ErrInvalidParams
+	}
+	return validator.VerfityPageSize(cursor.PageSize)
+}
+
+func (ms *MessageService) isMember(gid, uid uint) error {
+	members, err := ms.service.Cache().GetMembersAndCache(gid)
+	if err != nil {
+		return errorsx.ErrFailed
+	}
+	if !slices.Contains(members, uid) {
+		return errorsx.ErrNotInGroup
+	}
+	return nil
+}
@@ -0,0 +1,542 @@
+package service_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/farnese17/chat/service/mock"
+	"github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	ws "github.com/farnese17/chat/websocket"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversationMessages(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	peer := uid + 1
+	messages := []*model.Message{{ID: 1, MsgID: "a", Type: ws.Chat, Sender: uid, Receiver: peer, Body: "hi"}}
+	tests := []struct {
+		peer     uint
+		cursor   *model.Cursor
+		mock     error
+		expected error
+		mockAll  bool
+	}{
+		{1, &model.Cursor{PageSize: 10}, nil, errors.New("无效参数"), false},
+		{peer, nil, nil, errorsx.ErrInvalidParams, false},
+		{peer, &model.Cursor{PageSize: 0}, nil, errorsx.ErrPageSizeTooSmall, false},
+		{peer, &model.Cursor{PageSize: 31}, nil, errorsx.ErrPageSizeTooBig, false},
+		{peer, &model.Cursor{PageSize: 10}, errorsx.ErrFailed, errorsx.ErrFailed, true},
+		{peer, &model.Cursor{PageSize: 10}, nil, nil, true},
+	}
+	for i, tt := range tests {
+		if tt.mockAll {
+			mockm.EXPECT().Conversation(uid, tt.peer, tt.cursor).Return(messages, tt.cursor, tt.mock)
+		}
+		t.Run(fmt.Sprintf("conversation messages %d", i), func(t *testing.T) {
+			result, err := ms.Conversation(uid, tt.peer, tt.cursor)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				assert.Equal(t, messages, result["data"])
+				assert.Equal(t, tt.cursor, result["cursor"])
+			} else {
+				assert.Nil(t, result)
+			}
+		})
+	}
+}
+
+func TestGroupMessages(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	messages := []*model.Message{{ID: 1, MsgID: "a", Type: ws.Broadcast, Sender: uid, GroupID: gid, Body: "hi"}}
+	tests := []struct {
+		cursor    *model.Cursor
+		members   []uint
+		cacheErr  error
+		mock      error
+		expected  error
+		mockCache bool
+		mockAll   bool
+	}{
+		{&model.Cursor{PageSize: 0}, nil, nil, nil, errorsx.ErrPageSizeTooSmall, false, false},
+		{&model.Cursor{PageSize: 10}, nil, errorsx.ErrFailed, nil, errorsx.ErrFailed, true, false},
+		{&model.Cursor{PageSize: 10}, []uint{uid + 1}, nil, nil, errorsx.ErrNotInGroup, true, false},
+		{&model.Cursor{PageSize: 10}, []uint{uid}, nil, errorsx.ErrFailed, errorsx.ErrFailed, true, true},
+		{&model.Cursor{PageSize: 10}, []uint{uid}, nil, nil, nil, true, true},
+	}
+	for i, tt := range tests {
+		if tt.mockCache {
+			mockc.EXPECT().GetMembersAndCache(gid).Return(tt.members, tt.cacheErr)
+		}
+		if tt.mockAll {
+			mockm.EXPECT().GroupMessages(gid, tt.cursor).Return(messages, tt.cursor, tt.mock)
+		}
+		t.Run(fmt.Sprintf("group messages %d", i), func(t *testing.T) {
+			result, err := ms.GroupMessages(uid, gid, tt.cursor)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				assert.Equal(t, messages, result["data"])
+				assert.Equal(t, tt.cursor, result["cursor"])
+			} else {
+				assert.Nil(t, result)
+			}
+		})
+	}
+}
+
+func TestConversations(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	peer := uid + 1
+	newConversations := func() []*model.Conversation {
+		return []*model.Conversation{
+			{GroupID: gid, LastSeq: 10},
+			{PeerID: peer, LastSeq: 8},
+		}
+	}
+
+	// 获取会话失败
+	mockm.EXPECT().Conversations(uid).Return(nil, errorsx.ErrFailed)
+	result, err := ms.Conversations(uid)
+	assert.Equal(t, errorsx.ErrFailed, err)
+	assert.Nil(t, result)
+
+	// 获取读游标失败
+	mockm.EXPECT().Conversations(uid).Return(newConversations(), nil)
+	mockc.EXPECT().GetReadCursors(uid).Return(nil, nil, errors.New("error"))
+	result, err = ms.Conversations(uid)
+	assert.Equal(t, errorsx.ErrFailed, err)
+	assert.Nil(t, result)
+
+	// 群聊已读到最新,单聊有未读
+	mockm.EXPECT().Conversations(uid).Return(newConversations(), nil)
+	mockc.EXPECT().GetReadCursors(uid).Return(map[uint]uint{peer: 5}, map[uint]uint{gid: 10}, nil)
+	mockc.EXPECT().GetReadCursor(peer, uid, uint(0)).Return(uint(8), nil)
+	mockm.EXPECT().CountUnread(uid, peer, uint(0), uint(5)).Return(int64(2), nil)
+	result, err = ms.Conversations(uid)
+	assert.NoError(t, err)
+	expected := []*model.Conversation{
+		{GroupID: gid, LastSeq: 10, ReadSeq: 10},
+		{PeerID: peer, LastSeq: 8, ReadSeq: 5, PeerReadSeq: 8, Unread: 2},
+	}
+	assert.Equal(t, expected, result)
+
+	// 统计未读失败
+	mockm.EXPECT().Conversations(uid).Return(newConversations(), nil)
+	mockc.EXPECT().GetReadCursors(uid).Return(map[uint]uint{}, map[uint]uint{}, nil)
+	mockm.EXPECT().CountUnread(uid, uint(0), gid, uint(0)).Return(int64(0), errors.New("error"))
+	result, err = ms.Conversations(uid)
+	assert.Equal(t, errorsx.ErrFailed, err)
+	assert.Nil(t, result)
+}
+
+func TestReact(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	got, err := ms.React(uid, "a", "👍", true)
+	assert.NoError(t, err)
+	assert.Equal(t, &model.ReactionCount{MsgID: "a", Emoji: "👍", Count: 1, Reacted: true}, got)
+}
+
+func TestReactions(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	reactions := []*model.ReactionCount{{MsgID: "a", Emoji: "👍", Count: 2, Reacted: true}}
+	tests := []struct {
+		msg       *model.Message
+		getErr    error
+		members   []uint
+		mock      error
+		expected  error
+		mockCache bool
+		mockAll   bool
+	}{
+		{nil, errorsx.ErrRecordNotFound, nil, nil, errorsx.ErrMessageNotFound, false, false},
+		{nil, errorsx.ErrFailed, nil, nil, errorsx.ErrFailed, false, false},
+		// 不是会话的参与者
+		{&model.Message{MsgID: "a", Sender: uid + 1, Receiver: uid + 2}, nil, nil, nil, errorsx.ErrMessageNotFound, false, false},
+		{&model.Message{MsgID: "a", Sender: uid + 1, GroupID: gid}, nil, []uint{uid + 1}, nil, errorsx.ErrNotInGroup, true, false},
+		{&model.Message{MsgID: "a", Sender: uid + 1, GroupID: gid}, nil, []uint{uid}, errorsx.ErrFailed, errorsx.ErrFailed, true, true},
+		{&model.Message{MsgID: "a", Sender: uid + 1, GroupID: gid}, nil, []uint{uid}, nil, nil, true, true},
+		{&model.Message{MsgID: "a", Sender: uid + 1, Receiver: uid}, nil, nil, nil, nil, false, true},
+	}
+	for i, tt := range tests {
+		mockm.EXPECT().Get("a").Return(tt.msg, tt.getErr)
+		if tt.mockCache {
+			mockc.EXPECT().GetMembersAndCache(gid).Return(tt.members, nil)
+		}
+		if tt.mockAll {
+			mockm.EXPECT().Reactions("a", uid).Return(reactions, tt.mock)
+		}
+		t.Run(fmt.Sprintf("reactions %d", i), func(t *testing.T) {
+			result, err := ms.Reactions(uid, "a")
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				assert.Equal(t, reactions, result)
+			} else {
+				assert.Nil(t, result)
+			}
+		})
+	}
+}
+
+func TestThreadReplies(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	parent := &model.Message{ID: 1, MsgID: "a", Type: ws.Broadcast, Sender: uid + 1, GroupID: gid, ReplyCount: 1}
+	replies := []*model.Message{{ID: 2, MsgID: "b", Type: ws.Broadcast, Sender: uid, GroupID: gid, ThreadID: "a"}}
+	tests := []struct {
+		cursor    *model.Cursor
+		msg       *model.Message
+		getErr    error
+		members   []uint
+		mock      error
+		expected  error
+		mockGet   bool
+		mockCache bool
+		mockAll   bool
+	}{
+		{&model.Cursor{PageSize: 0}, nil, nil, nil, nil, errorsx.ErrPageSizeTooSmall, false, false, false},
+		{&model.Cursor{PageSize: 10}, nil, errorsx.ErrRecordNotFound, nil, nil, errorsx.ErrMessageNotFound, true, false, false},
+		// 单聊消息和话题回复不能作为话题
+		{&model.Cursor{PageSize: 10}, &model.Message{MsgID: "a", Sender: uid, Receiver: uid + 1}, nil, nil, nil, errorsx.ErrInvalidThread, true, false, false},
+		{&model.Cursor{PageSize: 10}, &model.Message{MsgID: "a", GroupID: gid, ThreadID: "c"}, nil, nil, nil, errorsx.ErrInvalidThread, true, false, false},
+		{&model.Cursor{PageSize: 10}, parent, nil, []uint{uid + 1}, nil, errorsx.ErrNotInGroup, true, true, false},
+		{&model.Cursor{PageSize: 10}, parent, nil, []uint{uid}, errorsx.ErrFailed, errorsx.ErrFailed, true, true, true},
+		{&model.Cursor{PageSize: 10}, parent, nil, []uint{uid}, nil, nil, true, true, true},
+	}
+	for i, tt := range tests {
+		if tt.mockGet {
+			mockm.EXPECT().Get("a").Return(tt.msg, tt.getErr)
+		}
+		if tt.mockCache {
+			mockc.EXPECT().GetMembersAndCache(gid).Return(tt.members, nil)
+		}
+		if tt.mockAll {
+			mockm.EXPECT().ThreadReplies("a", tt.cursor).Return(replies, tt.cursor, tt.mock)
+		}
+		t.Run(fmt.Sprintf("thread replies %d", i), func(t *testing.T) {
+			result, err := ms.ThreadReplies(uid, "a", tt.cursor)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				assert.Equal(t, parent, result["parent"])
+				assert.Equal(t, replies, result["data"])
+			} else {
+				assert.Nil(t, result)
+			}
+		})
+	}
+}
+
+func TestSubscribeThread(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	parent := &model.Message{ID: 1, MsgID: "a", Type: ws.Broadcast, Sender: uid + 1, GroupID: gid}
+	tests := []struct {
+		subscribed bool
+		mock       error
+		expected   error
+	}{
+		{true, errorsx.ErrFailed, errorsx.ErrFailed},
+		{true, nil, nil},
+		{false, nil, nil},
+	}
+	for i, tt := range tests {
+		mockm.EXPECT().Get("a").Return(parent, nil)
+		mockc.EXPECT().GetMembersAndCache(gid).Return([]uint{uid}, nil)
+		if tt.subscribed {
+			mockm.EXPECT().SubscribeThread("a", uid).Return(tt.mock)
+		} else {
+			mockm.EXPECT().UnsubscribeThread("a", uid).Return(tt.mock)
+		}
+		t.Run(fmt.Sprintf("subscribe thread %d", i), func(t *testing.T) {
+			err := ms.SubscribeThread(uid, "a", tt.subscribed)
+			assert.Equal(t, tt.expected, err)
+		})
+	}
+}
+
+func TestPin(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	group := &model.Message{MsgID: "a", Type: ws.Broadcast, Sender: uid + 1, GroupID: gid}
+	roles := func(role int) []*model.GroupMemberRole {
+		return []*model.GroupMemberRole{{ID: gid, MemberID: uid, Role: role, Username: "a"}}
+	}
+	tests := []struct {
+		name     string
+		roles    []*model.GroupMemberRole
+		pinned   bool
+		mock     error
+		expected error
+		mockPin  bool
+	}{
+		{"not member", nil, true, nil, errorsx.ErrNotInGroup, false},
+		{"member", roles(model.GroupRoleMember), true, nil, errorsx.ErrPermissiondenied, false},
+		{"duplicate", roles(model.GroupRoleAdmin), true, errorsx.ErrDuplicateEntry, errorsx.ErrAlreadyPinned, true},
+		{"pin", roles(model.GroupRoleOwner), true, nil, nil, true},
+		{"not pinned", roles(model.GroupRoleAdmin), false, errorsx.ErrNoAffectedRows, errorsx.ErrNotPinned, true},
+		{"unpin", roles(model.GroupRoleAdmin), false, nil, nil, true},
+	}
+	for _, tt := range tests {
+		mockm.EXPECT().Get("a").Return(group, nil)
+		mockg.EXPECT().QueryRole(gid, uid).Return(tt.roles, nil)
+		if tt.mockPin {
+			if tt.pinned {
+				mockm.EXPECT().Pin(gomock.Any()).Return(tt.mock)
+			} else {
+				mockm.EXPECT().Unpin("a").Return(tt.mock)
+			}
+		}
+		t.Run("group "+tt.name, func(t *testing.T) {
+			err := ms.Pin(uid, "a", tt.pinned)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				msg := <-mock.Message
+				assert.Equal(t, ws.System, msg.Type)
+				assert.Equal(t, gid, msg.To)
+			}
+		})
+	}
+
+	direct := &model.Message{MsgID: "b", Type: ws.Chat, Sender: uid + 1, Receiver: uid}
+	mockm.EXPECT().Get("b").Return(direct, nil)
+	mocku.EXPECT().Get(uid, "id").Return(&model.User{ID: uid, Username: "a"}, nil)
+	mockm.EXPECT().Pin(&pinMatcher{"b", uid, uid + 1}).Return(nil)
+	t.Run("direct pin", func(t *testing.T) {
+		err := ms.Pin(uid, "b", true)
+		assert.Nil(t, err)
+		for _, to := range []uint{uid, uid + 1} {
+			msg := <-mock.Message
+			assert.Equal(t, ws.System, msg.Type)
+			assert.Equal(t, to, msg.To)
+		}
+	})
+
+	mockm.EXPECT().Get("b").Return(direct, nil)
+	t.Run("direct not participant", func(t *testing.T) {
+		err := ms.Pin(uid+2, "b", true)
+		assert.Equal(t, errorsx.ErrMessageNotFound, err)
+	})
+}
+
+type pinMatcher struct {
+	msgID string
+	userA uint
+	userB uint
+}
+
+func (p *pinMatcher) Matches(x any) bool {
+	pin, ok := x.(*model.PinnedMessage)
+	return ok && pin.MsgID == p.msgID && pin.UserA == p.userA && pin.UserB == p.userB && pin.GroupID == 0
+}
+
+func (p *pinMatcher) String() string {
+	return fmt.Sprintf("pin %s between %d and %d", p.msgID, p.userA, p.userB)
+}
+
+func TestGroupPins(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	pins := []*model.PinnedMessage{{ID: 1, MsgID: "a", GroupID: gid, PinnedBy: uid}}
+	tests := []struct {
+		gid       uint
+		cursor    *model.Cursor
+		members   []uint
+		expected  error
+		mockCache bool
+		mockAll   bool
+	}{
+		{0, &model.Cursor{PageSize: 10}, nil, errorsx.ErrInvalidParams, false, false},
+		{gid, nil, nil, errorsx.ErrInvalidParams, false, false},
+		{gid, &model.Cursor{PageSize: 10}, []uint{uid + 1}, errorsx.ErrNotInGroup, true, false},
+		{gid, &model.Cursor{PageSize: 10}, []uint{uid}, nil, true, true},
+	}
+	for i, tt := range tests {
+		if tt.mockCache {
+			mockc.EXPECT().GetMembersAndCache(tt.gid).Return(tt.members, nil)
+		}
+		if tt.mockAll {
+			mockm.EXPECT().GroupPins(tt.gid, tt.cursor).Return(pins, tt.cursor, nil)
+		}
+		t.Run(fmt.Sprintf("group pins %d", i), func(t *testing.T) {
+			result, err := ms.GroupPins(uid, tt.gid, tt.cursor)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				assert.Equal(t, pins, result["data"])
+			}
+		})
+	}
+}
+
+func TestSearchMessages(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	cursor := func() *model.SearchCursor {
+		return &model.SearchCursor{Cursor: model.Cursor{PageSize: 10, HasMore: true}}
+	}
+	tests := []struct {
+		name      string
+		search    *model.MessageSearch
+		cursor    *model.SearchCursor
+		expected  error
+		mockCache bool
+		mockAll   bool
+	}{
+		{"empty query", &model.MessageSearch{Query: ""}, cursor(), errorsx.ErrInvalidParams, false, false},
+		{"blank query", &model.MessageSearch{Query: ` " `}, cursor(), errorsx.ErrInvalidParams, false, false},
+		{"bad kind", &model.MessageSearch{Query: "hello", Kind: "video"}, cursor(), errorsx.ErrInvalidParams, false, false},
+		{"peer and group", &model.MessageSearch{Query: "hello", Peer: uid + 1, GroupID: gid}, cursor(), errorsx.ErrInvalidParams, false, false},
+		{"date range", &model.MessageSearch{Query: "hello", After: 2, Before: 1}, cursor(), errorsx.ErrInvalidParams, false, false},
+		{"nil cursor", &model.MessageSearch{Query: "hello"}, nil, errorsx.ErrInvalidParams, false, false},
+		{"page size", &model.MessageSearch{Query: "hello"}, &model.SearchCursor{}, errorsx.ErrPageSizeTooSmall, false, false},
+		{"not member", &model.MessageSearch{Query: "hello", GroupID: gid}, cursor(), errorsx.ErrNotInGroup, true, false},
+		{"search", &model.MessageSearch{Query: "Hello  world hello", GroupID: gid, Kind: "text"}, cursor(), nil, true, true},
+	}
+	for _, tt := range tests {
+		if tt.mockCache {
+			members := []uint{uid + 1}
+			if tt.mockAll {
+				members = append(members, uid)
+			}
+			mockc.EXPECT().GetMembersAndCache(gid).Return(members, nil)
+		}
+		if tt.mockAll {
+			hits := []*model.MessageHit{{Message: model.Message{MsgID: "a", Body: "<b>HELLO</b> world"}, Score: 1}}
+			mockm.EXPECT().Search(uid, []string{"hello", "world"}, tt.search, tt.cursor).Return(hits, tt.cursor, nil)
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ms.Search(uid, tt.search, tt.cursor)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				hits := result["data"].([]*model.MessageHit)
+				assert.Equal(t, "&lt;b&gt;<em>HELLO</em>&lt;/b&gt; <em>world</em>", hits[0].Snippet)
+			}
+		})
+	}
+}
+
+func TestCancelScheduled(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	tests := []struct {
+		mock     error
+		expected error
+	}{
+		{errorsx.ErrNoAffectedRows, errorsx.ErrScheduledNotFound},
+		{errorsx.ErrFailed, errorsx.ErrFailed},
+		{nil, nil},
+	}
+	for i, tt := range tests {
+		mockm.EXPECT().CancelScheduled(uid, "a").Return(tt.mock)
+		t.Run(fmt.Sprintf("cancel scheduled %d", i), func(t *testing.T) {
+			err := ms.CancelScheduled(uid, "a")
+			assert.Equal(t, tt.expected, err)
+		})
+	}
+}
+
+func TestSetRetention(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	roles := []*model.GroupMemberRole{{ID: gid, MemberID: uid, Role: model.GroupRoleAdmin, Username: "a"}}
+	tests := []struct {
+		name     string
+		ttl      int64
+		roles    []*model.GroupMemberRole
+		expected error
+		body     string
+	}{
+		{"too short", 59, nil, errorsx.ErrInvalidParams, ""},
+		{"too long", 366 * 24 * 3600, nil, errorsx.ErrInvalidParams, ""},
+		{"not member", 3600, nil, errorsx.ErrNotInGroup, ""},
+		{"member", 3600, []*model.GroupMemberRole{{ID: gid, MemberID: uid, Role: model.GroupRoleMember}},
+			errorsx.ErrPermissiondenied, ""},
+		{"days", 7 * 24 * 3600, roles, nil, "a 将消息保留时间设置为7天"},
+		{"minutes", 90 * 60, roles, nil, "a 将消息保留时间设置为90分钟"},
+		{"off", 0, roles, nil, "a 关闭了消息自动删除"},
+	}
+	for _, tt := range tests {
+		if tt.name != "too short" && tt.name != "too long" {
+			mockg.EXPECT().QueryRole(gid, uid).Return(tt.roles, nil)
+		}
+		if tt.expected == nil {
+			mockm.EXPECT().SetRetention(&model.Retention{GroupID: gid, TTL: tt.ttl, UpdatedBy: uid}).Return(nil)
+		}
+		t.Run("group "+tt.name, func(t *testing.T) {
+			err := ms.SetGroupRetention(uid, gid, tt.ttl)
+			assert.Equal(t, tt.expected, err)
+			if tt.expected == nil {
+				msg := <-mock.Message
+				assert.Equal(t, ws.System, msg.Type)
+				assert.Equal(t, tt.body, msg.Body)
+			}
+		})
+	}
+
+	t.Run("direct self", func(t *testing.T) {
+		err := ms.SetDirectRetention(uid, uid, 3600)
+		assert.Equal(t, errorsx.ErrInvalidParams, err)
+	})
+
+	mocku.EXPECT().Get(uid+1, "id").Return(nil, errorsx.ErrRecordNotFound)
+	t.Run("direct peer not exist", func(t *testing.T) {
+		err := ms.SetDirectRetention(uid, uid+1, 3600)
+		assert.Equal(t, errorsx.ErrUserNotExist, err)
+	})
+
+	mocku.EXPECT().Get(uid+1, "id").Return(&model.User{ID: uid + 1, Username: "b"}, nil)
+	mocku.EXPECT().Get(uid, "id").Return(&model.User{ID: uid, Username: "a"}, nil)
+	mockm.EXPECT().SetRetention(&model.Retention{UserA: uid, UserB: uid + 1, TTL: 3600, UpdatedBy: uid}).Return(nil)
+	t.Run("direct", func(t *testing.T) {
+		err := ms.SetDirectRetention(uid, uid+1, 3600)
+		assert.Nil(t, err)
+		for _, to := range []uint{uid, uid + 1} {
+			msg := <-mock.Message
+			assert.Equal(t, "a 将消息保留时间设置为1小时", msg.Body)
+			assert.Equal(t, to, msg.To)
+		}
+	})
+}
+
+func TestRetention(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	mockm.EXPECT().Retention(uint(0), uid, uid+1).Return(nil, errorsx.ErrRecordNotFound)
+	t.Run("not set", func(t *testing.T) {
+		retention, err := ms.DirectRetention(uid, uid+1)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), retention.TTL)
+	})
+
+	expected := &model.Retention{UserA: uid, UserB: uid + 1, TTL: 3600, UpdatedBy: uid + 1}
+	mockm.EXPECT().Retention(uint(0), uid, uid+1).Return(expected, nil)
+	t.Run("direct", func(t *testing.T) {
+		retention, err := ms.DirectRetention(uid, uid+1)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, retention)
+	})
+
+	mockc.EXPECT().GetMembersAndCache(gid).Return([]uint{uid + 1}, nil)
+	t.Run("group not member", func(t *testing.T) {
+		_, err := ms.GroupRetention(uid, gid)
+		assert.Equal(t, errorsx.ErrNotInGroup, err)
+	})
+}
@@ -9,6 +9,7 @@ import (
 	time "time"
 
 	repository "github.com/farnese17/chat/repository"
+	model "github.com/farnese17/chat/service/model"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -61,6 +62,47 @@ func (mr *MockCacheMockRecorder) AddMemberIfKeyExist(gid, member, role interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddMemberIfKeyExist", reflect.TypeOf((*MockCache)(nil).AddMemberIfKeyExist), gid, member, role)
 }
 
+// AddReadBy mocks base method.
+func (m *MockCache) AddReadBy(msgID string, uid uint) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddReadBy", msgID, uid)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AddReadBy indicates an expected call of AddReadBy.
+func (mr *MockCacheMockRecorder) AddReadBy(msgID, uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddReadBy", reflect.TypeOf((*MockCache)(nil).AddReadBy), msgID, uid)
+}
+
+// AddRoute mocks base method.
+func (m *MockCache) AddRoute(node string, uid uint, device string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddRoute", node, uid, device)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AddRoute indicates an expected call of AddRoute.
+func (mr *MockCacheMockRecorder) AddRoute(node, uid, device interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddRoute", reflect.TypeOf((*MockCache)(nil).AddRoute), node, uid, device)
+}
+
+// AddSession mocks base method.
+func (m *MockCache) AddSession(id uint, session *model.Session) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "AddSession", id, session)
+}
+
+// AddSession indicates an expected call of AddSession.
+func (mr *MockCacheMockRecorder) AddSession(id, session interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddSession", reflect.TypeOf((*MockCache)(nil).AddSession), id, session)
+}
+
 // BFM mocks base method.
 func (m *MockCache) BFM() repository.BloomFilter {
 	m.ctrl.T.Helper()
@@ -137,6 +179,55 @@ func (mr *MockCacheMockRecorder) GetBanned(cursor interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBanned", reflect.TypeOf((*MockCache)(nil).GetBanned), cursor)
 }
 
+// GetFriendStatus mocks base method.
+func (m *MockCache) GetFriendStatus(id1, id2 uint) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetFriendStatus", id1, id2)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetFriendStatus indicates an expected call of GetFriendStatus.
+func (mr *MockCacheMockRecorder) GetFriendStatus(id1, id2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetFriendStatus", reflect.TypeOf((*MockCache)(nil).GetFriendStatus), id1, id2)
+}
+
+// GetGroupMute mocks base method.
+func (m *MockCache) GetGroupMute(gid uint) (*model.GroupMuteInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetGroupMute", gid)
+	ret0, _ := ret[0].(*model.GroupMuteInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetGroupMute indicates an expected call of GetGroupMute.
+func (mr *MockCacheMockRecorder) GetGroupMute(gid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroupMute", reflect.TypeOf((*MockCache)(nil).GetGroupMute), gid)
+}
+
+// GetLastSeen mocks base method.
+func (m *MockCache) GetLastSeen(ids ...uint) (map[uint]int64, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range ids {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetLastSeen", varargs...)
+	ret0, _ := ret[0].(map[uint]int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLastSeen indicates an expected call of GetLastSeen.
+func (mr *MockCacheMockRecorder) GetLastSeen(ids ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastSeen", reflect.TypeOf((*MockCache)(nil).GetLastSeen), ids...)
+}
+
 // GetMembers mocks base method.
 func (m *MockCache) GetMembers(gid uint) ([]uint, error) {
 	m.ctrl.T.Helper()
@@ -197,19 +288,98 @@ func (mr *MockCacheMockRecorder) GetPendingMessages() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingMessages", reflect.TypeOf((*MockCache)(nil).GetPendingMessages))
 }
 
+// GetReadCursor mocks base method.
+func (m *MockCache) GetReadCursor(uid, peer, gid uint) (uint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReadCursor", uid, peer, gid)
+	ret0, _ := ret[0].(uint)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetReadCursor indicates an expected call of GetReadCursor.
+func (mr *MockCacheMockRecorder) GetReadCursor(uid, peer, gid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReadCursor", reflect.TypeOf((*MockCache)(nil).GetReadCursor), uid, peer, gid)
+}
+
+// GetReadCursors mocks base method.
+func (m *MockCache) GetReadCursors(uid uint) (map[uint]uint, map[uint]uint, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetReadCursors", uid)
+	ret0, _ := ret[0].(map[uint]uint)
+	ret1, _ := ret[1].(map[uint]uint)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetReadCursors indicates an expected call of GetReadCursors.
+func (mr *MockCacheMockRecorder) GetReadCursors(uid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetReadCursors", reflect.TypeOf((*MockCache)(nil).GetReadCursors), uid)
+}
+
+// GetRoutes mocks base method.
+func (m *MockCache) GetRoutes(uids ...uint) (map[uint][]model.Route, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range uids {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "GetRoutes", varargs...)
+	ret0, _ := ret[0].(map[uint][]model.Route)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRoutes indicates an expected call of GetRoutes.
+func (mr *MockCacheMockRecorder) GetRoutes(uids ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRoutes", reflect.TypeOf((*MockCache)(nil).GetRoutes), uids...)
+}
+
+// GetSessions mocks base method.
+func (m *MockCache) GetSessions(id uint) ([]*model.Session, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSessions", id)
+	ret0, _ := ret[0].([]*model.Session)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetSessions indicates an expected call of GetSessions.
+func (mr *MockCacheMockRecorder) GetSessions(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSessions", reflect.TypeOf((*MockCache)(nil).GetSessions), id)
+}
+
 // GetToken mocks base method.
-func (m *MockCache) GetToken(id uint) (string, error) {
+func (m *MockCache) GetToken(id uint, device string) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetToken", id)
+	ret := m.ctrl.Call(m, "GetToken", id, device)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetToken indicates an expected call of GetToken.
-func (mr *MockCacheMockRecorder) GetToken(id interface{}) *gomock.Call {
+func (mr *MockCacheMockRecorder) GetToken(id, device interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetToken", reflect.TypeOf((*MockCache)(nil).GetToken), id, device)
+}
+
+// Healthy mocks base method.
+func (m *MockCache) Healthy() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Healthy")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Healthy indicates an expected call of Healthy.
+func (mr *MockCacheMockRecorder) Healthy() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetToken", reflect.TypeOf((*MockCache)(nil).GetToken), id)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Healthy", reflect.TypeOf((*MockCache)(nil).Healthy))
 }
 
 // IsBanMuted mocks base method.
@@ -254,6 +424,36 @@ func (mr *MockCacheMockRecorder) IsBanned(id interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IsBanned", reflect.TypeOf((*MockCache)(nil).IsBanned), id)
 }
 
+// NodeHeartbeat mocks base method.
+func (m *MockCache) NodeHeartbeat(node string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NodeHeartbeat", node)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NodeHeartbeat indicates an expected call of NodeHeartbeat.
+func (mr *MockCacheMockRecorder) NodeHeartbeat(node interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NodeHeartbeat", reflect.TypeOf((*MockCache)(nil).NodeHeartbeat), node)
+}
+
+// Publish mocks base method.
+func (m *MockCache) Publish(channel string, payload []byte) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Publish", channel, payload)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Publish indicates an expected call of Publish.
+func (mr *MockCacheMockRecorder) Publish(channel, payload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Publish", reflect.TypeOf((*MockCache)(nil).Publish), channel, payload)
+}
+
 // Remove mocks base method.
 func (m *MockCache) Remove(key string) {
 	m.ctrl.T.Helper()
@@ -278,6 +478,20 @@ func (mr *MockCacheMockRecorder) RemoveGroupLastActiveTime(gid interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveGroupLastActiveTime", reflect.TypeOf((*MockCache)(nil).RemoveGroupLastActiveTime), gid)
 }
 
+// RemoveGroupMute mocks base method.
+func (m *MockCache) RemoveGroupMute(gid uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveGroupMute", gid)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveGroupMute indicates an expected call of RemoveGroupMute.
+func (mr *MockCacheMockRecorder) RemoveGroupMute(gid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveGroupMute", reflect.TypeOf((*MockCache)(nil).RemoveGroupMute), gid)
+}
+
 // RemoveMember mocks base method.
 func (m *MockCache) RemoveMember(gid, member uint) error {
 	m.ctrl.T.Helper()
@@ -292,6 +506,20 @@ func (mr *MockCacheMockRecorder) RemoveMember(gid, member interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveMember", reflect.TypeOf((*MockCache)(nil).RemoveMember), gid, member)
 }
 
+// RemoveNode mocks base method.
+func (m *MockCache) RemoveNode(node string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveNode", node)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveNode indicates an expected call of RemoveNode.
+func (mr *MockCacheMockRecorder) RemoveNode(node interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveNode", reflect.TypeOf((*MockCache)(nil).RemoveNode), node)
+}
+
 // RemoveOfflineMessage mocks base method.
 func (m *MockCache) RemoveOfflineMessage(id uint, message string) {
 	m.ctrl.T.Helper()
@@ -304,6 +532,20 @@ func (mr *MockCacheMockRecorder) RemoveOfflineMessage(id, message interface{}) *
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveOfflineMessage", reflect.TypeOf((*MockCache)(nil).RemoveOfflineMessage), id, message)
 }
 
+// RemoveOfflineMessages mocks base method.
+func (m *MockCache) RemoveOfflineMessages(id uint, msgIDs []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveOfflineMessages", id, msgIDs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveOfflineMessages indicates an expected call of RemoveOfflineMessages.
+func (mr *MockCacheMockRecorder) RemoveOfflineMessages(id, msgIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveOfflineMessages", reflect.TypeOf((*MockCache)(nil).RemoveOfflineMessages), id, msgIDs)
+}
+
 // RemovePendingMessage mocks base method.
 func (m *MockCache) RemovePendingMessage(msgID string, receiver uint, sign int64) error {
 	m.ctrl.T.Helper()
@@ -318,6 +560,78 @@ func (mr *MockCacheMockRecorder) RemovePendingMessage(msgID, receiver, sign inte
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemovePendingMessage", reflect.TypeOf((*MockCache)(nil).RemovePendingMessage), msgID, receiver, sign)
 }
 
+// RemovePendingMessages mocks base method.
+func (m *MockCache) RemovePendingMessages(from, to int64, msgIDs []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemovePendingMessages", from, to, msgIDs)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemovePendingMessages indicates an expected call of RemovePendingMessages.
+func (mr *MockCacheMockRecorder) RemovePendingMessages(from, to, msgIDs interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemovePendingMessages", reflect.TypeOf((*MockCache)(nil).RemovePendingMessages), from, to, msgIDs)
+}
+
+// RemoveRoute mocks base method.
+func (m *MockCache) RemoveRoute(node string, uid uint, device string, last bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveRoute", node, uid, device, last)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveRoute indicates an expected call of RemoveRoute.
+func (mr *MockCacheMockRecorder) RemoveRoute(node, uid, device, last interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveRoute", reflect.TypeOf((*MockCache)(nil).RemoveRoute), node, uid, device, last)
+}
+
+// RemoveSession mocks base method.
+func (m *MockCache) RemoveSession(id uint, device string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveSession", id, device)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveSession indicates an expected call of RemoveSession.
+func (mr *MockCacheMockRecorder) RemoveSession(id, device interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveSession", reflect.TypeOf((*MockCache)(nil).RemoveSession), id, device)
+}
+
+// RemoveStaleNodes mocks base method.
+func (m *MockCache) RemoveStaleNodes(timeout time.Duration) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveStaleNodes", timeout)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RemoveStaleNodes indicates an expected call of RemoveStaleNodes.
+func (mr *MockCacheMockRecorder) RemoveStaleNodes(timeout interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveStaleNodes", reflect.TypeOf((*MockCache)(nil).RemoveStaleNodes), timeout)
+}
+
+// RemoveTokens mocks base method.
+func (m *MockCache) RemoveTokens(id uint) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveTokens", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveTokens indicates an expected call of RemoveTokens.
+func (mr *MockCacheMockRecorder) RemoveTokens(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveTokens", reflect.TypeOf((*MockCache)(nil).RemoveTokens), id)
+}
+
 // Set mocks base method.
 func (m *MockCache) Set(key string, val any, expire time.Duration) {
 	m.ctrl.T.Helper()
@@ -354,6 +668,18 @@ func (mr *MockCacheMockRecorder) SetExpiration(key, expire interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetExpiration", reflect.TypeOf((*MockCache)(nil).SetExpiration), key, expire)
 }
 
+// SetFriendStatus mocks base method.
+func (m *MockCache) SetFriendStatus(id1, id2 uint, status int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetFriendStatus", id1, id2, status)
+}
+
+// SetFriendStatus indicates an expected call of SetFriendStatus.
+func (mr *MockCacheMockRecorder) SetFriendStatus(id1, id2, status interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetFriendStatus", reflect.TypeOf((*MockCache)(nil).SetFriendStatus), id1, id2, status)
+}
+
 // SetGroupLastActiveTime mocks base method.
 func (m *MockCache) SetGroupLastActiveTime(gid uint, lasttime int64) {
 	m.ctrl.T.Helper()
@@ -366,16 +692,43 @@ func (mr *MockCacheMockRecorder) SetGroupLastActiveTime(gid, lasttime interface{
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetGroupLastActiveTime", reflect.TypeOf((*MockCache)(nil).SetGroupLastActiveTime), gid, lasttime)
 }
 
+// SetLastSeen mocks base method.
+func (m *MockCache) SetLastSeen(id uint, lastSeen int64) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetLastSeen", id, lastSeen)
+}
+
+// SetLastSeen indicates an expected call of SetLastSeen.
+func (mr *MockCacheMockRecorder) SetLastSeen(id, lastSeen interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLastSeen", reflect.TypeOf((*MockCache)(nil).SetLastSeen), id, lastSeen)
+}
+
+// SetReadCursor mocks base method.
+func (m *MockCache) SetReadCursor(uid, peer, gid, seq uint) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetReadCursor", uid, peer, gid, seq)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SetReadCursor indicates an expected call of SetReadCursor.
+func (mr *MockCacheMockRecorder) SetReadCursor(uid, peer, gid, seq interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetReadCursor", reflect.TypeOf((*MockCache)(nil).SetReadCursor), uid, peer, gid, seq)
+}
+
 // SetToken mocks base method.
-func (m *MockCache) SetToken(id uint, token string, expire time.Duration) {
+func (m *MockCache) SetToken(id uint, device, token string, expire time.Duration) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "SetToken", id, token, expire)
+	m.ctrl.Call(m, "SetToken", id, device, token, expire)
 }
 
 // SetToken indicates an expected call of SetToken.
-func (mr *MockCacheMockRecorder) SetToken(id, token, expire interface{}) *gomock.Call {
+func (mr *MockCacheMockRecorder) SetToken(id, device, token, expire interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetToken", reflect.TypeOf((*MockCache)(nil).SetToken), id, token, expire)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetToken", reflect.TypeOf((*MockCache)(nil).SetToken), id, device, token, expire)
 }
 
 // StartFlush mocks base method.
@@ -390,6 +743,20 @@ func (mr *MockCacheMockRecorder) StartFlush() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StartFlush", reflect.TypeOf((*MockCache)(nil).StartFlush))
 }
 
+// Stats mocks base method.
+func (m *MockCache) Stats() map[string]any {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Stats")
+	ret0, _ := ret[0].(map[string]any)
+	return ret0
+}
+
+// Stats indicates an expected call of Stats.
+func (mr *MockCacheMockRecorder) Stats() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Stats", reflect.TypeOf((*MockCache)(nil).Stats))
+}
+
 // Stop mocks base method.
 func (m *MockCache) Stop() {
 	m.ctrl.T.Helper()
@@ -426,6 +793,35 @@ func (mr *MockCacheMockRecorder) StorePendingMessage(message, sign interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StorePendingMessage", reflect.TypeOf((*MockCache)(nil).StorePendingMessage), message, sign)
 }
 
+// Subscribe mocks base method.
+func (m *MockCache) Subscribe(channel string, handler func(string)) (func() error, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Subscribe", channel, handler)
+	ret0, _ := ret[0].(func() error)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Subscribe indicates an expected call of Subscribe.
+func (mr *MockCacheMockRecorder) Subscribe(channel, handler interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockCache)(nil).Subscribe), channel, handler)
+}
+
+// UpdateOfflineMessage mocks base method.
+func (m *MockCache) UpdateOfflineMessage(id uint, msgID string, update func(string) string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateOfflineMessage", id, msgID, update)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateOfflineMessage indicates an expected call of UpdateOfflineMessage.
+func (mr *MockCacheMockRecorder) UpdateOfflineMessage(id, msgID, update interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateOfflineMessage", reflect.TypeOf((*MockCache)(nil).UpdateOfflineMessage), id, msgID, update)
+}
+
 // MockBloomFilter is a mock of BloomFilter interface.
 type MockBloomFilter struct {
 	ctrl     *gomock.Controller
@@ -560,18 +956,6 @@ func (m *MockTestableCache) EXPECT() *MockTestableCacheMockRecorder {
 	return m.recorder
 }
 
-// Clearup mocks base method.
-func (m *MockTestableCache) Clearup() {
-	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "Clearup")
-}
-
-// Clearup indicates an expected call of Clearup.
-func (mr *MockTestableCacheMockRecorder) Clearup() *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Clearup", reflect.TypeOf((*MockTestableCache)(nil).Clearup))
-}
-
 // CountSet mocks base method.
 func (m *MockTestableCache) CountSet(key string) int64 {
 	m.ctrl.T.Helper()
@@ -600,18 +984,3 @@ func (mr *MockTestableCacheMockRecorder) GetGroupsOrMembers(key interface{}) *go
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetGroupsOrMembers", reflect.TypeOf((*MockTestableCache)(nil).GetGroupsOrMembers), key)
 }
-
-// ScanKeys mocks base method.
-func (m *MockTestableCache) ScanKeys(key string, count int64) ([]string, error) {
-	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "ScanKeys", key, count)
-	ret0, _ := ret[0].([]string)
-	ret1, _ := ret[1].(error)
-	return ret0, ret1
-}
-
-// ScanKeys indicates an expected call of ScanKeys.
-func (mr *MockTestableCacheMockRecorder) ScanKeys(key, count interface{}) *gomock.Call {
-	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScanKeys", reflect.TypeOf((*MockTestableCache)(nil).ScanKeys), key, count)
-}
@@ -192,6 +192,49 @@ func (mr *MockGroupRepositoryMockRecorder) Members(gid, uid, limit interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Members", reflect.TypeOf((*MockGroupRepository)(nil).Members), gid, uid, limit)
 }
 
+// MuteAll mocks base method.
+func (m *MockGroupRepository) MuteAll(gid uint, muted bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MuteAll", gid, muted)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MuteAll indicates an expected call of MuteAll.
+func (mr *MockGroupRepositoryMockRecorder) MuteAll(gid, muted interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MuteAll", reflect.TypeOf((*MockGroupRepository)(nil).MuteAll), gid, muted)
+}
+
+// MuteInfo mocks base method.
+func (m *MockGroupRepository) MuteInfo(gid uint) (*model.GroupMuteInfo, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MuteInfo", gid)
+	ret0, _ := ret[0].(*model.GroupMuteInfo)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MuteInfo indicates an expected call of MuteInfo.
+func (mr *MockGroupRepositoryMockRecorder) MuteInfo(gid interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MuteInfo", reflect.TypeOf((*MockGroupRepository)(nil).MuteInfo), gid)
+}
+
+// MuteMember mocks base method.
+func (m *MockGroupRepository) MuteMember(gid, uid uint, expireAt int64) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MuteMember", gid, uid, expireAt)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// MuteMember indicates an expected call of MuteMember.
+func (mr *MockGroupRepositoryMockRecorder) MuteMember(gid, uid, expireAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MuteMember", reflect.TypeOf((*MockGroupRepository)(nil).MuteMember), gid, uid, expireAt)
+}
+
 // QueryRole mocks base method.
 func (m *MockGroupRepository) QueryRole(gid uint, uid ...uint) ([]*model.GroupMemberRole, error) {
 	m.ctrl.T.Helper()
@@ -257,6 +300,20 @@ func (mr *MockGroupRepositoryMockRecorder) SearchByName(name, cursor interface{}
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SearchByName", reflect.TypeOf((*MockGroupRepository)(nil).SearchByName), name, cursor)
 }
 
+// SetDoNotDisturb mocks base method.
+func (m *MockGroupRepository) SetDoNotDisturb(gid, uid uint, enabled bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDoNotDisturb", gid, uid, enabled)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDoNotDisturb indicates an expected call of SetDoNotDisturb.
+func (mr *MockGroupRepositoryMockRecorder) SetDoNotDisturb(gid, uid, enabled interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDoNotDisturb", reflect.TypeOf((*MockGroupRepository)(nil).SetDoNotDisturb), gid, uid, enabled)
+}
+
 // Update mocks base method.
 func (m *MockGroupRepository) Update(from, gid uint, cloumn, value string) error {
 	m.ctrl.T.Helper()
@@ -18,6 +18,11 @@ func (m *MockHub) Uptime() time.Duration {
 	panic("unimplemented")
 }
 
+// Stats implements websocket.HubInterface.
+func (m *MockHub) Stats() map[string]any {
+	return nil
+}
+
 // SendToAck implements websocket.HubInterface.
 func (m *MockHub) SendToAck(message *ws.AckMsg) {
 }
@@ -39,6 +44,9 @@ func (m *MockHub) Kick(id uint) {
 	Confirm <- id
 }
 
+// KickDevice implements websocket.HubInterface.
+func (m *MockHub) KickDevice(id uint, device string) {}
+
 // IsClosed implements websocket.HubInterface.
 func (m *MockHub) IsClosed() bool {
 	return false
@@ -72,6 +80,34 @@ func (m *MockHub) SendToBroadcast(message *ws.ChatMsg) {
 	Message <- message
 }
 
+func (m *MockHub) SendToModify(message *ws.ChatMsg) {
+	Message <- message
+}
+
+func (m *MockHub) SendToRead(message *ws.ReadMsg) {}
+
+func (m *MockHub) SendToTyping(message *ws.TypingMsg) {}
+
+// React implements websocket.HubInterface.
+func (m *MockHub) React(uid uint, msgID, emoji string, add bool) (int64, error) {
+	return 1, nil
+}
+
+// SendToSenderKey implements websocket.HubInterface.
+func (m *MockHub) SendToSenderKey(from uint, message *ws.SenderKeyMsg) error {
+	return nil
+}
+
+// Online implements websocket.HubInterface.
+func (m *MockHub) Online(id uint) bool {
+	return false
+}
+
+// Devices implements websocket.HubInterface.
+func (m *MockHub) Devices(id uint) []string {
+	return nil
+}
+
 func (m *MockHub) SendToApply(message *ws.ChatMsg) {
 	Message <- message
 }
@@ -109,6 +109,20 @@ func (mr *MockServiceMockRecorder) Hub() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Hub", reflect.TypeOf((*MockService)(nil).Hub))
 }
 
+// Key mocks base method.
+func (m *MockService) Key() repository.KeyRepository {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Key")
+	ret0, _ := ret[0].(repository.KeyRepository)
+	return ret0
+}
+
+// Key indicates an expected call of Key.
+func (mr *MockServiceMockRecorder) Key() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Key", reflect.TypeOf((*MockService)(nil).Key))
+}
+
 // Logger mocks base method.
 func (m *MockService) Logger() *zap.Logger {
 	m.ctrl.T.Helper()
@@ -137,28 +151,30 @@ func (mr *MockServiceMockRecorder) Manager() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Manager", reflect.TypeOf((*MockService)(nil).Manager))
 }
 
-// SetHub mocks base method.
-func (m *MockService) SetHub(hub websocket.HubInterface) {
+// Message mocks base method.
+func (m *MockService) Message() repository.MessageRepository {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "SetHub", hub)
+	ret := m.ctrl.Call(m, "Message")
+	ret0, _ := ret[0].(repository.MessageRepository)
+	return ret0
 }
 
-// SetHub indicates an expected call of SetHub.
-func (mr *MockServiceMockRecorder) SetHub(hub interface{}) *gomock.Call {
+// Message indicates an expected call of Message.
+func (mr *MockServiceMockRecorder) Message() *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHub", reflect.TypeOf((*MockService)(nil).SetHub), hub)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Message", reflect.TypeOf((*MockService)(nil).Message))
 }
 
-// SetRunningAt mocks base method.
-func (m *MockService) SetRunningAt(t time.Time) {
+// SetHub mocks base method.
+func (m *MockService) SetHub(hub websocket.HubInterface) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "SetRunningAt", t)
+	m.ctrl.Call(m, "SetHub", hub)
 }
 
-// SetRunningAt indicates an expected call of SetRunningAt.
-func (mr *MockServiceMockRecorder) SetRunningAt(t interface{}) *gomock.Call {
+// SetHub indicates an expected call of SetHub.
+func (mr *MockServiceMockRecorder) SetHub(hub interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetRunningAt", reflect.TypeOf((*MockService)(nil).SetRunningAt), t)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetHub", reflect.TypeOf((*MockService)(nil).SetHub), hub)
 }
 
 // Shutdown mocks base method.
@@ -187,6 +203,20 @@ func (mr *MockServiceMockRecorder) Storage() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Storage", reflect.TypeOf((*MockService)(nil).Storage))
 }
 
+// Uploads mocks base method.
+func (m *MockService) Uploads() *storage.Uploads {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Uploads")
+	ret0, _ := ret[0].(*storage.Uploads)
+	return ret0
+}
+
+// Uploads indicates an expected call of Uploads.
+func (mr *MockServiceMockRecorder) Uploads() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Uploads", reflect.TypeOf((*MockService)(nil).Uploads))
+}
+
 // Uptime mocks base method.
 func (m *MockService) Uptime() time.Duration {
 	m.ctrl.T.Helper()
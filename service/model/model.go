@@ -68,18 +68,21 @@ type Group struct {
 	Desc      string `json:"desc" gorm:"type:varchar(255)" validate:"max=255"`
 	CreatedAt int64  `json:"created_at" gorm:"autoCreateTime"`
 	LastTime  int64  `json:"last_time" gorm:"autoUpdateTime;column:last_time"`
+	MuteAll   bool   `json:"mute_all" gorm:"not null;default:false;column:mute_all"`
 
 	Members      []GroupPerson       `json:"-" gorm:"foreignKey:GroupID;references:GID;constraint:OnDelete:CASCADE"`
 	Announcement []GroupAnnouncement `json:"-" gorm:"foreignKey:GroupID;references:GID;constraint:OnDelete:CASCADE"`
 }
 type GroupPerson struct {
-	ID        uint  `json:"id" gorm:"primarykey;autoincrement;column:id"`
-	MemberID  uint  `json:"member_id" gorm:"not null;column:member_id;uniqueIndex:idx_member" validate:"required,uid"`
-	GroupID   uint  `json:"group_id" gorm:"not null;column:group_id;uniqueIndex:idx_member"`
-	Role      int   `json:"role" gorm:"type:int;default:3"`
-	InviterID uint  `json:"inviter_id" gorm:"column:inviter_id" validate:"omitempty,uid"`
-	CreatedAt int64 `json:"created_at" gorm:"autoCreatTime"`
-	Version   int   `gorm:"type:int;default:0"`
+	ID           uint  `json:"id" gorm:"primarykey;autoincrement;column:id"`
+	MemberID     uint  `json:"member_id" gorm:"not null;column:member_id;uniqueIndex:idx_member" validate:"required,uid"`
+	GroupID      uint  `json:"group_id" gorm:"not null;column:group_id;uniqueIndex:idx_member"`
+	Role         int   `json:"role" gorm:"type:int;default:3"`
+	InviterID    uint  `json:"inviter_id" gorm:"column:inviter_id" validate:"omitempty,uid"`
+	CreatedAt    int64 `json:"created_at" gorm:"autoCreatTime"`
+	MuteExpireAt int64 `json:"mute_expire_at" gorm:"not null;default:0;column:mute_expire_at"`
+	DoNotDisturb bool  `json:"do_not_disturb" gorm:"not null;default:false;column:do_not_disturb"`
+	Version      int   `gorm:"type:int;default:0"`
 }
 type GroupAnnouncement struct {
 	// gorm.Model
@@ -94,20 +97,22 @@ type GroupAnnouncement struct {
 
 // 成员信息
 type MemberInfo struct {
-	ID          uint   `json:"id"`
-	Username    string `json:"username"`
-	Phone       string `json:"phone"`
-	Email       string `json:"email"`
-	Avatar      string `json:"avatar"`
-	Role        int    `json:"role"`
-	Created_at  int64  `json:"created_at"`
-	BanLevel    int    `json:"ban_level"`
-	BanExpireAt int64  `json:"ban_expire_at"`
+	ID           uint   `json:"id"`
+	Username     string `json:"username"`
+	Phone        string `json:"phone"`
+	Email        string `json:"email"`
+	Avatar       string `json:"avatar"`
+	Role         int    `json:"role"`
+	Created_at   int64  `json:"created_at"`
+	BanLevel     int    `json:"ban_level"`
+	BanExpireAt  int64  `json:"ban_expire_at"`
+	MuteExpireAt int64  `json:"mute_expire_at"`
 }
 
 type SummaryGroupInfo struct {
-	GID       uint   `json:"gid" gorm:"column:gid"`
-	GroupName string `json:"groupname" gorm:"column:groupname"`
+	GID          uint   `json:"gid" gorm:"column:gid"`
+	GroupName    string `json:"groupname" gorm:"column:groupname"`
+	DoNotDisturb bool   `json:"do_not_disturb" gorm:"column:do_not_disturb"`
 }
 
 type GroupLastActiveTime struct {
@@ -124,6 +129,17 @@ type GroupMemberRole struct {
 	Version   int    `gorm:"column:version"`
 }
 
+// 群组禁言状态,Members为成员禁言到期时间(秒)
+type GroupMuteInfo struct {
+	MuteAll bool           `json:"mute_all"`
+	Members map[uint]int64 `json:"members"`
+}
+
+type GroupMemberMute struct {
+	MemberID     uint  `gorm:"column:member_id"`
+	MuteExpireAt int64 `gorm:"column:mute_expire_at"`
+}
+
 type GroupAnnounceInfo struct {
 	ID        uint   `json:"id"`
 	Content   string `json:"content"`
@@ -186,6 +202,193 @@ type SummaryFriendInfo struct {
 	BanExpireAt int64  `json:"ban_expire_at"`
 }
 
+// 聊天记录,单聊 group_id 为0,群聊 receiver 为0
+type Message struct {
+	ID       uint   `json:"seq" gorm:"primarykey;autoincrement"`
+	MsgID    string `json:"id" gorm:"type:varchar(36);not null;uniqueIndex;column:msg_id"`
+	Type     int    `json:"type" gorm:"type:int;not null"`
+	Sender   uint   `json:"from" gorm:"not null;column:sender;index:idx_direct,priority:1"`
+	Receiver uint   `json:"to" gorm:"not null;column:receiver;index:idx_direct,priority:2"`
+	GroupID  uint   `json:"group_id" gorm:"not null;default:0;column:group_id;index:idx_group"`
+	Body     string `json:"body" gorm:"type:text;index:idx_body,class:FULLTEXT,option:WITH PARSER ngram"`
+	Extra    string `json:"extra" gorm:"type:text"`
+	Content  string `json:"content" gorm:"type:text"`
+	Mentions string `json:"mentions" gorm:"type:text"`
+	// 图片、文件和语音消息的文件公开ID,用于检查下载权限
+	FileID   string `json:"-" gorm:"type:varchar(64);not null;default:'';index:idx_file;column:file_id"`
+	Time     int64  `json:"time" gorm:"not null"`
+	EditedAt int64  `json:"edited_at" gorm:"not null;default:0;column:edited_at"`
+	Recalled bool   `json:"recalled" gorm:"not null;default:false"`
+	// 话题回复的原消息ID,回复不出现在群聊记录中
+	ThreadID    string `json:"thread_id" gorm:"type:varchar(36);not null;default:'';index:idx_thread;column:thread_id"`
+	ReplyCount  int64  `json:"reply_count" gorm:"not null;default:0;column:reply_count"`
+	LastReplyAt int64  `json:"last_reply_at" gorm:"not null;default:0;column:last_reply_at"`
+}
+
+// 消息搜索条件,q按空格分词,所有词都需要匹配
+// peer和group_id限定会话,after和before为毫秒时间戳
+type MessageSearch struct {
+	Query   string `form:"q" validate:"required,max=64" label:"搜索内容"`
+	From    uint   `form:"from" validate:"omitempty,uid" label:"发送者"`
+	Peer    uint   `form:"peer" validate:"omitempty,uid,excluded_with=GroupID" label:"会话"`
+	GroupID uint   `form:"group_id" validate:"omitempty,gid" label:"群组"`
+	After   int64  `form:"after" validate:"min=0" label:"开始时间"`
+	Before  int64  `form:"before" validate:"min=0" label:"结束时间"`
+	Kind    string `form:"kind" validate:"omitempty,oneof=text image file voice location quote" label:"消息类型"`
+}
+
+// 消息搜索结果,snippet为高亮的片段
+type MessageHit struct {
+	Message
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet" gorm:"-"`
+}
+
+// 按相关度分页的游标,last_score和last_id为上一页最后一条的相关度和seq
+type SearchCursor struct {
+	Cursor
+	LastScore float64 `json:"last_score"`
+}
+
+// 定时消息,到达send_at后由调度器重新验证并发送
+// 群聊时receiver为群组ID,payload为客户端提交的消息,device为发送定时消息的设备
+// claimed_until为正在发送的节点持有的租约到期时间,到期前不会被其他节点重复发送
+type ScheduledMessage struct {
+	ID           uint   `json:"-" gorm:"primarykey;autoincrement"`
+	MsgID        string `json:"id" gorm:"type:varchar(36);not null;uniqueIndex;column:msg_id"`
+	Type         int    `json:"type" gorm:"type:int;not null"`
+	Sender       uint   `json:"from" gorm:"not null;index:idx_scheduled_sender"`
+	Receiver     uint   `json:"to" gorm:"not null"`
+	Body         string `json:"body" gorm:"type:text"`
+	SendAt       int64  `json:"send_at" gorm:"not null;index:idx_send_at"`
+	Payload      string `json:"-" gorm:"type:text;not null"`
+	Device       string `json:"-" gorm:"type:varchar(64);not null;default:''"`
+	ClaimedUntil int64  `json:"-" gorm:"not null;default:0"`
+	CreatedAt    int64  `json:"created_at" gorm:"autoCreateTime:milli"`
+}
+
+// 会话的消息保留时间,发送超过ttl秒的消息会被删除
+// 群聊时user_a和user_b为0,单聊时group_id为0,较小的ID在前
+type Retention struct {
+	ID        uint  `json:"-" gorm:"primarykey;autoincrement"`
+	GroupID   uint  `json:"group_id" gorm:"not null;default:0;uniqueIndex:idx_retention,priority:1"`
+	UserA     uint  `json:"-" gorm:"not null;default:0;uniqueIndex:idx_retention,priority:2"`
+	UserB     uint  `json:"-" gorm:"not null;default:0;uniqueIndex:idx_retention,priority:3"`
+	TTL       int64 `json:"ttl" gorm:"not null;column:ttl"`
+	UpdatedBy uint  `json:"updated_by" gorm:"not null"`
+	UpdatedAt int64 `json:"updated_at" gorm:"autoUpdateTime:milli"`
+}
+
+// 端到端加密的身份公钥和签名预共享公钥,服务端只保存公钥
+type IdentityKey struct {
+	UserID         uint   `json:"user_id" gorm:"primarykey;autoIncrement:false"`
+	IdentityKey    string `json:"identity_key" gorm:"type:varchar(255);not null" validate:"required,base64,max=255" label:"身份公钥"`
+	SignedPreKeyID uint32 `json:"signed_prekey_id" gorm:"not null"`
+	SignedPreKey   string `json:"signed_prekey" gorm:"type:varchar(255);not null" validate:"required,base64,max=255" label:"签名预共享公钥"`
+	Signature      string `json:"signature" gorm:"type:varchar(255);not null" validate:"required,base64,max=255" label:"签名"`
+	UpdatedAt      int64  `json:"updated_at" gorm:"autoUpdateTime:milli"`
+}
+
+// 一次性预共享公钥,获取密钥包时取出一个后删除
+type PreKey struct {
+	ID        uint   `json:"-" gorm:"primarykey;autoincrement"`
+	UserID    uint   `json:"-" gorm:"not null;uniqueIndex:idx_prekey,priority:1"`
+	KeyID     uint32 `json:"key_id" gorm:"not null;uniqueIndex:idx_prekey,priority:2"`
+	PublicKey string `json:"public_key" gorm:"type:varchar(255);not null" validate:"required,base64,max=255" label:"预共享公钥"`
+}
+
+// 上传的密钥,身份公钥变化时旧的一次性预共享公钥失效
+type KeyUpload struct {
+	IdentityKey
+	PreKeys []*PreKey `json:"prekeys" validate:"max=100,dive,required" label:"一次性预共享公钥"`
+}
+
+// 建立加密会话需要的密钥包,一次性预共享公钥用完时prekey为空
+type KeyBundle struct {
+	*IdentityKey
+	PreKey *PreKey `json:"prekey"`
+}
+
+// 创建分片上传,size为文件的总大小
+type UploadCreate struct {
+	Name string `json:"name" validate:"required,max=255" label:"文件名"`
+	Size int64  `json:"size" validate:"required,min=1" label:"文件大小"`
+}
+
+// 置顶消息,群聊时 group_id 为群组,单聊时 user_a 和 user_b 为会话双方,较小的ID在前
+type PinnedMessage struct {
+	ID       uint     `json:"seq" gorm:"primarykey;autoincrement"`
+	MsgID    string   `json:"message_id" gorm:"type:varchar(36);not null;uniqueIndex;column:msg_id"`
+	GroupID  uint     `json:"group_id" gorm:"not null;default:0;index:idx_pin_group"`
+	UserA    uint     `json:"-" gorm:"not null;default:0;index:idx_pin_direct,priority:1"`
+	UserB    uint     `json:"-" gorm:"not null;default:0;index:idx_pin_direct,priority:2"`
+	PinnedBy uint     `json:"pinned_by" gorm:"not null"`
+	PinnedAt int64    `json:"pinned_at" gorm:"not null"`
+	Message  *Message `json:"message" gorm:"-"`
+}
+
+// 话题的订阅者,回复时只通知订阅者,参与回复的成员自动订阅
+type ThreadSubscriber struct {
+	ID        uint   `json:"-" gorm:"primarykey;autoincrement"`
+	MsgID     string `json:"message_id" gorm:"type:varchar(36);not null;uniqueIndex:idx_subscriber,priority:1;column:msg_id"`
+	UserID    uint   `json:"user_id" gorm:"not null;uniqueIndex:idx_subscriber,priority:2"`
+	CreatedAt int64  `json:"created_at" gorm:"autoCreateTime:milli"`
+}
+
+// 用户对消息的表情回应,每个用户对同一条消息的同一个表情只能回应一次
+// 表情使用二进制排序规则,否则不同的emoji会被视为相同
+type Reaction struct {
+	ID        uint   `json:"-" gorm:"primarykey;autoincrement"`
+	MsgID     string `json:"message_id" gorm:"type:varchar(36);not null;uniqueIndex:idx_reaction,priority:1;column:msg_id"`
+	UserID    uint   `json:"user_id" gorm:"not null;uniqueIndex:idx_reaction,priority:2"`
+	Emoji     string `json:"emoji" gorm:"type:varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;not null;uniqueIndex:idx_reaction,priority:3"`
+	CreatedAt int64  `json:"created_at" gorm:"autoCreateTime:milli"`
+}
+
+// 消息每个表情的回应数量,reacted表示当前用户是否回应过
+type ReactionCount struct {
+	MsgID   string `json:"message_id" gorm:"type:varchar(36);primarykey;column:msg_id"`
+	Emoji   string `json:"emoji" gorm:"type:varchar(32) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin;primarykey"`
+	Count   int64  `json:"count" gorm:"not null;default:0"`
+	Reacted bool   `json:"reacted" gorm:"-"`
+}
+
+// 会话,单聊 group_id 为0,群聊 peer_id 为0
+// read_seq 为当前用户的读游标,peer_read_seq 为单聊对方的读游标
+type Conversation struct {
+	PeerID      uint  `json:"peer_id" gorm:"column:peer_id"`
+	GroupID     uint  `json:"group_id" gorm:"column:group_id"`
+	LastSeq     uint  `json:"last_seq" gorm:"column:last_seq"`
+	LastTime    int64 `json:"last_time" gorm:"column:last_time"`
+	ReadSeq     uint  `json:"read_seq" gorm:"-"`
+	PeerReadSeq uint  `json:"peer_read_seq,omitempty" gorm:"-"`
+	Unread      int64 `json:"unread" gorm:"-"`
+}
+
+// 好友在线状态,last_seen 为最后一次上线或下线的时间
+type Presence struct {
+	ID       uint  `json:"id"`
+	Online   bool  `json:"online"`
+	LastSeen int64 `json:"last_seen"`
+}
+
+// 集群路由,用户的一个设备连接在某个节点上
+type Route struct {
+	Node   string
+	Device string
+}
+
+// 登录会话,每个设备一个
+type Session struct {
+	Device    string `json:"device"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	LoginAt   int64  `json:"login_at"`
+	ExpireAt  int64  `json:"expire_at"`
+	Current   bool   `json:"current"`
+	Online    bool   `json:"online"`
+}
+
 type Cursor struct {
 	PageSize int  `json:"page_size"`
 	LastID   uint `json:"last_id"`
@@ -198,9 +401,20 @@ const (
 	CacheBlockUnack     = "chat:block:unack"
 	CacheGroup          = "chat:cache:group:"
 	CacheGroups         = "chat:cache:groups"
+	CacheFriendStatus   = "chat:cache:friend:"
+	CacheGroupMute      = "chat:cache:group_mute:"
+	CacheReadCursor     = "chat:cache:read:"
+	CacheReadBy         = "chat:cache:read_by:"
+	CacheLastSeen       = "chat:presence:last_seen"
+
+	CacheRoute     = "chat:cluster:route:"
+	CacheNodeUsers = "chat:cluster:node:"
+	CacheNodes     = "chat:cluster:nodes"
+	ClusterChannel = "chat:cluster:channel:"
 
-	CacheToken  = "chat:token:"
-	CacheBanned = "chat:banned:"
+	CacheToken   = "chat:token:"
+	CacheSession = "chat:session:"
+	CacheBanned  = "chat:banned:"
 
 	CacheLatestWarmTime = "chat:cache:latest_warm"
 )
@@ -3,6 +3,7 @@ package service
 import (
 	"errors"
 	"fmt"
+	"slices"
 	"strconv"
 	"time"
 
@@ -253,8 +254,50 @@ func (u *UserService) GetAccountField(value string) (string, error) {
 	return "", errorsx.ErrInvalidParams
 }
 
-func (u *UserService) Logout(id uint) error {
-	key := m.CacheToken + strconv.Itoa(int(id))
-	u.service.Cache().Remove(key)
+// 退出当前设备的登录
+func (u *UserService) Logout(id uint, device string) error {
+	if _, err := u.service.Cache().RemoveSession(id, device); err != nil {
+		return err
+	}
+	u.kickDevice(id, device)
 	return nil
 }
+
+// 登录会话列表,current为当前请求的设备
+func (u *UserService) Sessions(id uint, current string) ([]*m.Session, error) {
+	sessions, err := u.service.Cache().GetSessions(id)
+	if err != nil {
+		return nil, err
+	}
+	var online []string
+	if hub := u.service.Hub(); hub != nil && !hub.IsClosed() {
+		online = hub.Devices(id)
+	}
+	for _, session := range sessions {
+		session.Current = session.Device == current
+		session.Online = slices.Contains(online, session.Device)
+	}
+	return sessions, nil
+}
+
+// 注销指定设备的登录,并断开该设备的websocket连接
+func (u *UserService) RevokeSession(id uint, device string) error {
+	if err := validator.ValidateDevice(device); err != nil {
+		return err
+	}
+	removed, err := u.service.Cache().RemoveSession(id, device)
+	if err != nil {
+		return err
+	}
+	if !removed {
+		return errorsx.ErrSessionNotFound
+	}
+	u.kickDevice(id, device)
+	return nil
+}
+
+func (u *UserService) kickDevice(id uint, device string) {
+	if hub := u.service.Hub(); hub != nil && !hub.IsClosed() {
+		hub.KickDevice(id, device)
+	}
+}
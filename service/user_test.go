@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/farnese17/chat/config"
+	"github.com/farnese17/chat/pkg/storage"
+	smock "github.com/farnese17/chat/pkg/storage/mock"
 	"github.com/farnese17/chat/service"
 	"github.com/farnese17/chat/service/mock"
 	"github.com/farnese17/chat/service/model"
@@ -24,20 +26,27 @@ import (
 )
 
 var (
-	uid   = uint(1e5 + 1)
-	gid   = uint(1e9 + 1)
-	log   *zap.Logger
-	ctrl  *gomock.Controller
-	hub   ws.HubInterface
-	mocku *mock.MockUserRepository
-	mockf *mock.MockFriendRepository
-	mockg *mock.MockGroupRepository
-	mockc *mock.MockCache
-	u     *service.UserService
-	f     *service.FriendService
-	g     *service.GroupService
-	s     *mock.MockService
-	cfg   config.Config
+	uid    = uint(1e5 + 1)
+	gid    = uint(1e9 + 1)
+	log    *zap.Logger
+	ctrl   *gomock.Controller
+	hub    ws.HubInterface
+	mocku  *mock.MockUserRepository
+	mockf  *mock.MockFriendRepository
+	mockg  *mock.MockGroupRepository
+	mockc  *mock.MockCache
+	mockm  *mock.MockMessageRepository
+	mockk  *mock.MockKeyRepository
+	mockd  *smock.MockDB
+	mockfs *smock.MockStorage
+	u      *service.UserService
+	f      *service.FriendService
+	g      *service.GroupService
+	ms     *service.MessageService
+	ks     *service.KeyService
+	files  *service.FileService
+	s      *mock.MockService
+	cfg    config.Config
 )
 
 func TestMain(m *testing.M) {
@@ -69,8 +78,17 @@ func setup(t *testing.T) {
 	mockf = mock.NewMockFriendRepository(ctrl)
 	mockg = mock.NewMockGroupRepository(ctrl)
 	mockc = mock.NewMockCache(ctrl)
+	mockm = mock.NewMockMessageRepository(ctrl)
+	mockk = mock.NewMockKeyRepository(ctrl)
+	mockd = smock.NewMockDB(ctrl)
+	mockfs = smock.NewMockStorage(ctrl)
+	uploads, err := storage.NewUploads(t.TempDir(), 4, time.Hour, mockfs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(uploads.Close)
 	hub = mock.NewMockHub()
-	go hub.Run()
+	hub.Run()
 
 	s = mock.NewMockService(ctrl)
 	s.EXPECT().Config().Return(cfg).AnyTimes()
@@ -79,11 +97,18 @@ func setup(t *testing.T) {
 	s.EXPECT().Friend().Return(mockf).AnyTimes()
 	s.EXPECT().Group().Return(mockg).AnyTimes()
 	s.EXPECT().Cache().Return(mockc).AnyTimes()
+	s.EXPECT().Message().Return(mockm).AnyTimes()
+	s.EXPECT().Key().Return(mockk).AnyTimes()
 	s.EXPECT().Hub().Return(hub).AnyTimes()
+	s.EXPECT().Storage().Return(&storage.LocalStorage{DB: mockd, Secret: []byte("secret")}).AnyTimes()
+	s.EXPECT().Uploads().Return(uploads).AnyTimes()
 
 	u = service.NewUserService(s)
 	f = service.NewFriendService(s)
 	g = service.NewGroupService(s)
+	ms = service.NewMessageService(s)
+	ks = service.NewKeyService(s)
+	files = service.NewFileService(s)
 }
 
 func TestRegister(t *testing.T) {
@@ -380,6 +405,61 @@ func TestLogin(t *testing.T) {
 	}
 }
 
+func TestSessions(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	sessions := []*model.Session{{Device: "phone"}, {Device: "desktop"}}
+	mockc.EXPECT().GetSessions(uid).Return(sessions, nil)
+	got, err := u.Sessions(uid, "desktop")
+	assert.NoError(t, err)
+	assert.False(t, got[0].Current)
+	assert.True(t, got[1].Current)
+
+	mockc.EXPECT().GetSessions(uid).Return(nil, errors.New("error"))
+	got, err = u.Sessions(uid, "desktop")
+	assert.Error(t, err)
+	assert.Nil(t, got)
+}
+
+func TestRevokeSession(t *testing.T) {
+	setup(t)
+	defer clear(t)
+
+	tests := []struct {
+		name        string
+		device      string
+		mock        bool
+		removed     bool
+		mockErr     error
+		expectedErr error
+	}{
+		{"success", "phone", true, true, nil, nil},
+		{"not found", "phone", true, false, nil, errorsx.ErrSessionNotFound},
+		{"cache error", "phone", true, false, errorsx.ErrFailed, errorsx.ErrFailed},
+		{"empty device", "", false, false, nil, nil},
+		{"invalid device", "a b", false, false, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.mock {
+				mockc.EXPECT().RemoveSession(uid, tt.device).Return(tt.removed, tt.mockErr)
+			}
+			err := u.RevokeSession(uid, tt.device)
+			if tt.mock {
+				assert.Equal(t, tt.expectedErr, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	t.Run("logout", func(t *testing.T) {
+		mockc.EXPECT().RemoveSession(uid, "phone").Return(false, nil)
+		assert.NoError(t, u.Logout(uid, "phone"))
+	})
+}
+
 func TestGetAccountFeild(t *testing.T) {
 	setup(t)
 	defer clear(t)
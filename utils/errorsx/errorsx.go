@@ -50,6 +50,7 @@ var (
 	ErrBanned                        = errors.New("你已被禁止")
 	ErrUserBanned                    = errors.New("该用户已被禁止")
 	ErrUserMuted                     = errors.New("该用户已被禁言")
+	ErrSessionNotFound               = errors.New("登录会话不存在")
 	//
 	ErrAlreadyFriend  = errors.New("对方已经是你的好友")
 	ErrBlocked        = errors.New("你在对方的黑名单中")
@@ -57,6 +58,7 @@ var (
 	ErrAlreadyBlock   = errors.New("对方在黑名单中")
 	ErrNoBlocked      = errors.New("对方不在黑名单中")
 	ErrNoRequest      = errors.New("对方没有发送好友请求")
+	ErrNotFriend      = errors.New("对方不是你的好友")
 	//
 	ErrAlreadyInGroup       = errors.New("已经在群组中")
 	ErrJoinGroup            = errors.New("%s加入群组")
@@ -83,6 +85,37 @@ var (
 	ErrCantKickAdmin        = errors.New("不能踢出管理员")
 	ErrNotInApplyList       = errors.New("对方不在申请列表中")
 	ErrCantSearchNull       = errors.New("搜索值不能为空")
+	ErrCantMuteAdmin        = errors.New("不能禁言管理员")
+	ErrMemberMuted          = errors.New("你已被禁言")
+	ErrGroupMuted           = errors.New("群组已开启全员禁言")
+	//
+	ErrSenderMismatch     = errors.New("消息发送者与当前用户不一致")
+	ErrMessageNotFound    = errors.New("消息不存在")
+	ErrNotMessageSender   = errors.New("只能修改自己发送的消息")
+	ErrModifyExpired      = errors.New("消息已超过可撤回或编辑的时限")
+	ErrMessageRecalled    = errors.New("消息已撤回")
+	ErrInvalidContent     = errors.New("消息内容无效")
+	ErrMentionNotMember   = errors.New("只能提及群组成员")
+	ErrCantEditContent    = errors.New("只能编辑文本消息")
+	ErrAlreadyReacted     = errors.New("已经回应过该表情")
+	ErrReactionNotFound   = errors.New("没有回应过该表情")
+	ErrInvalidThread      = errors.New("只能回复群聊中的原消息")
+	ErrAlreadyPinned      = errors.New("消息已置顶")
+	ErrNotPinned          = errors.New("消息未置顶")
+	ErrInvalidSendAt      = errors.New("定时发送时间超出范围")
+	ErrScheduledNotFound  = errors.New("定时消息不存在")
+	ErrKeyNotFound        = errors.New("用户没有上传加密密钥")
+	ErrTooManyPreKeys     = errors.New("一次性预共享密钥数量超出上限")
+	ErrFileNotFound       = errors.New("文件不存在")
+	ErrInvalidLink        = errors.New("下载链接无效")
+	ErrLinkExpired        = errors.New("下载链接已过期")
+	ErrUploadNotFound     = errors.New("上传不存在或已过期")
+	ErrInvalidChunk       = errors.New("分片序号或大小不正确")
+	ErrUploadIncomplete   = errors.New("文件还没有上传完成")
+	ErrNoThumbnail        = errors.New("文件没有缩略图")
+	ErrFileTooLarge       = errors.New("文件大小超出限制")
+	ErrQuotaExceeded      = errors.New("存储空间或文件数量超出限额")
+	ErrFileTypeNotAllowed = errors.New("不允许上传该类型的文件")
 )
 
 var StatusCode = map[error]int{
@@ -120,6 +153,7 @@ var StatusCode = map[error]int{
 	ErrBanned:                        1605,
 	ErrUserBanned:                    1606,
 	ErrUserMuted:                     1607,
+	ErrSessionNotFound:               1608,
 	//
 	ErrWrongPassword:           2001,
 	ErrUsernameOrPasswordWrong: 2002,
@@ -132,6 +166,7 @@ var StatusCode = map[error]int{
 	ErrAlreadyRequest: 3003,
 	ErrAlreadyBlock:   3004,
 	ErrNoRequest:      3005,
+	ErrNotFriend:      3006,
 	//
 	ErrAlreadyInGroup:       4001,
 	ErrJoinGroup:            4002,
@@ -158,8 +193,38 @@ var StatusCode = map[error]int{
 	ErrNotInApplyList:       4023,
 	ErrCantSearchNull:       4024,
 	ErrPageSizeTooBig:       4026,
+	ErrCantMuteAdmin:        4027,
+	ErrMemberMuted:          4028,
+	ErrGroupMuted:           4029,
 
 	ErrUnkonwnMessageType: 5000,
+	ErrSenderMismatch:     5001,
+	ErrMessageNotFound:    5002,
+	ErrNotMessageSender:   5003,
+	ErrModifyExpired:      5004,
+	ErrMessageRecalled:    5005,
+	ErrInvalidContent:     5006,
+	ErrMentionNotMember:   5007,
+	ErrCantEditContent:    5008,
+	ErrAlreadyReacted:     5009,
+	ErrReactionNotFound:   5010,
+	ErrInvalidThread:      5011,
+	ErrAlreadyPinned:      5012,
+	ErrNotPinned:          5013,
+	ErrInvalidSendAt:      5014,
+	ErrScheduledNotFound:  5015,
+	ErrKeyNotFound:        5016,
+	ErrTooManyPreKeys:     5017,
+	ErrFileNotFound:       5018,
+	ErrInvalidLink:        5019,
+	ErrLinkExpired:        5020,
+	ErrUploadNotFound:     5021,
+	ErrInvalidChunk:       5022,
+	ErrUploadIncomplete:   5023,
+	ErrNoThumbnail:        5024,
+	ErrFileTooLarge:       5025,
+	ErrQuotaExceeded:      5026,
+	ErrFileTypeNotAllowed: 5027,
 }
 
 func GetStatusCode(err error) int {
@@ -9,11 +9,16 @@ import (
 )
 
 const userIDKey = "from"
+const deviceIDKey = "device"
 
 func GetUserID(c *gin.Context) uint {
 	return c.MustGet(userIDKey).(uint)
 }
 
+func GetDeviceID(c *gin.Context) string {
+	return c.GetString(deviceIDKey)
+}
+
 func ManagerGetID(c *gin.Context) uint {
 	p := c.Param("id")
 	id, err := strconv.Atoi(p)
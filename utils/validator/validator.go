@@ -222,6 +222,29 @@ func ValidateRemark(remark string) error {
 	return nil
 }
 
+func ValidateDevice(device string) error {
+	if err := validateVar(device, "required,max=64,nospace"); err != "" {
+		return errors.New("设备ID" + err)
+	}
+	return nil
+}
+
+// 提及的用户,最多50个且不能重复
+func ValidateMentions(mentions []uint) error {
+	if err := validateVar(mentions, "max=50,unique,dive,uid"); err != "" {
+		return errors.New("提及" + err)
+	}
+	return nil
+}
+
+// 表情回应,组合emoji由多个字符组成
+func ValidateEmoji(emoji string) error {
+	if err := validateVar(emoji, "required,max=16,nospace"); err != "" {
+		return errors.New("表情" + err)
+	}
+	return nil
+}
+
 func ValidateGIDAndUID(gid uint, uid ...uint) error {
 	if err := ValidateGID(gid); err != nil {
 		return err
@@ -2,8 +2,12 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/farnese17/chat/config"
@@ -18,6 +22,17 @@ const (
 	Broadcast
 	UpdateBlackList
 	Ack
+	Error
+	Recall
+	Edit
+	Read
+	Presence
+	Typing
+	Mention
+	ReactionAdd
+	ReactionRemove
+	Scheduled
+	SenderKey
 )
 
 const (
@@ -30,33 +45,45 @@ const (
 	Apply
 )
 
+// send为有界队列,入队不会阻塞,关闭后由写协程把队列中的消息转为离线消息
 type Client struct {
 	id      uint
+	device  string
 	conn    *websocket.Conn
 	send    chan any
+	quit    chan struct{}
+	codec   Codec
+	mu      sync.Mutex
 	closed  bool
 	service Service
 }
 
-func NewWsClient(s Service, id uint, conn *websocket.Conn) *Client {
+func NewWsClient(s Service, id uint, device string, conn *websocket.Conn) *Client {
+	protocol := ""
+	if conn != nil {
+		protocol = conn.Subprotocol()
+	}
 	return &Client{
 		id:      id,
+		device:  device,
 		conn:    conn,
-		send:    make(chan any),
+		send:    make(chan any, s.Config().Common().SendQueueSize()),
+		quit:    make(chan struct{}),
+		codec:   CodecFor(protocol),
 		closed:  false,
 		service: s,
 	}
 }
 
-type CloseSignal struct{}
-
 func (c *Client) Read() {
-	defer func() {
-		if !c.closed {
-			c.closed = true
-			c.send <- CloseSignal{}
-		}
-	}()
+	defer c.close()
+
+	// 超过pong_wait没有收到pong或消息视为断线,读取失败后关闭连接
+	c.extendReadDeadline()
+	c.conn.SetPongHandler(func(string) error {
+		c.extendReadDeadline()
+		return nil
+	})
 
 	for {
 		_, p, err := c.conn.ReadMessage()
@@ -65,38 +92,115 @@ func (c *Client) Read() {
 				strings.Contains(err.Error(), "use of closed network connection") {
 				return
 			}
+			if isTimeout(err) {
+				c.service.Logger().Warn("Websocket peer timed out",
+					zap.Uint("client_id", c.id), zap.String("device", c.device))
+				return
+			}
 			c.service.Logger().Error("Failed to read websocket message", zap.Error(err), zap.Uint("client_id", c.id))
 			return
 		}
+		c.extendReadDeadline()
 
-		var msg *Message
-		if err := json.Unmarshal(p, &msg); err != nil {
-			c.service.Logger().Warn("Failed to unmarsal JSON message", zap.Error(err), zap.String("message", string(p)))
+		msgType, body, err := c.codec.Decode(p)
+		if err != nil {
+			c.service.Logger().Warn("Failed to decode message", zap.Error(err), zap.ByteString("message", p))
 			continue
 		}
 
-		body := msg.Body
-		switch msg.Type {
+		switch msgType {
 		case Chat:
 			msg, err := c.parseMessage(body)
 			if err != nil {
 				return
 			}
+			msg.Type = Chat
+			if err := c.verifySender(msg); err != nil {
+				c.sendError(msg.ID, err)
+				continue
+			}
+			if msg.SendAt > time.Now().UnixMilli() {
+				if err := c.schedule(msg); err != nil {
+					c.sendError(msg.ID, err)
+				}
+				continue
+			}
+			msg.SendAt = 0
 			c.service.Hub().SendToChat(msg)
 		case Broadcast:
 			msg, err := c.parseMessage(body)
 			if err != nil {
 				return
 			}
+			msg.Type = Broadcast
+			if err := c.verifySender(msg); err != nil {
+				c.sendError(msg.ID, err)
+				continue
+			}
+			if msg.SendAt > time.Now().UnixMilli() {
+				if err := c.schedule(msg); err != nil {
+					c.sendError(msg.ID, err)
+				}
+				continue
+			}
+			msg.SendAt = 0
 			c.service.Hub().SendToBroadcast(msg)
+		case Recall, Edit:
+			t := msgType
+			msg, err := c.parseMessage(body)
+			if err != nil {
+				return
+			}
+			msg.Type = t
+			if err := c.verifyModify(msg); err != nil {
+				c.sendError(msg.ID, err)
+				continue
+			}
+			c.service.Hub().SendToModify(msg)
+		case Read:
+			msg, err := c.parseReadMessage(body)
+			if err != nil {
+				return
+			}
+			msg.Type = Read
+			msg.From = c.id
+			if err := c.markRead(msg); err != nil {
+				c.sendError(msg.ID, err)
+			}
+		case ReactionAdd, ReactionRemove:
+			msg, err := c.parseReactionMessage(body)
+			if err != nil {
+				return
+			}
+			if _, err := c.service.Hub().React(c.id, msg.ID, msg.Emoji, msgType == ReactionAdd); err != nil {
+				c.sendError(msg.ID, err)
+			}
+		case SenderKey:
+			msg, err := c.parseSenderKeyMessage(body)
+			if err != nil {
+				return
+			}
+			if err := c.service.Hub().SendToSenderKey(c.id, msg); err != nil {
+				c.sendError(msg.ID, err)
+			}
+		case Typing:
+			msg, err := c.parseTypingMessage(body)
+			if err != nil {
+				return
+			}
+			msg.Type = Typing
+			msg.From = c.id
+			c.service.Hub().SendToTyping(msg)
 		case Ack:
 			msg, err := c.parseAckMessage(body)
 			if err != nil {
 				return
 			}
+			// 只能确认发给自己的消息
+			msg.To = c.id
 			c.service.Hub().SendToAck(msg)
 		default:
-			c.service.Logger().Error("Unknow websocket message type", zap.String("message", string(p)))
+			c.service.Logger().Error("Unknow websocket message type", zap.ByteString("message", p))
 			return
 		}
 	}
@@ -107,57 +211,111 @@ func (c *Client) Write() {
 		c.service.Hub().Unregister(c)
 	}()
 
-	for msg := range c.send {
-		if c.closed {
+	ticker := time.NewTicker(c.service.Config().Common().PingInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case msg := <-c.send:
+			c.write(msg)
+		case <-c.quit:
 			c.sendCloseMessage()
 			c.conn.Close()
-			close(c.send)
-			if _, ok := msg.(CloseSignal); !ok {
-				c.service.Hub().StoreOfflineMessage(msg, c.id)
-			}
-			for msg := range c.send {
-				if _, ok := msg.(CloseSignal); !ok {
-					c.service.Hub().StoreOfflineMessage(msg, c.id)
-				}
-			}
+			c.drain()
 			return
+		case <-ticker.C:
+			// 重置计时器,应用热更新
+			ticker.Reset(c.service.Config().Common().PingInterval())
+			deadline := time.Now().Add(c.service.Config().Common().WriteWait())
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				c.service.Logger().Warn("Failed to ping websocket peer",
+					zap.Uint("client_id", c.id), zap.String("device", c.device), zap.Error(err))
+				c.reap()
+			}
 		}
-		var packagingMsg struct {
-			Type int `json:"type"`
-			Body any `json:"body"`
-		}
-		switch m := msg.(type) {
-		case *ChatMsg:
-			packagingMsg.Type = m.Type
-			packagingMsg.Body = m
-		case *AckMsg:
-			packagingMsg.Type = m.Type
-			packagingMsg.Body = m
-		default:
-			c.service.Logger().Error("Unknown message type")
-			continue
-		}
+	}
+}
 
-		sent := false
-		if err := c.conn.WriteJSON(packagingMsg); err != nil {
-			c.service.Logger().Error("Failed to send message", zap.Error(err))
-			maxRetries := config.GetConfig().Common().MaxRetries()
-			for try := 0; try < maxRetries; try++ {
-				logMsg := fmt.Sprintf("Failed to send message,start retrying: %d times", try)
-				c.service.Logger().Error(logMsg, zap.Error(err))
-				if err := c.conn.WriteJSON(packagingMsg); err != nil {
-					delay := config.GetConfig().Common().RetryDelay(try)
-					time.Sleep(delay)
-					continue
-				}
-				sent = true
-				break
-			}
-			if !sent {
-				c.service.Hub().StoreOfflineMessage(msg, c.id)
+func (c *Client) write(msg any) {
+	// 连接已关闭,剩余消息转为离线消息
+	if c.isClosed() {
+		c.storeOffline(msg)
+		return
+	}
+	body := msg
+	if p, ok := msg.(*pendingMsg); ok {
+		body = p.msg
+	}
+	var msgType int
+	switch m := body.(type) {
+	case *ChatMsg:
+		msgType = m.Type
+	case *AckMsg:
+		msgType = m.Type
+	case *ErrorMsg:
+		msgType = m.Type
+	case *ReadMsg:
+		msgType = m.Type
+	case *PresenceMsg:
+		msgType = m.Type
+	case *TypingMsg:
+		msgType = m.Type
+	default:
+		c.service.Logger().Error("Unknown message type")
+		return
+	}
+	data, err := c.codec.Encode(msgType, body)
+	if err != nil {
+		c.service.Logger().Error("Failed to encode message", zap.Error(err))
+		return
+	}
+
+	err = c.writeMessage(data)
+	if err == nil {
+		return
+	}
+	c.service.Logger().Error("Failed to send message", zap.Error(err))
+	// 写超时后连接已不可用,不再重试
+	sent := false
+	if !isTimeout(err) {
+		maxRetries := config.GetConfig().Common().MaxRetries()
+		for try := 0; try < maxRetries && !c.isClosed(); try++ {
+			logMsg := fmt.Sprintf("Failed to send message,start retrying: %d times", try)
+			c.service.Logger().Error(logMsg, zap.Error(err))
+			if err = c.writeMessage(data); err != nil {
+				delay := config.GetConfig().Common().RetryDelay(try)
+				time.Sleep(delay)
+				continue
 			}
+			sent = true
+			break
 		}
 	}
+	if !sent {
+		c.storeOffline(msg)
+		c.reap()
+	}
+}
+
+func (c *Client) writeMessage(data []byte) error {
+	common := c.service.Config().Common()
+	// 没有协商压缩时不生效
+	c.conn.EnableWriteCompression(common.Compression() && len(data) >= common.CompressionThreshold())
+	c.conn.SetWriteDeadline(time.Now().Add(common.WriteWait()))
+	return c.conn.WriteMessage(c.codec.FrameType(), data)
+}
+
+func (c *Client) extendReadDeadline() {
+	c.conn.SetReadDeadline(time.Now().Add(c.service.Config().Common().PongWait()))
+}
+
+// 断开失效的连接,读取随之失败并发出关闭信号,之后发给该连接的消息转为离线消息
+func (c *Client) reap() {
+	c.conn.Close()
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 type Message struct {
@@ -173,6 +331,20 @@ type ChatMsg struct {
 	Time  int64  `json:"time"`
 	To    uint   `json:"to"`
 	Extra any    `json:"extra"`
+	// 非纯文本消息的结构化内容,body为服务端生成的摘要
+	Content *Content `json:"content,omitempty"`
+	// 群聊中提及的成员
+	Mentions []uint `json:"mentions,omitempty"`
+	// 表情回应的变化
+	Reaction *ReactionDelta `json:"reaction,omitempty"`
+	// 话题回复的原消息ID
+	ThreadID string `json:"thread_id,omitempty"`
+	// 定时发送的毫秒时间戳,未来的时间才有效
+	SendAt int64 `json:"send_at,omitempty"`
+	// 发送消息的设备,用于同步到发送者的其他设备
+	device string
+	// 第一次被回复时为原消息作者,用于自动订阅话题
+	threadAuthor uint
 }
 
 type AckMsg struct {
@@ -182,21 +354,238 @@ type AckMsg struct {
 	Time int64  `json:"time"`
 }
 
-func (c *Client) parseMessage(data json.RawMessage) (*ChatMsg, error) {
-	var msg *ChatMsg
-	err := json.Unmarshal(data, &msg)
-	return msg, c.handleJsonError(err, data)
+// 已读回执,客户端只需要提供已读到的消息ID
+// 转发给消息发送者时,群聊带上群组ID和已读人数
+type ReadMsg struct {
+	Type    int    `json:"type"`
+	ID      string `json:"id"`
+	From    uint   `json:"from"`
+	To      uint   `json:"to"`
+	GroupID uint   `json:"group_id,omitempty"`
+	ReadBy  int64  `json:"read_by,omitempty"`
+	Time    int64  `json:"time"`
+}
+
+// 错误消息,只发给当前连接,不缓存也不需要确认
+type ErrorMsg struct {
+	Type    int    `json:"type"`
+	ID      string `json:"id"`
+	Code    int    `json:"code"`
+	Message string `json:"message"`
 }
 
-func (c *Client) parseAckMessage(data json.RawMessage) (*AckMsg, error) {
-	var msg *AckMsg
-	err := json.Unmarshal(data, &msg)
-	return msg, c.handleJsonError(err, data)
+// 以连接的身份为准,拒绝伪造发送者,群聊消息需要发送者在群组内
+func (c *Client) verifySender(msg *ChatMsg) error {
+	if msg.From != 0 && msg.From != c.id {
+		c.service.Logger().Warn("Sender mismatch", zap.Uint("client_id", c.id), zap.Uint("from", msg.From))
+		return errorsx.ErrSenderMismatch
+	}
+	msg.From = c.id
+	msg.device = c.device
+
+	var members []uint
+	if msg.Type == Broadcast {
+		var err error
+		members, err = c.service.Cache().GetMembersAndCache(msg.To)
+		if err != nil {
+			return errorsx.ErrFailed
+		}
+		if !slices.Contains(members, c.id) {
+			return errorsx.ErrNotInGroup
+		}
+		// 接收者只能由服务端填充
+		msg.Extra = members
+	}
+	if err := c.verifyContent(msg, members); err != nil {
+		return err
+	}
+	if msg.ThreadID != "" {
+		return c.verifyThread(msg, members)
+	}
+	return nil
+}
+
+// 撤回和编辑只允许原发送者在时限内操作,消息ID为原消息ID
+// 验证通过后由服务端填充接收者,时间使用原消息时间
+func (c *Client) verifyModify(msg *ChatMsg) error {
+	origin, err := c.service.Message().Get(msg.ID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return errorsx.ErrMessageNotFound
+		}
+		c.service.Logger().Error("Failed to get message", zap.String("id", msg.ID), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	if origin.Sender != c.id {
+		return errorsx.ErrNotMessageSender
+	}
+	if origin.Recalled {
+		return errorsx.ErrMessageRecalled
+	}
+	window := c.service.Config().Common().MessageModifyWindow()
+	if time.Since(time.UnixMilli(origin.Time)) > window {
+		return errorsx.ErrModifyExpired
+	}
+	if msg.Type == Edit && msg.Body == "" {
+		return errorsx.ErrInvalidParams
+	}
+	// 加密消息编辑时替换密文
+	encrypted := isEncryptedContent(origin.Content)
+	if msg.Type == Edit && origin.Content != "" && !encrypted {
+		return errorsx.ErrCantEditContent
+	}
+	if msg.Type == Edit && len(msg.Body) > maxCiphertextLength {
+		return errorsx.ErrInvalidContent
+	}
+
+	msg.From = c.id
+	msg.device = c.device
+	msg.Time = origin.Time
+	// 撤回和编辑只修改body
+	msg.Content = nil
+	if encrypted && msg.Type == Edit {
+		msg.Content = &Content{Kind: ContentEncrypted}
+	}
+	msg.Mentions = nil
+	msg.ThreadID = origin.ThreadID
+	if msg.Type == Recall {
+		msg.Body = ""
+	}
+	if origin.GroupID != 0 {
+		members, err := c.service.Cache().GetMembersAndCache(origin.GroupID)
+		if err != nil {
+			return errorsx.ErrFailed
+		}
+		msg.To = origin.GroupID
+		msg.Extra = members
+	} else {
+		msg.To = origin.Receiver
+		msg.Extra = []uint{origin.Receiver}
+	}
+	return nil
+}
+
+// 将当前用户在消息所属会话的读游标推进到该消息,并通知消息发送者
+func (c *Client) markRead(msg *ReadMsg) error {
+	origin, err := c.service.Message().Get(msg.ID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return errorsx.ErrMessageNotFound
+		}
+		c.service.Logger().Error("Failed to get message", zap.String("id", msg.ID), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+
+	// 话题回复不影响会话的读游标
+	if origin.ThreadID != "" {
+		return nil
+	}
+
+	var peer uint
+	if origin.GroupID != 0 {
+		members, err := c.service.Cache().GetMembersAndCache(origin.GroupID)
+		if err != nil {
+			return errorsx.ErrFailed
+		}
+		if !slices.Contains(members, c.id) {
+			return errorsx.ErrNotInGroup
+		}
+	} else {
+		switch c.id {
+		case origin.Receiver:
+			peer = origin.Sender
+		case origin.Sender:
+			peer = origin.Receiver
+		default:
+			return errorsx.ErrMessageNotFound
+		}
+	}
+
+	advanced, err := c.service.Cache().SetReadCursor(c.id, peer, origin.GroupID, origin.ID)
+	if err != nil {
+		return errorsx.ErrFailed
+	}
+	// 游标没有前进或读的是自己的消息,不需要回执
+	if !advanced || origin.Sender == c.id {
+		return nil
+	}
+
+	msg.To = origin.Sender
+	msg.GroupID = origin.GroupID
+	msg.Time = time.Now().UnixMilli()
+	if origin.GroupID != 0 {
+		count, err := c.service.Cache().AddReadBy(origin.MsgID, c.id)
+		if err != nil {
+			return errorsx.ErrFailed
+		}
+		msg.ReadBy = count
+	}
+	c.service.Hub().SendToRead(msg)
+	return nil
+}
+
+func (c *Client) sendError(id string, err error) {
+	c.push(newErrorMsg(id, err))
+}
+
+func newErrorMsg(id string, err error) *ErrorMsg {
+	return &ErrorMsg{
+		Type:    Error,
+		ID:      id,
+		Code:    errorsx.GetStatusCode(err),
+		Message: err.Error(),
+	}
+}
+
+// 错误消息、已读回执、在线状态和正在输入不需要存为离线消息
+// 待确认的消息由挂起记录重发或转为离线消息
+func storable(msg any) bool {
+	switch msg.(type) {
+	case *ErrorMsg, *ReadMsg, *PresenceMsg, *TypingMsg, *pendingMsg:
+		return false
+	}
+	return true
+}
+
+func (c *Client) parseMessage(data []byte) (*ChatMsg, error) {
+	return decodeBody[ChatMsg](c, data)
+}
+
+func (c *Client) parseAckMessage(data []byte) (*AckMsg, error) {
+	return decodeBody[AckMsg](c, data)
+}
+
+func (c *Client) parseReadMessage(data []byte) (*ReadMsg, error) {
+	return decodeBody[ReadMsg](c, data)
+}
+
+func (c *Client) parseTypingMessage(data []byte) (*TypingMsg, error) {
+	return decodeBody[TypingMsg](c, data)
+}
+
+func (c *Client) parseSenderKeyMessage(data []byte) (*SenderKeyMsg, error) {
+	return decodeBody[SenderKeyMsg](c, data)
+}
+
+func (c *Client) parseReactionMessage(data []byte) (*ReactionMsg, error) {
+	return decodeBody[ReactionMsg](c, data)
+}
+
+var errEmptyBody = errors.New("empty message body")
+
+// body为null时解码结果为nil,视为解码失败
+func decodeBody[T any](c *Client, data []byte) (*T, error) {
+	var msg *T
+	err := c.codec.DecodeBody(data, &msg)
+	if err == nil && msg == nil {
+		err = errEmptyBody
+	}
+	return msg, c.handleDecodeError(err, data)
 }
 
-func (c *Client) handleJsonError(err error, data json.RawMessage) error {
+func (c *Client) handleDecodeError(err error, data []byte) error {
 	if err != nil {
-		c.service.Logger().Error("Unknow websocket message type", zap.String("message", string(data)))
+		c.service.Logger().Error("Unknow websocket message type", zap.ByteString("message", data))
 		return err
 	}
 	return nil
@@ -206,5 +595,5 @@ func (c *Client) sendCloseMessage() {
 	message := websocket.FormatCloseMessage(
 		websocket.CloseServiceRestart,
 		errorsx.ErrServerClosed.Error())
-	c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(3*time.Second))
+	c.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(c.service.Config().Common().WriteWait()))
 }
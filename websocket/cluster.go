@@ -0,0 +1,284 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/farnese17/chat/service/model"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	opMessage = "message"
+	opKick    = "kick"
+)
+
+// 集群模式下节点之间转发的数据,消息只在接收节点本地投递,不会再次转发
+type envelope struct {
+	Op      string          `json:"op"`
+	To      []uint          `json:"to"`
+	Device  string          `json:"device,omitempty"`
+	Cache   bool            `json:"cache,omitempty"`
+	Pending bool            `json:"pending,omitempty"`
+	Message json.RawMessage `json:"message,omitempty"`
+}
+
+// 开启集群模式时订阅本节点的频道并开始心跳,失败时以单机模式运行
+func (h *Hub) joinCluster() {
+	common := h.service.Config().Common()
+	if !common.Cluster() {
+		return
+	}
+	node := common.NodeID()
+	if node == "" {
+		node = uuid.NewString()
+	}
+	if strings.Contains(node, "|") {
+		h.service.Logger().Error("Invalid node id, running in standalone mode", zap.String("node", node))
+		return
+	}
+
+	unsubscribe, err := h.service.Cache().Subscribe(model.ClusterChannel+node, h.receive)
+	if err != nil {
+		h.service.Logger().Error("Failed to join cluster, running in standalone mode", zap.Error(err))
+		return
+	}
+	h.node = node
+	h.unsubscribe = unsubscribe
+	h.service.Logger().Info("Joined cluster", zap.String("node", node))
+	go h.heartbeat()
+}
+
+// 退出集群,删除本节点的路由
+func (h *Hub) leaveCluster() {
+	if h.node == "" {
+		return
+	}
+	if err := h.unsubscribe(); err != nil {
+		h.service.Logger().Error("Failed to unsubscribe cluster channel", zap.Error(err))
+	}
+	h.service.Cache().RemoveNode(h.node)
+}
+
+func (h *Hub) heartbeat() {
+	interval := h.service.Config().Common().NodeHeartbeat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	h.beat()
+	for {
+		select {
+		case <-ticker.C:
+			// 重置计时器,应用热更新
+			ticker.Reset(h.service.Config().Common().NodeHeartbeat())
+			h.beat()
+		case <-h.done:
+			return
+		}
+	}
+}
+
+func (h *Hub) beat() {
+	added, err := h.service.Cache().NodeHeartbeat(h.node)
+	if err != nil {
+		return
+	}
+	// 心跳中断过,路由可能已被其他节点清理,重新登记本节点的连接
+	if added {
+		h.restoreRoutes()
+	}
+	timeout := h.service.Config().Common().NodeTimeout()
+	removed, _ := h.service.Cache().RemoveStaleNodes(timeout)
+	for _, node := range removed {
+		h.service.Logger().Warn("Removed stale node", zap.String("node", node))
+	}
+}
+
+func (h *Hub) restoreRoutes() {
+	h.mu.RLock()
+	routes := make(map[uint][]string, len(h.clients))
+	for id, devices := range h.clients {
+		for device := range devices {
+			routes[id] = append(routes[id], device)
+		}
+	}
+	h.mu.RUnlock()
+	for id, devices := range routes {
+		for _, device := range devices {
+			h.service.Cache().AddRoute(h.node, id, device)
+		}
+	}
+}
+
+// 连接注册后登记路由,first表示该用户在本节点的第一个设备
+func (h *Hub) connected(id uint, device string, first bool) {
+	if h.node != "" {
+		// 已经在其他节点在线的用户不重复推送上线
+		if first && h.onlineRemote(id) {
+			first = false
+		}
+		h.service.Cache().AddRoute(h.node, id, device)
+	}
+	if first {
+		h.publishPresence(id, true)
+	}
+}
+
+// 连接注销后删除路由,last表示该用户在本节点已经没有其他设备
+func (h *Hub) disconnected(id uint, device string, last bool) {
+	if h.node != "" {
+		h.service.Cache().RemoveRoute(h.node, id, device, last)
+		if last && h.onlineRemote(id) {
+			last = false
+		}
+	}
+	if last {
+		h.publishPresence(id, false)
+	}
+}
+
+func (h *Hub) onlineRemote(id uint) bool {
+	return len(h.remoteNodes([]uint{id})[id]) > 0
+}
+
+// 用户在其他节点上的设备
+func (h *Hub) remoteRoutes(ids []uint) map[uint][]model.Route {
+	if h.node == "" || len(ids) == 0 {
+		return nil
+	}
+	routes, err := h.service.Cache().GetRoutes(ids...)
+	if err != nil {
+		return nil
+	}
+	for id, r := range routes {
+		routes[id] = slices.DeleteFunc(r, func(route model.Route) bool {
+			return route.Node == h.node
+		})
+	}
+	return routes
+}
+
+// 用户所在的其他节点
+func (h *Hub) remoteNodes(ids []uint) map[uint][]string {
+	routes := h.remoteRoutes(ids)
+	nodes := make(map[uint][]string, len(routes))
+	for id, r := range routes {
+		for _, route := range r {
+			if !slices.Contains(nodes[id], route.Node) {
+				nodes[id] = append(nodes[id], route.Node)
+			}
+		}
+	}
+	return nodes
+}
+
+// 将消息转发给其他节点,返回没有节点接收的用户
+func (h *Hub) forward(ctx *MessageContext, nodes map[string][]uint) map[uint]bool {
+	failed := make(map[uint]bool)
+	if len(nodes) == 0 {
+		return failed
+	}
+	data, err := json.Marshal(ctx.Message)
+	if err != nil {
+		h.service.Logger().Error("Failed to marshal forward message", zap.Error(err))
+		for _, ids := range nodes {
+			for _, id := range ids {
+				failed[id] = true
+			}
+		}
+		return failed
+	}
+	for node, ids := range nodes {
+		env := &envelope{Op: opMessage, To: ids, Cache: ctx.Cache, Pending: ctx.Pending, Message: data}
+		if !h.publish(node, env) {
+			for _, id := range ids {
+				failed[id] = true
+			}
+		}
+	}
+	return failed
+}
+
+func (h *Hub) publish(node string, env *envelope) bool {
+	payload, _ := json.Marshal(env)
+	n, err := h.service.Cache().Publish(model.ClusterChannel+node, payload)
+	if err != nil {
+		return false
+	}
+	if n == 0 {
+		h.service.Logger().Warn("No subscriber on node", zap.String("node", node))
+		return false
+	}
+	return true
+}
+
+// 断开用户在其他节点上的连接,device为空时断开所有设备
+func (h *Hub) kickRemote(id uint, device string) {
+	nodes := []string{}
+	for _, route := range h.remoteRoutes([]uint{id})[id] {
+		if (device == "" || route.Device == device) && !slices.Contains(nodes, route.Node) {
+			nodes = append(nodes, route.Node)
+		}
+	}
+	for _, node := range nodes {
+		h.publish(node, &envelope{Op: opKick, To: []uint{id}, Device: device})
+	}
+}
+
+// 处理其他节点转发来的数据
+func (h *Hub) receive(payload string) {
+	var env envelope
+	if err := json.Unmarshal([]byte(payload), &env); err != nil || len(env.To) == 0 {
+		h.service.Logger().Error("Invalid cluster message", zap.String("payload", payload))
+		return
+	}
+
+	switch env.Op {
+	case opKick:
+		h.kickLocal(env.To[0], env.Device)
+	case opMessage:
+		msg, err := decodeMessage(env.Message)
+		if err != nil {
+			h.service.Logger().Error("Invalid cluster message", zap.String("payload", payload), zap.Error(err))
+			return
+		}
+		ctx := &MessageContext{Message: msg, To: env.To, Cache: env.Cache, Pending: env.Pending}
+		for _, id := range env.To {
+			// 转发期间用户已经离开本节点
+			if !h.deliver(ctx, id) && env.Cache {
+				h.StoreOfflineMessage(msg, id)
+			}
+		}
+	}
+}
+
+func decodeMessage(data json.RawMessage) (any, error) {
+	var header struct {
+		Type int `json:"type"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, err
+	}
+	var msg any
+	switch header.Type {
+	case Ack:
+		msg = &AckMsg{}
+	case Error:
+		msg = &ErrorMsg{}
+	case Read:
+		msg = &ReadMsg{}
+	case Presence:
+		msg = &PresenceMsg{}
+	case Typing:
+		msg = &TypingMsg{}
+	case 0:
+		return nil, errors.New("unknown message type")
+	default:
+		msg = &ChatMsg{}
+	}
+	err := json.Unmarshal(data, msg)
+	return msg, err
+}
@@ -0,0 +1,98 @@
+package websocket
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// 客户端通过Sec-WebSocket-Protocol选择编码,未指定时使用json
+const (
+	ProtocolJSON    = "chat.v1.json"
+	ProtocolMsgpack = "chat.v1.msgpack"
+)
+
+// 外层为{type, body},先解码外层,再根据type解码body
+// 两种编码的字段名相同,都取自json标签
+type Codec interface {
+	Protocol() string
+	// websocket帧类型
+	FrameType() int
+	Encode(msgType int, body any) ([]byte, error)
+	Decode(data []byte) (msgType int, body []byte, err error)
+	DecodeBody(body []byte, v any) error
+}
+
+// 返回子协议对应的编码,不支持时返回json
+func CodecFor(protocol string) Codec {
+	if protocol == ProtocolMsgpack {
+		return msgpackCodec{}
+	}
+	return jsonCodec{}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Protocol() string { return ProtocolJSON }
+
+func (jsonCodec) FrameType() int { return websocket.TextMessage }
+
+func (jsonCodec) Encode(msgType int, body any) ([]byte, error) {
+	return json.Marshal(struct {
+		Type int `json:"type"`
+		Body any `json:"body"`
+	}{msgType, body})
+}
+
+func (jsonCodec) Decode(data []byte) (int, []byte, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return 0, nil, err
+	}
+	return msg.Type, msg.Body, nil
+}
+
+func (jsonCodec) DecodeBody(body []byte, v any) error {
+	return json.Unmarshal(body, v)
+}
+
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	// 区分字符串和二进制
+	h.WriteExt = true
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]any(nil))
+	return h
+}()
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Protocol() string { return ProtocolMsgpack }
+
+func (msgpackCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Encode(msgType int, body any) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, msgpackHandle).Encode(struct {
+		Type int `codec:"type"`
+		Body any `codec:"body"`
+	}{msgType, body})
+	return data, err
+}
+
+func (msgpackCodec) Decode(data []byte) (int, []byte, error) {
+	var msg struct {
+		Type int       `codec:"type"`
+		Body codec.Raw `codec:"body"`
+	}
+	if err := codec.NewDecoderBytes(data, msgpackHandle).Decode(&msg); err != nil {
+		return 0, nil, err
+	}
+	return msg.Type, msg.Body, nil
+}
+
+func (msgpackCodec) DecodeBody(body []byte, v any) error {
+	return codec.NewDecoderBytes(body, msgpackHandle).Decode(v)
+}
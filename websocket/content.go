@@ -0,0 +1,236 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/farnese17/chat/pkg/storage"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/farnese17/chat/utils/validator"
+	"go.uber.org/zap"
+)
+
+const (
+	ContentText     = "text"
+	ContentImage    = "image"
+	ContentFile     = "file"
+	ContentVoice    = "voice"
+	ContentLocation = "location"
+	ContentQuote    = "quote"
+	// 端到端加密消息,body为客户端加密后的密文,服务端不检查也不修改
+	ContentEncrypted = "encrypted"
+)
+
+// 密文的最大长度,与消息表body字段的长度一致
+const maxCiphertextLength = 65535
+
+// 结构化消息内容,kind决定需要的字段
+// 图片、文件和语音的file_id为上传文件返回的公开ID,会话中的用户因此可以下载该文件
+type Content struct {
+	Kind      string  `json:"kind" validate:"required,oneof=text image file voice location quote encrypted" label:"消息类型"`
+	Text      string  `json:"text,omitempty" validate:"max=4096" label:"消息内容"`
+	FileID    string  `json:"file_id,omitempty" validate:"max=64" label:"文件ID"`
+	Name      string  `json:"name,omitempty" validate:"max=255" label:"文件名"`
+	Size      int64   `json:"size,omitempty" validate:"min=0" label:"文件大小"`
+	Duration  int     `json:"duration,omitempty" validate:"min=0,max=600" label:"语音时长"`
+	Latitude  float64 `json:"latitude,omitempty" validate:"min=-90,max=90" label:"纬度"`
+	Longitude float64 `json:"longitude,omitempty" validate:"min=-180,max=180" label:"经度"`
+	Address   string  `json:"address,omitempty" validate:"max=255" label:"地址"`
+	ParentID  string  `json:"parent_id,omitempty" validate:"max=64" label:"引用消息ID"`
+}
+
+// 字段范围由标签检查,这里检查各类型必填的字段
+func (content *Content) validate() error {
+	if err := validator.Validate(content); err != nil {
+		return err
+	}
+	var ok bool
+	switch content.Kind {
+	case ContentText:
+		ok = content.Text != ""
+	case ContentImage:
+		ok = content.FileID != ""
+	case ContentFile:
+		ok = content.FileID != "" && content.Name != ""
+	case ContentVoice:
+		ok = content.FileID != "" && content.Duration > 0
+	case ContentLocation:
+		ok = true
+	case ContentQuote:
+		ok = content.Text != "" && content.ParentID != ""
+	}
+	if !ok {
+		return errors.New("缺少" + content.Kind + "消息的必填字段")
+	}
+	return nil
+}
+
+// 摘要作为消息的body,用于不支持结构化内容的客户端、通知和搜索
+func (content *Content) summary() string {
+	switch content.Kind {
+	case ContentImage:
+		return "[图片]"
+	case ContentFile:
+		return "[文件] " + content.Name
+	case ContentVoice:
+		return "[语音]"
+	case ContentLocation:
+		return strings.TrimSpace("[位置] " + content.Address)
+	default:
+		return content.Text
+	}
+}
+
+// 检查结构化内容和提及,纯文本内容转为普通消息,其他类型由服务端生成body
+// 加密消息原样转发body,只检查长度,提及只在群聊中有效,且必须是群组成员,members为群组成员
+func (c *Client) verifyContent(msg *ChatMsg, members []uint) error {
+	if msg.encrypted() {
+		if msg.Body == "" || len(msg.Body) > maxCiphertextLength || len(msg.Content.FileID) > 64 {
+			return errorsx.ErrInvalidContent
+		}
+		// 其他字段可能包含明文,只保留类型和加密后上传的附件ID
+		msg.Content = &Content{Kind: ContentEncrypted, FileID: msg.Content.FileID}
+	} else if msg.Content != nil {
+		if err := msg.Content.validate(); err != nil {
+			c.service.Logger().Warn("Invalid message content", zap.Uint("from", c.id), zap.Error(err))
+			return errorsx.ErrInvalidContent
+		}
+		if msg.Content.Kind == ContentQuote {
+			if err := c.verifyQuote(msg); err != nil {
+				return err
+			}
+		}
+		msg.Body = msg.Content.summary()
+		if msg.Content.Kind == ContentText {
+			msg.Content = nil
+		}
+	}
+	if msg.Content != nil && msg.Content.FileID != "" {
+		if err := c.verifyFile(msg.Content.FileID); err != nil {
+			return err
+		}
+	}
+
+	if msg.Type != Broadcast {
+		msg.Mentions = nil
+		return nil
+	}
+	if err := validator.ValidateMentions(msg.Mentions); err != nil {
+		c.service.Logger().Warn("Invalid mentions", zap.Uint("from", c.id), zap.Error(err))
+		return errorsx.ErrInvalidParams
+	}
+	msg.Mentions = slices.DeleteFunc(msg.Mentions, func(id uint) bool {
+		return id == c.id
+	})
+	for _, id := range msg.Mentions {
+		if !slices.Contains(members, id) {
+			return errorsx.ErrMentionNotMember
+		}
+	}
+	if len(msg.Mentions) == 0 {
+		msg.Mentions = nil
+	}
+	return nil
+}
+
+func (msg *ChatMsg) encrypted() bool {
+	return msg.Content != nil && msg.Content.Kind == ContentEncrypted
+}
+
+// content为持久化的结构化内容
+func isEncryptedContent(content string) bool {
+	if content == "" {
+		return false
+	}
+	var c Content
+	return json.Unmarshal([]byte(content), &c) == nil && c.Kind == ContentEncrypted
+}
+
+// 只能引用同一会话中未撤回的消息
+func (c *Client) verifyQuote(msg *ChatMsg) error {
+	parent, err := c.service.Message().Get(msg.Content.ParentID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return errorsx.ErrMessageNotFound
+		}
+		c.service.Logger().Error("Failed to get message", zap.String("id", msg.Content.ParentID), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	if msg.Type == Broadcast {
+		if parent.GroupID != msg.To {
+			return errorsx.ErrMessageNotFound
+		}
+	} else if parent.GroupID != 0 ||
+		!(parent.Sender == c.id && parent.Receiver == msg.To ||
+			parent.Sender == msg.To && parent.Receiver == c.id) {
+		return errorsx.ErrMessageNotFound
+	}
+	if parent.Recalled {
+		return errorsx.ErrMessageRecalled
+	}
+	return nil
+}
+
+// 只能发送自己上传的文件,或者已经发送到自己所在会话中的文件
+func (c *Client) verifyFile(id string) error {
+	_, err := c.service.Storage().Download(id, &storage.Access{
+		UserID:    c.id,
+		Permitted: c.service.Message().FileShared,
+	})
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrPermissiondenied):
+		c.service.Logger().Warn("File not permitted", zap.Uint("from", c.id), zap.String("file", id))
+		return errorsx.ErrPermissiondenied
+	default:
+		c.service.Logger().Error("Failed to get file", zap.Uint("from", c.id), zap.String("file", id), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+}
+
+type mentionMiddleware struct {
+	hub *Hub
+}
+
+// 消息投递后通知被提及的群组成员,不受免打扰影响,需在StoreMiddleware之后注册
+func MentionMiddleware(hub *Hub) MessageMiddleware {
+	return &mentionMiddleware{hub}
+}
+
+func (m *mentionMiddleware) Process(ctx *MessageContext, next func(ctx *MessageContext)) {
+	msg, ok := ctx.Message.(*ChatMsg)
+	if !ok {
+		return
+	}
+
+	// 先取出提及的成员,投递会修改ctx
+	var to []uint
+	if msg.Type == Broadcast {
+		for _, id := range msg.Mentions {
+			if slices.Contains(ctx.To, id) {
+				to = append(to, id)
+			}
+		}
+	}
+	next(ctx)
+
+	if len(to) == 0 {
+		return
+	}
+	mention := &ChatMsg{
+		ID:   msg.ID,
+		Type: Mention,
+		From: msg.From,
+		To:   msg.To,
+		Body: msg.Body,
+		Time: msg.Time,
+	}
+	// 客户端根据类型判断body是否需要解密
+	if msg.encrypted() {
+		mention.Content = msg.Content
+	}
+	m.hub.sendDirect(&MessageContext{Message: mention, To: to, Cache: true})
+}
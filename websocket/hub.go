@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/farnese17/chat/config"
+	"github.com/farnese17/chat/pkg/storage"
 	repo "github.com/farnese17/chat/repository"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -16,6 +17,9 @@ type Service interface {
 	Logger() *zap.Logger
 	Config() config.Config
 	Cache() repo.Cache
+	Message() repo.MessageRepository
+	Friend() repo.FriendRepository
+	Storage() storage.Storage
 	Hub() HubInterface
 	SetHub(hub HubInterface)
 }
@@ -28,19 +32,29 @@ type HubInterface interface {
 	SendToChat(message *ChatMsg)
 	SendToBroadcast(message *ChatMsg)
 	SendToAck(message *AckMsg)
+	SendToModify(message *ChatMsg)
+	SendToRead(message *ReadMsg)
+	SendToTyping(message *TypingMsg)
 	SendToApply(message *ChatMsg)
 	SendUpdateBlockedListNotify(message *ChatMsg)
 	StoreOfflineMessage(message any, id uint)
 	Count() int
 	IsClosed() bool
 	Kick(id uint)
+	KickDevice(id uint, device string)
+	Online(id uint) bool
+	Devices(id uint) []string
 	Uptime() time.Duration
+	Stats() map[string]any
+	React(uid uint, msgID, emoji string, add bool) (int64, error)
+	SendToSenderKey(from uint, message *SenderKeyMsg) error
 }
 
 func NewHubInterface(service Service) HubInterface {
 	return NewHub(service)
 }
 
+// Err为消息被中间件拦截的原因
 type MessageContext struct {
 	Message any
 	To      []uint
@@ -48,29 +62,33 @@ type MessageContext struct {
 	Pending bool
 	Sent    bool
 	Extra   map[string]any
+	Err     error
 }
 
+// 同一用户可以有多个设备同时在线
 type Hub struct {
-	clients     map[uint]*Client
+	clients     map[uint]map[string]*Client
 	register    chan *Client
 	unregister  chan *Client
-	chat        chan *ChatMsg
-	broadcast   chan *ChatMsg
 	done        chan struct{}
 	closed      atomic.Bool
 	mu          sync.RWMutex
 	service     Service
 	middlewares []MessageMiddleware
 	runningAt   time.Time
+	// 集群模式下的节点ID,为空表示单机模式
+	node        string
+	unsubscribe func() error
+	// 发送队列已满时丢弃的消息数和断开的连接数
+	droppedMessages atomic.Int64
+	slowDisconnects atomic.Int64
 }
 
 func NewHub(service Service) *Hub {
 	hub := &Hub{
-		clients:     make(map[uint]*Client),
+		clients:     make(map[uint]map[string]*Client),
 		register:    make(chan *Client),
 		unregister:  make(chan *Client),
-		chat:        make(chan *ChatMsg),
-		broadcast:   make(chan *ChatMsg),
 		done:        make(chan struct{}),
 		closed:      atomic.Bool{},
 		mu:          sync.RWMutex{},
@@ -79,9 +97,18 @@ func NewHub(service Service) *Hub {
 		runningAt:   time.Now(),
 	}
 	hub.Use(Filter(hub))
+	hub.Use(FriendshipMiddleware(hub))
+	hub.Use(GroupMuteMiddleware(hub))
+	hub.Use(ModifyMiddleware(hub))
 	hub.Use(AckMiddleware(hub))
+	hub.Use(SyncMiddleware(hub))
+	hub.Use(StoreMiddleware(hub))
+	hub.Use(MentionMiddleware(hub))
+	hub.joinCluster()
 	go hub.Run()
 	go hub.resendPendingMessages()
+	go hub.releaseScheduledMessages()
+	go hub.purgeExpiredMessages()
 	return hub
 }
 
@@ -95,9 +122,21 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.register:
 			h.mu.Lock()
-			h.clients[client.id] = client
+			devices, online := h.clients[client.id]
+			if !online {
+				devices = make(map[string]*Client)
+				h.clients[client.id] = devices
+			}
+			old := devices[client.device]
+			devices[client.device] = client
 			h.mu.Unlock()
-			h.service.Logger().Info("User connected to websocket", zap.Uint("id", client.id))
+			// 同一设备重复连接时关闭旧连接,旧连接注销时不会影响新连接
+			if old != nil && old.conn != nil {
+				old.conn.Close()
+			}
+			h.service.Logger().Info("User connected to websocket",
+				zap.Uint("id", client.id), zap.String("device", client.device))
+			go h.connected(client.id, client.device, !online)
 			go func(id uint) {
 				messages, err := h.service.Cache().GetOfflineMessages(id)
 				if err != nil {
@@ -110,6 +149,12 @@ func (h *Hub) Run() {
 						continue
 					}
 					ctx := &MessageContext{Message: msg, Pending: true, To: []uint{id}}
+					// 退回的错误消息不需要确认
+					if msg.Type == Error {
+						errMsg := &ErrorMsg{}
+						json.Unmarshal([]byte(message), errMsg)
+						ctx = &MessageContext{Message: errMsg, To: []uint{id}}
+					}
 					if h.sendDirect(ctx) {
 						h.service.Cache().RemoveOfflineMessage(id, message)
 					}
@@ -117,24 +162,22 @@ func (h *Hub) Run() {
 			}(client.id)
 		case client := <-h.unregister:
 			h.mu.Lock()
-			delete(h.clients, client.id)
+			devices := h.clients[client.id]
+			current := devices[client.device] == client
+			if current {
+				delete(devices, client.device)
+				if len(devices) == 0 {
+					delete(h.clients, client.id)
+				}
+			}
 			h.mu.Unlock()
-		case message := <-h.chat:
-			ctx := &MessageContext{Message: message, Cache: true, Pending: true, To: []uint{message.To}}
-			h.Send(ctx)
-		case message := <-h.broadcast:
-			uid, ok := message.Extra.([]uint)
-			if !ok {
-				continue
+			// 所有设备都断开后才视为下线
+			if current {
+				go h.disconnected(client.id, client.device, len(devices) == 0)
 			}
-			message.Extra = nil
-			ctx := &MessageContext{Message: message, Cache: true, Pending: true, To: uid}
-			h.Send(ctx)
 		case <-h.done:
 			close(h.register)
 			close(h.unregister)
-			close(h.chat)
-			close(h.broadcast)
 			h.service.Logger().Info("Hub Stoped...")
 			return
 		}
@@ -144,9 +187,10 @@ func (h *Hub) Run() {
 func (h *Hub) Stop() {
 	h.closed.Store(true)
 	h.mu.Lock()
-	for _, c := range h.clients {
-		c.closed = true
-		c.send <- CloseSignal{}
+	for _, devices := range h.clients {
+		for _, c := range devices {
+			c.close()
+		}
 	}
 	h.mu.Unlock()
 
@@ -159,17 +203,36 @@ func (h *Hub) Stop() {
 		h.mu.RUnlock()
 		time.Sleep(time.Millisecond * 50)
 	}
+	h.leaveCluster()
 	close(h.done)
 }
+
+// 断开用户所有设备的连接
 func (h *Hub) Kick(id uint) {
+	h.kickLocal(id, "")
+	h.kickRemote(id, "")
+}
+
+// 断开用户指定设备的连接
+func (h *Hub) KickDevice(id uint, device string) {
+	if !h.kickLocal(id, device) {
+		h.kickRemote(id, device)
+	}
+}
+
+// device为空时断开所有设备,返回值表示是否找到连接
+func (h *Hub) kickLocal(id uint, device string) bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	c := h.clients[id]
-	if c == nil {
-		return
+	found := false
+	for d, c := range h.clients[id] {
+		if device != "" && d != device {
+			continue
+		}
+		c.close()
+		found = true
 	}
-	c.closed = true
-	c.send <- CloseSignal{}
+	return found
 }
 
 func (h *Hub) IsClosed() bool {
@@ -194,8 +257,11 @@ func (h *Hub) Unregister(c *Client) {
 	h.unregister <- c
 }
 
+// 消息在调用者的goroutine中经过中间件处理,持久化和权限检查不阻塞Run
+// 客户端的消息在各自的读取goroutine中顺序处理,保持同一连接的消息顺序
 func (h *Hub) SendToChat(message *ChatMsg) {
-	h.chat <- message
+	ctx := &MessageContext{Message: message, Cache: true, Pending: true, To: []uint{message.To}}
+	h.Send(ctx)
 }
 
 func (h *Hub) SendToBroadcast(message *ChatMsg) {
@@ -206,14 +272,35 @@ func (h *Hub) SendToBroadcast(message *ChatMsg) {
 		}
 		message.Extra = uid
 	}
-
-	h.broadcast <- message
+	h.sendToMembers(message, true)
 }
 
 func (h *Hub) SendToAck(message *AckMsg) {
 	h.service.Cache().RemovePendingMessage(message.ID, message.To, message.Time)
 }
 
+// 撤回和编辑通知不需要确认,离线时缓存
+func (h *Hub) SendToModify(message *ChatMsg) {
+	h.sendToMembers(message, false)
+}
+
+// 接收者由Extra传入
+func (h *Hub) sendToMembers(message *ChatMsg, pending bool) {
+	uid, ok := message.Extra.([]uint)
+	if !ok {
+		return
+	}
+	message.Extra = nil
+	ctx := &MessageContext{Message: message, Cache: true, Pending: pending, To: uid}
+	h.Send(ctx)
+}
+
+// 已读回执只投递给在线的发送者,不缓存也不需要确认
+func (h *Hub) SendToRead(message *ReadMsg) {
+	ctx := &MessageContext{Message: message, To: []uint{message.To}}
+	h.sendDirect(ctx)
+}
+
 func (h *Hub) SendUpdateBlockedListNotify(message *ChatMsg) {
 	ctx := &MessageContext{Message: message, Pending: true, To: []uint{message.To}}
 	h.Send(ctx)
@@ -225,55 +312,94 @@ func (h *Hub) SendToApply(message *ChatMsg) {
 		return
 	}
 	message.Extra = uid
-	h.broadcast <- message
+	h.sendToMembers(message, true)
 }
 
 // 返回值只对单发有效
 func (h *Hub) sendDirect(ctx *MessageContext) bool {
+	delivered := make(map[uint]bool, len(ctx.To))
+	forward := make(map[string][]uint)
+	remote := h.remoteNodes(ctx.To)
 	for _, id := range ctx.To {
-		h.mu.RLock()
-		c, ok := h.clients[id]
-		if ok && c.conn != nil {
-			// 群发下值复制避免后续迭代影响消息
-			var msgCopy any
-			if msg, ok := ctx.Message.(*ChatMsg); ok && msg.Type == Broadcast {
-				msgCopy = &ChatMsg{
-					ID:    msg.ID,
-					Type:  msg.Type,
-					From:  msg.From,
-					To:    id,
-					Body:  msg.Body,
-					Time:  msg.Time,
-					Extra: msg.To,
-				}
-			} else {
-				// 单发不受影响
-				msgCopy = ctx.Message
-			}
-			c.send <- msgCopy
-			h.mu.RUnlock()
+		delivered[id] = h.deliver(ctx, id)
+		for _, node := range remote[id] {
+			forward[node] = append(forward[node], id)
+		}
+	}
+	// 集群模式下转发给用户所在的其他节点,由对方节点挂起或缓存消息
+	failed := h.forward(ctx, forward)
+
+	for _, id := range ctx.To {
+		if delivered[id] || (len(remote[id]) > 0 && !failed[id]) {
 			/* 挂起消息
 			第一次发送必定会标为true
 			重发不会进入这个条件,只会缓存成离线消息后或者收到ack消息再删除挂起消息 */
 			if ctx.Pending {
-				// 统一使用指针
-				if msg, ok := msgCopy.(*ChatMsg); ok {
-					h.service.Cache().StorePendingMessage(msgCopy, msg.Time)
-				}
 				ctx.Sent = true
 			}
-			// 缓存成离线消息，视为发送成功
-		} else if ctx.Cache {
-			h.mu.RUnlock()
+			continue
+		}
+		// 缓存成离线消息，视为发送成功
+		if ctx.Cache {
 			h.StoreOfflineMessage(ctx.Message, id)
-			ctx.Sent = true
-		} else { // 应视为用户离线
-			ctx.Sent = true
 		}
+		// 否则应视为用户离线
+		ctx.Sent = true
 	}
 	return ctx.Sent
 }
 
+// 投递给连接在本节点的用户的所有设备,用户不在本节点时返回false
+func (h *Hub) deliver(ctx *MessageContext, id uint) bool {
+	h.mu.RLock()
+	devices := h.clients[id]
+	if len(devices) == 0 {
+		h.mu.RUnlock()
+		return false
+	}
+	// 群发下值复制避免后续迭代影响消息
+	var msgCopy any
+	if msg, ok := ctx.Message.(*ChatMsg); ok && (msg.Type == Broadcast || isReaction(msg.Type)) {
+		msgCopy = &ChatMsg{
+			ID:       msg.ID,
+			Type:     msg.Type,
+			From:     msg.From,
+			To:       id,
+			Body:     msg.Body,
+			Time:     msg.Time,
+			Extra:    msg.To,
+			Content:  msg.Content,
+			Mentions: msg.Mentions,
+			Reaction: msg.Reaction,
+			ThreadID: msg.ThreadID,
+		}
+	} else {
+		// 单发不受影响
+		msgCopy = ctx.Message
+	}
+	// 待确认的消息被丢弃时由挂起记录重发,避免同时转为离线消息导致重复投递
+	item := msgCopy
+	msg, pending := msgCopy.(*ChatMsg)
+	pending = pending && ctx.Pending
+	if pending {
+		item = &pendingMsg{msg: msgCopy}
+	}
+	var dropped []any
+	for _, c := range devices {
+		if c.conn != nil {
+			dropped = append(dropped, h.push(c, item)...)
+		}
+	}
+	h.mu.RUnlock()
+
+	if pending {
+		// 统一使用指针
+		h.service.Cache().StorePendingMessage(msgCopy, msg.Time)
+	}
+	h.storeDropped(id, dropped)
+	return true
+}
+
 // 返回值只对单发有效
 func (h *Hub) Send(ctx *MessageContext) bool {
 	finalHandler := func(ctx *MessageContext) {
@@ -292,6 +418,18 @@ func (h *Hub) Send(ctx *MessageContext) bool {
 	return ctx.Sent
 }
 
+// 将错误消息退回给发送者,离线则丢弃
+func (h *Hub) sendError(to uint, id string, err error) {
+	ctx := &MessageContext{Message: newErrorMsg(id, err), To: []uint{to}}
+	h.sendDirect(ctx)
+}
+
+// 将错误消息退回给发送者,离线则缓存为离线消息
+func (h *Hub) sendOfflineError(to uint, id string, err error) {
+	ctx := &MessageContext{Message: newErrorMsg(id, err), Cache: true, To: []uint{to}}
+	h.sendDirect(ctx)
+}
+
 func (h *Hub) StoreOfflineMessage(message any, id uint) {
 	h.service.Cache().StoreOfflineMessage(id, message)
 }
@@ -328,7 +466,8 @@ func (m *ackMiddleware) Process(ctx *MessageContext, next func(ctx *MessageConte
 	}
 
 	next(ctx)
-	if msg.Type != Chat && msg.Type != Broadcast { // 服务器生成的消息不需要确认
+	if msg.Type != Chat && msg.Type != Broadcast &&
+		msg.Type != Recall && msg.Type != Edit { // 服务器生成的消息不需要确认
 		return
 	}
 
@@ -371,7 +510,7 @@ func (h *Hub) resendPendingMessages() {
 				}
 				var err error
 				switch t.Type {
-				case Chat, System:
+				case Chat, System, ReactionAdd, ReactionRemove, SenderKey:
 					var m *ChatMsg
 					err = json.Unmarshal([]byte(msg), &m)
 					if err == nil {
@@ -0,0 +1,285 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"go.uber.org/zap"
+)
+
+type storeMiddleware struct {
+	hub *Hub
+}
+
+// 持久化用户发出的聊天消息,需在AckMiddleware之后注册以获得消息ID和时间
+func StoreMiddleware(hub *Hub) MessageMiddleware {
+	return &storeMiddleware{hub}
+}
+
+func (m *storeMiddleware) Process(ctx *MessageContext, next func(ctx *MessageContext)) {
+	msg, ok := ctx.Message.(*ChatMsg)
+	if !ok {
+		return
+	}
+
+	if msg.Type == Chat || msg.Type == Broadcast {
+		// 存储失败不影响投递
+		if err := m.hub.service.Message().Create(toModelMessage(msg)); err != nil {
+			m.hub.service.Logger().Error("Failed to store message",
+				zap.String("id", msg.ID), zap.Uint("from", msg.From), zap.Error(err))
+		} else if msg.ThreadID != "" {
+			m.hub.storeThreadReply(msg)
+		}
+	}
+	next(ctx)
+}
+
+func toModelMessage(msg *ChatMsg) *model.Message {
+	message := &model.Message{
+		MsgID:    msg.ID,
+		Type:     msg.Type,
+		Sender:   msg.From,
+		Body:     msg.Body,
+		Time:     msg.Time,
+		ThreadID: msg.ThreadID,
+	}
+	if msg.Type == Broadcast {
+		message.GroupID = msg.To
+	} else {
+		message.Receiver = msg.To
+	}
+	if msg.Extra != nil {
+		if extra, err := json.Marshal(msg.Extra); err == nil {
+			message.Extra = string(extra)
+		}
+	}
+	if msg.Content != nil {
+		if content, err := json.Marshal(msg.Content); err == nil {
+			message.Content = string(content)
+		}
+		message.FileID = msg.Content.FileID
+	}
+	if len(msg.Mentions) > 0 {
+		if mentions, err := json.Marshal(msg.Mentions); err == nil {
+			message.Mentions = string(mentions)
+		}
+	}
+	return message
+}
+
+type friendshipMiddleware struct {
+	hub *Hub
+}
+
+// 根据好友状态拦截单聊消息,被拒绝的消息会退回错误消息给发送者
+func FriendshipMiddleware(hub *Hub) MessageMiddleware {
+	return &friendshipMiddleware{hub}
+}
+
+func (m *friendshipMiddleware) Process(ctx *MessageContext, next func(ctx *MessageContext)) {
+	msg, ok := ctx.Message.(*ChatMsg)
+	if !ok {
+		return
+	}
+
+	if msg.Type == Chat && msg.From != msg.To {
+		if err := m.hub.friendshipPermitted(msg.From, msg.To); err != nil {
+			ctx.Err = err
+			m.hub.sendError(msg.From, msg.ID, err)
+			return
+		}
+	}
+	next(ctx)
+}
+
+// 检查好友状态是否允许from向to发送单聊消息
+func (h *Hub) friendshipPermitted(from, to uint) error {
+	status, err := h.service.Cache().GetFriendStatus(from, to)
+	if err != nil {
+		h.service.Logger().Error("Failed to get friend status",
+			zap.Uint("from", from), zap.Uint("to", to), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+
+	smaller := from < to
+	switch status {
+	case model.FSAdded:
+		return nil
+	case model.FSBothBlocked:
+		return errorsx.ErrAlreadyBlock
+	case model.FSBlock1To2, model.FSBlock2To1:
+		if (smaller && status == model.FSBlock1To2) ||
+			(!smaller && status == model.FSBlock2To1) {
+			return errorsx.ErrAlreadyBlock
+		}
+		return errorsx.ErrBlocked
+	default: // 陌生人或好友请求中
+		if h.service.Config().Common().AllowStrangerMessage() {
+			return nil
+		}
+		return errorsx.ErrNotFriend
+	}
+}
+
+type syncMiddleware struct {
+	hub *Hub
+}
+
+// 将用户发出的消息同步到发送者的其他在线设备,接收者包含发送者时(群聊)已经投递过
+func SyncMiddleware(hub *Hub) MessageMiddleware {
+	return &syncMiddleware{hub}
+}
+
+func (m *syncMiddleware) Process(ctx *MessageContext, next func(ctx *MessageContext)) {
+	msg, ok := ctx.Message.(*ChatMsg)
+	if !ok {
+		return
+	}
+
+	next(ctx)
+	if msg.device != "" && !slices.Contains(ctx.To, msg.From) {
+		m.hub.syncDevices(msg)
+	}
+}
+
+func (h *Hub) syncDevices(msg *ChatMsg) {
+	var dropped []any
+	h.mu.RLock()
+	for device, c := range h.clients[msg.From] {
+		if device != msg.device && c.conn != nil {
+			dropped = append(dropped, h.push(c, msg)...)
+		}
+	}
+	h.mu.RUnlock()
+	h.storeDropped(msg.From, dropped)
+
+	// 其他节点上的设备都不是发送消息的设备
+	forward := make(map[string][]uint)
+	for _, node := range h.remoteNodes([]uint{msg.From})[msg.From] {
+		forward[node] = []uint{msg.From}
+	}
+	h.forward(&MessageContext{Message: msg}, forward)
+}
+
+type groupMuteMiddleware struct {
+	hub *Hub
+}
+
+// 拦截被禁言成员的群聊消息,全员禁言时群主和管理员不受限制
+func GroupMuteMiddleware(hub *Hub) MessageMiddleware {
+	return &groupMuteMiddleware{hub}
+}
+
+func (m *groupMuteMiddleware) Process(ctx *MessageContext, next func(ctx *MessageContext)) {
+	msg, ok := ctx.Message.(*ChatMsg)
+	if !ok {
+		return
+	}
+
+	if msg.Type == Broadcast {
+		if err := m.hub.mutePermitted(msg.To, msg.From); err != nil {
+			ctx.Err = err
+			m.hub.sendError(msg.From, msg.ID, err)
+			return
+		}
+	}
+	next(ctx)
+}
+
+// 检查禁言状态是否允许uid在群组gid中发言
+func (h *Hub) mutePermitted(gid, uid uint) error {
+	info, err := h.service.Cache().GetGroupMute(gid)
+	if err != nil {
+		h.service.Logger().Error("Failed to get group mute",
+			zap.Uint("gid", gid), zap.Uint("uid", uid), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+
+	if info.Members[uid] > time.Now().Unix() {
+		return errorsx.ErrMemberMuted
+	}
+	if !info.MuteAll {
+		return nil
+	}
+	admins, err := h.service.Cache().GetAdmin(gid)
+	if err != nil {
+		return errorsx.ErrFailed
+	}
+	if slices.Contains(admins, uid) {
+		return nil
+	}
+	return errorsx.ErrGroupMuted
+}
+
+type modifyMiddleware struct {
+	hub *Hub
+}
+
+// 处理撤回和编辑:更新持久化的消息,并同步接收者的离线消息和待确认消息
+func ModifyMiddleware(hub *Hub) MessageMiddleware {
+	return &modifyMiddleware{hub}
+}
+
+func (m *modifyMiddleware) Process(ctx *MessageContext, next func(ctx *MessageContext)) {
+	msg, ok := ctx.Message.(*ChatMsg)
+	if !ok {
+		return
+	}
+
+	if msg.Type == Recall || msg.Type == Edit {
+		if err := m.persist(msg); err != nil {
+			ctx.Err = err
+			m.hub.sendError(msg.From, msg.ID, err)
+			return
+		}
+		for _, id := range ctx.To {
+			m.updateCopies(msg, id)
+		}
+	}
+	next(ctx)
+}
+
+func (m *modifyMiddleware) persist(msg *ChatMsg) error {
+	var err error
+	if msg.Type == Recall {
+		err = m.hub.service.Message().Recall(msg.ID)
+	} else {
+		err = m.hub.service.Message().Edit(msg.ID, msg.Body, time.Now().UnixMilli())
+	}
+	if err != nil {
+		if errors.Is(err, errorsx.ErrNoAffectedRows) {
+			return errorsx.ErrMessageRecalled
+		}
+		m.hub.service.Logger().Error("Failed to modify message",
+			zap.String("id", msg.ID), zap.Int("type", msg.Type), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	return nil
+}
+
+// 未确认的原消息不再重发,离线的原消息和提及通知撤回时删除,编辑时替换内容
+func (m *modifyMiddleware) updateCopies(msg *ChatMsg, id uint) {
+	cache := m.hub.service.Cache()
+	cache.RemovePendingMessage(msg.ID, id, msg.Time)
+	err := cache.UpdateOfflineMessage(id, msg.ID, func(message string) string {
+		var origin *ChatMsg
+		if err := json.Unmarshal([]byte(message), &origin); err != nil ||
+			(origin.Type != Chat && origin.Type != Broadcast && origin.Type != Mention) {
+			return message
+		}
+		if msg.Type == Recall {
+			return ""
+		}
+		origin.Body = msg.Body
+		data, _ := json.Marshal(origin)
+		return string(data)
+	})
+	if err != nil {
+		m.hub.service.Logger().Error("Failed to update offline message",
+			zap.String("id", msg.ID), zap.Uint("receiver", id), zap.Error(err))
+	}
+}
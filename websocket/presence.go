@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"slices"
+	"time"
+
+	"github.com/farnese17/chat/service/model"
+	"go.uber.org/zap"
+)
+
+// 上下线通知,只推送给在线的好友
+type PresenceMsg struct {
+	Type     int   `json:"type"`
+	From     uint  `json:"from"`
+	Online   bool  `json:"online"`
+	LastSeen int64 `json:"last_seen"`
+}
+
+// 正在输入,单聊时To为对方,群聊时GroupID为群组
+// 只转发给在线用户,不持久化、不缓存也不需要确认
+type TypingMsg struct {
+	Type    int   `json:"type"`
+	From    uint  `json:"from"`
+	To      uint  `json:"to,omitempty"`
+	GroupID uint  `json:"group_id,omitempty"`
+	Time    int64 `json:"time"`
+}
+
+func (h *Hub) Online(id uint) bool {
+	h.mu.RLock()
+	_, ok := h.clients[id]
+	h.mu.RUnlock()
+	return ok || h.onlineRemote(id)
+}
+
+// 用户在线的设备,集群模式下包括其他节点上的设备
+func (h *Hub) Devices(id uint) []string {
+	h.mu.RLock()
+	devices := make([]string, 0, len(h.clients[id]))
+	for device := range h.clients[id] {
+		devices = append(devices, device)
+	}
+	h.mu.RUnlock()
+	for _, route := range h.remoteRoutes([]uint{id})[id] {
+		if !slices.Contains(devices, route.Device) {
+			devices = append(devices, route.Device)
+		}
+	}
+	return devices
+}
+
+// 记录最后在线时间,并把上下线状态推送给好友
+func (h *Hub) publishPresence(id uint, online bool) {
+	now := time.Now().UnixMilli()
+	h.service.Cache().SetLastSeen(id, now)
+
+	friends, err := h.service.Friend().List(id)
+	if err != nil {
+		h.service.Logger().Error("Failed to get friend list", zap.Uint("id", id), zap.Error(err))
+		return
+	}
+	to := make([]uint, 0, len(friends))
+	for _, friend := range friends {
+		if friend.Status == model.FSAdded {
+			to = append(to, friend.UID)
+		}
+	}
+	if len(to) == 0 {
+		return
+	}
+
+	msg := &PresenceMsg{Type: Presence, From: id, Online: online, LastSeen: now}
+	h.sendDirect(&MessageContext{Message: msg, To: to})
+}
+
+// 正在输入不经过中间件,没有权限时直接丢弃
+func (h *Hub) SendToTyping(message *TypingMsg) {
+	message.Time = time.Now().UnixMilli()
+	var to []uint
+	if message.GroupID != 0 {
+		members, err := h.service.Cache().GetMembersAndCache(message.GroupID)
+		if err != nil || !slices.Contains(members, message.From) {
+			return
+		}
+		message.To = 0
+		to = slices.DeleteFunc(slices.Clone(members), func(id uint) bool {
+			return id == message.From
+		})
+	} else {
+		if message.To == 0 || message.To == message.From ||
+			h.friendshipPermitted(message.From, message.To) != nil {
+			return
+		}
+		to = []uint{message.To}
+	}
+	h.sendDirect(&MessageContext{Message: message, To: to})
+}
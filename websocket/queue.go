@@ -0,0 +1,147 @@
+package websocket
+
+import (
+	"github.com/farnese17/chat/config"
+	"go.uber.org/zap"
+)
+
+type queueResult int
+
+const (
+	queued queueResult = iota
+	// 队列已满,丢弃了最早的消息
+	queueDropped
+	// 队列已满,断开了连接
+	queueDisconnected
+	// 连接已关闭
+	queueClosed
+)
+
+// 已保存挂起记录的消息,由挂起记录负责重发,丢弃时不再转为离线消息
+type pendingMsg struct {
+	msg any
+}
+
+// 消息入队,不会阻塞,队列已满时按send_queue_policy处理
+// 返回被丢弃的消息和关闭后入队的消息,由调用者释放锁后转为离线消息,入队时不访问redis
+func (c *Client) enqueue(msg any) (queueResult, []any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return queueClosed, []any{msg}
+	}
+
+	result := queued
+	var dropped []any
+	for {
+		select {
+		case c.send <- msg:
+			return result, dropped
+		default:
+		}
+
+		if c.service.Config().Common().SendQueuePolicy() == config.SendQueueDisconnect {
+			c.service.Logger().Warn("Send queue is full, disconnect slow client",
+				zap.Uint("client_id", c.id), zap.String("device", c.device))
+			c.closed = true
+			close(c.quit)
+			c.conn.Close()
+			return queueDisconnected, append(dropped, msg)
+		}
+		select {
+		case old := <-c.send:
+			dropped = append(dropped, old)
+			result = queueDropped
+		default:
+		}
+	}
+}
+
+// 标记连接已关闭并通知写协程退出
+func (c *Client) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		close(c.quit)
+	}
+}
+
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
+
+// 关闭后不会再有消息入队,把队列中剩余的消息转为离线消息
+func (c *Client) drain() {
+	for {
+		select {
+		case msg := <-c.send:
+			c.storeOffline(msg)
+		default:
+			return
+		}
+	}
+}
+
+func (c *Client) storeOffline(msg any) {
+	if storable(msg) {
+		c.service.Hub().StoreOfflineMessage(msg, c.id)
+	}
+}
+
+// 投递到客户端的发送队列并记录丢弃和断开的次数,返回需要转为离线消息的消息
+func (h *Hub) push(c *Client, msg any) []any {
+	result, dropped := c.enqueue(msg)
+	switch result {
+	case queueDropped:
+		h.droppedMessages.Add(int64(len(dropped)))
+	case queueDisconnected:
+		h.slowDisconnects.Add(1)
+	}
+	return dropped
+}
+
+// 调用者没有持有hub锁时使用,丢弃的消息直接转为离线消息
+func (c *Client) push(msg any) {
+	_, dropped := c.enqueue(msg)
+	for _, msg := range dropped {
+		c.storeOffline(msg)
+	}
+}
+
+// 释放锁后把丢弃的消息转为离线消息
+func (h *Hub) storeDropped(id uint, dropped []any) {
+	for _, msg := range dropped {
+		if storable(msg) {
+			h.StoreOfflineMessage(msg, id)
+		}
+	}
+}
+
+// 发送队列的状态
+func (h *Hub) Stats() map[string]any {
+	h.mu.RLock()
+	clients, depth, maxDepth := 0, 0, 0
+	for _, devices := range h.clients {
+		for _, c := range devices {
+			n := len(c.send)
+			clients++
+			depth += n
+			maxDepth = max(maxDepth, n)
+		}
+	}
+	h.mu.RUnlock()
+
+	common := h.service.Config().Common()
+	return map[string]any{
+		"clients":          clients,
+		"queue_size":       common.SendQueueSize(),
+		"queue_policy":     common.SendQueuePolicy(),
+		"queue_depth":      depth,
+		"max_queue_depth":  maxDepth,
+		"dropped_messages": h.droppedMessages.Load(),
+		"slow_disconnects": h.slowDisconnects.Load(),
+	}
+}
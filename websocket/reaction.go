@@ -0,0 +1,97 @@
+package websocket
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/farnese17/chat/utils/validator"
+	"go.uber.org/zap"
+)
+
+// 客户端发送的表情回应,id为被回应的消息ID
+type ReactionMsg struct {
+	ID    string `json:"id"`
+	Emoji string `json:"emoji"`
+}
+
+// 表情回应的变化,count为变化后该表情的回应数量
+type ReactionDelta struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	Count     int64  `json:"count"`
+}
+
+func isReaction(msgType int) bool {
+	return msgType == ReactionAdd || msgType == ReactionRemove
+}
+
+// 添加或取消表情回应,返回变化后的数量
+// 只能回应自己参与的会话中未撤回的消息,变化通过SendToBroadcast推送给会话中的所有用户
+func (h *Hub) React(uid uint, msgID, emoji string, add bool) (int64, error) {
+	if err := validator.ValidateEmoji(emoji); err != nil {
+		return 0, errorsx.ErrInvalidParams
+	}
+	origin, err := h.service.Message().Get(msgID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return 0, errorsx.ErrMessageNotFound
+		}
+		h.service.Logger().Error("Failed to get message", zap.String("id", msgID), zap.Error(err))
+		return 0, errorsx.ErrFailed
+	}
+	if origin.Recalled {
+		return 0, errorsx.ErrMessageRecalled
+	}
+
+	var participants []uint
+	if origin.GroupID != 0 {
+		members, err := h.service.Cache().GetMembersAndCache(origin.GroupID)
+		if err != nil {
+			return 0, errorsx.ErrFailed
+		}
+		if !slices.Contains(members, uid) {
+			return 0, errorsx.ErrNotInGroup
+		}
+		participants = members
+	} else {
+		if uid != origin.Sender && uid != origin.Receiver {
+			return 0, errorsx.ErrMessageNotFound
+		}
+		participants = []uint{origin.Sender}
+		if origin.Receiver != origin.Sender {
+			participants = append(participants, origin.Receiver)
+		}
+	}
+
+	var count int64
+	msgType := ReactionAdd
+	if add {
+		count, err = h.service.Message().AddReaction(&model.Reaction{MsgID: msgID, UserID: uid, Emoji: emoji})
+		if errors.Is(err, errorsx.ErrDuplicateEntry) {
+			return 0, errorsx.ErrAlreadyReacted
+		}
+	} else {
+		msgType = ReactionRemove
+		count, err = h.service.Message().RemoveReaction(msgID, uid, emoji)
+		if errors.Is(err, errorsx.ErrNoAffectedRows) {
+			return 0, errorsx.ErrReactionNotFound
+		}
+	}
+	if err != nil {
+		h.service.Logger().Error("Failed to update reaction",
+			zap.String("id", msgID), zap.Uint("uid", uid), zap.Bool("add", add), zap.Error(err))
+		return 0, errorsx.ErrFailed
+	}
+
+	h.SendToBroadcast(&ChatMsg{
+		Type:     msgType,
+		From:     uid,
+		To:       origin.GroupID,
+		Body:     emoji,
+		Extra:    participants,
+		Reaction: &ReactionDelta{MessageID: msgID, Emoji: emoji, Count: count},
+	})
+	return count, nil
+}
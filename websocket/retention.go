@@ -0,0 +1,88 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/farnese17/chat/service/model"
+	"go.uber.org/zap"
+)
+
+// 每次从数据库取出的过期消息数量
+const purgeBatchSize = 500
+
+// 定时删除超过会话保留时间的消息,包括数据库、离线消息和待确认消息
+func (h *Hub) purgeExpiredMessages() {
+	ticker := time.NewTicker(h.service.Config().Common().PurgeInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// 重置计时器,应用热更新
+			ticker.Reset(h.service.Config().Common().PurgeInterval())
+
+			retentions, err := h.service.Message().Retentions()
+			if err != nil {
+				h.service.Logger().Error("Failed to get retentions", zap.Error(err))
+				continue
+			}
+			now := time.Now().UnixMilli()
+			for _, retention := range retentions {
+				h.purgeConversation(retention, now-retention.TTL*1000)
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// 先删除缓存再删除数据库,缓存删除失败时保留数据库中的消息,下次重试
+func (h *Hub) purgeConversation(retention *model.Retention, before int64) {
+	logger := h.service.Logger().With(zap.Uint("gid", retention.GroupID),
+		zap.Uint("user_a", retention.UserA), zap.Uint("user_b", retention.UserB))
+
+	receivers := []uint{retention.UserA, retention.UserB}
+	if retention.GroupID != 0 {
+		members, err := h.service.Cache().GetMembersAndCache(retention.GroupID)
+		if err != nil {
+			logger.Error("Failed to get members", zap.Error(err))
+			return
+		}
+		receivers = members
+	}
+
+	for {
+		messages, err := h.service.Message().ExpiredMessages(retention, before, purgeBatchSize)
+		if err != nil {
+			logger.Error("Failed to get expired messages", zap.Error(err))
+			return
+		}
+		if len(messages) == 0 {
+			return
+		}
+		ids := make([]string, len(messages))
+		from, to := messages[0].Time, messages[0].Time
+		for i, msg := range messages {
+			ids[i] = msg.MsgID
+			from, to = min(from, msg.Time), max(to, msg.Time)
+		}
+
+		for _, id := range receivers {
+			if err := h.service.Cache().RemoveOfflineMessages(id, ids); err != nil {
+				logger.Error("Failed to purge offline messages", zap.Uint("id", id), zap.Error(err))
+				return
+			}
+		}
+		if err := h.service.Cache().RemovePendingMessages(from, to, ids); err != nil {
+			logger.Error("Failed to purge pending messages", zap.Error(err))
+			return
+		}
+		if err := h.service.Message().DeleteMessages(ids); err != nil {
+			logger.Error("Failed to purge messages", zap.Error(err))
+			return
+		}
+		logger.Info("Purged expired messages", zap.Int("count", len(ids)))
+		if len(messages) < purgeBatchSize {
+			return
+		}
+	}
+}
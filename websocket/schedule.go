@@ -0,0 +1,168 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/farnese17/chat/service/model"
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// 每次检查最多发送的定时消息数量
+const scheduleBatchSize = 100
+
+// 发送定时消息的租约时长,节点在发送过程中崩溃时租约到期后由其他节点重试
+const scheduleLease = time.Minute
+
+// 发送时间在未来的消息先保存,返回Scheduled确认,到期后由调度器发送
+func (c *Client) schedule(msg *ChatMsg) error {
+	now := time.Now()
+	if msg.SendAt > now.Add(c.service.Config().Common().MaxScheduleDelay()).UnixMilli() {
+		return errorsx.ErrInvalidSendAt
+	}
+	if msg.ID == "" {
+		msg.ID = uuid.NewString()
+	}
+	// 接收者在发送时重新计算
+	msg.Extra = nil
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return errorsx.ErrFailed
+	}
+	scheduled := &model.ScheduledMessage{
+		MsgID:    msg.ID,
+		Type:     msg.Type,
+		Sender:   msg.From,
+		Receiver: msg.To,
+		Body:     msg.Body,
+		SendAt:   msg.SendAt,
+		Payload:  string(payload),
+		Device:   c.device,
+	}
+	if err := c.service.Message().CreateScheduled(scheduled); err != nil {
+		c.service.Logger().Error("Failed to create scheduled message",
+			zap.String("id", msg.ID), zap.Uint("from", msg.From), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+
+	c.push(&ChatMsg{
+		ID:     msg.ID,
+		Type:   Scheduled,
+		From:   msg.From,
+		To:     msg.To,
+		Body:   msg.Body,
+		Time:   now.UnixMilli(),
+		SendAt: msg.SendAt,
+	})
+	return nil
+}
+
+// 定时发送到期的消息,取得租约后发送,集群中每条消息只会被一个节点发送
+func (h *Hub) releaseScheduledMessages() {
+	ticker := time.NewTicker(h.service.Config().Common().ScheduleInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			// 重置计时器,应用热更新
+			ticker.Reset(h.service.Config().Common().ScheduleInterval())
+
+			now := time.Now().UnixMilli()
+			messages, err := h.service.Message().DueScheduled(now, scheduleBatchSize)
+			if err != nil {
+				h.service.Logger().Error("Failed to get due scheduled messages", zap.Error(err))
+				continue
+			}
+			released := 0
+			for _, scheduled := range messages {
+				if err := h.service.Message().ClaimScheduled(scheduled.ID, now, scheduleLease); err != nil {
+					if !errors.Is(err, errorsx.ErrNoAffectedRows) {
+						h.service.Logger().Error("Failed to claim scheduled message",
+							zap.String("id", scheduled.MsgID), zap.Error(err))
+					}
+					continue
+				}
+				if h.releaseScheduled(scheduled) {
+					released++
+				}
+			}
+			// 还有到期的消息,立即执行,失败的消息等到下次检查
+			if len(messages) == scheduleBatchSize && released > 0 {
+				ticker.Reset(time.Millisecond)
+			}
+		case <-h.done:
+			return
+		}
+	}
+}
+
+// 发送前按发送者当前的权限重新验证,发送成功或发送者已无权发送时删除定时消息
+// 临时错误时释放租约,下次检查时重试,返回值表示定时消息是否已经处理完
+func (h *Hub) releaseScheduled(scheduled *model.ScheduledMessage) bool {
+	var msg *ChatMsg
+	if err := json.Unmarshal([]byte(scheduled.Payload), &msg); err != nil {
+		h.service.Logger().Error("Failed to parse scheduled message",
+			zap.String("id", scheduled.MsgID), zap.Error(err))
+		return h.deleteScheduled(scheduled)
+	}
+	msg.SendAt = 0
+	msg.Time = time.Now().UnixMilli()
+	msg.Extra = nil
+
+	err := h.verifyScheduled(msg, scheduled.Device)
+	if errors.Is(err, errorsx.ErrFailed) {
+		return h.retryScheduled(scheduled)
+	}
+	if err != nil {
+		// 发送者可能已经离线,错误消息缓存为离线消息
+		h.sendOfflineError(msg.From, msg.ID, err)
+		return h.deleteScheduled(scheduled)
+	}
+
+	ctx := &MessageContext{Message: msg, Cache: true, Pending: true, To: []uint{msg.To}}
+	if msg.Type == Broadcast {
+		ctx.To, _ = msg.Extra.([]uint)
+		msg.Extra = nil
+	}
+	// 验证后到发送前出现临时错误时重试
+	if !h.Send(ctx) && errors.Is(ctx.Err, errorsx.ErrFailed) {
+		return h.retryScheduled(scheduled)
+	}
+	return h.deleteScheduled(scheduled)
+}
+
+// 和实时消息经过相同的检查,设备用于同步到发送者的其他设备
+func (h *Hub) verifyScheduled(msg *ChatMsg, device string) error {
+	sender := &Client{id: msg.From, device: device, service: h.service}
+	if err := sender.verifySender(msg); err != nil {
+		return err
+	}
+	switch {
+	case msg.Type == Chat && msg.From != msg.To:
+		return h.friendshipPermitted(msg.From, msg.To)
+	case msg.Type == Broadcast:
+		return h.mutePermitted(msg.To, msg.From)
+	}
+	return nil
+}
+
+func (h *Hub) retryScheduled(scheduled *model.ScheduledMessage) bool {
+	// 释放失败时等待租约到期
+	if err := h.service.Message().ReleaseScheduled(scheduled.ID); err != nil {
+		h.service.Logger().Error("Failed to release scheduled message",
+			zap.String("id", scheduled.MsgID), zap.Error(err))
+	}
+	return false
+}
+
+func (h *Hub) deleteScheduled(scheduled *model.ScheduledMessage) bool {
+	// 删除失败时租约到期后会再次发送,消息ID不变
+	if err := h.service.Message().DeleteScheduled(scheduled.ID); err != nil {
+		h.service.Logger().Error("Failed to delete scheduled message",
+			zap.String("id", scheduled.MsgID), zap.Error(err))
+	}
+	return true
+}
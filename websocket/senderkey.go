@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"slices"
+	"time"
+
+	"github.com/farnese17/chat/utils/errorsx"
+	"github.com/google/uuid"
+)
+
+// 群聊加密会话的发送者密钥分发,to为群组,keys为每个成员用单聊会话加密后的发送者密钥
+// 服务端只转发密文,每个成员只收到自己的部分
+type SenderKeyMsg struct {
+	ID   string          `json:"id"`
+	To   uint            `json:"to"`
+	Keys map[uint]string `json:"keys"`
+}
+
+// 分发发送者密钥,接收者必须是群组成员
+// 每个接收者收到一条SenderKey消息,to为接收者,extra为群组,需要确认,离线时缓存
+func (h *Hub) SendToSenderKey(from uint, message *SenderKeyMsg) error {
+	if message.To == 0 || len(message.Keys) == 0 {
+		return errorsx.ErrInvalidParams
+	}
+	members, err := h.service.Cache().GetMembersAndCache(message.To)
+	if err != nil {
+		return errorsx.ErrFailed
+	}
+	if !slices.Contains(members, from) {
+		return errorsx.ErrNotInGroup
+	}
+	for id, key := range message.Keys {
+		if id == from || !slices.Contains(members, id) {
+			return errorsx.ErrInvalidParams
+		}
+		if key == "" || len(key) > maxCiphertextLength {
+			return errorsx.ErrInvalidContent
+		}
+	}
+
+	if message.ID == "" {
+		message.ID = uuid.NewString()
+	}
+	now := time.Now().UnixMilli()
+	for id, key := range message.Keys {
+		msg := &ChatMsg{
+			ID:    message.ID,
+			Type:  SenderKey,
+			From:  from,
+			To:    id,
+			Body:  key,
+			Time:  now,
+			Extra: message.To,
+		}
+		h.Send(&MessageContext{Message: msg, Cache: true, Pending: true, To: []uint{id}})
+	}
+	return nil
+}
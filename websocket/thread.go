@@ -0,0 +1,67 @@
+package websocket
+
+import (
+	"errors"
+	"slices"
+
+	"github.com/farnese17/chat/utils/errorsx"
+	"go.uber.org/zap"
+)
+
+// 话题回复只能回复群聊中的原消息,只发给仍在群组内的订阅者
+// 发送者和第一次被回复的原消息作者会在回复保存后自动订阅
+func (c *Client) verifyThread(msg *ChatMsg, members []uint) error {
+	if msg.Type != Broadcast {
+		return errorsx.ErrInvalidThread
+	}
+	parent, err := c.service.Message().Get(msg.ThreadID)
+	if err != nil {
+		if errors.Is(err, errorsx.ErrRecordNotFound) {
+			return errorsx.ErrMessageNotFound
+		}
+		c.service.Logger().Error("Failed to get message", zap.String("id", msg.ThreadID), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	if parent.GroupID != msg.To || parent.ThreadID != "" {
+		return errorsx.ErrInvalidThread
+	}
+	if parent.Recalled {
+		return errorsx.ErrMessageRecalled
+	}
+
+	subscribers, err := c.service.Message().ThreadSubscribers(msg.ThreadID)
+	if err != nil {
+		c.service.Logger().Error("Failed to get thread subscribers", zap.String("id", msg.ThreadID), zap.Error(err))
+		return errorsx.ErrFailed
+	}
+	subscribers = append(subscribers, c.id)
+	if parent.ReplyCount == 0 {
+		msg.threadAuthor = parent.Sender
+		subscribers = append(subscribers, parent.Sender)
+	}
+	to := make([]uint, 0, len(subscribers))
+	for _, id := range subscribers {
+		if slices.Contains(members, id) && !slices.Contains(to, id) {
+			to = append(to, id)
+		}
+	}
+	msg.Extra = to
+	return nil
+}
+
+// 回复保存后更新原消息的回复数量和最后回复时间,并订阅话题
+func (h *Hub) storeThreadReply(msg *ChatMsg) {
+	if err := h.service.Message().AddThreadReply(msg.ThreadID, msg.Time); err != nil {
+		h.service.Logger().Error("Failed to update thread", zap.String("thread", msg.ThreadID), zap.Error(err))
+	}
+	subscribers := []uint{msg.From}
+	if msg.threadAuthor != 0 && msg.threadAuthor != msg.From {
+		subscribers = append(subscribers, msg.threadAuthor)
+	}
+	for _, id := range subscribers {
+		if err := h.service.Message().SubscribeThread(msg.ThreadID, id); err != nil {
+			h.service.Logger().Error("Failed to subscribe thread",
+				zap.String("thread", msg.ThreadID), zap.Uint("uid", id), zap.Error(err))
+		}
+	}
+}
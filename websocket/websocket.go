@@ -9,12 +9,15 @@ import (
 	"go.uber.org/zap"
 )
 
+// 客户端支持时使用permessage-deflate压缩,子协议决定消息编码
 var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
+	ReadBufferSize:    1024,
+	WriteBufferSize:   1024,
+	EnableCompression: true,
+	Subprotocols:      []string{ProtocolJSON, ProtocolMsgpack},
 }
 
-func UpgradeToWS(s Service, id uint, w http.ResponseWriter, r *http.Request) {
+func UpgradeToWS(s Service, id uint, device string, w http.ResponseWriter, r *http.Request) {
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		http.Error(w, "Failed to upgrade http to websocket", http.StatusInternalServerError)
@@ -23,7 +26,7 @@ func UpgradeToWS(s Service, id uint, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := NewWsClient(s, id, conn)
+	client := NewWsClient(s, id, device, conn)
 	if wsIsClosed(s) {
 		client.sendCloseMessage()
 		conn.Close()